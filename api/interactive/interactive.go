@@ -10,26 +10,179 @@ import (
 	//"time"
 )
 
-type Interative bufio.Reader
+type Interative struct {
+	reader  *bufio.Reader
+	session string // token of the current session, if any
+	op      string // operation ID of the next command, if any
+	lastOp  string // operation ID of the last command
+	// commands of the current transaction, and whether one has begun
+	txn   []string
+	inTxn bool
+	// commands of the last command, if it was a transaction
+	lastTxn []string
+	// server to connect to, from :connect, and that of the last command
+	connect     string
+	lastConnect string
+	// control query, from e.g. :members, and that of the last command
+	control     string
+	lastControl string
+}
 
 func Create() *Interative {
-	return (*Interative)(bufio.NewReader(os.Stdin))
+	return &Interative{reader: bufio.NewReader(os.Stdin)}
 
 }
 
+// meta handles meta-commands, which start with ':' and control the client
+// rather than being sent to the cluster. It returns true if a transaction
+// was committed, so is ready to be sent
+func (i *Interative) meta(text string) bool {
+	args := strings.Fields(text)
+	switch args[0] {
+	case ":begin":
+		// group the following commands into a transaction, until :commit
+		if i.inTxn {
+			fmt.Println("Already in a transaction of", len(i.txn), "commands")
+			break
+		}
+		i.txn, i.inTxn = nil, true
+		fmt.Println("Started transaction")
+	case ":commit":
+		if !i.inTxn {
+			fmt.Println("Not in a transaction")
+			break
+		}
+		if len(i.txn) == 0 {
+			fmt.Println("Ended empty transaction")
+			i.inTxn = false
+			break
+		}
+		return true
+	case ":abort":
+		// the transaction has not been sent, so it is just discarded
+		if !i.inTxn {
+			fmt.Println("Not in a transaction")
+			break
+		}
+		fmt.Println("Aborted transaction of", len(i.txn), "commands")
+		i.txn, i.inTxn = nil, false
+	case ":session":
+		// group the following commands into a session, pinned to one server
+		if len(args) > 1 {
+			i.session = args[1]
+			fmt.Println("Started session", i.session)
+		} else {
+			fmt.Println("Ended session", i.session)
+			i.session = ""
+		}
+	case ":connect":
+		// move the client to a server, by index or address, until it fails over
+		if len(args) != 2 {
+			fmt.Println("Usage: :connect <index or address>")
+			break
+		}
+		i.connect = args[1]
+	case ":members":
+		// query the master for the membership of the cluster
+		i.control = "members"
+	case ":drain", ":undrain":
+		// stop, or resume, using a server, e.g. for maintenance
+		if len(args) != 2 {
+			fmt.Println("Usage:", args[0], "<index or address>")
+			break
+		}
+		i.control = args[0][1:] + " " + args[1]
+	case ":op":
+		// give the next command an operation ID, so resubmitting it is deduplicated
+		if len(args) > 1 {
+			i.op = args[1]
+		}
+	default:
+		fmt.Println("Unknown command:", args[0])
+	}
+	return false
+}
+
 func (i *Interative) Next() (string, bool, bool) {
-	b := (*bufio.Reader)(i)
-	fmt.Print("Enter command: ")
-	text, err := b.ReadString('\n')
-	if err != nil {
-		glog.Fatal(err)
+	for {
+		if i.inTxn {
+			fmt.Print("Enter command (in transaction): ")
+		} else {
+			fmt.Print("Enter command: ")
+		}
+		text, err := i.reader.ReadString('\n')
+		if err != nil {
+			glog.Fatal(err)
+		}
+		text = strings.Trim(text, "\n")
+		glog.Info("User entered", text)
+		if strings.HasPrefix(text, ":") {
+			if i.meta(text) {
+				i.lastOp, i.op = i.op, ""
+				i.lastTxn, i.txn, i.inTxn = i.txn, nil, false
+				i.lastConnect, i.lastControl = "", ""
+				return strings.Join(i.lastTxn, "; "), true, true
+			}
+			if i.connect != "" {
+				// the client connects instead of sending a command
+				i.lastConnect, i.connect = i.connect, ""
+				i.lastTxn, i.lastControl = nil, ""
+				return text, false, true
+			}
+			if i.control != "" {
+				// the client queries the cluster instead of sending a command
+				i.lastControl, i.control = i.control, ""
+				i.lastTxn, i.lastConnect = nil, ""
+				return text, false, true
+			}
+			continue
+		}
+		if i.inTxn {
+			i.txn = append(i.txn, text)
+			continue
+		}
+		i.lastOp, i.op = i.op, ""
+		i.lastTxn, i.lastConnect, i.lastControl = nil, "", ""
+		return text, true, true
 	}
-	text = strings.Trim(text, "\n")
-	glog.Info("User entered", text)
-	return text, true, true
+}
+
+// OperationID returns the operation ID of the last command, or "" if there is none
+func (i *Interative) OperationID() string {
+	return i.lastOp
+}
+
+// Transaction returns the commands of the last command, if it was a
+// transaction, or nil otherwise
+func (i *Interative) Transaction() []string {
+	return i.lastTxn
+}
+
+// Connect returns the server to connect to, by index or address, if the
+// last command was :connect, or "" otherwise
+func (i *Interative) Connect() string {
+	return i.lastConnect
+}
+
+// Control returns the control query of the last command, if it was one
+// such as :members, or "" otherwise
+func (i *Interative) Control() string {
+	return i.lastControl
+}
+
+// Session returns the token of the current session, or "" if there is none
+func (i *Interative) Session() string {
+	return i.session
 }
 
 func (_ *Interative) Return(str string) {
 	// , time time.Duration  "request took ", time
 	fmt.Print(str)
 }
+
+// ReturnStream prints each chunk of a streamed response as it arrives
+func (_ *Interative) ReturnStream(chunks chan string) {
+	for str := range chunks {
+		fmt.Print(str)
+	}
+}
@@ -0,0 +1,88 @@
+package interactive
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// check that commands between :begin and :commit are issued as one
+// transaction, and that :abort discards them
+func TestTransaction(t *testing.T) {
+	input := []string{
+		"get A",
+		":begin", "update A 1", "get A", ":commit",
+		":begin", "update B 2", ":abort",
+		":commit",
+		":begin", ":commit",
+		"get B",
+	}
+	expected := []struct {
+		text string
+		txn  []string
+	}{
+		{"get A", nil},
+		{"update A 1; get A", []string{"update A 1", "get A"}},
+		{"get B", nil},
+	}
+	i := &Interative{reader: bufio.NewReader(strings.NewReader(strings.Join(input, "\n") + "\n"))}
+	for j, e := range expected {
+		text, replicate, ok := i.Next()
+		if !ok || !replicate || text != e.text {
+			t.Errorf("Command %d was %q, expected %q", j, text, e.text)
+		}
+		if txn := i.Transaction(); !reflect.DeepEqual(txn, e.txn) {
+			t.Errorf("Command %d had transaction %q, expected %q", j, txn, e.txn)
+		}
+	}
+}
+
+// check that :connect is issued as a command to connect, and not sent
+func TestConnect(t *testing.T) {
+	input := []string{":connect 1", "get A", ":connect", ":connect 127.0.0.1:8081", "get B"}
+	expected := []struct {
+		text    string
+		connect string
+	}{
+		{":connect 1", "1"},
+		{"get A", ""},
+		{":connect 127.0.0.1:8081", "127.0.0.1:8081"},
+		{"get B", ""},
+	}
+	i := &Interative{reader: bufio.NewReader(strings.NewReader(strings.Join(input, "\n") + "\n"))}
+	for j, e := range expected {
+		text, _, ok := i.Next()
+		if !ok || text != e.text {
+			t.Errorf("Command %d was %q, expected %q", j, text, e.text)
+		}
+		if connect := i.Connect(); connect != e.connect {
+			t.Errorf("Command %d connects to %q, expected %q", j, connect, e.connect)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	input := []string{":members", "get A", ":connect 1", ":members", ":drain 127.0.0.1:8081", ":drain", ":undrain 1"}
+	expected := []struct {
+		text    string
+		control string
+	}{
+		{":members", "members"},
+		{"get A", ""},
+		{":connect 1", ""},
+		{":members", "members"},
+		{":drain 127.0.0.1:8081", "drain 127.0.0.1:8081"},
+		{":undrain 1", "undrain 1"},
+	}
+	i := &Interative{reader: bufio.NewReader(strings.NewReader(strings.Join(input, "\n") + "\n"))}
+	for j, e := range expected {
+		text, replicate, ok := i.Next()
+		if !ok || text != e.text || (e.control != "" && replicate) {
+			t.Errorf("Command %d was %q, expected %q", j, text, e.text)
+		}
+		if control := i.Control(); control != e.control {
+			t.Errorf("Command %d has control query %q, expected %q", j, control, e.control)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package multi
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Blend draws each command from one of several APIs at random, in proportion
+// to their weights, routing each response back to the API which issued the
+// command. APIs which have no more commands are dropped from the blend.
+type Blend struct {
+	apis    []API
+	weights []int // zero once an API has no more commands
+	rand    *rand.Rand
+	last    int // source of the outstanding command
+}
+
+func CreateBlend(weights []int, apis ...API) *Blend {
+	return &Blend{
+		apis:    apis,
+		weights: append([]int{}, weights...),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// APIs returns the blended APIs
+func (b *Blend) APIs() []API {
+	return b.apis
+}
+
+func (b *Blend) Next() (string, bool, bool) {
+	for {
+		total := 0
+		for _, w := range b.weights {
+			total += w
+		}
+		if total == 0 {
+			return "", false, false
+		}
+		// pick an API in proportion to its weight
+		n := b.rand.Intn(total)
+		i := 0
+		for n >= b.weights[i] {
+			n -= b.weights[i]
+			i++
+		}
+		text, replicate, ok := b.apis[i].Next()
+		if ok {
+			b.last = i
+			return text, replicate, true
+		}
+		b.weights[i] = 0
+	}
+}
+
+func (b *Blend) Return(str string) {
+	b.apis[b.last].Return(str)
+}
+
+func (b *Blend) ReturnStream(chunks chan string) {
+	b.apis[b.last].ReturnStream(chunks)
+}
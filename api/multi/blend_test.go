@@ -0,0 +1,48 @@
+package multi
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// check that the blend matches the weights, and responses reach the right API
+func TestBlend(t *testing.T) {
+	a := &fake{name: "a", remaining: -1}
+	b := &fake{name: "b", remaining: -1}
+	blend := CreateBlend([]int{70, 30}, a, b)
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		cmd, _, ok := blend.Next()
+		if !ok {
+			t.Fatal("Blend terminated early")
+		}
+		name := strings.Fields(cmd)[0]
+		counts[name]++
+		blend.Return(cmd)
+	}
+	if ratio := float64(counts["a"]) / 10000; math.Abs(ratio-0.7) > 0.03 {
+		t.Errorf("%.1f%% of commands were from a, expected 70%%", ratio*100)
+	}
+	for _, f := range []*fake{a, b} {
+		for i := range f.issued {
+			if f.returned[i] != f.issued[i] {
+				t.Errorf("API %s was returned %q for %q", f.name, f.returned[i], f.issued[i])
+			}
+		}
+	}
+}
+
+// check that the blend continues with the remaining APIs once one ends
+func TestBlendTermination(t *testing.T) {
+	a := &fake{name: "a", remaining: 5}
+	b := &fake{name: "b", remaining: 20}
+	blend := CreateBlend([]int{90, 10}, a, b)
+	n := 0
+	for _, _, ok := blend.Next(); ok; _, _, ok = blend.Next() {
+		n++
+	}
+	if n != 25 {
+		t.Errorf("Blend issued %d commands, expected 25", n)
+	}
+}
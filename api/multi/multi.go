@@ -0,0 +1,110 @@
+// Multi composes several APIs into one, so a client can be driven by them simultaneously
+package multi
+
+import (
+	"github.com/golang/glog"
+)
+
+// API is implemented by each of the composed APIs
+type API interface {
+	Next() (string, bool, bool)
+	Return(string)
+	ReturnStream(chan string)
+}
+
+type command struct {
+	source    int
+	text      string
+	replicate bool
+	ok        bool
+}
+
+// reply is a response, or a stream of chunks of one if stream is not nil
+type reply struct {
+	str    string
+	stream chan string
+}
+
+// Multi merges the commands from each API, routing each response back to
+// the API which issued the command. Each API has at most one pending
+// command and APIs with pending commands are served in turn.
+type Multi struct {
+	apis    []API
+	pending []chan command
+	replies []chan reply
+	ready   chan bool // notified when a command becomes pending
+	live    int       // number of APIs which may still issue commands
+	last    int       // source of the outstanding command
+}
+
+func Create(apis ...API) *Multi {
+	m := &Multi{
+		apis:    apis,
+		pending: make([]chan command, len(apis)),
+		replies: make([]chan reply, len(apis)),
+		ready:   make(chan bool, 1),
+		live:    len(apis),
+		last:    len(apis) - 1}
+
+	for i := range apis {
+		m.pending[i] = make(chan command, 1)
+		m.replies[i] = make(chan reply)
+		go m.forward(i)
+	}
+	return m
+}
+
+// pass commands from API i to the client, one at a time
+func (m *Multi) forward(i int) {
+	for {
+		text, replicate, ok := m.apis[i].Next()
+		m.pending[i] <- command{i, text, replicate, ok}
+		select {
+		case m.ready <- true:
+		default: // Next has already been notified
+		}
+		if !ok {
+			glog.Info("API ", i, " has no more commands")
+			return
+		}
+		r := <-m.replies[i]
+		if r.stream != nil {
+			m.apis[i].ReturnStream(r.stream)
+		} else {
+			m.apis[i].Return(r.str)
+		}
+	}
+}
+
+func (m *Multi) Next() (string, bool, bool) {
+	for m.live > 0 {
+		// take the first pending command, starting after the last source
+		for j := 1; j <= len(m.apis); j++ {
+			i := (m.last + j) % len(m.apis)
+			select {
+			case cmd := <-m.pending[i]:
+				if !cmd.ok {
+					m.live--
+					continue
+				}
+				m.last = i
+				return cmd.text, cmd.replicate, true
+			default:
+			}
+		}
+		if m.live > 0 {
+			<-m.ready
+		}
+	}
+	return "", false, false
+}
+
+func (m *Multi) Return(str string) {
+	m.replies[m.last] <- reply{str: str}
+}
+
+// ReturnStream hands the stream to the API which issued the command, which
+// receives the chunks
+func (m *Multi) ReturnStream(chunks chan string) {
+	m.replies[m.last] <- reply{stream: chunks}
+}
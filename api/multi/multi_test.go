@@ -0,0 +1,100 @@
+package multi
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fake API issuing commands named after it, and recording responses
+type fake struct {
+	name      string
+	remaining int
+	issued    []string
+	returned  []string
+}
+
+func (f *fake) Next() (string, bool, bool) {
+	if f.remaining == 0 {
+		return "", false, false
+	}
+	f.remaining--
+	cmd := f.name + " " + strconv.Itoa(len(f.issued))
+	f.issued = append(f.issued, cmd)
+	return cmd, true, true
+}
+
+func (f *fake) Return(str string) {
+	f.returned = append(f.returned, str)
+}
+
+func (f *fake) ReturnStream(chunks chan string) {
+	str := ""
+	for chunk := range chunks {
+		str += chunk
+	}
+	f.Return(str)
+}
+
+// wait until each of the APIs has a pending command
+func waitPending(m *Multi) {
+	for i := range m.pending {
+		for len(m.pending[i]) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// check that commands are interleaved fairly and responses reach the right API
+func TestMulti(t *testing.T) {
+	a := &fake{name: "a", remaining: 50}
+	b := &fake{name: "b", remaining: 50}
+	m := Create(a, b)
+
+	counts := map[string]int{}
+	for i := 0; i < 40; i++ {
+		waitPending(m)
+		cmd, _, ok := m.Next()
+		if !ok {
+			t.Fatal("Multi API terminated early")
+		}
+		counts[cmd[:1]]++
+		m.Return("reply to " + cmd)
+	}
+	if counts["a"] != 20 || counts["b"] != 20 {
+		t.Errorf("Commands were not interleaved fairly: %v", counts)
+	}
+
+	// drain the remaining commands, streaming every other response
+	n := 40
+	for {
+		cmd, _, ok := m.Next()
+		if !ok {
+			break
+		}
+		n++
+		if n%2 == 0 {
+			m.Return("reply to " + cmd)
+			continue
+		}
+		chunks := make(chan string)
+		m.ReturnStream(chunks)
+		chunks <- "reply to "
+		chunks <- cmd
+		close(chunks)
+	}
+	if n != 100 {
+		t.Errorf("Multi API issued %d commands but 100 were expected", n)
+	}
+
+	for _, f := range []*fake{a, b} {
+		if len(f.returned) != len(f.issued) {
+			t.Fatalf("API %s issued %d commands but received %d responses", f.name, len(f.issued), len(f.returned))
+		}
+		for i := range f.issued {
+			if f.returned[i] != "reply to "+f.issued[i] {
+				t.Errorf("API %s received '%s' for '%s'", f.name, f.returned[i], f.issued[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Null issues a constant command as fast as possible and discards the
+// responses, to benchmark the transport and servers without the overhead of
+// generating a workload. The request is not marshalled ahead of time, as
+// each carries its own request ID, trace ID and correlation token; blast
+// mode sends requests encoded ahead of time instead
+package null
+
+// Command is the command issued, a read so that it is not replicated
+const Command = "get A"
+
+type Null struct {
+	requests int // remaining requests, unlimited if negative
+}
+
+// Create a Null API which issues requests commands, or an unlimited number
+// if requests is negative
+func Create(requests int) *Null {
+	return &Null{requests}
+}
+
+func (n *Null) Next() (string, bool, bool) {
+	if n.requests == 0 {
+		return "", false, false
+	}
+	if n.requests > 0 {
+		n.requests--
+	}
+	return Command, false, true
+}
+
+func (_ *Null) Return(_ string) {}
+
+func (_ *Null) ReturnStream(chunks chan string) {
+	for range chunks {
+	}
+}
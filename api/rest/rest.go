@@ -2,23 +2,33 @@
 package rest
 
 import (
+	"fmt"
 	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 )
 
-type Rest struct{}
+type Rest struct {
+	consistency msgs.Consistency // of the current request
+	command     *msgs.Command    // of the current request, nil if raw
+}
 
 type RestRequest struct {
-	Req     string
-	ReplyTo http.ResponseWriter
+	Req         string
+	Consistency msgs.Consistency
+	ReplyTo     http.ResponseWriter
+	Command     *msgs.Command // structured form of Req, nil if it cannot be parsed
 }
 
 var waiting chan RestRequest
 var outstanding chan RestRequest
 
+// longest command accepted, in bytes, 0 for no limit
+var maxLength int
+
 func versionServer(w http.ResponseWriter, req *http.Request) {
 	io.WriteString(w, "hydra 0.1\n")
 }
@@ -28,20 +38,42 @@ func closeServer(w http.ResponseWriter, req *http.Request) {
 	io.WriteString(w, "Will do\n")
 }
 
-// main request handler
+// main request handler. Requests are replicated, unless given a lease or
+// stale consistency as the consistency query parameter, e.g.
+// /request/get/A?consistency=stale, which makes them reads
 func requestServer(w http.ResponseWriter, req *http.Request) {
 	// NB: ResponseWriter needs to be used before this function exits
 	glog.Info("Incoming GET request to", req.URL.String())
-	reqs := strings.Split(req.URL.String(), "/")
+	consistency, err := msgs.ParseConsistency(req.URL.Query().Get("consistency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reqs := strings.Split(req.URL.Path, "/")
 	reqNew := strings.Join(reqs[2:], " ")
+	if maxLength > 0 && len(reqNew) > maxLength {
+		glog.Warning("API request of ", len(reqNew), " bytes rejected")
+		http.Error(w, fmt.Sprintf("Request of %d bytes exceeds the maximum length of %d", len(reqNew), maxLength),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
 	glog.Info("API request is:", reqNew)
-	waiting <- RestRequest{reqNew + "\n", w}
+	// each element of the path is a word of the command, e.g.
+	// /request/update/A/1, so it is built in structured form
+	var command *msgs.Command
+	if cmd, err := msgs.ParseCommand(reqNew); err == nil {
+		command = &cmd
+	}
+	waiting <- RestRequest{reqNew + "\n", consistency, w, command}
 
 	//wait for response, else give up
 	time.Sleep(time.Second)
 }
 
-func Create() *Rest {
+// Create starts the HTTP server, rejecting commands longer than max bytes
+// unless max is 0
+func Create(max int) *Rest {
+	maxLength = max
 	port := ":12345"
 	glog.Info("Setting up HTTP server on ", port)
 
@@ -71,8 +103,21 @@ func (r *Rest) Next() (string, bool, bool) {
 		return "", false, false
 	}
 	outstanding <- restreq
+	r.consistency = restreq.Consistency
+	r.command = restreq.Command
 	glog.Info("Next request received: ", restreq.Req)
-	return restreq.Req, true, true
+	return restreq.Req, restreq.Consistency == msgs.ConsistencyLinearizable, true
+}
+
+// Consistency returns the consistency of the last request from Next
+func (r *Rest) Consistency() msgs.Consistency {
+	return r.consistency
+}
+
+// Command returns the structured form of the last request from Next, or nil
+// if it has none
+func (r *Rest) Command() *msgs.Command {
+	return r.command
 }
 
 func (r *Rest) Return(str string) {
@@ -82,3 +127,15 @@ func (r *Rest) Return(str string) {
 	glog.Info("Response sent")
 
 }
+
+// ReturnStream writes each chunk of a streamed response as it arrives
+func (r *Rest) ReturnStream(chunks chan string) {
+	restreq := <-outstanding
+	for str := range chunks {
+		io.WriteString(restreq.ReplyTo, str)
+		if f, ok := restreq.ReplyTo.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	glog.Info("Streamed response sent")
+}
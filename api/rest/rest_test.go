@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// check that commands longer than the maximum length are rejected, and
+// those up to it are passed on
+func TestMaxLength(t *testing.T) {
+	defer func() { maxLength = 0 }()
+	maxLength = 11
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/request/put/A/12345", http.StatusOK},
+		{"/request/put/AB/12345", http.StatusRequestEntityTooLarge},
+		{"/request/put/A/12345678", http.StatusRequestEntityTooLarge},
+		{"/request/get/A", http.StatusOK},
+	}
+	for _, test := range tests {
+		waiting = make(chan RestRequest, 1)
+		w := httptest.NewRecorder()
+		requestServer(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, expected %d", test.path, w.Code, test.status)
+		}
+		if passed := len(waiting) == 1; passed != (test.status == http.StatusOK) {
+			t.Errorf("%s: passed on %t", test.path, passed)
+		}
+		if test.status != http.StatusOK && !strings.Contains(w.Body.String(), "exceeds the maximum length of 11") {
+			t.Errorf("%s: error was %q", test.path, w.Body.String())
+		}
+	}
+}
+
+// check that requests are built in structured form, or left raw if they
+// cannot be
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		path    string
+		command *msgs.Command
+	}{
+		{"/request/update/A/1", &msgs.Command{Op: msgs.OpUpdate, Key: "A", Value: "1"}},
+		{"/request/get/A", &msgs.Command{Op: msgs.OpGet, Key: "A"}},
+		{"/request/get/A/B", nil},
+	}
+	for _, test := range tests {
+		waiting = make(chan RestRequest, 1)
+		requestServer(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if restreq := <-waiting; !reflect.DeepEqual(restreq.Command, test.command) {
+			t.Errorf("%s: command %+v, expected %+v", test.path, restreq.Command, test.command)
+		}
+	}
+}
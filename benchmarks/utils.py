@@ -137,6 +137,9 @@ def read_results_file(filename):
     start_set = False
     with open(filename, newline='') as csvfile:
         for row in csv.reader(csvfile):
+            # skip the header row
+            if row[0].startswith('#'):
+                continue
             # latency in ms
             val = int(row[2])/1000000 
             results['latency'].append(val)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errAffinityUnsupported = errors.New("CPU affinity is not supported on this platform")
+
+// parseCPUList parses a list of cores such as "0-3,6"
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, errors.New("Invalid CPU list: " + list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, errors.New("Invalid CPU list: " + list)
+			}
+		}
+		if first < 0 {
+			return nil, errors.New("Invalid CPU list: " + list)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
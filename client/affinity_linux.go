@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"strconv"
+)
+
+// setAffinity pins every thread of the process to cpus. Threads created
+// later inherit the affinity of the thread creating them.
+func setAffinity(cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		// threads may exit while we are iterating
+		if err := unix.SchedSetaffinity(tid, &set); err != nil && err != unix.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"golang.org/x/sys/unix"
+	"runtime"
+	"testing"
+)
+
+func TestSetAffinity(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var old unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &old); err != nil {
+		t.Fatal(err)
+	}
+	cpu := -1
+	for i := 0; cpu < 0 && i < 1024; i++ {
+		if old.IsSet(i) {
+			cpu = i
+		}
+	}
+	defer setAffinityMask(t, &old)
+
+	if err := setAffinity([]int{cpu}); err != nil {
+		t.Fatal(err)
+	}
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		t.Fatal(err)
+	}
+	if set.Count() != 1 || !set.IsSet(cpu) {
+		t.Errorf("Affinity mask has %d cpus after pinning to cpu %d", set.Count(), cpu)
+	}
+}
+
+// restore the affinity of the process
+func setAffinityMask(t *testing.T, set *unix.CPUSet) {
+	var cpus []int
+	for i := 0; i < 1024; i++ {
+		if set.IsSet(i) {
+			cpus = append(cpus, i)
+		}
+	}
+	if err := setAffinity(cpus); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+func setAffinity(cpus []int) error {
+	return errAffinityUnsupported
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cases := []struct {
+		list string
+		cpus []int
+	}{
+		{"0", []int{0}},
+		{"0-3", []int{0, 1, 2, 3}},
+		{"1,3-4,7", []int{1, 3, 4, 7}},
+		{"", nil},
+		{"a", nil},
+		{"3-1", nil},
+		{"-1", nil},
+	}
+	for _, c := range cases {
+		cpus, err := parseCPUList(c.list)
+		if !reflect.DeepEqual(cpus, c.cpus) || (err == nil) != (c.cpus != nil) {
+			t.Errorf("%q parsed as %v (%v) but %v was expected", c.list, cpus, err, c.cpus)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// asyncRequest is a request submitted by SubmitAsync
+type asyncRequest struct {
+	ctx       context.Context
+	text      string
+	replicate bool
+	callback  func(string, error)
+}
+
+// asyncQueue holds the requests submitted by SubmitAsync until they are
+// issued. Its zero value is an empty queue
+type asyncQueue struct {
+	requests []asyncRequest
+	running  bool // a goroutine is issuing the requests
+	sync.Mutex
+}
+
+// SubmitAsync submits a command and returns at once, calling callback with
+// the response when the reply arrives, or with the error if the request
+// fails or ctx is done first.
+//
+// A client has a single request in flight on its connection, so requests
+// are queued and issued in the order submitted, by a goroutine started for
+// as long as there are requests queued. Callbacks are called on that
+// goroutine one at a time, in the order the requests were submitted, and
+// should not block, as the requests queued after wait for them. A callback
+// may submit further requests with SubmitAsync. SubmitAsync is safe to call
+// from any goroutine, but the client must not otherwise be used while
+// requests are queued.
+func (c *client) SubmitAsync(ctx context.Context, text string, replicate bool, callback func(string, error)) {
+	c.async.Lock()
+	defer c.async.Unlock()
+	c.async.requests = append(c.async.requests, asyncRequest{ctx, text, replicate, callback})
+	if !c.async.running {
+		c.async.running = true
+		go c.issueAsync()
+	}
+}
+
+// issueAsync issues the queued requests until there are none
+func (c *client) issueAsync() {
+	for {
+		c.async.Lock()
+		if len(c.async.requests) == 0 {
+			c.async.running = false
+			c.async.Unlock()
+			return
+		}
+		req := c.async.requests[0]
+		c.async.requests = c.async.requests[1:]
+		c.async.Unlock()
+
+		if err := req.ctx.Err(); err != nil {
+			req.callback("", err)
+			continue
+		}
+		c.ctx = req.ctx
+		release := c.order.Wait(c.order.Keys([]string{req.text})...)
+		response, err := c.submitErr(req.text, req.replicate)
+		if err == nil {
+			response, err = c.transform(req.text, response)
+		}
+		release()
+		c.ctx = nil
+		if errors.Is(err, ErrCancelled) && req.ctx.Err() != nil {
+			err = req.ctx.Err()
+		}
+		if err != nil {
+			response = ""
+		}
+		req.callback(response, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// check that every async request is replied to, in order, including those
+// submitted by callbacks
+func TestSubmitAsync(t *testing.T) {
+	server := newFakeServer(t, 0)
+	server.echo = true
+	c := newTestClient(t, server.addr)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var order []string
+	n := 50
+	wg.Add(n + 1)
+	for i := 0; i < n; i++ {
+		text := "get " + strconv.Itoa(i)
+		c.SubmitAsync(context.Background(), text, false, func(response string, err error) {
+			defer wg.Done()
+			if response != text || err != nil {
+				t.Errorf("Response to %q was %q, %v", text, response, err)
+			}
+			mu.Lock()
+			order = append(order, response)
+			mu.Unlock()
+			if text == "get 0" {
+				c.SubmitAsync(context.Background(), "get last", false, func(response string, err error) {
+					defer wg.Done()
+					mu.Lock()
+					order = append(order, response)
+					mu.Unlock()
+				})
+			}
+		})
+	}
+	wg.Wait()
+	if len(order) != n+1 || order[n] != "get last" {
+		t.Fatalf("Responses were %q", order)
+	}
+	for i := 0; i < n; i++ {
+		if order[i] != "get "+strconv.Itoa(i) {
+			t.Errorf("Response %d was %q", i, order[i])
+		}
+	}
+}
+
+// check that failed requests, and those whose context is done before or
+// while they are issued, call back with the error
+func TestSubmitAsyncErrors(t *testing.T) {
+	server := newFakeServer(t, 200*time.Millisecond)
+	server.token = "token"
+	c := newTestClient(t, server.addr)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelDeadline()
+	cases := []struct {
+		ctx context.Context
+		err error
+	}{
+		{cancelled, context.Canceled},
+		// the server replies after the deadline
+		{deadline, context.DeadlineExceeded},
+		{context.Background(), ErrUnauthorized},
+	}
+	errs := make(chan error, len(cases))
+	for _, tc := range cases {
+		c.SubmitAsync(tc.ctx, "get A", false, func(response string, err error) {
+			if response != "" {
+				t.Errorf("Response was %q", response)
+			}
+			errs <- err
+		})
+	}
+	for i, tc := range cases {
+		if err := <-errs; !errors.Is(err, tc.err) {
+			t.Errorf("case %d: error was %v, expected %v", i, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenSource provides the bearer token for requests, either a fixed token
+// or one read from a file, which is reread when the file changes.
+// It is safe for concurrent access
+type tokenSource struct {
+	token    string
+	filename string // empty if the token is fixed
+	modTime  time.Time
+	sync.Mutex
+}
+
+func newTokenSource(token string, filename string) (*tokenSource, error) {
+	t := &tokenSource{token: token, filename: filename}
+	if filename != "" {
+		if _, err := t.read(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// read the token from the file, returning true if it changed
+func (t *tokenSource) read() (bool, error) {
+	info, err := os.Stat(t.filename)
+	if err != nil {
+		return false, err
+	}
+	b, err := ioutil.ReadFile(t.filename)
+	if err != nil {
+		return false, err
+	}
+	token := strings.TrimSpace(string(b))
+	changed := token != t.token
+	t.token = token
+	t.modTime = info.ModTime()
+	return changed, nil
+}
+
+// Token returns the current token, rereading the file if it was modified
+func (t *tokenSource) Token() string {
+	t.Lock()
+	defer t.Unlock()
+	if t.filename != "" {
+		if info, err := os.Stat(t.filename); err == nil && !info.ModTime().Equal(t.modTime) {
+			if _, err := t.read(); err != nil {
+				glog.Warning("Unable to reread token: ", err)
+			} else {
+				glog.Info("Token file ", t.filename, " changed, reread token")
+			}
+		}
+	}
+	return t.token
+}
+
+// Refresh rereads the token file, returning true if the token changed
+func (t *tokenSource) Refresh() bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.filename == "" {
+		return false
+	}
+	changed, err := t.read()
+	if err != nil {
+		glog.Warning("Unable to reread token: ", err)
+	}
+	return changed
+}
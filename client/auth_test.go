@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthentication(t *testing.T) {
+	cases := []struct {
+		token    string
+		response string
+		sent     int
+	}{
+		{"secret", "0", 1},
+		{"", ErrUnauthorized.Error(), 1},
+		{"guess", ErrUnauthorized.Error(), 1},
+	}
+	for i, test := range cases {
+		s := newFakeServer(t, 0)
+		s.token = "secret"
+		c := newTestClient(t, s.addr)
+		if test.token != "" {
+			c.auth, _ = newTokenSource(test.token, "")
+		}
+		if response := c.submit("get A", false); response != test.response {
+			t.Errorf("case %d: response was %q but %q was expected", i, response, test.response)
+		}
+		// rejected requests are not retried
+		if n := len(s.Received()); n != test.sent {
+			t.Errorf("case %d: server received %d requests but %d were expected", i, n, test.sent)
+		}
+	}
+}
+
+// check that a token file is reread when it changes, and on rejection
+func TestAuthenticationRefresh(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(filename, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeServer(t, 0)
+	s.token = "old"
+	c := newTestClient(t, s.addr)
+	var err error
+	c.auth, err = newTokenSource("", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := c.submit("get A", false); response != "0" {
+		t.Fatalf("Response with the original token was %q", response)
+	}
+
+	// the token is rotated, the client picks up the new file
+	s.Lock()
+	s.token = "new"
+	s.Unlock()
+	if err := ioutil.WriteFile(filename, []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Response after rotating the token was %q", response)
+	}
+
+	// a rejection rereads the token even if the file appears unmodified
+	s.Lock()
+	s.token = "newer"
+	s.Unlock()
+	if err := ioutil.WriteFile(filename, []byte("newer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.auth.Lock()
+	c.auth.modTime = info.ModTime()
+	c.auth.Unlock()
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Response after rotating the token again was %q", response)
+	}
+	if n := len(s.Received()); n != 4 {
+		t.Errorf("Server received %d requests, the rejected request was not retried once", n)
+	}
+}
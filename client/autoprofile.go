@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+var autoprofile_threshold = flag.Duration("autoprofile-threshold", 0, "Write goroutine and heap profiles when a request takes longer than this, to catch latency spikes as they happen, 0 to never write them")
+var autoprofile_errors = flag.Int("autoprofile-errors", 0, "Write goroutine and heap profiles when this many tries in a row fail, 0 to never write them")
+var autoprofile_dir = flag.String("autoprofile-dir", ".", "Directory to write the profiles of -autoprofile-threshold and -autoprofile-errors to")
+var autoprofile_interval = flag.Duration("autoprofile-interval", time.Minute, "Least time between writing profiles, so that a run of slow requests writes them once")
+
+// autoProfile writes profiles on latency spikes or errors, nil if it does
+// not
+var autoProfile *autoProfiler
+
+// autoProfiler writes a goroutine and a heap profile, to files named by
+// the time, when a request is slower than threshold or errors tries fail
+// in a row, at most once per interval. Profiles are written in the
+// background, so requests are not held up. It is safe for concurrent
+// access, and a nil *autoProfiler writes nothing
+type autoProfiler struct {
+	threshold time.Duration // 0 if latency does not trigger profiles
+	errors    int           // 0 if errors do not
+	dir       string
+	interval  time.Duration
+	failures  int       // tries failed in a row
+	last      time.Time // when profiles were last written
+	captured  int
+	writing   sync.WaitGroup
+	sync.Mutex
+}
+
+// newAutoProfiler returns a profiler writing to dir, or nil if neither
+// threshold nor errors is set
+func newAutoProfiler(threshold time.Duration, errors int, dir string, interval time.Duration) *autoProfiler {
+	if threshold <= 0 && errors <= 0 {
+		return nil
+	}
+	return &autoProfiler{threshold: threshold, errors: errors, dir: dir, interval: interval}
+}
+
+// Observe records the latency of a successful request
+func (p *autoProfiler) Observe(latency time.Duration) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.failures = 0
+	if p.threshold > 0 && latency > p.threshold {
+		p.capture("latency of " + latency.String())
+	}
+}
+
+// Fail records a failed try
+func (p *autoProfiler) Fail() {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.failures++
+	if p.errors > 0 && p.failures >= p.errors {
+		p.failures = 0
+		p.capture("tries failing in a row")
+	}
+}
+
+// capture starts writing the profiles, unless they were written less than
+// interval ago, with the lock held
+func (p *autoProfiler) capture(reason string) {
+	now := time.Now()
+	if !p.last.IsZero() && now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+	p.captured++
+	prefix := filepath.Join(p.dir, now.Format("20060102-150405.000000")+"-")
+	glog.Warning("Writing profiles to ", prefix, "*.pprof after ", reason)
+	p.writing.Add(1)
+	go func() {
+		defer p.writing.Done()
+		for _, name := range []string{"goroutine", "heap"} {
+			if err := writeProfile(name, prefix+name+".pprof"); err != nil {
+				glog.Warning("Unable to write ", name, " profile: ", err)
+			}
+		}
+	}()
+}
+
+// writeProfile writes the named pprof profile to filename
+func writeProfile(name string, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(file, 0); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Captured returns the number of times profiles were written
+func (p *autoProfiler) Captured() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.captured
+}
+
+// Wait until the profiles being written have been
+func (p *autoProfiler) Wait() {
+	if p != nil {
+		p.writing.Wait()
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// check that a slow request writes goroutine and heap profiles, and that a
+// run of them writes profiles only once per interval
+func TestAutoProfile(t *testing.T) {
+	defer func() { autoProfile = nil }()
+	dir := t.TempDir()
+	autoProfile = newAutoProfiler(30*time.Millisecond, 0, dir, time.Minute)
+	s := newFakeServer(t, 0)
+	c := newTestClient(t, s.addr)
+	c.run(&commandList{commands: []string{"get A"}})
+	autoProfile.Wait()
+	if profiles, _ := filepath.Glob(filepath.Join(dir, "*.pprof")); len(profiles) != 0 {
+		t.Errorf("Fast request wrote profiles %v", profiles)
+	}
+
+	s.Lock()
+	s.delay = 50 * time.Millisecond
+	s.Unlock()
+	c.run(&commandList{commands: []string{"get A", "get B", "get C"}})
+	autoProfile.Wait()
+	for _, name := range []string{"goroutine", "heap"} {
+		if profiles, _ := filepath.Glob(filepath.Join(dir, "*-"+name+".pprof")); len(profiles) != 1 {
+			t.Errorf("Slow requests wrote %d %s profiles, expected 1", len(profiles), name)
+		}
+	}
+	if autoProfile.Captured() != 1 {
+		t.Errorf("Profiles written %d times, expected once", autoProfile.Captured())
+	}
+}
+
+// check that tries failing in a row write profiles, once per interval
+func TestAutoProfileErrors(t *testing.T) {
+	dir := t.TempDir()
+	p := newAutoProfiler(0, 3, dir, 50*time.Millisecond)
+	p.Fail()
+	p.Fail()
+	p.Observe(time.Hour)
+	p.Fail()
+	p.Fail()
+	if p.Captured() != 0 {
+		t.Errorf("Profiles written after 2 failures in a row")
+	}
+	p.Fail()
+	p.Fail()
+	p.Fail()
+	p.Fail()
+	if p.Captured() != 1 {
+		t.Errorf("Profiles written %d times within the interval, expected once", p.Captured())
+	}
+	time.Sleep(60 * time.Millisecond)
+	p.Fail()
+	p.Fail()
+	p.Fail()
+	p.Wait()
+	if p.Captured() != 2 {
+		t.Errorf("Profiles written %d times after the interval, expected twice", p.Captured())
+	}
+	if profiles, _ := filepath.Glob(filepath.Join(dir, "*.pprof")); len(profiles) != 4 {
+		t.Errorf("Wrote profiles %v, expected 2 of each", profiles)
+	}
+	if newAutoProfiler(0, 0, dir, time.Minute) != nil {
+		t.Error("Profiler without a threshold or errors was created")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"time"
+)
+
+// how long a throttle hint without a RetryAfter lasts
+const defaultThrottleFor = time.Second
+
+// backpressure honours the hint of an overloaded server in reply, if any,
+// by throttling the rate requests are issued at, which is shared by all
+// clients. Without -rate, requests are not rate limited so only RetryAfter
+// of busy replies is honoured
+func (c *client) backpressure(reply *msgs.ClientResponse) {
+	if reply.Throttle <= 0 {
+		return
+	}
+	d := reply.RetryAfter
+	if d <= 0 {
+		d = defaultThrottleFor
+	}
+	if c.limiter != nil {
+		glog.Warning("Server asked to slow down, throttling requests to ", reply.Throttle, " of the rate for ", d)
+	}
+	c.limiter.Throttle(reply.Throttle, d)
+}
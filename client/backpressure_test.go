@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketThrottle(t *testing.T) {
+	bucket := newTokenBucket(100, 1)
+	bucket.Throttle(0.25, 50*time.Millisecond)
+	if rate := bucket.Rate(); rate != 25 {
+		t.Errorf("Throttled rate was %v, expected 25", rate)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if rate := bucket.Rate(); rate != 100 {
+		t.Errorf("Rate was %v after the throttle, expected 100", rate)
+	}
+	var none *tokenBucket
+	none.Throttle(0.5, time.Second)
+}
+
+// hooks recording the rate of limiter after each reply
+type rateHooks struct {
+	noHooks
+	limiter *tokenBucket
+	rates   []float64
+}
+
+func (h *rateHooks) AfterReply(_ *msgs.ClientRequest, _ *msgs.ClientResponse, err error) {
+	if err == nil {
+		h.rates = append(h.rates, h.limiter.Rate())
+	}
+}
+
+// check that clients slow down when a server asks them to, and recover once
+// the hint expires
+func TestBackpressure(t *testing.T) {
+	s := newFakeServer(t, 0)
+	s.hints, s.throttle, s.retryAfter = 1, 0.2, 300*time.Millisecond
+	c := newTestClient(t, s.addr)
+	c.limiter = newTokenBucket(100, 1)
+	hooks := &rateHooks{limiter: c.limiter}
+	c.hooks = hooks
+	commands := []string{"get A", "get B", "get C", "get A", "get B"}
+
+	// the first reply throttles the rest to 20 requests a second, checked as
+	// it is replied to, well within the hint however slow the test is
+	start := time.Now()
+	c.run(&commandList{commands: commands})
+	if elapsed := time.Since(start); elapsed < 4*45*time.Millisecond {
+		t.Errorf("Throttled requests took %v, expected at least 200ms", elapsed)
+	}
+	if len(hooks.rates) == 0 || hooks.rates[0] != 20 {
+		t.Errorf("Rates were %v after each reply, expected 20 after the first", hooks.rates)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	start = time.Now()
+	c.run(&commandList{commands: commands})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Requests took %v after the throttle expired, expected 50ms", elapsed)
+	}
+	if rate := c.limiter.Rate(); rate != 100 {
+		t.Errorf("Rate was %v after the throttle, expected 100", rate)
+	}
+}
+
+// check that a busy request is retried after the RetryAfter of the server,
+// but no later than the timeout
+func TestBusyRetryAfter(t *testing.T) {
+	for _, test := range []struct{ retryAfter, min, max time.Duration }{
+		{250 * time.Millisecond, 250 * time.Millisecond, 750 * time.Millisecond},
+		{time.Hour, time.Second, 1500 * time.Millisecond},
+	} {
+		s := newFakeServer(t, 0)
+		s.overloaded, s.hints, s.retryAfter = 1, 1, test.retryAfter
+		c := newTestClient(t, s.addr)
+		start := time.Now()
+		if response := c.submit("get A", false); response != "0" {
+			t.Errorf("Response was %q", response)
+		}
+		if elapsed := time.Since(start); elapsed < test.min || elapsed > test.max {
+			t.Errorf("Busy request with RetryAfter %v retried after %v, expected %v to %v", test.retryAfter, elapsed, test.min, test.max)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"github.com/heidi-ann/hydra/api/multi"
+	"github.com/heidi-ann/hydra/test"
+	"strconv"
+	"strings"
+)
+
+// parseBlend parses a blend of workloads, as name:weight pairs separated by
+// commas. The weight of a workload defaults to 1 if it is not given.
+func parseBlend(spec string) ([]string, []int, error) {
+	var names []string
+	var weights []int
+	for _, part := range strings.Split(spec, ",") {
+		name, weight := part, 1
+		if i := strings.LastIndex(part, ":"); i >= 0 {
+			var err error
+			name = part[:i]
+			weight, err = strconv.Atoi(part[i+1:])
+			if err != nil || weight < 0 {
+				return nil, nil, errors.New("Invalid weight for workload " + name + ": " + part[i+1:])
+			}
+		}
+		if name == "" {
+			return nil, nil, errors.New("Missing workload name in blend: " + spec)
+		}
+		names = append(names, name)
+		weights = append(weights, weight)
+	}
+	return names, weights, nil
+}
+
+// workloadAPI generates the workload named by -workload, or a blend of
+// several workloads from the library if more than one is named
+func workloadAPI(filename string, spec string) (API, error) {
+	if !strings.ContainsAny(spec, ",:") {
+		return test.Generate(test.ParseAuto(filename, spec)), nil
+	}
+	names, weights, err := parseBlend(spec)
+	if err != nil {
+		return nil, err
+	}
+	apis := make([]multi.API, len(names))
+	for i, name := range names {
+		apis[i] = test.Generate(test.ParseAuto(filename, name))
+	}
+	return multi.CreateBlend(weights, apis...), nil
+}
+
+// generators returns the workload generators driving ioapi
+func generators(ioapi API) []*test.Generator {
+	switch api := ioapi.(type) {
+	case *test.Generator:
+		return []*test.Generator{api}
+	case *multi.Blend:
+		var gs []*test.Generator
+		for _, sub := range api.APIs() {
+			if g, ok := sub.(*test.Generator); ok {
+				gs = append(gs, g)
+			}
+		}
+		return gs
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBlend(t *testing.T) {
+	cases := []struct {
+		spec    string
+		names   []string
+		weights []int
+		ok      bool
+	}{
+		{"readheavy:70,writeheavy:30", []string{"readheavy", "writeheavy"}, []int{70, 30}, true},
+		{"readheavy,mixed:2", []string{"readheavy", "mixed"}, []int{1, 2}, true},
+		{"readheavy:x", nil, nil, false},
+		{":1", nil, nil, false},
+	}
+	for _, c := range cases {
+		names, weights, err := parseBlend(c.spec)
+		if (err == nil) != c.ok || !reflect.DeepEqual(names, c.names) || !reflect.DeepEqual(weights, c.weights) {
+			t.Errorf("%s parsed as %v %v (%v)", c.spec, names, weights, err)
+		}
+	}
+}
+
+// check that a blend of the workloads in a library generates both
+func TestWorkloadBlend(t *testing.T) {
+	api, err := workloadAPI("../test/workloads.conf", "readheavy:70,writeheavy:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gs := generators(api); len(gs) != 2 || gs[0].Ratio != 95 || gs[1].Ratio != 5 {
+		t.Errorf("Blend has generators %v", gs)
+	}
+	n := 0
+	for _, _, ok := api.Next(); ok; _, _, ok = api.Next() {
+		api.Return("0")
+		n++
+	}
+	if n != 2000 {
+		t.Errorf("Blend issued %d commands, expected all 2000 from both workloads", n)
+	}
+}
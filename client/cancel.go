@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// time within which a second interrupt exits the client
+const interruptWindow = 2 * time.Second
+
+// canceller cancels the requests in flight of the clients sharing it, so
+// that an interactive user can return to the prompt. Requests started after
+// Cancel are not affected. It is safe for concurrent access, and a nil
+// *canceller never cancels
+type canceller struct {
+	cancelled chan bool // closed to cancel the requests in flight
+	inflight  int
+	sync.Mutex
+}
+
+func newCanceller() *canceller {
+	return &canceller{cancelled: make(chan bool)}
+}
+
+// Start a request, returning a channel which is closed if it is cancelled
+func (c *canceller) Start() <-chan bool {
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.inflight++
+	return c.cancelled
+}
+
+// Done finishes a request, whether or not it was cancelled
+func (c *canceller) Done() {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	c.inflight--
+	c.Unlock()
+}
+
+// Cancel cancels the requests in flight, returning false if there are none
+func (c *canceller) Cancel() bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.inflight == 0 {
+		return false
+	}
+	close(c.cancelled)
+	c.cancelled = make(chan bool)
+	return true
+}
+
+// cancellable lets the current request be cancelled by c.cancel, or when
+// c.ctx is done, until the returned function is called
+func (c *client) cancellable() func() {
+	c.cancelled = c.cancel.Start()
+	done := func() {
+		c.cancelled = nil
+		c.cancel.Done()
+	}
+	if c.ctx == nil {
+		return done
+	}
+	cancelled, finished := make(chan bool), make(chan bool)
+	go func(shared <-chan bool, ctxDone <-chan struct{}) {
+		select {
+		case <-shared:
+			close(cancelled)
+		case <-ctxDone:
+			close(cancelled)
+		case <-finished:
+		}
+	}(c.cancelled, c.ctx.Done())
+	c.cancelled = cancelled
+	return func() {
+		close(finished)
+		done()
+	}
+}
+
+// closed returns true if ch is closed, a nil ch is never closed
+func closed(ch <-chan bool) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// cancelOn passes on the reply or error from replyCh and errCh, or
+// ErrCancelled if cancelled is closed first
+func cancelOn(replyCh <-chan []byte, errCh <-chan error, cancelled <-chan bool) (<-chan []byte, <-chan error) {
+	if cancelled == nil {
+		return replyCh, errCh
+	}
+	reply := make(chan []byte, 1)
+	err := make(chan error, 1)
+	go func() {
+		select {
+		case b := <-replyCh:
+			reply <- b
+		case e := <-errCh:
+			err <- e
+		case <-cancelled:
+			err <- ErrCancelled
+		}
+	}()
+	return reply, err
+}
+
+// interactiveMode returns true if mode includes the interactive API
+func interactiveMode(mode string) bool {
+	for _, m := range strings.Split(mode, ",") {
+		if m == "interactive" {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInterrupts cancels the requests in flight on each interrupt. An
+// interrupt which follows another within window is passed on to exit, to
+// terminate the client, as is every interrupt after it
+func handleInterrupts(interrupts <-chan os.Signal, exit chan<- os.Signal, cancel *canceller, w io.Writer, window time.Duration) {
+	var last time.Time
+	for sig := range interrupts {
+		if !last.IsZero() && time.Since(last) < window {
+			select {
+			case exit <- sig:
+			default:
+			}
+			// further interrupts force the exit, if shutting down stalls
+			for sig := range interrupts {
+				select {
+				case exit <- sig:
+				default:
+				}
+			}
+			return
+		}
+		last = time.Now()
+		if cancel.Cancel() {
+			glog.Warning("Cancelled the requests in flight due to: ", sig)
+		}
+		fmt.Fprintf(w, "\nPress Ctrl-C again within %s to exit\n", window)
+	}
+}
+
+// forceExit exits with status 1 on the next signal from sigs, once a
+// graceful shutdown has begun, so that a shutdown which stalls, e.g. on an
+// unresponsive server, can still be interrupted
+func forceExit(sigs <-chan os.Signal, exit func(int)) {
+	sig := <-sigs
+	glog.Warning("Exiting immediately due to: ", sig, ", stats may be incomplete")
+	glog.Flush()
+	exit(1)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// check that cancelling a request in a slow dispatch returns at once, and
+// that the next request is sent afresh
+func TestCancel(t *testing.T) {
+	s := newFakeServer(t, 300*time.Millisecond)
+	c := newTestClient(t, s.addr)
+	c.timeout = 5 * time.Second
+	c.cancel = newCanceller()
+
+	// nothing is in flight yet
+	if c.cancel.Cancel() {
+		t.Error("Cancelled with no request in flight")
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if !c.cancel.Cancel() {
+			t.Error("No request in flight to cancel")
+		}
+	}()
+	start := time.Now()
+	response := c.submit("get A", false)
+	if response != ErrCancelled.Error() {
+		t.Errorf("Cancelled request returned %q", response)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("Cancelled request took %s to return", elapsed)
+	}
+
+	// the next request is not cancelled, and has a new RequestID
+	if response := c.submit("get B", false); response != "0" {
+		t.Errorf("Request after a cancel returned %q", response)
+	}
+	received := s.Received()
+	if len(received) != 2 || received[0].RequestID != 1 || received[1].RequestID != 2 {
+		t.Errorf("Server received %+v, expected requests 1 and 2", received)
+	}
+	if c.cancel.Cancel() {
+		t.Error("Cancelled with no request in flight")
+	}
+}
+
+// check that a single interrupt cancels and a double interrupt exits, with
+// every interrupt after it passed on to force the exit
+func TestHandleInterrupts(t *testing.T) {
+	cases := []struct {
+		gaps  []time.Duration // before each interrupt
+		exits int             // interrupts passed on
+	}{
+		{[]time.Duration{0}, 0},
+		{[]time.Duration{0, 10 * time.Millisecond}, 1},
+		{[]time.Duration{0, 150 * time.Millisecond}, 0},
+		{[]time.Duration{0, 150 * time.Millisecond, 10 * time.Millisecond}, 1},
+		{[]time.Duration{0, 10 * time.Millisecond, 500 * time.Millisecond}, 2},
+	}
+	for i, test := range cases {
+		interrupts := make(chan os.Signal)
+		exit := make(chan os.Signal, 2)
+		done := make(chan bool)
+		go func() {
+			handleInterrupts(interrupts, exit, newCanceller(), io.Discard, 100*time.Millisecond)
+			close(done)
+		}()
+		for _, gap := range test.gaps {
+			time.Sleep(gap)
+			interrupts <- os.Interrupt
+		}
+		close(interrupts)
+		<-done
+		if len(exit) != test.exits {
+			t.Errorf("case %d: %d interrupts passed on, expected %d", i, len(exit), test.exits)
+		}
+	}
+}
+
+// check that once shutting down, the next signal exits at once
+func TestForceExit(t *testing.T) {
+	sigs := make(chan os.Signal, 2)
+	exited := make(chan int, 1)
+	go forceExit(sigs, func(code int) { exited <- code })
+	select {
+	case <-exited:
+		t.Fatal("Exited without a signal")
+	case <-time.After(50 * time.Millisecond):
+	}
+	start := time.Now()
+	sigs <- syscall.SIGINT
+	select {
+	case code := <-exited:
+		if code != 1 || time.Since(start) > 100*time.Millisecond {
+			t.Errorf("Exited with status %d after %v", code, time.Since(start))
+		}
+	case <-time.After(time.Second):
+		t.Error("Did not exit on the second signal")
+	}
+}
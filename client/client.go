@@ -2,20 +2,28 @@ package main
 
 import (
 	"bufio"
-	"encoding/csv"
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/golang/glog"
 	"github.com/heidi-ann/hydra/api/interactive"
+	"github.com/heidi-ann/hydra/api/multi"
+	"github.com/heidi-ann/hydra/api/null"
 	"github.com/heidi-ann/hydra/api/rest"
 	"github.com/heidi-ann/hydra/config"
+	"github.com/heidi-ann/hydra/history"
 	"github.com/heidi-ann/hydra/msgs"
 	"github.com/heidi-ann/hydra/test"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -23,21 +31,80 @@ import (
 type API interface {
 	Next() (string, bool, bool)
 	Return(string)
+	// ReturnStream receives the chunks of a streamed response from the
+	// channel, until it is closed
+	ReturnStream(chan string)
 }
 
 var config_file = flag.String("config", "client/example.conf", "Client configuration file")
 var auto_file = flag.String("auto", "test/workload.conf", "If workload is automatically generated, configure file for workload")
-var stat_file = flag.String("stat", "latency.csv", "File to write stats to")
-var mode = flag.String("mode", "interactive", "interactive, rest or test")
+var workload = flag.String("workload", "", "If the auto file is a workload library, the name of the workload to use, or a blend of workloads such as readheavy:70,writeheavy:30")
+var stat_file = flag.String("stat", "latency.csv", "File to write stats to, none if empty")
+var statsd_addr = flag.String("statsd", "", "host:port of a statsd server to send request latency and counts to over UDP")
+var statsd_prefix = flag.String("statsdprefix", "hydra.client", "Prefix of the statsd metric names")
+var statsd_sample = flag.Float64("statsdsample", 1, "Fraction of requests sent to statsd")
+var influx_addr = flag.String("influx", "", "url,db of an InfluxDB server and database to write the latency and tries of each request to")
+var influx_interval = flag.Duration("influxinterval", time.Second, "Interval between writes of batched points to InfluxDB")
+var syslog_addr = flag.String("syslog", "", "host:port, or tcp://host:port, of a syslog server to send logs and the run summary to")
+var syslog_facility = flag.String("syslogfacility", "user", "Syslog facility, user, daemon or local0 to local7")
+var syslog_threshold = flag.String("syslogthreshold", "WARNING", "Minimum severity of logs sent to syslog, INFO, WARNING, ERROR or FATAL")
+var stat_format = flag.String("statformat", "csv", "Format of the stat file, csv or parquet (if built with -tags parquet)")
+var stat_compress = flag.String("statcompress", "", "Compress stat file with none, gzip or zstd (default: from file extension)")
+var mode = flag.String("mode", "interactive", "interactive, rest, test, faulttest, saturate, null, replay, blast, genframes, checklin or members. APIs can be combined, e.g. interactive,rest")
 var id = flag.Int("id", -1, "ID of client (must be unique)")
+var clients = flag.Int("clients", 1, "Number of logical clients to run in test mode, using IDs from id onwards")
+var startup_retry = flag.Duration("startupretry", 0, "Keep retrying the initial connection for this long, if the cluster is starting up")
+var start_jitter = flag.Duration("startjitter", 0, "Delay the start of each client by a random amount up to this, seeded by client ID")
+var rate = flag.Float64("rate", 0, "Maximum requests per second across all clients, 0 for unlimited")
+var burst = flag.Int("burst", 1, "Maximum burst of requests allowed above the rate")
+var null_requests = flag.Int("nullrequests", -1, "In null mode, number of requests to send, unlimited if negative")
+var ramp_step = flag.Float64("rampstep", 100, "In saturate mode, requests per second added to the offered load at each step")
+var step_duration = flag.Duration("stepduration", 10*time.Second, "In saturate mode, how long each step of the ramp is run for")
+var ramp_steps = flag.Int("rampsteps", 20, "In saturate mode, maximum number of steps of the ramp")
+var latency_slo = flag.Duration("slo", 100*time.Millisecond, "In saturate mode, p99 latency beyond which the server is saturated")
+var open_loop = flag.Bool("openloop", false, "Issue requests at -rate regardless of whether earlier requests have completed, queueing them until a client is free")
+var queue_size = flag.Int("queuesize", 1000, "Maximum requests queued in open loop mode, beyond which they are dropped")
+var shutdown_drain = flag.Duration("shutdowndrain", 0, "On shutdown in open loop mode, keep sending queued requests for up to this long, 0 to drop them")
+var adaptive_timeout = flag.Bool("adaptivetimeout", false, "Tune the request timeout from the observed latency, up to the config timeout")
+var timeout_percentile = flag.Float64("timeoutpercentile", 99, "Latency percentile used by the adaptive timeout")
+var timeout_factor = flag.Float64("timeoutfactor", 2, "Multiple of the latency percentile used by the adaptive timeout")
+var min_timeout = flag.Duration("mintimeout", 10*time.Millisecond, "Minimum adaptive timeout")
+var metrics_dump = flag.String("metricsdump", "", "File to write final metrics to in OpenMetrics format, on exit")
+var fault_every = flag.Int("faultevery", 5, "In faulttest mode, kill the connection when sending every nth request")
+var drain_window = flag.Duration("drain", 10*time.Millisecond, "Time to wait for a late reply after a timeout, before reconnecting. 0 disables draining")
+var max_request_len = flag.Int("maxrequestlen", 0, "Maximum length in bytes of the text of a command, longer commands are rejected without being sent, 0 for no limit")
+var max_msg_size = flag.Int("maxmsgsize", 16<<20, "Maximum size in bytes of a request or response")
+var cpu_affinity = flag.String("cpuaffinity", "", "Pin the client to these cores, e.g. 0-3,6 (Linux only)")
+var shadow_config = flag.String("shadow", "", "Configuration file of a shadow cluster to mirror requests to, whose responses are discarded")
+var shadow_stat = flag.String("shadowstat", "shadow.csv", "File to write stats of shadow or compared requests to")
+var compare_config = flag.String("compare", "", "Configuration file of a second cluster to send reads to, reporting responses which differ")
+var max_reqs_per_conn = flag.Int("maxreqsperconn", 0, "Close and reopen the connection after this many requests, 0 for no limit")
+var warm_pool = flag.Int("warmpool", 0, "Number of standby connections to other servers kept open for failover")
+var compression = flag.String("compression", "", "Connection compressions to offer the servers, in order of preference, e.g. zstd,gzip. None if empty")
+var conn_mode = flag.String("connpermode", "persistent", "persistent, to reuse a connection for all requests, or perrequest, to use a new connection for each request")
+var auth_token = flag.String("token", "", "Bearer token to authenticate requests with")
+var token_file = flag.String("tokenfile", "", "File containing the bearer token to authenticate requests with, reread when it changes")
+var watch_config = flag.Bool("watchconfig", false, "Reload the server addresses when the config file changes, for use on the next reconnect")
+var gen_config = flag.String("genconfig", "", "Write an example config to this file, or - for stdout, and exit")
+var dedup_window = flag.Duration("dedupwindow", 0, "Return the cached response for an operation ID submitted again within this window, 0 disables")
+var hedge = flag.Bool("hedge", false, "Send reads which are slower than usual to a second server too, using the first reply")
+var hedge_percentile = flag.Float64("hedgepercentile", 95, "Latency percentile of recent reads after which a read is hedged")
+var verify = flag.Bool("verify", false, "Check responses against the expectations in the workload script, exiting with an error on a mismatch")
+var coalesce = flag.Bool("coalesce", false, "Coalesce identical concurrent reads into a single request")
 
 func connect(addrs []string, tries int, hint int) (net.Conn, int, error) {
 	var conn net.Conn
 	var err error
 
+	// drained servers are skipped, unless all are
+	order := drained.Filter(addrs, preference.Order(addrs))
+	if drained.Avoid(addrs, hint) {
+		hint = order[0]
+	}
+
 	// first, try on to connect to the most likely leader
 	glog.Info("Trying to connect to ", addrs[hint])
-	conn, err = net.Dial("tcp", addrs[hint])
+	conn, err = dialServer(addrs[hint])
 	// if successful
 	if err == nil {
 		glog.Infof("Connect established to %s", addrs[hint])
@@ -46,11 +113,11 @@ func connect(addrs []string, tries int, hint int) (net.Conn, int, error) {
 	//if unsuccessful
 	glog.Warning(err)
 
-	// if fails, try everyone else
-	for i := range addrs {
+	// if fails, try everyone else, most preferred first
+	for _, i := range order {
 		for t := tries; t > 0; t-- {
 			glog.Info("Trying to connect to ", addrs[i])
-			conn, err = net.Dial("tcp", addrs[i])
+			conn, err = dialServer(addrs[i])
 
 			// if successful
 			if err == nil {
@@ -63,37 +130,152 @@ func connect(addrs []string, tries int, hint int) (net.Conn, int, error) {
 		}
 	}
 
-	return conn, hint + 1, err
+	return conn, hint + 1, fmt.Errorf("%w: unable to connect to any server: %w", ErrNoLeader, err)
 }
 
-// send bytes and wait for reply, return bytes returned if succussful or error otherwise
-func dispatcher(b []byte, conn net.Conn, r *bufio.Reader, timeout time.Duration) ([]byte, error) {
+// connect to the cluster when starting up, retrying with backoff for up to
+// deadline in case the servers are still starting up too
+func connectAtStartup(addrs []string, deadline time.Duration) (net.Conn, int, error) {
+	start := time.Now()
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		conn, leader, err := connect(addrs, 1, preference.First(addrs))
+		if err == nil || time.Since(start)+backoff > deadline {
+			return conn, leader, err
+		}
+		glog.Warningf("Startup connection attempt %d failed, retrying in %s", attempt, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > time.Second {
+			backoff = time.Second
+		}
+	}
+}
+
+// read a newline terminated message of up to max bytes, without buffering
+// more than that if it is too large
+func readMsg(r *bufio.Reader, max int) ([]byte, error) {
+	var msg []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		if len(msg)+len(frag) > max+1 {
+			return nil, ErrMsgTooLarge
+		}
+		msg = append(msg, frag...)
+		if err != bufio.ErrBufferFull {
+			return msg, err
+		}
+	}
+}
+
+// checkRequestLength returns ErrRequestTooLong if the text of a command,
+// without its trailing newline, is longer than maxrequestlen
+func checkRequestLength(text string) error {
+	n := len(strings.TrimSuffix(text, "\n"))
+	if *max_request_len > 0 && n > *max_request_len {
+		return fmt.Errorf("%w: %d bytes, the maximum is %d", ErrRequestTooLong, n, *max_request_len)
+	}
+	return nil
+}
+
+// send bytes and read the reply in the background, the reply or error is
+// delivered on the returned channels. Latency is injected if -injectlatency
+// is set
+func dispatch(b []byte, conn net.Conn, r *bufio.Reader) (<-chan []byte, <-chan error) {
+	return dispatchDelayed(b, conn, r, netDelay.Draw())
+}
+
+// dispatchDelayed is dispatch with a round trip of rtt added, half before
+// sending and half after the reply is received, as by a slow network
+func dispatchDelayed(b []byte, conn net.Conn, r *bufio.Reader, rtt time.Duration) (<-chan []byte, <-chan error) {
+	return dispatchTimed(b, conn, r, rtt, nil, true)
+}
+
+// dispatchTimed is dispatchDelayed, recording when the request is sent and
+// when its reply arrives in timing, unless it is nil. The send is logged
+// only if logged is true, as chosen by -logsample
+func dispatchTimed(b []byte, conn net.Conn, r *bufio.Reader, rtt time.Duration, timing *replyTiming, logged bool) (<-chan []byte, <-chan error) {
 	// setup channels for timeout implementation
 	errCh := make(chan error, 1)
 	replyCh := make(chan []byte, 1)
 
 	go func() {
+		time.Sleep(rtt / 2)
 		// send request
 		_, err := conn.Write(b)
 		_, err = conn.Write([]byte("\n"))
 		if err != nil && err != io.EOF {
 			glog.Warning(err)
 			errCh <- err
+			return
 		}
 
-		glog.Info("Sent")
-
-		// read response
-		reply, err := r.ReadBytes('\n')
-		if err != nil && err != io.EOF {
-			glog.Warning(err)
+		if logged {
+			glog.Info("Sent")
+			dumpBytes("Sent", b)
+		}
+		timing.Sent(time.Now(), len(b))
+		if rtt <= 0 {
+			readTimedReply(r, replyCh, errCh, timing)
+			return
+		}
+		received := make(chan []byte, 1)
+		receiveErr := make(chan error, 1)
+		readTimedReply(r, received, receiveErr, timing)
+		time.Sleep(rtt - rtt/2)
+		select {
+		case reply := <-received:
+			replyCh <- reply
+		case err := <-receiveErr:
 			errCh <- err
 		}
-
-		// success, return reply
-		replyCh <- reply
 	}()
+	return replyCh, errCh
+}
+
+// resend writes b to conn again, for a reply to be read by the dispatch
+// of the earlier send
+func resend(b []byte, conn net.Conn) error {
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+	_, err := conn.Write([]byte("\n"))
+	return err
+}
+
+// read a single reply
+func readReply(r *bufio.Reader, replyCh chan<- []byte, errCh chan<- error) {
+	readTimedReply(r, replyCh, errCh, nil)
+}
+
+// readTimedReply is readReply, recording when the first byte of the reply
+// arrives and when the whole of it has in timing, unless it is nil
+func readTimedReply(r *bufio.Reader, replyCh chan<- []byte, errCh chan<- error, timing *replyTiming) {
+	// wait for the first byte before reading the rest
+	if _, err := r.Peek(1); err == nil {
+		timing.FirstByte(time.Now())
+	}
+	reply, err := readMsg(r, *max_msg_size)
+	if err == nil {
+		// the size of the marshalled reply, without its newline
+		timing.LastByte(time.Now(), len(reply)-1)
+	}
+	if err == io.EOF && len(reply) == 0 {
+		err = fmt.Errorf("%w: connection closed without a reply", ErrServer)
+	}
+	if err != nil && err != io.EOF {
+		glog.Warning(err)
+		errCh <- err
+		return
+	}
 
+	// success, return reply
+	dumpBytes("Received", reply)
+	replyCh <- reply
+}
+
+// wait for a reply from dispatch until timeout
+func await(replyCh <-chan []byte, errCh <-chan error, timeout time.Duration) ([]byte, error) {
 	//handling outcomes
 	select {
 	case reply := <-replyCh:
@@ -101,8 +283,879 @@ func dispatcher(b []byte, conn net.Conn, r *bufio.Reader, timeout time.Duration)
 	case err := <-errCh:
 		return nil, err
 	case <-time.After(timeout):
-		return nil, errors.New("Timeout")
+		return nil, ErrTimeout
+	}
+}
+
+// send bytes and wait for reply, return bytes returned if succussful or error otherwise
+func dispatcher(b []byte, conn net.Conn, r *bufio.Reader, timeout time.Duration) ([]byte, error) {
+	replyCh, errCh := dispatch(b, conn, r)
+	return await(replyCh, errCh, timeout)
+}
+
+// client is the connection and request state of a single logical client
+type client struct {
+	id         int
+	conf       config.Config
+	timeout    time.Duration
+	stats      *StatsWriter
+	conn       net.Conn
+	rd         *bufio.Reader
+	leader     int
+	requestID  int
+	reads      *coalescer       // nil if reads are not coalesced
+	limiter    *tokenBucket     // nil if requests are not rate limited
+	queue      *arrivalQueue    // nil if not in open loop mode
+	timeouts   *adaptiveTimeout // nil if the timeout is fixed
+	metrics    *metrics
+	inflight   *inFlight
+	statsd     *statsdSink // nil if not sending to statsd
+	influx     *influxSink // nil if not writing to InfluxDB
+	hooks      Hooks
+	shadow     *shadow      // nil if requests are not mirrored
+	pause      *pauser      // nil if the client cannot be paused
+	perRequest bool         // use a new connection for each request
+	maxPerConn int          // requests after which the connection is recycled, 0 for no limit
+	connReqs   int          // requests completed on the current connection
+	auth       *tokenSource // nil if requests are not authenticated
+	compare    bool         // compare reads with the shadow, instead of mirroring requests
+	book       *addressBook // nil if the addresses are fixed
+	dedup      *dedupCache  // nil if operations are not deduplicated
+	hedge      *hedger      // nil if reads are not hedged
+	warm       *warmPool    // nil if there are no standby connections
+	// current session, whose commands are pinned to sessionServer
+	session       string
+	sessionServer int
+	stop          chan bool // closed when the client should stop issuing requests
+	// recently completed requests for the crash dump, nil if there is none
+	recent *recentRequests
+	// recording of the requests issued, nil if they are not recorded
+	record *recorder
+	// history of operations, nil if it is not recorded
+	history *history.Writer
+	// when the current request was generated, zero if it was just now
+	generated time.Time
+	// metadata attached to every request, and to the current request
+	defaultMetadata map[string]string
+	metadata        map[string]string
+	// transformers of the responses to each command, nil if there are none
+	transforms *transformRegistry
+	// structured form of the current command from the API, nil if raw
+	command *msgs.Command
+	// correlation token of the current try
+	correlation string
+	// cancels requests in flight, and the channel closed if the current
+	// request is cancelled
+	cancel    *canceller
+	cancelled <-chan bool
+	// versions read in the current session, nil if monotonic reads are not
+	// checked
+	monotonic *monotonicReads
+	// latency of each server, if reads are sent to the fastest
+	fast *serverLatency
+	// limits the clients connecting at once, shared by all clients
+	reconnects semaphore
+	// requests completed in each window of the run, nil if not recorded
+	timeline *timeline
+	// consistency of reads not set by the API, and of the current read,
+	// with the connection for stale reads, nil until one is sent
+	defaultConsistency msgs.Consistency
+	consistency        msgs.Consistency
+	replica            *serverConn
+	// the connection for reads to the fastest server, nil until one is sent
+	fastConn *serverConn
+	// latencies of the whole run, nil if not recorded
+	hdr *hdrHistogram
+	// how to retry requests failing with each kind of error
+	retry retryPolicy
+	// requests submitted by SubmitAsync, and the context of the current
+	// one, nil if it has none
+	async asyncQueue
+	ctx   context.Context
+	// connection for control queries, shared by all clients, nil if each
+	// query connects
+	control *controlConn
+	// orders operations on the same key, shared by all clients, nil if
+	// they are not ordered
+	order *keyOrder
+	// state of the clients for the status file, nil if not written
+	status *statusTracker
+	// latency injected into the tries of the current request
+	injected time.Duration
+	// when the reply to the last try sent arrived, nil if none was sent
+	timing *replyTiming
+	// bus the progress of requests is published to, nil if none
+	events *eventBus
+}
+
+// fatal closes the stat file, so that no stats are lost, and dumps the
+// recent requests before exiting
+func (c *client) fatal(args ...interface{}) {
+	c.stats.Close()
+	if c.recent != nil {
+		c.recent.Dump(*crash_dump, fmt.Sprintf("client %d request %d: %s", c.id, c.requestID, fmt.Sprint(args...)))
+	}
+	exit(args...)
+}
+
+// newClient connects to the cluster for client id
+func newClient(id int, conf config.Config, timeout time.Duration, stats *StatsWriter) *client {
+	// set up request id
+	// TODO: write this value to disk
+	c := &client{
+		id:        id,
+		conf:      conf,
+		timeout:   timeout,
+		stats:     stats,
+		requestID: 1,
+		hooks:     noHooks{},
+		stop:      make(chan bool)}
+
+	// connecting to server
+	var err error
+	c.conn, c.leader, err = connectAtStartup(conf.Addresses.Address, *startup_retry)
+	if err != nil {
+		c.fatal(err)
+	}
+	c.rd = bufio.NewReader(c.conn)
+	return c
+}
+
+// addrs returns the current server addresses
+func (c *client) addrs() []string {
+	if c.book != nil {
+		return c.book.Get()
+	}
+	return c.conf.Addresses.Address
+}
+
+// try to establish a new connection, until successful
+func (c *client) reconnect() {
+	c.conn.Close()
+	c.status.Disconnected(c.id)
+	defer func() { c.events.Emit(c.event("reconnect")) }()
+	next := preference.Failover(c.addrs(), c.leader)
+	if c.warm != nil {
+		if conn, leader := c.warm.Take(next); conn != nil && drained.Avoid(c.addrs(), leader) {
+			conn.Close()
+		} else if conn != nil {
+			glog.Info("Failing over to warm connection to server ", leader)
+			c.use(conn, bufio.NewReader(conn), leader)
+			return
+		}
+	}
+	c.connectFrom(next)
+}
+
+// connect to the cluster, trying hint first, until successful
+func (c *client) connectFrom(hint int) {
+	for {
+		addrs := c.addrs()
+		// the wait between attempts is outside the semaphore, so waiting
+		// clients can try meanwhile
+		c.reconnects.Acquire()
+		conn, leader, err := connect(addrs, c.conf.Parameters.Retries, hint%len(addrs))
+		c.reconnects.Release()
+		if err == nil {
+			c.use(conn, bufio.NewReader(conn), leader)
+			return
+		}
+		glog.Warning("Serious connectivity issues")
+		time.Sleep(time.Second)
+		hint = leader + 1
+	}
+}
+
+// use conn to server leader, read with rd, for the following requests
+func (c *client) use(conn net.Conn, rd *bufio.Reader, leader int) {
+	c.conn, c.rd, c.leader = conn, rd, leader
+	c.connReqs = 0
+	c.connected()
+	if c.warm != nil {
+		c.warm.SetLeader(leader)
+	}
+	if c.pinned() && c.leader != c.sessionServer {
+		glog.Warning("Session ", c.session, " moved from server ", c.sessionServer, " to ", c.leader)
+		c.sessionServer = c.leader
+	}
+}
+
+// receive waits for a reply from dispatch or readReply until timeout
+func receive(replyCh <-chan []byte, errCh <-chan error, timeout time.Duration) (*msgs.ClientResponse, error) {
+	replyBytes, err := await(replyCh, errCh, timeout)
+	if err != nil {
+		return nil, err
+	}
+	reply := new(msgs.ClientResponse)
+	err = msgs.Unmarshal(replyBytes, reply)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	if secret != nil && !msgs.Verify(reply, secret) {
+		return nil, fmt.Errorf("%w: reply to request %d", ErrBadSignature, reply.RequestID)
+	}
+	return reply, nil
+}
+
+// dispatchCurrent is dispatch for the current try of a request, except that
+// replies to earlier requests or tries of this client, which arrived after
+// they timed out, are discarded and the next reply read instead
+func (c *client) dispatchCurrent(b []byte, conn net.Conn, rd *bufio.Reader) (<-chan []byte, <-chan error) {
+	rtt := netDelay.Draw()
+	c.injected += rtt
+	timing := new(replyTiming)
+	c.timing = timing
+	replyCh, errCh := dispatchTimed(b, conn, rd, rtt, timing, logSample.chosen(c.id, c.requestID))
+	current := make(chan []byte, 1)
+	currentErr := make(chan error, 1)
+	id, requestID, correlation, cancelled := c.id, c.requestID, c.correlation, c.cancelled
+	go func() {
+		for {
+			select {
+			case replyBytes := <-replyCh:
+				var reply msgs.ClientResponse
+				err := msgs.Unmarshal(replyBytes, &reply)
+				if err != nil || reply.ClientID != id ||
+					(reply.RequestID >= requestID && !uncorrelated(&reply, correlation)) {
+					current <- replyBytes
+					return
+				}
+				if reply.RequestID == requestID {
+					glog.Warning("Discarding reply to an earlier try of request ", requestID)
+				} else {
+					glog.Warning("Discarding stale reply to request ", reply.RequestID, " while waiting for request ", requestID)
+				}
+				next := make(chan []byte, 1)
+				nextErr := make(chan error, 1)
+				timing.Discard()
+				go readTimedReply(rd, next, nextErr, timing)
+				replyCh, errCh = next, nextErr
+			case err := <-errCh:
+				currentErr <- err
+				return
+			case <-cancelled:
+				currentErr <- ErrCancelled
+				return
+			}
+		}
+	}()
+	return current, currentErr
+}
+
+// check that reply is to the current request
+func (c *client) checkReply(reply *msgs.ClientResponse) {
+	//check reply is not nil, an empty response is valid if it has a status
+	if reply.Status == msgs.StatusNone {
+		c.fatal("Response has no status, the server may be running an older version")
+	}
+
+	//check reply is as expected
+	if reply.ClientID != c.id {
+		c.fatal("Response received has wrong ClientID: expected ",
+			c.id, " ,received ", reply.ClientID)
+	}
+	if reply.RequestID != c.requestID {
+		c.fatal("Response received has wrong RequestID: expected ",
+			c.requestID, " ,received ", reply.RequestID)
+	}
+	if uncorrelated(reply, c.correlation) {
+		c.fatal("Response received has wrong correlation token: expected ",
+			c.correlation, " ,received ", reply.Correlation)
+	}
+	c.backpressure(reply)
+}
+
+// submit sends a command to the cluster and returns the response, retrying
+// until successful. Streamed responses are reassembled.
+func (c *client) submit(text string, replicate bool) string {
+	response, _ := c.submitErr(text, replicate)
+	return response
+}
+
+// submitErr is submit, also returning the error if the request failed, when
+// the response is the text of the error
+func (c *client) submitErr(text string, replicate bool) (string, error) {
+	var response []string
+	err := c.submitStream(text, replicate, func(chunk string, more bool) {
+		response = append(response, chunk)
+	})
+	return strings.Join(response, ""), err
+}
+
+// submitStream sends a command to the cluster, retrying until successful,
+// and passes each chunk of the response to chunk as it arrives. more is true
+// if further chunks follow. When retrying, the chunks already passed on are
+// skipped. If the request fails instead, the error is returned, after being
+// passed to chunk as the response.
+func (c *client) submitStream(text string, replicate bool, chunk func(string, bool)) error {
+	// the trace ID is kept across retries
+	req := msgs.ClientRequest{
+		ClientID:  c.id,
+		RequestID: c.requestID,
+		Replicate: replicate,
+		Request:   text,
+		Command:   c.structuredCommand(text),
+		TraceID:   newTraceID(),
+		Metadata:  c.metadata}
+	if !replicate {
+		req.Consistency = c.consistency
+	}
+	if c.auth != nil {
+		req.Auth = c.auth.Token()
+	}
+	command := req.Command
+	c.hooks.BeforeSend(&req)
+	if req.Request != text && req.Command == command {
+		// the structured form would otherwise be sent, and applied, as it was
+		req.Command = c.structuredCommand(req.Request)
+	}
+	c.correlate(&req)
+	logged := logSample.Sampled(c.id, c.requestID)
+	if logged {
+		glog.Info("Request ", c.requestID, " (trace ", req.TraceID, ") is: ", req.Request)
+	}
+
+	if err := checkRequestLength(req.Request); err != nil {
+		glog.Error("Request ", c.requestID, " (trace ", req.TraceID, ") not sent: ", err)
+		c.failed(&req, err)
+		chunk(err.Error(), false)
+		return err
+	}
+
+	// encode as request
+	b, err := msgs.Marshal(req)
+	if err != nil {
+		c.fatal(err)
+	}
+	if req.Auth == "" && logged {
+		// requests would include the token otherwise
+		glog.Info(string(b))
+	}
+	if len(b) > *max_msg_size {
+		glog.Error("Request ", c.requestID, " (trace ", req.TraceID, ") is ", len(b), " bytes, not sending")
+		c.failed(&req, ErrMsgTooLarge)
+		chunk(ErrMsgTooLarge.Error(), false)
+		return ErrMsgTooLarge
+	}
+
+	startTime := time.Now()
+	c.injected = 0
+	if c.events != nil {
+		e := c.event("start")
+		e.TraceID, e.Command = req.TraceID, commandName(text)
+		c.events.Emit(e)
+	}
+	inflight := c.inflight.Start()
+	defer c.inflight.Done()
+	defer c.cancellable()()
+	tries := 0
+	delivered := 0          // chunks passed to chunk
+	var setup time.Duration // connection setup time, in per request mode
+	backoff := minRetryBackoff
+
+	// stale reads go to a replica other than the leader, and other reads to
+	// the fastest server and hedged, unless pinned to a session's server
+	stale := req.Consistency == msgs.ConsistencyStale && !replicate && !c.pinned()
+	fast := c.fast != nil && !replicate && !c.pinned() && !stale
+	hedged := c.hedge != nil && !replicate && !c.pinned() && !stale
+	if stale {
+		defer c.useReplica()()
+	} else if fast {
+		connect, moveBack := c.preferFast()
+		setup += connect
+		defer moveBack()
+	}
+
+	// dispatch request until successfull
+	var reply *msgs.ClientResponse
+	// replies to a try which timed out, retried on the same connection, nil
+	// if the last try did not
+	var lateCh <-chan []byte
+	var lateErr <-chan error
+	// replies still to come on owedConn to tries sent again, as only one
+	// reply to a try is read
+	owed := 0
+	var owedConn net.Conn
+	for {
+		tries++
+		if tries > 1 && lateCh == nil {
+			// each try has its own correlation token
+			c.correlate(&req)
+			if b, err = msgs.Marshal(req); err != nil {
+				c.fatal(err)
+			}
+		}
+		timeout := c.timeout
+		if c.timeouts != nil {
+			timeout = c.timeouts.Timeout()
+		}
+		if c.conn == nil {
+			connStart := time.Now()
+			c.connectFrom(c.leader)
+			setup += time.Since(connStart)
+		}
+		tryStart := time.Now()
+		var replyCh <-chan []byte
+		var errCh <-chan error
+		if lateCh != nil {
+			// the reply to the last try is still being read, so the try is
+			// sent again as it was, and a reply to either accepted
+			replyCh, errCh = lateCh, lateErr
+			lateCh, lateErr = nil, nil
+			if err := resend(b, c.conn); err != nil {
+				// retried as by the retry policy
+				glog.Warning(err)
+				failed := make(chan error, 1)
+				failed <- err
+				replyCh, errCh = nil, failed
+			} else {
+				if owedConn != c.conn {
+					owed, owedConn = 0, c.conn
+				}
+				owed++
+			}
+		} else {
+			replyCh, errCh = c.dispatchCurrent(b, c.conn, c.rd)
+		}
+		if hedged && tries == 1 {
+			// only the first try is hedged, later ones are retried as usual
+			reply, err = receive(replyCh, errCh, c.hedge.latency.Timeout())
+			if remaining := timeout - time.Since(tryStart); errors.Is(err, ErrTimeout) && remaining > 0 {
+				result, sent := c.hedgeRead(b, replyCh, errCh, remaining)
+				if sent {
+					tries++
+				}
+				reply, err = result.reply, result.err
+			}
+		} else {
+			reply, err = receive(replyCh, errCh, timeout)
+		}
+		if errors.Is(err, ErrTimeout) {
+			// the connection is still up, so the reply may just be late
+			reply = c.drain(replyCh, errCh, *drain_window)
+			if reply != nil {
+				glog.Info("Request ", c.requestID, " (trace ", req.TraceID, ") replied while draining")
+				err = nil
+			}
+		}
+		var timedOutCh <-chan []byte
+		var timedOutErr <-chan error
+		if errors.Is(err, ErrTimeout) {
+			timedOutCh, timedOutErr = replyCh, errCh
+		}
+		if err == nil && c.timeouts != nil {
+			c.timeouts.Observe(time.Since(tryStart))
+		}
+		if fast {
+			c.observeRead(time.Since(tryStart), err)
+		}
+
+		// pass on each chunk of the reply, reading any which follow
+		for chunks := 0; err == nil; chunks++ {
+			c.checkReply(reply)
+			if reply.Unauthorized {
+				err = ErrUnauthorized
+				break
+			}
+			if reply.Status == msgs.StatusBusy {
+				err = ErrBusy
+				break
+			}
+			if chunks >= delivered {
+				chunk(reply.Response, reply.More)
+				delivered++
+			}
+			if !reply.More {
+				break
+			}
+			next := make(chan []byte, 1)
+			nextErr := make(chan error, 1)
+			go readTimedReply(c.rd, next, nextErr, c.timing)
+			replyCh, errCh = cancelOn(next, nextErr, c.cancelled)
+			reply, err = receive(replyCh, errCh, timeout)
+		}
+		if err == nil {
+			break
+		}
+		if errors.Is(err, ErrCancelled) || closed(c.cancelled) {
+			glog.Warning("Request ", c.requestID, " (trace ", req.TraceID, ") was cancelled")
+			c.failed(&req, ErrCancelled)
+			// the request may still be served, so its reply is left on the
+			// old connection and the next request has a new RequestID
+			c.reconnect()
+			c.requestID++
+			chunk(ErrCancelled.Error(), false)
+			return ErrCancelled
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			// retry only if the token has since changed
+			if c.auth != nil && c.auth.Refresh() {
+				glog.Info("Request ", c.requestID, " (trace ", req.TraceID, ") unauthorized, retrying with new token")
+				req.Auth = c.auth.Token()
+				continue
+			}
+			glog.Error("Request ", c.requestID, " (trace ", req.TraceID, ") was rejected as unauthorized")
+			c.failed(&req, err)
+			chunk(err.Error(), false)
+			return err
+		}
+
+		action := c.retry.Action(err)
+		glog.Warning("Request ", c.requestID, " (trace ", req.TraceID, ") failed due to: ", err, ", action is ", action)
+		c.failed(&req, err)
+		switch action {
+		case retrySame, retryBackoff:
+			if action == retryBackoff {
+				// a busy server may say when to retry, up to the timeout,
+				// so that a bad hint does not stall the client
+				wait := backoff
+				if errors.Is(err, ErrBusy) && reply != nil && reply.RetryAfter > 0 {
+					wait = reply.RetryAfter
+					if wait > c.timeout {
+						wait = c.timeout
+					}
+				}
+				select {
+				case <-time.After(wait):
+				case <-c.cancelled:
+				}
+				if backoff *= 2; backoff > maxRetryBackoff {
+					backoff = maxRetryBackoff
+				}
+			}
+			if errors.Is(err, ErrTimeout) {
+				if timedOutCh == nil {
+					// the rest of a streamed reply may still arrive
+					c.reconnect()
+				}
+				lateCh, lateErr = timedOutCh, timedOutErr
+			} else if !errors.Is(err, ErrBusy) {
+				// the connection may be broken, so the next try connects
+				// again, to the same server if possible
+				c.conn.Close()
+				c.conn = nil
+			}
+		case retryFail:
+			// the connection may be left mid reply. The request may have
+			// been served, e.g. with an oversized response, so the next
+			// has a new RequestID rather than being answered from the
+			// server's cache
+			c.reconnect()
+			c.requestID++
+			chunk(err.Error(), false)
+			return err
+		default:
+			c.reconnect()
+		}
+	}
+
+	if logged {
+		glog.Info("Request ", c.requestID, " (trace ", req.TraceID, ") replied with status ", reply.Status, " after ", tries, " tries: ", reply.Response)
+	}
+	if hedged {
+		c.hedge.latency.Observe(time.Since(startTime))
+	}
+	c.complete(&req, reply, startTime, tries, setup, inflight)
+	if owed > 0 && c.conn == owedConn {
+		c.discardOwed(owed)
+	}
+	return nil
+}
+
+// discardOwed reads and discards the replies still to come on the connection
+// to tries which were sent again, so that none is left to be read as the
+// reply to the next request. The connection is closed if they do not arrive
+// within the timeout
+func (c *client) discardOwed(owed int) {
+	for owed > 0 {
+		replyCh := make(chan []byte, 1)
+		errCh := make(chan error, 1)
+		go readReply(c.rd, replyCh, errCh)
+		reply, err := receive(replyCh, errCh, c.timeout)
+		if err != nil {
+			glog.Warning("Closing connection as replies to earlier sends did not arrive: ", err)
+			c.conn.Close()
+			c.conn = nil
+			return
+		}
+		glog.Info("Discarding reply to request ", reply.RequestID, " which was sent again")
+		if !reply.More {
+			owed--
+		}
+	}
+}
+
+// complete records a successful request, which was sent at startTime with
+// inflight requests in flight, and moves on to the next. Its latency is
+// measured from when it was generated, split into the time it was queued
+// before being sent and the time taken to serve it
+func (c *client) complete(req *msgs.ClientRequest, reply *msgs.ClientResponse, startTime time.Time, tries int, setup time.Duration, inflight int64) {
+	// write to latency to log, measured on the monotonic clock
+	end := time.Now()
+	generated := c.generated
+	if generated.IsZero() || generated.After(startTime) {
+		generated = startTime
+	}
+	c.generated = time.Time{}
+	elapsed := end.Sub(generated)
+	c.metrics.Observe(elapsed, tries)
+	c.timeline.Observe(end, elapsed)
+	c.hdr.Observe(elapsed)
+	c.statsd.Observe(elapsed, tries)
+	autoProfile.Observe(elapsed)
+	c.influx.Observe(generated, c.id, req.Request, elapsed, tries)
+	if c.events != nil {
+		e := c.event("complete")
+		e.TraceID, e.Command, e.Latency, e.Tries = req.TraceID, commandName(req.Request), elapsed, tries
+		c.events.Emit(e)
+	}
+	latency := strconv.FormatInt(elapsed.Nanoseconds(), 10)
+	queued := strconv.FormatInt(startTime.Sub(generated).Nanoseconds(), 10)
+	service := strconv.FormatInt(end.Sub(startTime).Nanoseconds(), 10)
+	firstByte, lastByte := c.timing.Latencies()
+	// the server time is that of the last try, so is taken from its round
+	// trip, or from the service time if its reply was not timed
+	roundTrip := lastByte
+	if roundTrip == 0 {
+		roundTrip = end.Sub(startTime)
+	}
+	server, network := overhead(roundTrip, reply.ServerProcessingTime)
+	requestSize, replySize := c.timing.Sizes()
+	// columns as in statsHeader
+	err := c.stats.Write([]string{wallTime(generated), strconv.Itoa(c.requestID), latency, strconv.Itoa(tries), strconv.Itoa(c.id),
+		strconv.FormatInt(setup.Nanoseconds(), 10), strconv.FormatInt(inflight, 10), queued, service,
+		strconv.FormatInt(c.injected.Nanoseconds(), 10), strconv.FormatInt(firstByte.Nanoseconds(), 10),
+		strconv.FormatInt(lastByte.Nanoseconds(), 10), strconv.FormatInt(server.Nanoseconds(), 10),
+		strconv.FormatInt(network.Nanoseconds(), 10), strconv.Itoa(requestSize), strconv.Itoa(replySize)})
+	if err == ErrStatsClosed {
+		glog.Warning("Stats for request ", c.requestID, " dropped during shutdown")
+	} else if err != nil {
+		c.fatal(err)
+	}
+
+	c.hooks.AfterReply(req, reply, nil)
+	c.monotonic.Observe(c.session, req, reply)
+	if c.recent != nil {
+		c.recent.Add(recentRequest{startTime, c.id, c.requestID, req.Request, reply.Response})
+	}
+	c.requestID++
+	c.connReqs++
+	if c.perRequest || (c.maxPerConn > 0 && c.connReqs >= c.maxPerConn) {
+		// the next request reconnects, to the same server if possible
+		glog.Info("Closing connection after ", c.connReqs, " requests")
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// failed records a failed attempt at req
+func (c *client) failed(req *msgs.ClientRequest, err error) {
+	c.metrics.Fail(err)
+	autoProfile.Fail()
+	c.status.Error(err)
+	if c.events != nil {
+		e := c.event("error")
+		e.TraceID, e.Command, e.ErrorKind, e.Error = req.TraceID, commandName(req.Request), errorKind(err), err.Error()
+		c.events.Emit(e)
+	}
+	c.hooks.AfterReply(req, nil, err)
+}
+
+// submit a command, returning the response to ioapi. Streamed responses
+// are passed to ReturnStream as they arrive.
+func (c *client) submitTo(ioapi API, text string, replicate bool) {
+	var stream chan string
+	done := make(chan bool)
+	c.submitStream(text, replicate, func(chunk string, more bool) {
+		if stream == nil {
+			if !more {
+				ioapi.Return(chunk)
+				return
+			}
+			stream = make(chan string)
+			go func() {
+				ioapi.ReturnStream(stream)
+				close(done)
+			}()
+		}
+		stream <- chunk
+		if !more {
+			close(stream)
+		}
+	})
+	if stream != nil {
+		<-done
+	}
+}
+
+// run issues commands from ioapi until it has no more
+func (c *client) run(ioapi API) {
+	for {
+		if c.pause != nil {
+			c.pause.Wait(c.stop)
+		}
+		select {
+		case <-c.stop:
+			glog.Info("Client ", c.id, " stopping")
+			return
+		default:
+		}
+		if c.limiter != nil {
+			c.limiter.Wait()
+		}
+		var arrival time.Time
+		if c.queue != nil {
+			var ok bool
+			if arrival, ok = c.queue.Wait(c.stop); !ok {
+				glog.Info("Client ", c.id, " stopping as no requests are queued")
+				return
+			}
+		}
+
+		// get next command
+		text, replicate, ok := ioapi.Next()
+		if !ok {
+			break
+		}
+		// the API may move the client to another server, or query the
+		// cluster, instead of a command
+		if capi, ok := ioapi.(ConnectAPI); ok {
+			if target := capi.Connect(); target != "" {
+				ioapi.Return(c.connectTo(target))
+				continue
+			}
+		}
+		if capi, ok := ioapi.(ControlAPI); ok {
+			if query := capi.Control(); query != "" {
+				ioapi.Return(c.runControl(query))
+				continue
+			}
+		}
+		// requests are generated when they arrive in open loop mode
+		c.generated = arrival
+		if arrival.IsZero() {
+			c.generated = time.Now()
+		}
+		if sapi, ok := ioapi.(SessionAPI); ok {
+			c.setSession(sapi.Session())
+		}
+		c.metadata = c.requestMetadata(ioapi)
+		c.command = c.requestCommand(ioapi)
+		c.consistency = c.requestConsistency(ioapi)
+		out := c.track(ioapi, text)
+		if c.record != nil {
+			if err := c.record.Record(c.id, text, replicate); err != nil {
+				c.fatal(err)
+			}
+		}
+		if c.shadow != nil && !c.compare {
+			c.shadow.Mirror(text, replicate)
+		}
+
+		// move off a server drained since the last request
+		if drained.Avoid(c.addrs(), c.leader) {
+			glog.Info("Moving client ", c.id, " off drained server ", c.leader)
+			c.reconnect()
+		}
+
+		// operations on the same key are issued one at a time, in order
+		release := c.order.Wait(c.orderKeys(ioapi, text)...)
+		c.issue(ioapi, out, text, replicate)
+		release()
+	}
+}
+
+// issue submits a command from ioapi, returning its result to out
+func (c *client) issue(ioapi API, out API, text string, replicate bool) {
+	// transactions are submitted whole, with a single result
+	if tapi, ok := ioapi.(TxnAPI); ok {
+		if commands := tapi.Transaction(); commands != nil {
+			out.Return(c.submitTxn(commands))
+			return
+		}
+	}
+
+	// operations submitted within the dedup window are answered from the
+	// cache, others are submitted as below but with their whole response
+	opID := ""
+	if oapi, ok := ioapi.(OperationAPI); ok && c.dedup != nil {
+		opID = oapi.OperationID()
+	}
+	if opID != "" {
+		response, ok := c.dedup.Get(opID)
+		if ok {
+			glog.Info("Operation ", opID, " was already submitted, returning its response")
+		} else {
+			response = c.submitWhole(text, replicate)
+			c.dedup.Put(opID, response)
+		}
+		out.Return(response)
+		return
+	}
+
+	// compared, coalesced and transformed responses need the whole
+	// response, so are not streamed
+	if c.compare && !replicate || c.coalesces(replicate) || c.transforms.Transforms(text) {
+		out.Return(c.submitWhole(text, replicate))
+	} else {
+		c.submitTo(out, text, replicate)
+	}
+}
+
+// coalesces returns true if reads are coalesced. Reads in a session must go
+// to the session's server, and stale reads may be behind, so neither are
+func (c *client) coalesces(replicate bool) bool {
+	return c.reads != nil && !replicate && !c.pinned() && c.consistency != msgs.ConsistencyStale
+}
+
+// submitWhole submits a command and returns its whole response, compared
+// with the shadow, coalesced with identical reads and transformed as the
+// client does
+func (c *client) submitWhole(text string, replicate bool) string {
+	if c.compare && !replicate {
+		response, err := c.submitErr(text, replicate)
+		c.shadow.Compare(text, response)
+		return c.transformed(text, response, err)
+	}
+	if c.coalesces(replicate) {
+		response, shared := c.reads.Do(text, func() string {
+			return c.submitTransformed(text, replicate)
+		})
+		if shared {
+			glog.Info("Request from client ", c.id, " coalesced: ", text)
+		}
+		return response
+	}
+	return c.submitTransformed(text, replicate)
+}
+
+// createAPI sets up the API for mode, several modes separated by commas are
+// composed so that the client can be driven by all of them
+func createAPI(mode string) API {
+	if modes := strings.Split(mode, ","); len(modes) > 1 {
+		apis := make([]multi.API, len(modes))
+		for i := range modes {
+			apis[i] = createAPI(modes[i])
+		}
+		return multi.Create(apis...)
+	}
+
+	switch mode {
+	case "interactive":
+		return interactive.Create()
+	case "test", "faulttest", "saturate":
+		api, err := workloadAPI(*auto_file, *workload)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		return api
+	case "rest":
+		return rest.Create(*max_request_len)
+	case "null":
+		return null.Create(*null_requests)
 	}
+	glog.Fatal("Invalid mode: ", mode)
+	return nil
 }
 
 func main() {
@@ -110,148 +1163,722 @@ func main() {
 	flag.Parse()
 	defer glog.Flush()
 
-	// always flush (whatever happens)
-	sigs := make(chan os.Signal, 1)
+	// always flush (whatever happens). The first signal shuts down
+	// gracefully and a second exits at once, so there is room for both
+	sigs := make(chan os.Signal, 2)
 	finish := make(chan bool, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+	// in interactive mode, Ctrl-C cancels the request in flight and returns
+	// to the prompt, and a second Ctrl-C exits
+	var cancel *canceller
+	if interactiveMode(*mode) {
+		cancel = newCanceller()
+		signal.Stop(sigs)
+		signal.Notify(sigs, syscall.SIGTERM)
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		go handleInterrupts(interrupts, sigs, cancel, os.Stdout, interruptWindow)
+	}
+
+	if *gen_config != "" {
+		if *gen_config == "-" {
+			fmt.Print(config.SampleClientConfig)
+		} else if err := ioutil.WriteFile(*gen_config, []byte(config.SampleClientConfig), 0644); err != nil {
+			glog.Fatal(err)
+		}
+		return
+	}
+
+	// check a recorded history instead of issuing requests
+	if *mode == "checklin" {
+		if *history_file == "" {
+			glog.Fatal("Checklin mode requires a -history file")
+		}
+		ok, err := checkHistory(os.Stdout, *history_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		glog.Flush()
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// parse config files
 	conf := config.ParseClientConfig(*config_file)
+	if conf.Parameters.Codec != "" {
+		if err := msgs.UseCodec(conf.Parameters.Codec); err != nil {
+			glog.Fatal(err)
+		}
+	}
 	timeout := time.Millisecond * time.Duration(conf.Parameters.Timeout)
+	// the servers may be discovered from a seed instead
+	if *seed_addr != "" {
+		if addrs, err := discover(*seed_addr, timeout); err != nil {
+			glog.Warning("Unable to discover members from ", *seed_addr, ", using the config instead: ", err)
+		} else {
+			glog.Info("Discovered members ", addrs, " from ", *seed_addr)
+			conf.Addresses.Address = addrs
+		}
+	}
+	if err := conf.Validate(); err != nil {
+		glog.Fatal("Invalid config ", *config_file, ": ", err)
+	}
+	retry, retryErr := parseRetryPolicy(conf.Retry.Policy)
+	if retryErr != nil {
+		glog.Fatal("Invalid config ", *config_file, ": ", retryErr)
+	}
+	preference = newServerPreference(conf, *client_zone)
+	if *client_zone != "" && preference == nil {
+		glog.Warning("Zone ", *client_zone, " given, but the config has no [server] sections giving the zones of servers")
+	}
 	// TODO: find a better way to handle required flags
 	if *id == -1 {
 		glog.Fatal("ID must be provided")
 	}
+	if *clients > 1 && *mode != "test" && *mode != "faulttest" && *mode != "saturate" && *mode != "null" {
+		glog.Fatal("Multiple clients are only supported in test mode")
+	}
+
+	// loaded before genframes, so the frames it writes are signed too
+	if *secret_file != "" {
+		var err error
+		if secret, err = readSecret(*secret_file); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	// encode the requests of the workload for blast mode, instead of
+	// issuing them
+	if *mode == "genframes" {
+		if *frame_file == "" {
+			glog.Fatal("Genframes mode requires a -framefile to write")
+		}
+		api, err := workloadAPI(*auto_file, *workload)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		n, err := writeFrameFile(*frame_file, codecName(conf), api, *id, *frame_count)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		fmt.Printf("Wrote %d frames to %s\n", n, *frame_file)
+		return
+	}
+
+	// a replay runs a client for each recorded client
+	var replays []*replayStream
+	if *mode == "replay" {
+		if *replay_file == "" {
+			glog.Fatal("Replay mode requires a -replay recording")
+		}
+		var err error
+		replays, err = loadRecording(*replay_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		*clients = len(replays)
+		glog.Info("Replaying ", len(replays), " clients from ", *replay_file)
+		if *replay_rate < 0 {
+			glog.Fatal("Replay rate must not be negative")
+		} else if *replay_rate > 0 {
+			paceReplay(replays, *replay_rate)
+			glog.Info("Replaying at ", *replay_rate, " requests/s")
+		}
+	}
+
+	if *conn_mode != "persistent" && *conn_mode != "perrequest" {
+		glog.Fatal("Invalid connection mode: ", *conn_mode)
+	}
 
 	glog.Info("Starting up client ", *id)
 	defer glog.Info("Shutting down client ", *id)
 
+	// reduce scheduling noise when benchmarking
+	if *cpu_affinity != "" {
+		cpus, err := parseCPUList(*cpu_affinity)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if err = setAffinity(cpus); err != nil {
+			glog.Warning("Unable to set CPU affinity: ", err)
+		} else {
+			runtime.GOMAXPROCS(len(cpus))
+			glog.Info("Pinned to cores ", *cpu_affinity)
+		}
+	}
+
+	// tune TCP keepalive, so that the OS detects dead servers
+	if keepAlive, ok := keepAliveConfig(conf); ok {
+		dialer = &keepAliveDialer{dialer, keepAlive}
+	}
+
+	// inject connection failures at scripted points
+	var faults *faultInjector
+	if *mode == "faulttest" {
+		faults = newFaultInjector(*fault_every, dialer)
+		dialer = faults
+	}
+
+	// simulate a slow network between the client and the servers
+	delay, delayErr := parseLatency(*inject_latency)
+	if delayErr != nil {
+		glog.Fatal(delayErr)
+	}
+	netDelay = delay
+	autoProfile = newAutoProfiler(*autoprofile_threshold, *autoprofile_errors, *autoprofile_dir, *autoprofile_interval)
+
+	// log only a sample of requests at high throughput
+	sampler, sampleErr := newLogSampler(*log_sample, *log_sample_seed)
+	if sampleErr != nil {
+		glog.Fatal(sampleErr)
+	}
+	logSample = sampler
+
+	// offer compressions whenever connecting
+	if *compression != "" {
+		offered, err := parseCompressions(*compression)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		dialer = &negotiatingDialer{dialer, offered}
+	}
+
+	// report cluster membership instead of issuing requests
+	if *mode == "members" {
+		reply, err := fetchMembership(conf, timeout)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		printMembership(os.Stdout, reply, conf)
+		return
+	}
+
+	// send pre-encoded requests as fast as possible, for the throughput of
+	// the network and servers alone
+	if *mode == "blast" {
+		if *frame_file == "" {
+			glog.Fatal("Blast mode requires a -framefile")
+		}
+		frames, err := openFrames(*frame_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		defer frames.Close()
+		if frames.codec != codecName(conf) {
+			glog.Fatal("Frames are encoded as ", frames.codec, ", but the config uses ", codecName(conf))
+		}
+		conn, _, err := connect(conf.Addresses.Address, conf.Parameters.Retries, 0)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		defer conn.Close()
+		result, err := blast(conn, bufio.NewReader(conn), frames, timeout)
+		fmt.Println(result)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		return
+	}
+
+	// copy logs to a remote syslog server
+	var err error
+	var sink *syslogSink
+	stopSyslog := func() {}
+	if *syslog_addr != "" {
+		sink, err = newSyslogSink(*syslog_addr, *syslog_facility)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		stopSyslog, err = captureGlog(sink, *syslog_threshold)
+		if err != nil {
+			glog.Fatal(err)
+		}
+	}
+
 	// set up stats collection
 	filename := *stat_file
+	if filename == "" {
+		filename = os.DevNull
+	}
 	glog.Info("Opening file: ", filename)
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0777)
+	stats, err := OpenStatsWriterFormat(filename, *stat_compress, *stat_format)
 	if err != nil {
 		glog.Fatal(err)
 	}
-	stats := csv.NewWriter(file)
-	defer stats.Flush()
+	defer stats.Close()
 
-	// set up request id
-	// TODO: write this value to disk
-	requestID := 1
+	var reads *coalescer
+	if *coalesce {
+		reads = newCoalescer()
+		defer func() { glog.Info(reads.Coalesced(), " requests were coalesced") }()
+	}
+	var order *keyOrder
+	if *key_order != "" {
+		parser, err := parseKeyParser(*key_order)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		order = newKeyOrder(parser)
+		defer func() { glog.Info(order.Waited(), " operations waited for an earlier one on the same key") }()
+	}
 
-	// connecting to server
-	conn, leader, err := connect(conf.Addresses.Address, 1, 0)
+	transforms, err := parseTransforms(*transform_spec)
 	if err != nil {
 		glog.Fatal(err)
 	}
-	rd := bufio.NewReader(conn)
 
-	// setup API
-	var ioapi API
-	switch *mode {
-	case "interactive":
-		ioapi = interactive.Create()
-	case "test":
-		ioapi = test.Generate(test.ParseAuto(*auto_file))
-	case "rest":
-		ioapi = rest.Create()
-	default:
-		glog.Fatal("Invalid mode: ", mode)
+	// the request rate is shared by all logical clients
+	var limiter *tokenBucket
+	var queue *arrivalQueue
+	if *mode == "saturate" {
+		// the ramp sets the rate of an open loop
+		queue = newArrivalQueue(*ramp_step, *queue_size)
+	} else if *open_loop {
+		if *rate <= 0 {
+			glog.Fatal("Open loop mode requires a -rate")
+		}
+		queue = newArrivalQueue(*rate, *queue_size)
+	} else if *rate > 0 {
+		limiter = newTokenBucket(*rate, *burst)
 	}
 
-	glog.Info("Client is ready to start processing incoming requests")
-	go func() {
-		for {
-			// get next command
-			text, replicate, ok := ioapi.Next()
-			if !ok {
-				finish <- true
-				break
-			}
-			glog.Info("Request ", requestID, " is: ", text)
-
-			// encode as request
-			req := msgs.ClientRequest{
-				*id, requestID, replicate, text}
-			b, err := msgs.Marshal(req)
-			if err != nil {
-				glog.Fatal(err)
-			}
-			glog.Info(string(b))
+	clientMetrics := newMetrics()
+	var status *statusTracker
+	if *status_file != "" {
+		if *status_interval <= 0 {
+			glog.Fatal("Status interval must be positive")
+		}
+		status = newStatusTracker(time.Now(), clientMetrics)
+	}
+	clientMetrics.maxSamples = *max_samples
+	inflight := new(inFlight)
+	var recent *recentRequests
+	if *crash_dump != "" {
+		recent = newRecentRequests(*crash_dump_size)
+	}
+	// the latency of each request is kept to check the SLOs and summarise
+	// the run
+	slos := sloFlags()
+	var runSamples *latencySamples
+	if len(slos) > 0 || *summary_file != "" {
+		runSamples = clientMetrics.Sampler()
+	}
+	var statsd *statsdSink
+	if *statsd_addr != "" {
+		if *statsd_sample <= 0 || *statsd_sample > 1 {
+			glog.Fatal("Statsd sample rate must be in (0, 1]")
+		}
+		statsd, err = newStatsdSink(*statsd_addr, *statsd_prefix, *statsd_sample)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		defer statsd.Close()
+	}
+	var influx *influxSink
+	if *influx_addr != "" {
+		write, err := parseInflux(*influx_addr)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		influx = newInfluxSink(write, *influx_interval)
+	}
+	var events *eventBus
+	if *event_bus != "" {
+		publisher, err := newEventPublisher(*event_bus, *event_subject)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		events = newEventBus(publisher, *event_queue)
+	}
 
-			startTime := time.Now()
-			tries := 0
+	// mirror requests to a shadow cluster, with separate stats
+	var shadowConf config.Config
+	var shadowStats *StatsWriter
+	if *shadow_config != "" && *compare_config != "" {
+		glog.Fatal("Only one of -shadow and -compare can be used")
+	}
+	if *compare_config != "" {
+		*shadow_config = *compare_config
+	}
+	if *shadow_config != "" {
+		shadowConf = config.ParseClientConfig(*shadow_config)
+		shadowStats, err = OpenStatsWriterFormat(*shadow_stat, *stat_compress, *stat_format)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		defer shadowStats.Close()
+	}
+	var shadows []*shadow
+	var monotonic []*monotonicReads
 
-			// dispatch request until successfull
-			var reply *msgs.ClientResponse
-			for {
-				tries++
-				replyBytes, err := dispatcher(b, conn, rd, timeout)
-				if err == nil {
+	// responses to operations are cached for all logical clients, as an
+	// operation may be submitted again to any of them
+	var dedup *dedupCache
+	if *dedup_window > 0 {
+		dedup = newDedupCache(*dedup_window)
+	}
 
-					//handle reply
-					reply = new(msgs.ClientResponse)
-					err = msgs.Unmarshal(replyBytes, reply)
+	// addresses are shared by all logical clients
+	var book *addressBook
+	if *watch_config || *seed_addr != "" && *membership_refresh > 0 {
+		book = newAddressBook(conf.Addresses.Address)
+	}
+	if *watch_config {
+		watcher, err := watchConfig(*config_file, book)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		defer watcher.Close()
+	}
 
-					if err == nil {
-						break
-					}
-				}
-				glog.Warning("Request ", requestID, " failed due to: ", err)
+	var auth *tokenSource
+	if *auth_token != "" || *token_file != "" {
+		auth, err = newTokenSource(*auth_token, *token_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+	}
 
-				// try to establish a new connection
-				for {
-					conn, leader, err = connect(conf.Addresses.Address, leader+1, conf.Parameters.Retries)
-					if err == nil {
-						break
-					}
-					glog.Warning("Serious connectivity issues")
-					time.Sleep(time.Second)
-				}
+	// SIGUSR2 pauses and resumes issuing requests
+	pause := newPauser()
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	go func() {
+		for range usr2 {
+			pause.Toggle()
+		}
+	}()
 
-				rd = bufio.NewReader(conn)
+	// latency is tracked across all logical clients
+	var timeouts *adaptiveTimeout
+	if *adaptive_timeout {
+		timeouts = newAdaptiveTimeout(1000, *timeout_percentile, *timeout_factor, *min_timeout, timeout)
+	}
 
-			}
+	metadata, err := parseMetadata(*request_metadata)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	consistency, err := msgs.ParseConsistency(*read_consistency)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	var tl *timeline
+	if *throughput_timeline != "" {
+		tl = newTimeline(time.Now(), *timeline_window)
+	}
+	var hdr *hdrHistogram
+	if *hdr_file != "" {
+		hdr = newHDRHistogram(time.Now())
+	}
+	var control *controlConn
+	if *control_conn {
+		// the addresses are followed as the clients follow them
+		addrs := func() []string { return conf.Addresses.Address }
+		if book != nil {
+			addrs = book.Get
+		}
+		control = newControlConn(addrs, conf.Parameters.Retries, timeout)
+		defer control.Close()
+	}
+	var reconnects semaphore
+	if *max_reconnects > 0 {
+		reconnects = newSemaphore(*max_reconnects)
+	}
+	// server latencies are shared, as the clients read from the same servers
+	var fast *serverLatency
+	if *prefer_fast {
+		if *fast_alpha <= 0 || *fast_alpha > 1 {
+			glog.Fatal("Fast alpha must be in (0, 1]")
+		}
+		fast = newServerLatency(*fast_alpha, *fast_explore)
+	}
 
-			//check reply is not nil
-			if *reply == (msgs.ClientResponse{}) {
-				glog.Fatal("Response is nil")
-			}
+	var hist *history.Writer
+	if *history_file != "" {
+		hist, err = history.Create(*history_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	var rec *recorder
+	if *record_file != "" {
+		rec, err = newRecorder(*record_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+	}
 
-			//check reply is as expected
-			if reply.ClientID != *id {
-				glog.Fatal("Response received has wrong ClientID: expected ",
-					*id, " ,received ", reply.ClientID)
+	// each logical client has its own connection and API
+	var wg sync.WaitGroup
+	stop := make(chan bool)
+	if *seed_addr != "" && *membership_refresh > 0 {
+		go refreshMembership(*seed_addr, book, *membership_refresh, timeout, stop)
+	}
+	startReplay(replays, stop)
+	if status != nil {
+		go status.Run(*status_file, *status_interval, stop)
+	}
+	var verified []*test.Generator
+	var seeds []int64
+	cs := newClients(*id, *clients, conf, timeout, stats, *connect_concurrency)
+	for i, c := range cs {
+		c.reads = reads
+		c.order = order
+		c.transforms = transforms
+		c.status = status
+		c.connected()
+		c.limiter = limiter
+		c.queue = queue
+		c.timeouts = timeouts
+		c.metrics = clientMetrics
+		c.inflight = inflight
+		c.statsd = statsd
+		c.influx = influx
+		c.events = events
+		c.cancel = cancel
+		c.recent = recent
+		c.record = rec
+		c.history = hist
+		c.defaultMetadata = metadata
+		c.metadata = metadata
+		c.defaultConsistency = consistency
+		c.stop = stop
+		c.pause = pause
+		c.perRequest = *conn_mode == "perrequest"
+		c.maxPerConn = *max_reqs_per_conn
+		c.auth = auth
+		c.book = book
+		c.dedup = dedup
+		c.fast = fast
+		c.reconnects = reconnects
+		c.timeline = tl
+		c.hdr = hdr
+		c.retry = retry
+		c.control = control
+		if *hedge {
+			c.hedge = newHedger(*hedge_percentile, timeout)
+		}
+		if *monotonic_reads {
+			c.monotonic = newMonotonicReads()
+			monotonic = append(monotonic, c.monotonic)
+		}
+		if *warm_pool > 0 {
+			c.warm = newWarmPool(*warm_pool, c.addrs)
+			c.warm.SetLeader(c.leader)
+		}
+		if shadowStats != nil {
+			c.shadow = newShadow(c.id, shadowConf, shadowStats)
+			c.compare = *compare_config != ""
+			shadows = append(shadows, c.shadow)
+		}
+		var ioapi API
+		if replays != nil {
+			ioapi = replays[i]
+		} else {
+			ioapi = createAPI(*mode)
+		}
+		for _, g := range generators(ioapi) {
+			seeds = append(seeds, g.Seed())
+			if *verify {
+				g.Verify = true
+				verified = append(verified, g)
 			}
-			if reply.RequestID != requestID {
-				glog.Fatal("Response received has wrong RequestID: expected ",
-					requestID, " ,received ", reply.RequestID)
+			if *mode == "saturate" {
+				// the ramp decides when to stop
+				g.Requests = -1
 			}
-
-			// write to latency to log
-			latency := strconv.FormatInt(time.Since(startTime).Nanoseconds(), 10)
-			err = stats.Write([]string{startTime.String(), strconv.Itoa(requestID), latency, strconv.Itoa(tries)})
-			if err != nil {
-				glog.Fatal(err)
+			if queue != nil {
+				// arrivals set the pace in open loop mode
+				g.Think = nil
 			}
-			stats.Flush()
-			// TODO: call error to check if successful
-
-			requestID++
-			// writing result to user
-			// time.Since(startTime)
-			ioapi.Return(reply.Response)
-
 		}
+		wg.Add(1)
+		go func() {
+			if *start_jitter > 0 {
+				delay := startDelay(*start_jitter, c.id)
+				glog.Info("Client ", c.id, " delaying start by ", delay)
+				time.Sleep(delay)
+			}
+			c.warmup(*conn_warmup)
+			c.run(ioapi)
+			if c.warm != nil {
+				c.warm.Close()
+			}
+			wg.Done()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		finish <- true
 	}()
 
+	glog.Info("Client is ready to start processing incoming requests")
+	runStart := time.Now()
+	deadline := runDeadline(*run_duration)
+	rampDone := make(chan bool)
+	if *mode == "saturate" {
+		go func() {
+			steps, knee, interrupted := ramp(os.Stdout, queue, clientMetrics, *ramp_step, *step_duration, *ramp_steps, *latency_slo, stop)
+			fmt.Println(rampReport(steps, knee, interrupted))
+			close(rampDone)
+		}()
+	}
 	select {
 	case sig := <-sigs:
-		glog.Warning("Termination due to: ", sig)
+		glog.Warning("Termination due to: ", sig, ", signal again to exit immediately")
+		go forceExit(sigs, os.Exit)
+		finished := false
+		if queue != nil {
+			var dropped int
+			dropped, finished = shutdownQueue(queue, *shutdown_drain, finish)
+			glog.Info(dropped, " queued requests were dropped at shutdown")
+			fmt.Printf("Open loop: %d queued requests dropped at shutdown, %d dropped as the queue was full\n",
+				dropped, queue.Overflow())
+		}
+		// give clients a chance to finish their current request before
+		// the stat file is closed
+		close(stop)
+		if !finished {
+			select {
+			case <-finish:
+			case <-time.After(timeout + time.Second):
+				glog.Warning("Clients did not stop in time")
+			}
+		}
+	case <-deadline:
+		glog.Info("Run duration of ", *run_duration, " reached")
+		go forceExit(sigs, os.Exit)
+		if queue != nil {
+			// arrivals after the deadline are not sent
+			queue.Close()
+			glog.Info(queue.Drop(), " queued requests were dropped at the end of the run")
+		}
+		close(stop)
+		select {
+		case <-finish:
+		case <-time.After(timeout + time.Second):
+			glog.Warning("Clients did not stop in time")
+		}
+	case <-rampDone:
+		glog.Info("Saturation ramp complete")
+		go forceExit(sigs, os.Exit)
+		queue.Close()
+		queue.Drop()
+		close(stop)
+		select {
+		case <-finish:
+		case <-time.After(timeout + time.Second):
+			glog.Warning("Clients did not stop in time")
+		}
 	case <-finish:
 		glog.Info("No more commands")
+		go forceExit(sigs, os.Exit)
+		if queue != nil {
+			queue.Close()
+			glog.Info("Shutting down with ", queue.Depth(), " queued requests, ",
+				queue.Overflow(), " were dropped as the queue was full")
+		}
+		if faults != nil {
+			fmt.Printf("Fault test complete: %d requests completed after %d injected faults and %d reconnects\n",
+				clientMetrics.Requests(), faults.Injected(), faults.Reconnects())
+		}
+	}
+	elapsed := time.Since(runStart)
+	summary := clientMetrics.Summary(elapsed)
+	glog.Info(summary)
+	if sink != nil {
+		sink.Notice(summary)
+	}
+	if *mode == "test" || *mode == "faulttest" || *mode == "null" || *mode == "replay" {
+		fmt.Println(summary)
+	}
+	err = stats.Close()
+	if err != nil {
+		glog.Warning(err)
+	}
+	influx.Close()
+	events.Close()
+	// profiles of a spike just before stopping are written in full
+	autoProfile.Wait()
+	if rec != nil {
+		if err = rec.Close(); err != nil {
+			glog.Warning(err)
+		}
+	}
+	if hist != nil {
+		if err = hist.Close(); err != nil {
+			glog.Warning(err)
+		}
+	}
+	compared, diverged := 0, 0
+	for _, s := range shadows {
+		s.Close(time.Second)
+		compared += s.Compared()
+		diverged += s.Diverged()
+	}
+	if *compare_config != "" {
+		fmt.Printf("Comparison complete: %d of %d reads compared had different responses\n", diverged, compared)
+	}
+	if *metrics_dump != "" {
+		writeMetricsDump(*metrics_dump, clientMetrics)
+	}
+	if status != nil {
+		if err = status.Write(*status_file, "stopped"); err != nil {
+			glog.Warning("Unable to write status file: ", err)
+		}
+	}
+	if tl != nil {
+		writeTimeline(*throughput_timeline, tl)
+	}
+	if hdr != nil {
+		writeHDR(*hdr_file, hdr)
+	}
+	var samples []time.Duration
+	if runSamples != nil {
+		samples = runSamples.Take()
+	}
+	if *summary_file != "" {
+		writeSummary(*summary_file, newRunSummary(clientMetrics, samples, runStart, elapsed, conf, seeds))
+	}
+	failed := false
+	if len(slos) > 0 {
+		violations := checkSLOs(samples, slos)
+		for _, v := range violations {
+			fmt.Println("SLO failed:", v)
+		}
+		if len(violations) == 0 {
+			fmt.Println("SLOs met")
+		}
+		failed = len(violations) > 0
+	}
+	if *monotonic_reads {
+		checked, violations := 0, 0
+		for _, m := range monotonic {
+			checked += m.Checked()
+			violations += m.Violations()
+		}
+		fmt.Printf("Monotonic reads check complete: %d of %d reads in sessions returned an older version\n", violations, checked)
+		failed = failed || violations > 0
+	}
+	if *verify {
+		checked, mismatches := 0, 0
+		for _, g := range verified {
+			c, m := g.Verified()
+			checked += c
+			mismatches += m
+		}
+		fmt.Printf("Verification complete: %d of %d responses checked did not match\n", mismatches, checked)
+		failed = failed || mismatches > 0
 	}
 	glog.Flush()
+	stopSyslog()
+	if failed {
+		os.Exit(1)
+	}
 
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// coalescer merges identical concurrent reads, so only one request is sent
+// and all callers share its response, as a caching layer would.
+// It is safe for concurrent access
+type coalescer struct {
+	calls     map[string]*call
+	coalesced int64
+	sync.Mutex
+}
+
+// call is an in-progress request, which other callers may wait on
+type call struct {
+	wg       sync.WaitGroup
+	response string
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: map[string]*call{}}
+}
+
+// Do calls fn unless there is already an identical call in progress, in
+// which case it waits for and returns its response. shared is true if the
+// response came from another call.
+func (co *coalescer) Do(key string, fn func() string) (response string, shared bool) {
+	co.Lock()
+	if c, ok := co.calls[key]; ok {
+		co.Unlock()
+		atomic.AddInt64(&co.coalesced, 1)
+		c.wg.Wait()
+		return c.response, true
+	}
+	c := new(call)
+	c.wg.Add(1)
+	co.calls[key] = c
+	co.Unlock()
+
+	c.response = fn()
+	c.wg.Done()
+
+	co.Lock()
+	delete(co.calls, key)
+	co.Unlock()
+	return c.response, false
+}
+
+// Coalesced returns the number of requests which shared another's response
+func (co *coalescer) Coalesced() int {
+	return int(atomic.LoadInt64(&co.coalesced))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// check that many identical concurrent reads result in a single request
+func TestCoalesceIdenticalReads(t *testing.T) {
+	co := newCoalescer()
+	release := make(chan bool)
+	var requests int64
+
+	readers := 20
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _ := co.Do("get A", func() string {
+				atomic.AddInt64(&requests, 1)
+				<-release
+				return "7"
+			})
+			if res != "7" {
+				t.Errorf("Coalesced read returned %s but 7 was expected", res)
+			}
+		}()
+	}
+
+	// give all readers time to join the in-progress request
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if requests != 1 {
+		t.Errorf("%d requests were sent but 1 was expected", requests)
+	}
+	if co.Coalesced() != readers-1 {
+		t.Errorf("%d requests were coalesced but %d was expected", co.Coalesced(), readers-1)
+	}
+}
+
+func TestCoalesceDistinctReads(t *testing.T) {
+	co := newCoalescer()
+	for _, key := range []string{"get A", "get B", "get A"} {
+		_, shared := co.Do(key, func() string { return "0" })
+		if shared {
+			t.Errorf("Sequential read %s was coalesced", key)
+		}
+	}
+	if co.Coalesced() != 0 {
+		t.Errorf("%d requests were coalesced but 0 was expected", co.Coalesced())
+	}
+}
+
+// check that identical concurrent reads from several clients result in a
+// single request to the server, sent by one client
+func TestClientsCoalesceReads(t *testing.T) {
+	server := newFakeServer(t, 200*time.Millisecond)
+	apis := make([]*oneCommand, 10)
+	for i := range apis {
+		apis[i] = &oneCommand{text: "get A"}
+	}
+	cs := runClients(t, server.addr, apis, nil)
+
+	if n := len(server.Received()); n != 1 {
+		t.Errorf("Server received %d requests but 1 was expected", n)
+	}
+	sent := 0
+	for i, c := range cs {
+		if c.requestID == 2 {
+			sent++
+		} else if c.requestID != 1 {
+			t.Errorf("Client %d request ID is %d", i, c.requestID)
+		}
+		if apis[i].response != "0" {
+			t.Errorf("Client %d received '%s' but 0 was expected", i, apis[i].response)
+		}
+	}
+	if sent != 1 {
+		t.Errorf("%d clients sent the read but 1 was expected", sent)
+	}
+}
+
+// check that identical concurrent writes are never coalesced
+func TestClientsDoNotCoalesceWrites(t *testing.T) {
+	server := newFakeServer(t, 200*time.Millisecond)
+	apis := make([]*oneCommand, 5)
+	for i := range apis {
+		apis[i] = &oneCommand{text: "update A 7", replicate: true}
+	}
+	cs := runClients(t, server.addr, apis, nil)
+
+	if n := len(server.Received()); n != len(apis) {
+		t.Errorf("Server received %d requests but %d were expected", n, len(apis))
+	}
+	for i, c := range cs {
+		if c.requestID != 2 {
+			t.Errorf("Client %d request ID is %d but 2 was expected", i, c.requestID)
+		}
+	}
+}
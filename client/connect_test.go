@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// reserve a local address which nothing is listening on yet
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// check the client connects to a server which comes up after it starts
+func TestConnectAtStartup(t *testing.T) {
+	addr := freeAddr(t)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, leader, err := connectAtStartup([]string{addr}, 5*time.Second)
+	if err != nil {
+		t.Fatal("Client failed to connect to delayed server: ", err)
+	}
+	conn.Close()
+	if leader != 0 {
+		t.Errorf("Connected to server %d but 0 was expected", leader)
+	}
+}
+
+func TestConnectAtStartupDeadline(t *testing.T) {
+	start := time.Now()
+	_, _, err := connectAtStartup([]string{freeAddr(t)}, 300*time.Millisecond)
+	if err == nil {
+		t.Fatal("Client connected to a server that is not running")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Startup retries took %s, beyond the deadline", time.Since(start))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// check that connections are reused or opened for each request, by mode
+func TestConnectionPerRequest(t *testing.T) {
+	for _, perRequest := range []bool{false, true} {
+		s := newFakeServer(t, 0)
+		c := newTestClient(t, s.addr)
+		filename := filepath.Join(t.TempDir(), "latency.csv")
+		stats, err := OpenStatsWriter(filename, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.stats = stats
+		c.perRequest = perRequest
+		api := &commandList{commands: []string{"get A", "get B", "get C"}}
+		c.run(api)
+		stats.Close()
+
+		conns, closed := 1, 0
+		if perRequest {
+			conns, closed = 3, 3
+		}
+		// wait for the server to see the last close
+		time.Sleep(10 * time.Millisecond)
+		s.Lock()
+		if s.conns != conns || s.closed != closed {
+			t.Errorf("per request %t: %d connections opened and %d closed, %d and %d were expected",
+				perRequest, s.conns, s.closed, conns, closed)
+		}
+		s.Unlock()
+
+		// the first request uses the connection made at startup
+		for i, record := range readStats(t, filename, "") {
+			setup, err := strconv.ParseInt(record[5], 10, 64)
+			if err != nil || (setup > 0) != (perRequest && i > 0) {
+				t.Errorf("per request %t: request %d has connection setup time %s", perRequest, i, record[5])
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+)
+
+var read_consistency = flag.String("consistency", "linearizable", "Consistency of reads which the API does not set: linearizable, lease or stale, to send them to any replica")
+
+// ConsistencyAPI is implemented by APIs which set the consistency of their
+// reads per command
+type ConsistencyAPI interface {
+	// Consistency returns the consistency level of the last command from
+	// Next, or "" if it is linearizable or not set
+	Consistency() msgs.Consistency
+}
+
+// requestConsistency returns the consistency of the current command, that
+// given by the API if any, or the client's otherwise
+func (c *client) requestConsistency(ioapi API) msgs.Consistency {
+	if capi, ok := ioapi.(ConsistencyAPI); ok {
+		if consistency := capi.Consistency(); consistency != "" {
+			return consistency
+		}
+	}
+	return c.defaultConsistency
+}
+
+// serverConn is a connection to the server at index server
+type serverConn struct {
+	conn   net.Conn
+	rd     *bufio.Reader
+	server int
+}
+
+// useReplica moves the client onto its connection to a server other than
+// the leader, for a stale read, and returns a func which moves it back. The
+// replica's connection is kept for later stale reads. If no other server
+// can be reached, the read is sent to the leader
+func (c *client) useReplica() func() {
+	leader := serverConn{c.conn, c.rd, c.leader}
+	addrs := c.addrs()
+	if c.replica == nil || c.replica.server == c.leader {
+		if c.replica != nil {
+			c.replica.conn.Close()
+			c.replica = nil
+		}
+		conn, server, err := connect(addrs, 1, (c.leader+1)%len(addrs))
+		if err != nil || server == c.leader%len(addrs) {
+			if err == nil {
+				conn.Close()
+			}
+			glog.Warning("No replica other than the leader for stale reads")
+			return func() {}
+		}
+		c.replica = &serverConn{conn, bufio.NewReader(conn), server}
+	}
+	glog.Info("Sending stale read of client ", c.id, " to server ", c.replica.server)
+	c.conn, c.rd, c.leader = c.replica.conn, c.replica.rd, c.replica.server
+	return c.moveBack(leader, &c.replica)
+}
+
+// moveBack returns a func which moves the client back to leader after a
+// read sent on another connection, keeping the connection the read ended on
+// in kept for later reads, unless it is to the leader's server
+func (c *client) moveBack(leader serverConn, kept **serverConn) func() {
+	return func() {
+		// the read may have moved server on failure, or closed its connection
+		*kept = nil
+		if c.conn != nil && c.conn != leader.conn {
+			if c.leader != leader.server {
+				*kept = &serverConn{c.conn, c.rd, c.leader}
+			} else {
+				c.conn.Close()
+			}
+		}
+		c.conn, c.rd, c.leader = leader.conn, leader.rd, leader.server
+		if c.warm != nil {
+			c.warm.SetLeader(c.leader)
+		}
+	}
+}
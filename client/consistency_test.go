@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"testing"
+	"time"
+)
+
+// API issuing a list of reads, each with a consistency level
+type consistencyList struct {
+	commandList
+	levels []msgs.Consistency
+}
+
+func (l *consistencyList) Consistency() msgs.Consistency {
+	return l.levels[len(l.responses)-1]
+}
+
+func (l *consistencyList) Next() (string, bool, bool) {
+	text, replicate, ok := l.commandList.Next()
+	if ok {
+		// the level is of the command returned, until its response
+		l.responses = append(l.responses, "")
+	}
+	return text, replicate, ok
+}
+
+func (l *consistencyList) Return(str string) {
+	l.responses[len(l.responses)-1] = str
+}
+
+func (l *consistencyList) ReturnStream(chunks chan string) {
+	l.Return(reassemble(chunks))
+}
+
+// check stale reads are sent to a replica, and other reads to the leader
+func TestConsistencyRouting(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0)}
+	c := newTestClient(t, servers[0].addr, servers[1].addr)
+	api := &consistencyList{
+		commandList: commandList{commands: []string{"get A", "get B", "get C", "get D", "get E"}},
+		levels: []msgs.Consistency{msgs.ConsistencyLinearizable, msgs.ConsistencyStale, msgs.ConsistencyLease,
+			msgs.ConsistencyStale, msgs.ConsistencyLinearizable}}
+	c.run(api)
+
+	expected := [][]string{{"get A", "get C", "get E"}, {"get B", "get D"}}
+	for i, server := range servers {
+		received := server.Received()
+		if len(received) != len(expected[i]) {
+			t.Fatalf("Server %d received %v, expected %v", i, received, expected[i])
+		}
+		for j, req := range received {
+			if req.Request != expected[i][j] {
+				t.Errorf("Server %d received %q, expected %q", i, req.Request, expected[i][j])
+			}
+			if (req.Consistency == msgs.ConsistencyStale) != (i == 1) {
+				t.Errorf("Server %d received %q with consistency %q", i, req.Request, req.Consistency)
+			}
+		}
+	}
+	if c.leader != 0 {
+		t.Errorf("Client moved to server %d after stale reads, expected to stay on the leader", c.leader)
+	}
+	// the replica's connection is kept for later stale reads
+	servers[1].Lock()
+	if servers[1].conns != 1 {
+		t.Errorf("Replica accepted %d connections, expected 1", servers[1].conns)
+	}
+	servers[1].Unlock()
+}
+
+// check writes are always sent to the leader, whatever the client's level
+func TestConsistencyWrites(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0)}
+	c := newTestClient(t, servers[0].addr, servers[1].addr)
+	c.defaultConsistency = msgs.ConsistencyStale
+	api := &commandList{commands: []string{"update A 1", "update B 2"}, replicate: true}
+	c.run(api)
+
+	received := servers[0].Received()
+	if len(received) != 2 || len(servers[1].Received()) != 0 {
+		t.Fatalf("Leader received %d writes and replica %d, expected 2 and 0", len(received), len(servers[1].Received()))
+	}
+	for _, req := range received {
+		if req.Consistency != msgs.ConsistencyLinearizable {
+			t.Errorf("Write %q sent with consistency %q", req.Request, req.Consistency)
+		}
+	}
+}
+
+// check stale reads go to the leader if there is no other server
+func TestConsistencyNoReplica(t *testing.T) {
+	server := newFakeServer(t, 0)
+	c := newTestClient(t, server.addr)
+	c.consistency = msgs.ConsistencyStale
+	done := make(chan string)
+	go func() { done <- c.submit("get A", false) }()
+	select {
+	case response := <-done:
+		if response != "0" || len(server.Received()) != 1 {
+			t.Errorf("Stale read without a replica returned %q", response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stale read without a replica did not complete")
+	}
+}
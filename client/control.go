@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/config"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var control_conn = flag.Bool("controlconn", false, "Keep a connection to the master for control queries, such as :members, apart from those for requests, instead of connecting for each query")
+
+// ControlAPI is implemented by APIs which can query the cluster, rather
+// than sending it commands
+type ControlAPI interface {
+	// Control returns the control query of the last command from Next, such
+	// as "members", or "" if it was not one
+	Control() string
+}
+
+// controlConn is a connection to the master for control queries, kept apart
+// from the connections requests are sent on, so that queries neither queue
+// behind requests nor hold them up. It connects when first used, and
+// follows the master as it moves. It is safe for concurrent access, queries
+// being sent one at a time
+type controlConn struct {
+	addrs   func() []string
+	tries   int
+	timeout time.Duration
+	conn    net.Conn // nil until connected
+	rd      *bufio.Reader
+	master  int // server connected to, or to connect to first
+	sync.Mutex
+}
+
+func newControlConn(addrs func() []string, tries int, timeout time.Duration) *controlConn {
+	return &controlConn{addrs: addrs, tries: tries, timeout: timeout}
+}
+
+// Membership queries the master for the membership of the cluster,
+// following redirects from other servers to it. If the connection was
+// kept from an earlier query and has since failed, it is reconnected
+func (cc *controlConn) Membership() (*msgs.MembershipResponse, error) {
+	cc.Lock()
+	defer cc.Unlock()
+	b, err := msgs.MembershipRequestToBytes(msgs.MembershipRequest{ClientID: *id})
+	if err != nil {
+		return nil, err
+	}
+	addrs := cc.addrs()
+	reused := cc.conn != nil
+	for redirects := 0; redirects <= len(addrs); {
+		if cc.conn == nil {
+			conn, master, err := connect(addrs, cc.tries, cc.master%len(addrs))
+			if err != nil {
+				return nil, err
+			}
+			cc.conn, cc.rd, cc.master = conn, bufio.NewReader(conn), master
+		}
+		replyBytes, err := dispatcher(b, cc.conn, cc.rd, cc.timeout)
+		if err != nil {
+			cc.close()
+			if reused {
+				glog.Warning("Control connection failed, reconnecting: ", err)
+				reused = false
+				continue
+			}
+			return nil, err
+		}
+		reply := new(msgs.MembershipResponse)
+		if err = msgs.Unmarshal(replyBytes, reply); err != nil {
+			cc.close()
+			return nil, err
+		}
+
+		if reply.MasterID == reply.SenderID {
+			return reply, nil
+		}
+		if reply.MasterID < 0 || reply.MasterID >= len(addrs) {
+			glog.Warning("Master ", reply.MasterID, " is not in the client config, using reply from ", reply.SenderID)
+			return reply, nil
+		}
+		glog.Info("Node ", reply.SenderID, " is not the master, redirecting to ", addrs[reply.MasterID])
+		cc.close()
+		cc.master = reply.MasterID
+		redirects++
+	}
+	return nil, fmt.Errorf("%w: too many membership redirects", ErrNoLeader)
+}
+
+// close the connection, if any, with the lock held
+func (cc *controlConn) close() {
+	if cc.conn != nil {
+		cc.conn.Close()
+		cc.conn, cc.rd = nil, nil
+	}
+}
+
+// Close the connection, a later query reconnects
+func (cc *controlConn) Close() {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.close()
+}
+
+// runControl runs a control query from the API, on the shared control
+// connection if there is one, or a connection for the query otherwise, and
+// returns its result
+func (c *client) runControl(query string) string {
+	if words := strings.Fields(query); len(words) == 2 && (words[0] == "drain" || words[0] == "undrain") {
+		return c.drainServer(words[1], words[0] == "drain")
+	}
+	cc := c.control
+	if cc == nil {
+		cc = newControlConn(c.addrs, c.conf.Parameters.Retries, c.timeout)
+		defer cc.Close()
+	}
+	switch query {
+	case "members":
+		reply, err := cc.Membership()
+		if err != nil {
+			glog.Warning("Membership query failed: ", err)
+			return err.Error()
+		}
+		var conf config.Config
+		conf.Addresses.Address = c.addrs()
+		var b strings.Builder
+		printMembership(&b, reply, conf)
+		return b.String()
+	}
+	return "Unknown control query: " + query
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check that control queries are answered at once, while the data
+// connection is saturated by slow requests, and that the control
+// connection is kept between queries and reconnected if it fails
+func TestControlConn(t *testing.T) {
+	// slow enough that a query behind a request would take far longer than
+	// one answered at once, however loaded the machine running the test
+	delay := 200 * time.Millisecond
+	server := newFakeServer(t, delay)
+	server.members = []msgs.Member{{ID: 0, Address: "127.0.0.1:8090", Role: "master", Live: true}}
+	c := newTestClient(t, server.addr)
+	control := newControlConn(c.addrs, 1, time.Second)
+	defer control.Close()
+
+	api := &commandList{commands: make([]string, 5), replicate: true}
+	for i := range api.commands {
+		api.commands[i] = "update A 1"
+	}
+	done := make(chan bool)
+	go func() {
+		c.run(api)
+		close(done)
+	}()
+	queries := 0
+	for running := true; running; queries++ {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if queries == 5 {
+			// the next query reconnects
+			control.Lock()
+			control.conn.Close()
+			control.Unlock()
+		}
+		start := time.Now()
+		reply, err := control.Membership()
+		if err != nil || len(reply.Members) != 1 {
+			t.Fatalf("Query %d returned %v, %v", queries, reply, err)
+		}
+		if elapsed := time.Since(start); elapsed > delay/2 {
+			t.Errorf("Query %d took %v, behind requests", queries, elapsed)
+		}
+	}
+	if queries < 10 {
+		t.Errorf("Only %d queries ran during the requests", queries)
+	}
+	for i, response := range api.responses {
+		if response != "0" {
+			t.Errorf("Response %d was %q", i, response)
+		}
+	}
+	server.Lock()
+	conns := server.conns
+	server.Unlock()
+	if conns != 3 {
+		t.Errorf("Server accepted %d connections, expected the client's and 2 for control", conns)
+	}
+
+	// a client without a control connection connects for the query
+	if out := c.runControl("members"); !strings.Contains(out, "127.0.0.1:8090") || !strings.Contains(out, "master") {
+		t.Errorf("Members were %q", out)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+)
+
+// newCorrelation generates an opaque token for one try of a request, which
+// the server echoes in its reply
+func newCorrelation() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		glog.Warning("Unable to generate correlation token: ", err)
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+// correlate gives req a new correlation token, so that a late reply to an
+// earlier try, which has the same RequestID, is not taken for its reply.
+// The request is signed again, as the signature covers the token
+func (c *client) correlate(req *msgs.ClientRequest) {
+	req.Correlation = newCorrelation()
+	c.correlation = req.Correlation
+	if secret != nil {
+		msgs.Sign(req, secret)
+	}
+}
+
+// uncorrelated reports whether reply is to another try than the one with
+// the correlation token. Servers which do not echo tokens are matched on
+// RequestID alone
+func uncorrelated(reply *msgs.ClientResponse, correlation string) bool {
+	return correlation != "" && reply.Correlation != "" && reply.Correlation != correlation
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+// check that replies are matched to the try they answer, even though all
+// tries of a request have the same RequestID
+func TestCorrelation(t *testing.T) {
+	cases := []struct {
+		drop         int // tries dropped by the server
+		retried      int
+		uncorrelated bool
+		sent         int // requests received by the server
+	}{
+		{0, 0, false, 1},
+		{0, 1, false, 1},
+		{1, 0, false, 2},
+		{1, 1, false, 2},
+		{1, 0, true, 2},
+	}
+
+	for i, test := range cases {
+		s := newFakeServer(t, 0)
+		s.drop = test.drop
+		s.retried = test.retried
+		s.uncorrelated = test.uncorrelated
+		c := newTestClient(t, s.addr)
+		response := c.submit("get A", false)
+
+		if response != "0" {
+			t.Errorf("case %d: response was %q", i, response)
+		}
+		received := s.Received()
+		if len(received) != test.sent {
+			t.Fatalf("case %d: server received %d requests but %d were expected", i, len(received), test.sent)
+		}
+		seen := make(map[string]bool)
+		for _, req := range received {
+			if req.RequestID != received[0].RequestID {
+				t.Errorf("case %d: retry has RequestID %d, not %d", i, req.RequestID, received[0].RequestID)
+			}
+			if req.Correlation == "" || seen[req.Correlation] {
+				t.Errorf("case %d: try has correlation token %q, which is not new", i, req.Correlation)
+			}
+			seen[req.Correlation] = true
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var crash_dump = flag.String("crashdump", "", "File to dump the most recent requests and responses to, if the client fails")
+var crash_dump_size = flag.Int("crashdumpsize", 100, "Number of recent requests kept for -crashdump")
+
+// exit logs args and exits, it is replaced by tests
+var exit = func(args ...interface{}) { glog.FatalDepth(2, args...) }
+
+type recentRequest struct {
+	start     time.Time
+	clientID  int
+	requestID int
+	request   string
+	response  string
+}
+
+// recentRequests is a ring buffer of the most recently completed requests,
+// which is safe for concurrent access without locking
+type recentRequests struct {
+	slots []atomic.Value
+	next  int64
+}
+
+func newRecentRequests(size int) *recentRequests {
+	return &recentRequests{slots: make([]atomic.Value, size)}
+}
+
+// Add records a request, replacing the oldest if the buffer is full
+func (r *recentRequests) Add(req recentRequest) {
+	i := atomic.AddInt64(&r.next, 1) - 1
+	r.slots[i%int64(len(r.slots))].Store(req)
+}
+
+// Recent returns the recorded requests, oldest first
+func (r *recentRequests) Recent() []recentRequest {
+	next := atomic.LoadInt64(&r.next)
+	start := next - int64(len(r.slots))
+	if start < 0 {
+		start = 0
+	}
+	var recent []recentRequest
+	for i := start; i < next; i++ {
+		if req, ok := r.slots[i%int64(len(r.slots))].Load().(recentRequest); ok {
+			recent = append(recent, req)
+		}
+	}
+	return recent
+}
+
+// Dump writes the recent requests to filename, after why the client failed
+func (r *recentRequests) Dump(filename string, why string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		glog.Warning("Unable to write crash dump: ", err)
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, "# client failed:", why)
+	for _, req := range r.Recent() {
+		fmt.Fprintf(file, "%s client %d request %d: %q => %q\n",
+			wallTime(req.start), req.clientID, req.requestID, req.request, req.response)
+	}
+	glog.Info("Dumped recent requests to ", filename)
+}
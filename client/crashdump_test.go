@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/heidi-ann/hydra/msgs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecentRequests(t *testing.T) {
+	r := newRecentRequests(3)
+	for i := 1; i <= 5; i++ {
+		r.Add(recentRequest{requestID: i})
+		recent := r.Recent()
+		first := i - 2
+		if first < 1 {
+			first = 1
+		}
+		if len(recent) != i-first+1 || recent[0].requestID != first || recent[len(recent)-1].requestID != i {
+			t.Errorf("After %d requests, recent requests are %v", i, recent)
+		}
+	}
+}
+
+// check that a fatal reply mismatch dumps the requests leading up to it
+func TestCrashDump(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "crash.txt")
+	defer func(f string) { *crash_dump = f }(*crash_dump)
+	*crash_dump = filename
+	defer func(e func(...interface{})) { exit = e }(exit)
+	exit = func(args ...interface{}) { panic(fmt.Sprint(args...)) }
+
+	s := newFakeServer(t, 0)
+	s.response = "42"
+	c := newTestClient(t, s.addr)
+	c.recent = newRecentRequests(2)
+	for _, command := range []string{"get A", "get B", "get C"} {
+		c.submit(command, false)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Mismatched reply did not fail the client")
+			}
+		}()
+		c.checkReply(&msgs.ClientResponse{ClientID: c.id, RequestID: c.requestID + 1, Response: "42", Status: msgs.StatusOK})
+	}()
+
+	dump, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(dump)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "wrong RequestID") ||
+		!strings.HasSuffix(lines[1], `request 2: "get B" => "42"`) ||
+		!strings.HasSuffix(lines[2], `request 3: "get C" => "42"`) {
+		t.Errorf("Crash dump is:\n%s", dump)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// OperationAPI is implemented by APIs which give commands an operation ID,
+// so that accidental resubmissions can be deduplicated
+type OperationAPI interface {
+	// OperationID returns the operation ID of the last command from Next,
+	// or "" if it has none
+	OperationID() string
+}
+
+type dedupEntry struct {
+	response string
+	at       time.Time
+}
+
+// dedupCache holds the responses to recent operations, so that an operation
+// submitted again within window is not resent.
+// It is safe for concurrent access
+type dedupCache struct {
+	window  time.Duration
+	entries map[string]dedupEntry
+	sync.Mutex
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	return &dedupCache{window: window, entries: map[string]dedupEntry{}}
+}
+
+// Get returns the response to operation id, if it was submitted within the window
+func (d *dedupCache) Get(id string) (string, bool) {
+	d.Lock()
+	defer d.Unlock()
+	e, ok := d.entries[id]
+	if !ok || time.Since(e.at) > d.window {
+		return "", false
+	}
+	return e.response, true
+}
+
+// Put records the response to operation id, removing expired operations
+func (d *dedupCache) Put(id string, response string) {
+	d.Lock()
+	defer d.Unlock()
+	now := time.Now()
+	for k, e := range d.entries {
+		if now.Sub(e.at) > d.window {
+			delete(d.entries, k)
+		}
+	}
+	d.entries[id] = dedupEntry{response, now}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// API issuing commands with operation IDs
+type operations struct {
+	commandList
+	ids   []string
+	pause time.Duration // between commands
+}
+
+func (o *operations) Next() (string, bool, bool) {
+	if len(o.responses) > 0 {
+		time.Sleep(o.pause)
+	}
+	return o.commandList.Next()
+}
+
+func (o *operations) OperationID() string {
+	return o.ids[len(o.responses)]
+}
+
+func TestDedup(t *testing.T) {
+	cases := []struct {
+		ids   []string
+		pause time.Duration
+		sent  int
+	}{
+		{[]string{"a", "b", "c"}, 0, 3},
+		{[]string{"a", "a", "b"}, 0, 2},
+		{[]string{"", "", ""}, 0, 3},
+		{[]string{"a", "a", "a"}, 0, 1},
+		{[]string{"a", "a", "a"}, 60 * time.Millisecond, 3},
+	}
+	for i, test := range cases {
+		s := newFakeServer(t, 0)
+		c := newTestClient(t, s.addr)
+		c.dedup = newDedupCache(50 * time.Millisecond)
+		api := &operations{commandList{commands: []string{"update A 1", "update A 1", "update B 2"}, replicate: true}, test.ids, test.pause}
+		c.run(api)
+
+		if !reflect.DeepEqual(api.responses, []string{"0", "0", "0"}) {
+			t.Errorf("case %d: responses were %v", i, api.responses)
+		}
+		if n := len(s.Received()); n != test.sent {
+			t.Errorf("case %d: %d requests sent but %d were expected", i, n, test.sent)
+		}
+	}
+}
+
+// check that operations which are not deduplicated are submitted as others
+// are, here compared with the shadow
+func TestDedupCompared(t *testing.T) {
+	primary := newFakeServer(t, 0)
+	second := newFakeServer(t, 0)
+	second.response = "1"
+	shadowStats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "compare.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf config.Config
+	conf.Addresses.Address = []string{second.addr}
+	conf.Parameters.Retries = 1
+	conf.Parameters.Timeout = 1000
+
+	c := newTestClient(t, primary.addr)
+	c.dedup = newDedupCache(time.Second)
+	c.shadow = newShadow(0, conf, shadowStats)
+	c.compare = true
+	api := &operations{commandList{commands: []string{"get A", "get A", "get B"}}, []string{"a", "a", "b"}, 0}
+	c.run(api)
+	c.shadow.Close(5 * time.Second)
+	shadowStats.Close()
+
+	if !reflect.DeepEqual(api.responses, []string{"0", "0", "0"}) {
+		t.Errorf("Responses were %v", api.responses)
+	}
+	if c.shadow.Compared() != 2 || c.shadow.Diverged() != 2 {
+		t.Errorf("%d of %d reads diverged but 2 of 2 were expected", c.shadow.Diverged(), c.shadow.Compared())
+	}
+}
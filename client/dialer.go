@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"time"
+)
+
+// Dialer opens connections to servers, by resolved address. It is replaced
+// to inject faults, offer compressions, or, in tests, to connect over
+// in-memory pipes instead of TCP
+type Dialer interface {
+	Dial(addr string) (net.Conn, error)
+	DialTimeout(addr string, timeout time.Duration) (net.Conn, error)
+}
+
+// netDialer dials TCP connections
+type netDialer struct {
+	d net.Dialer
+}
+
+func (n netDialer) Dial(addr string) (net.Conn, error) {
+	return n.d.Dial("tcp", addr)
+}
+
+func (n netDialer) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	d := n.d
+	d.Timeout = timeout
+	return d.Dial("tcp", addr)
+}
+
+// keepalive keeps idle connections up, e.g. while paused
+var defaultDialer Dialer = netDialer{net.Dialer{KeepAlive: 15 * time.Second}}
+
+// dialer is used for all connections to servers
+var dialer = defaultDialer
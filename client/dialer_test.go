@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeDialer connects to fake servers over in-memory pipes, by address.
+// Addresses without a server are refused
+type pipeDialer struct {
+	t       *testing.T
+	servers map[string]*fakeServer
+}
+
+// newPipeServers starts n fake servers reachable only through the dialer,
+// which is used until the end of the test
+func newPipeServers(t *testing.T, n int, delay time.Duration) []*fakeServer {
+	p := &pipeDialer{t: t, servers: make(map[string]*fakeServer)}
+	servers := make([]*fakeServer, n)
+	for i := range servers {
+		// IP addresses are not resolved
+		servers[i] = &fakeServer{addr: fmt.Sprintf("192.0.2.%d:8090", i+1), delay: delay}
+		p.servers[servers[i].addr] = servers[i]
+	}
+	dialer = p
+	t.Cleanup(func() { dialer = defaultDialer })
+	return servers
+}
+
+func (p *pipeDialer) Dial(addr string) (net.Conn, error) {
+	s, ok := p.servers[addr]
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Err: errors.New("connection refused")}
+	}
+	client, server := net.Pipe()
+	s.Lock()
+	s.conns++
+	s.Unlock()
+	go s.handle(p.t, server)
+	return client, nil
+}
+
+func (p *pipeDialer) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	return p.Dial(addr)
+}
+
+// check the request loop runs over pipes, without any sockets
+func TestPipeDialer(t *testing.T) {
+	servers := newPipeServers(t, 1, 0)
+	c := newTestClient(t, servers[0].addr)
+	api := &commandList{commands: []string{"update A 1", "get A", "update B 2"}, replicate: true}
+	c.run(api)
+
+	if len(api.responses) != len(api.commands) {
+		t.Fatalf("Got %d responses to %d commands", len(api.responses), len(api.commands))
+	}
+	for i, response := range api.responses {
+		if response != "0" {
+			t.Errorf("Response to %q is %q, expected 0", api.commands[i], response)
+		}
+	}
+	if received := servers[0].Received(); len(received) != len(api.commands) {
+		t.Errorf("Server received %d requests, expected %d", len(received), len(api.commands))
+	}
+}
+
+// check the client fails over between servers connected by pipes
+func TestPipeDialerFailover(t *testing.T) {
+	servers := newPipeServers(t, 2, 0)
+	servers[0].drop = 1
+	c := newTestClient(t, servers[0].addr, servers[1].addr)
+	api := &commandList{commands: []string{"update A 1", "update A 2"}, replicate: true}
+	c.run(api)
+
+	if len(api.responses) != len(api.commands) {
+		t.Fatalf("Got %d responses to %d commands", len(api.responses), len(api.commands))
+	}
+	if received := servers[1].Received(); len(received) != len(api.commands) {
+		t.Errorf("Server 1 received %d requests after server 0 dropped the connection, expected %d", len(received), len(api.commands))
+	}
+}
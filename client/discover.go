@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var seed_addr = flag.String("seedaddr", "", "Address of a server to discover the cluster's members from on startup, instead of using the addresses in the config, which are used if discovery fails")
+var membership_refresh = flag.Duration("membershiprefresh", 30*time.Second, "With -seedaddr, how often to rediscover the cluster's members, 0 to only discover them on startup")
+
+// discover asks the server at seed for the membership of the cluster, and
+// returns the client address of each member
+func discover(seed string, timeout time.Duration) ([]string, error) {
+	conn, err := dialServer(seed)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	b, err := msgs.MembershipRequestToBytes(msgs.MembershipRequest{ClientID: *id})
+	if err != nil {
+		return nil, err
+	}
+	replyBytes, err := dispatcher(b, conn, bufio.NewReader(conn), timeout)
+	if err != nil {
+		return nil, err
+	}
+	reply := new(msgs.MembershipResponse)
+	if err = msgs.Unmarshal(replyBytes, reply); err != nil {
+		return nil, err
+	}
+	return clientAddresses(reply)
+}
+
+// clientAddresses returns the client address of each member, in order of
+// ID, so that servers are numbered as in the config. Members without a
+// client address, e.g. from servers without one configured, cannot be used
+func clientAddresses(reply *msgs.MembershipResponse) ([]string, error) {
+	if len(reply.Members) == 0 {
+		return nil, fmt.Errorf("%w: membership has no members", ErrDiscovery)
+	}
+	members := append([]msgs.Member{}, reply.Members...)
+	sort.SliceStable(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	addrs := make([]string, len(members))
+	for i, m := range members {
+		if m.ClientAddress == "" {
+			return nil, fmt.Errorf("%w: member %d has no client address, it may not be in the [clients] of the server config", ErrDiscovery, m.ID)
+		}
+		addrs[i] = m.ClientAddress
+	}
+	return addrs, nil
+}
+
+// discoverAny discovers the members from the first of seeds which replies
+func discoverAny(seeds []string, timeout time.Duration) ([]string, error) {
+	err := fmt.Errorf("%w: no servers to discover members from", ErrDiscovery)
+	for _, seed := range seeds {
+		var addrs []string
+		if addrs, err = discover(seed, timeout); err == nil {
+			return addrs, nil
+		}
+		glog.Warning("Unable to discover members from ", seed, ": ", err)
+	}
+	return nil, err
+}
+
+// refreshMembership rediscovers the members every interval, into book,
+// until stop is closed. The seed is asked first, then the current members,
+// so that the cluster is still followed if the seed leaves. If none reply,
+// the addresses are left as they are
+func refreshMembership(seed string, book *addressBook, interval time.Duration, timeout time.Duration, stop <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		current := book.Get()
+		addrs, err := discoverAny(append([]string{seed}, current...), timeout)
+		if err != nil {
+			glog.Warning("Not refreshing membership: ", err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, current) {
+			glog.Info("Membership changed to ", addrs)
+			book.Set(addrs)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// check the client addresses of the members are discovered from a seed, in
+// order of ID
+func TestDiscover(t *testing.T) {
+	seed := newFakeServer(t, 0)
+	seed.members = []msgs.Member{
+		{ID: 1, Address: "10.0.0.2:8090", Role: "participant", ClientAddress: "10.0.0.2:8080"},
+		{ID: 0, Address: "10.0.0.1:8090", Role: "master", ClientAddress: seed.addr},
+		{ID: 2, Address: "10.0.0.3:8090", Role: "participant", ClientAddress: "10.0.0.3:8080"},
+	}
+	addrs, err := discover(seed.addr, time.Second)
+	if expected := []string{seed.addr, "10.0.0.2:8080", "10.0.0.3:8080"}; err != nil || !reflect.DeepEqual(addrs, expected) {
+		t.Errorf("Discovered %v, %v, expected %v", addrs, err, expected)
+	}
+
+	// members without client addresses cannot be used
+	seed.Lock()
+	seed.members = append(seed.members, msgs.Member{ID: 3, Address: "10.0.0.4:8090"})
+	seed.Unlock()
+	if addrs, err := discover(seed.addr, time.Second); err == nil {
+		t.Errorf("Discovered %v from members without client addresses", addrs)
+	}
+	seed.Lock()
+	seed.members = nil
+	seed.Unlock()
+	if addrs, err := discover(seed.addr, time.Second); err == nil {
+		t.Errorf("Discovered %v without members", addrs)
+	}
+}
+
+// check the membership is refreshed, from the current members if the seed
+// cannot be reached
+func TestRefreshMembership(t *testing.T) {
+	seed, member := newFakeServer(t, 0), newFakeServer(t, 0)
+	seed.members = []msgs.Member{{ID: 0, ClientAddress: seed.addr}, {ID: 1, ClientAddress: member.addr}}
+	member.members = []msgs.Member{{ID: 0, ClientAddress: member.addr}}
+	book := newAddressBook([]string{seed.addr})
+	stop := make(chan bool)
+	defer close(stop)
+	go refreshMembership(seed.addr, book, 10*time.Millisecond, time.Second, stop)
+
+	waitFor := func(expected []string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !reflect.DeepEqual(book.Get(), expected) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Addresses are %v, expected %v", book.Get(), expected)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor([]string{seed.addr, member.addr})
+
+	// the seed leaves the cluster
+	unreachable := "127.0.0.1:1"
+	seed.Lock()
+	seed.members = nil
+	seed.Unlock()
+	waitFor([]string{member.addr})
+	if discovered, err := discoverAny([]string{unreachable, member.addr}, time.Second); err != nil || !reflect.DeepEqual(discovered, []string{member.addr}) {
+		t.Errorf("Discovered %v, %v after an unreachable seed", discovered, err)
+	}
+}
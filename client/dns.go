@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/golang/glog"
+	"net"
+	"sync"
+	"time"
+)
+
+var dns_retries = flag.Int("dnsretries", 3, "Times to retry resolving a server hostname after a temporary DNS failure")
+var dns_backoff = flag.Duration("dnsbackoff", 50*time.Millisecond, "Delay before retrying a temporary DNS failure, doubled on each retry")
+var dns_ttl = flag.Duration("dnsttl", 0, "Cache resolved server addresses for this long, 0 disables caching")
+
+// lookupHost resolves hostnames, it is replaced to stub out DNS
+var lookupHost = net.DefaultResolver.LookupHost
+
+type dnsEntry struct {
+	addr    string
+	expires time.Time
+}
+
+// dnsCache resolves server addresses, retrying temporary failures and
+// caching results for -dnsttl.
+// It is safe for concurrent access
+type dnsCache struct {
+	entries map[string]dnsEntry
+	sync.Mutex
+}
+
+// servers resolves the addresses of all servers
+var servers = &dnsCache{entries: make(map[string]dnsEntry)}
+
+// temporaryDNS returns whether err is a DNS failure which may succeed if retried
+func temporaryDNS(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && (dnsErr.IsTemporary || dnsErr.IsTimeout)
+}
+
+// Resolve returns addr with its host replaced by an IP address. Addresses
+// which are already IP addresses are returned as they are
+func (d *dnsCache) Resolve(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		// leave dial to report malformed addresses
+		return addr, nil
+	}
+
+	d.Lock()
+	entry, ok := d.entries[addr]
+	d.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addr, nil
+	}
+
+	backoff := *dns_backoff
+	var ips []string
+	for retry := 0; ; retry++ {
+		ips, err = lookupHost(context.Background(), host)
+		if err == nil || !temporaryDNS(err) || retry == *dns_retries {
+			break
+		}
+		glog.Warningf("Temporary DNS failure resolving %s, retrying in %s: %v", host, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if err == nil && len(ips) == 0 {
+		err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	if err != nil {
+		return "", dialError(addr, err)
+	}
+
+	resolved := net.JoinHostPort(ips[0], port)
+	if *dns_ttl > 0 {
+		d.Lock()
+		d.entries[addr] = dnsEntry{resolved, time.Now().Add(*dns_ttl)}
+		d.Unlock()
+	}
+	return resolved, nil
+}
+
+// dialServer resolves addr and connects to it. DNS failures are reported
+// as ErrDNS, rather than as the server being unreachable
+func dialServer(addr string) (net.Conn, error) {
+	resolved, err := servers.Resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.Dial(resolved)
+	return conn, dialError(addr, err)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// stubDNS resolves every host to 127.0.0.1, after failing the given number
+// of lookups with err
+type stubDNS struct {
+	fail    int
+	err     error
+	lookups int
+}
+
+func (s *stubDNS) LookupHost(ctx context.Context, host string) ([]string, error) {
+	s.lookups++
+	if s.lookups <= s.fail {
+		return nil, s.err
+	}
+	return []string{"127.0.0.1"}, nil
+}
+
+// use stub to resolve hostnames until the test ends
+func useStubDNS(t *testing.T, stub *stubDNS, ttl time.Duration) {
+	oldLookup, oldServers, oldTTL, oldBackoff := lookupHost, servers, *dns_ttl, *dns_backoff
+	lookupHost = stub.LookupHost
+	servers = &dnsCache{entries: make(map[string]dnsEntry)}
+	*dns_ttl = ttl
+	*dns_backoff = time.Millisecond
+	t.Cleanup(func() {
+		lookupHost, servers, *dns_ttl, *dns_backoff = oldLookup, oldServers, oldTTL, oldBackoff
+	})
+}
+
+// check that temporary DNS failures are retried, and that DNS failures are
+// reported as such rather than as a refused connection
+func TestDNSRetry(t *testing.T) {
+	temporary := &net.DNSError{Err: "server misbehaving", Name: "hydra.test", IsTemporary: true}
+	notFound := &net.DNSError{Err: "no such host", Name: "hydra.test", IsNotFound: true}
+	tests := []struct {
+		fail    int
+		err     error
+		ok      bool
+		lookups int
+	}{
+		{0, nil, true, 1},
+		{2, temporary, true, 3},
+		{5, temporary, false, 4},
+		{1, notFound, false, 1},
+	}
+	s := newFakeServer(t, 0)
+	_, port, _ := net.SplitHostPort(s.addr)
+	for i, test := range tests {
+		stub := &stubDNS{fail: test.fail, err: test.err}
+		useStubDNS(t, stub, 0)
+
+		conn, _, err := connect([]string{net.JoinHostPort("hydra.test", port)}, 0, 0)
+		if test.ok {
+			if err != nil {
+				t.Errorf("case %d: client did not recover from DNS failures: %v", i, err)
+			} else {
+				conn.Close()
+			}
+		} else if !errors.Is(err, ErrDNS) || !errors.Is(err, ErrNoLeader) || errors.Is(err, ErrConnRefused) {
+			t.Errorf("case %d: error %v is not a DNS failure", i, err)
+		}
+		if stub.lookups != test.lookups {
+			t.Errorf("case %d: %d lookups, expected %d", i, stub.lookups, test.lookups)
+		}
+	}
+}
+
+// check that resolved addresses are cached for the TTL
+func TestDNSCache(t *testing.T) {
+	tests := []struct {
+		ttl     time.Duration
+		lookups int
+	}{
+		{0, 3},
+		{time.Minute, 1},
+	}
+	for _, test := range tests {
+		stub := &stubDNS{}
+		useStubDNS(t, stub, test.ttl)
+		for i := 0; i < 3; i++ {
+			addr, err := servers.Resolve("hydra.test:8080")
+			if err != nil || addr != "127.0.0.1:8080" {
+				t.Errorf("Resolved to %s (%v), expected 127.0.0.1:8080", addr, err)
+			}
+		}
+		if addr, _ := servers.Resolve("127.0.0.2:8080"); addr != "127.0.0.2:8080" {
+			t.Errorf("IP address was resolved to %s", addr)
+		}
+		if stub.lookups != test.lookups {
+			t.Errorf("TTL %s: %d lookups, expected %d", test.ttl, stub.lookups, test.lookups)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"time"
+)
+
+// drain waits up to window for the reply to the current request, after it
+// timed out, so that a late reply avoids a reconnect and resend. Replies to
+// earlier requests or tries are discarded. It returns nil if the reply did
+// not arrive.
+func (c *client) drain(replyCh <-chan []byte, errCh <-chan error, window time.Duration) *msgs.ClientResponse {
+	if window <= 0 {
+		return nil
+	}
+	deadline := time.After(window)
+	for {
+		select {
+		case replyBytes := <-replyCh:
+			reply := new(msgs.ClientResponse)
+			if err := msgs.Unmarshal(replyBytes, reply); err != nil {
+				return nil
+			}
+			if secret != nil && !msgs.Verify(reply, secret) {
+				return nil
+			}
+			if reply.ClientID == c.id && reply.RequestID == c.requestID && !uncorrelated(reply, c.correlation) {
+				return reply
+			}
+			glog.Info("Discarding stale reply to request ", reply.RequestID, " while draining")
+
+			// wait for the next reply
+			next := make(chan []byte, 1)
+			nextErr := make(chan error, 1)
+			go readReply(c.rd, next, nextErr)
+			replyCh, errCh = next, nextErr
+		case <-errCh:
+			return nil
+		case <-deadline:
+			return nil
+		}
+	}
+}
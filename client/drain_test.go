@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// check that a reply arriving just after the timeout is used, rather than
+// reconnecting and resending the request
+func TestDrainLateReply(t *testing.T) {
+	cases := []struct {
+		window time.Duration
+		stale  int
+		sent   int // requests received by the server
+	}{
+		{time.Second, 0, 1},
+		{time.Second, 1, 1},
+	}
+
+	for i, test := range cases {
+		s := newFakeServer(t, 100*time.Millisecond)
+		s.stale = test.stale
+		stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conf config.Config
+		conf.Addresses.Address = []string{s.addr}
+		conf.Parameters.Retries = 1
+
+		c := newClient(0, conf, 50*time.Millisecond, stats)
+		old := *drain_window
+		*drain_window = test.window
+		response := c.submit("get A", false)
+		*drain_window = old
+		stats.Close()
+
+		if response != "0" {
+			t.Errorf("case %d: response was %q", i, response)
+		}
+		if n := len(s.Received()); n != test.sent {
+			t.Errorf("case %d: server received %d requests but %d were expected", i, n, test.sent)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+)
+
+var dump_limit = flag.Int("dumplimit", 512, "Maximum bytes of each message dumped at -v=3, beyond which the dump is truncated")
+
+// dumpLog logs the dumps, it is replaced by tests
+var dumpLog = func(dump string) { glog.InfoDepth(2, dump) }
+
+// dumpBytes logs a hex dump of a message sent or received, at -v=3 only
+func dumpBytes(direction string, b []byte) {
+	if !glog.V(3) {
+		return
+	}
+	dumpLog(formatDump(direction, b, *dump_limit))
+}
+
+// formatDump formats up to limit bytes of b as a hex dump, with the
+// printable characters alongside
+func formatDump(direction string, b []byte, limit int) string {
+	header := fmt.Sprintf("%s %d bytes", direction, len(b))
+	if len(b) > limit {
+		header += fmt.Sprintf(", truncated to %d", limit)
+		b = b[:limit]
+	}
+	return header + ":\n" + hex.Dump(b)
+}
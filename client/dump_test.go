@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestFormatDump(t *testing.T) {
+	cases := []struct {
+		b      string
+		limit  int
+		header string
+		lines  int
+	}{
+		{"{\"Request\":\"get A\"}\n", 512, "Sent 20 bytes:", 2},
+		{strings.Repeat("a", 100), 32, "Sent 100 bytes, truncated to 32:", 2},
+	}
+	for _, c := range cases {
+		dump := formatDump("Sent", []byte(c.b), c.limit)
+		lines := strings.Split(strings.TrimSuffix(dump, "\n"), "\n")
+		if lines[0] != c.header || len(lines)-1 != c.lines {
+			t.Errorf("Dump of %d bytes with limit %d is:\n%s", len(c.b), c.limit, dump)
+		}
+	}
+}
+
+// check that messages are only dumped at -v=3 and above
+func TestDumpVerbosity(t *testing.T) {
+	defer func(log func(string)) { dumpLog = log }(dumpLog)
+	defer flag.Set("v", flag.Lookup("v").Value.String())
+	for _, v := range []string{"0", "2", "3", "4"} {
+		dumps := 0
+		dumpLog = func(string) { dumps++ }
+		flag.Set("v", v)
+		s := newFakeServer(t, 0)
+		c := newTestClient(t, s.addr)
+		c.submit("get A", false)
+		// one dump for the request and one for the reply
+		if expected := map[bool]int{false: 0, true: 2}[v >= "3"]; dumps != expected {
+			t.Errorf("-v=%s: %d messages dumped, expected %d", v, dumps, expected)
+		}
+	}
+}
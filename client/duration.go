@@ -0,0 +1,17 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var run_duration = flag.Duration("duration", 0, "Stop issuing requests after running for this long, finishing those in flight, 0 to run until the workload ends")
+
+// runDeadline returns a channel which receives once a run from now has
+// lasted d, or nil, on which nothing is received, if d is not positive
+func runDeadline(d time.Duration) <-chan time.Time {
+	if d <= 0 {
+		return nil
+	}
+	return time.After(d)
+}
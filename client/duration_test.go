@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// API issuing reads until stopped
+type endlessReads struct {
+	responses int
+	sync.Mutex
+}
+
+func (e *endlessReads) Next() (string, bool, bool) { return "get A", false, true }
+
+func (e *endlessReads) Return(str string) {
+	e.Lock()
+	defer e.Unlock()
+	e.responses++
+}
+
+func (e *endlessReads) ReturnStream(chunks chan string) {
+	e.Return(reassemble(chunks))
+}
+
+func (e *endlessReads) Responses() int {
+	e.Lock()
+	defer e.Unlock()
+	return e.responses
+}
+
+// check that a run stops issuing requests promptly at its deadline, and
+// finishes the request in flight
+func TestRunDeadline(t *testing.T) {
+	if runDeadline(0) != nil {
+		t.Error("Run without a duration has a deadline")
+	}
+
+	delay := 20 * time.Millisecond
+	server := newFakeServer(t, delay)
+	c := newTestClient(t, server.addr)
+	c.stop = make(chan bool)
+	api := &endlessReads{}
+	done := make(chan bool)
+	start := time.Now()
+	go func() {
+		c.run(api)
+		close(done)
+	}()
+
+	duration := 100 * time.Millisecond
+	<-runDeadline(duration)
+	close(c.stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Client did not stop at the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > duration+5*delay {
+		t.Errorf("Run of %s stopped after %s", duration, elapsed)
+	}
+	if received, responses := len(server.Received()), api.Responses(); responses == 0 || responses != received {
+		t.Errorf("Server received %d requests and the client had %d responses", received, responses)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Errors returned by the client. They are wrapped with further detail where
+// available, so should be matched with errors.Is
+var (
+	// no reply was received before the timeout
+	ErrTimeout = errors.New("Timeout")
+	// no server in the cluster could be reached
+	ErrNoLeader = errors.New("No leader available")
+	// a server actively refused the connection
+	ErrConnRefused = errors.New("Connection refused")
+	// a server's hostname could not be resolved, so its state is unknown
+	ErrDNS = errors.New("DNS resolution failed")
+	// the server failed the request or closed the connection without replying
+	ErrServer = errors.New("Server error")
+	// the reply could not be decoded, e.g. as the server uses another codec
+	ErrDecode = errors.New("Unable to decode reply")
+	// the server does not speak this version of the protocol, e.g. it does
+	// not understand the handshake
+	ErrVersionMismatch = errors.New("Version mismatch")
+	// a request or reply is larger than maxmsgsize
+	ErrMsgTooLarge = errors.New("Message exceeds maximum size")
+	// the request was rejected by the cluster as its token was missing or invalid
+	ErrUnauthorized = errors.New("Unauthorized")
+	// the request was cancelled by the user before it was replied to
+	ErrCancelled = errors.New("Request cancelled")
+	// the reply was not signed with the secret, so was corrupted or tampered with
+	ErrBadSignature = errors.New("Invalid signature")
+	// the server was too busy to serve the request
+	ErrBusy = errors.New("Server busy")
+	// the text of a command is longer than maxrequestlen, so it was not sent
+	ErrRequestTooLong = errors.New("Request exceeds maximum length")
+	// a transformer of -transform failed on the response
+	ErrTransform = errors.New("Transform failed")
+	// a server given by the user is not one of the config
+	ErrUnknownServer = errors.New("not in the config")
+	// the cluster membership could not be discovered from the seeds
+	ErrDiscovery = errors.New("Membership discovery failed")
+)
+
+// errInjectedFault is returned by connections killed by -faultevery, as a
+// connection failure would be
+var errInjectedFault = fmt.Errorf("%w: injected connection failure", ErrServer)
+
+// dialError adds ErrConnRefused to err, if the connection to addr was
+// refused, or ErrDNS if addr could not be resolved
+func dialError(addr string, err error) error {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("%w by %s", ErrConnRefused, addr)
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return fmt.Errorf("%w for %s: %w", ErrDNS, addr, err)
+	}
+	return err
+}
+
+// errorKinds names each error returned by the client, for counting failures
+var errorKinds = []struct {
+	err  error
+	name string
+}{
+	{ErrTimeout, "timeout"},
+	{ErrConnRefused, "conn_refused"},
+	{ErrDNS, "dns"},
+	{ErrNoLeader, "no_leader"},
+	{ErrServer, "server"},
+	{ErrDecode, "decode"},
+	{ErrVersionMismatch, "version_mismatch"},
+	{ErrMsgTooLarge, "msg_too_large"},
+	{ErrUnauthorized, "unauthorized"},
+	{ErrCancelled, "cancelled"},
+	{ErrBadSignature, "bad_signature"},
+	{ErrBusy, "busy"},
+	{ErrRequestTooLong, "request_too_long"},
+	{ErrUnknownServer, "unknown_server"},
+	{ErrDiscovery, "discovery"},
+}
+
+// errorKind returns the name of the kind of err, "other" if it is not one
+// of the client's errors
+func errorKind(err error) string {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.name
+		}
+	}
+	return "other"
+}
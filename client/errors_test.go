@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check that each error path of the client can be matched with errors.Is
+func TestErrors(t *testing.T) {
+	// address with nothing listening on it
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := ln.Addr().String()
+	ln.Close()
+
+	closing := newFakeServer(t, 0)
+	closing.drop = 1
+	closed := newTestClient(t, closing.addr)
+
+	tests := []struct {
+		name  string
+		run   func() error
+		match []error
+	}{
+		{"timeout", func() error {
+			_, err := receive(make(chan []byte), make(chan error), time.Millisecond)
+			return err
+		}, []error{ErrTimeout}},
+		{"refused", func() error {
+			_, _, err := connect([]string{refused}, 1, 0)
+			return err
+		}, []error{ErrNoLeader, ErrConnRefused}},
+		{"closed", func() error {
+			replyCh, errCh := dispatch([]byte("{}"), closed.conn, closed.rd)
+			_, err := receive(replyCh, errCh, time.Second)
+			return err
+		}, []error{ErrServer}},
+		{"undecodable", func() error {
+			replyCh := make(chan []byte, 1)
+			replyCh <- []byte("not a reply\n")
+			_, err := receive(replyCh, make(chan error), time.Second)
+			return err
+		}, []error{ErrDecode}},
+		{"handshake", func() error {
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				bufio.NewReader(server).ReadBytes('\n')
+				server.Write([]byte("not a handshake\n"))
+				server.Close()
+			}()
+			_, err := negotiate(client, []string{"gzip"})
+			return err
+		}, []error{ErrVersionMismatch}},
+		{"unknown server", func() error {
+			_, err := serverIndex([]string{refused}, "127.0.0.1:1")
+			return err
+		}, []error{ErrUnknownServer}},
+		{"no seeds", func() error {
+			_, err := discoverAny(nil, time.Second)
+			return err
+		}, []error{ErrDiscovery}},
+		{"injected fault", func() error {
+			return errInjectedFault
+		}, []error{ErrServer}},
+		{"too large", func() error {
+			_, err := readMsg(bufio.NewReader(strings.NewReader("hello\n")), 4)
+			return err
+		}, []error{ErrMsgTooLarge}},
+	}
+	for _, test := range tests {
+		err := test.run()
+		for _, target := range test.match {
+			if !errors.Is(err, target) {
+				t.Errorf("%s: error %v does not match %v", test.name, err, target)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var event_bus = flag.String("events", "", "URL of a message bus to publish an event to as each request starts, completes or fails, and as clients reconnect, e.g. nats://localhost:4222")
+var event_subject = flag.String("eventsubject", "hydra.events", "Subject the events are published on")
+var event_queue = flag.Int("eventqueue", 10000, "Events queued for publishing, beyond which they are dropped")
+
+// Event is a change in the state of a request or a client's connection, as
+// published to the event bus
+type Event struct {
+	// start, complete, error or reconnect
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	ClientID  int       `json:"client_id"`
+	RequestID int       `json:"request_id"`
+	// server connected to, as numbered in the config
+	Server int `json:"server"`
+	// of requests, the trace ID and first word of the command
+	TraceID string `json:"trace_id,omitempty"`
+	Command string `json:"command,omitempty"`
+	// of completed requests, the latency and attempts taken
+	Latency time.Duration `json:"latency_ns,omitempty"`
+	Tries   int           `json:"tries,omitempty"`
+	// of errors, the kind of error, as counted by the metrics, and the error
+	ErrorKind string `json:"error_kind,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// EventPublisher publishes events to a message bus. Publish is only called
+// from one goroutine at a time, and may block
+type EventPublisher interface {
+	Publish(e Event) error
+	Close() error
+}
+
+// eventBus publishes events with an EventPublisher, off the request path.
+// Events are queued and published in order, and dropped if the queue is
+// full, so that emitting one never blocks. It is safe for concurrent
+// access, and a nil *eventBus publishes nothing
+type eventBus struct {
+	publisher EventPublisher
+	events    chan Event
+	dropped   int64 // events dropped as the queue was full
+	failed    int64 // events the publisher failed to publish
+	done      chan bool
+}
+
+// newEventBus publishes events with publisher, queueing up to size of them
+func newEventBus(publisher EventPublisher, size int) *eventBus {
+	b := &eventBus{
+		publisher: publisher,
+		events:    make(chan Event, size),
+		done:      make(chan bool)}
+	go b.run()
+	return b
+}
+
+func (b *eventBus) run() {
+	defer close(b.done)
+	for e := range b.events {
+		if err := b.publisher.Publish(e); err != nil {
+			if atomic.AddInt64(&b.failed, 1) == 1 {
+				glog.Warning("Unable to publish event: ", err)
+			}
+		}
+	}
+}
+
+// Emit queues an event, or drops it if the queue is full
+func (b *eventBus) Emit(e Event) {
+	if b == nil {
+		return
+	}
+	select {
+	case b.events <- e:
+	default:
+		atomic.AddInt64(&b.dropped, 1)
+	}
+}
+
+// Dropped returns the number of events dropped as the queue was full
+func (b *eventBus) Dropped() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
+
+// Close publishes the queued events, then closes the publisher
+func (b *eventBus) Close() {
+	if b == nil {
+		return
+	}
+	close(b.events)
+	<-b.done
+	if err := b.publisher.Close(); err != nil {
+		glog.Warning(err)
+	}
+	if dropped := b.Dropped(); dropped > 0 {
+		glog.Warning(dropped, " events were dropped as the queue was full")
+	}
+	if failed := atomic.LoadInt64(&b.failed); failed > 0 {
+		glog.Warning(failed, " events were dropped as publishing them failed")
+	}
+}
+
+// event returns an event of type typ for the current request of the client
+func (c *client) event(typ string) Event {
+	return Event{Type: typ, Time: time.Now(), ClientID: c.id, RequestID: c.requestID, Server: c.leader}
+}
+
+// commandName returns the first word of command, e.g. get
+func commandName(command string) string {
+	if args := strings.Fields(command); len(args) > 0 {
+		return args[0]
+	}
+	return ""
+}
+
+// newEventPublisher returns the publisher for the bus at rawurl, publishing
+// on subject. Only NATS is supported
+func newEventPublisher(rawurl string, subject string) (EventPublisher, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" {
+		return nil, errors.New("Unsupported event bus " + rawurl + ", expected nats://host:port")
+	}
+	if strings.ContainsAny(subject, " \t\r\n") || subject == "" {
+		return nil, fmt.Errorf("Invalid NATS subject %q", subject)
+	}
+	return newNATSPublisher(u.Host, subject), nil
+}
+
+// natsPublisher publishes events as JSON to a NATS server, with the text
+// protocol of NATS. It connects when first used, and again after failing
+type natsPublisher struct {
+	addr    string
+	subject string
+	conn    net.Conn // nil until connected
+	w       *bufio.Writer
+	sync.Mutex
+}
+
+func newNATSPublisher(addr string, subject string) *natsPublisher {
+	return &natsPublisher{addr: addr, subject: subject}
+}
+
+// connect to the server, with the lock held. The server sends INFO on
+// connecting, and PING from time to time, which must be answered
+func (p *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	rd := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	info, err := rd.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || !strings.HasPrefix(info, "INFO") {
+		conn.Close()
+		return fmt.Errorf("%s is not a NATS server: %q, %v", p.addr, info, err)
+	}
+	p.conn, p.w = conn, bufio.NewWriter(conn)
+	p.w.WriteString("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"hydra-client\"}\r\n")
+	if err = p.w.Flush(); err != nil {
+		p.close()
+		return err
+	}
+	go p.read(conn, rd)
+	return nil
+}
+
+// read the messages from the server on conn until it is closed
+func (p *natsPublisher) read(conn net.Conn, rd *bufio.Reader) {
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			p.Lock()
+			if p.conn == conn {
+				p.w.WriteString("PONG\r\n")
+				p.w.Flush()
+			}
+			p.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			glog.Warning("NATS server ", p.addr, " replied ", strings.TrimSpace(line))
+		}
+	}
+}
+
+// Publish the event, connecting first if need be
+func (p *natsPublisher) Publish(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.conn == nil {
+		if err = p.connect(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(p.w, "PUB %s %d\r\n", p.subject, len(b))
+	p.w.Write(b)
+	p.w.WriteString("\r\n")
+	if err = p.w.Flush(); err != nil {
+		p.close()
+	}
+	return err
+}
+
+// close the connection, if any, with the lock held
+func (p *natsPublisher) close() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.w = nil, nil
+	}
+}
+
+func (p *natsPublisher) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	p.close()
+	return nil
+}
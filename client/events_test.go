@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher records the events published, blocking until release
+// is closed if it is not nil
+type recordingPublisher struct {
+	release chan bool
+	events  []Event
+	closed  bool
+	sync.Mutex
+}
+
+func (p *recordingPublisher) Publish(e Event) error {
+	if p.release != nil {
+		<-p.release
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.events = append(p.events, e)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	return nil
+}
+
+// check that a request retried after the connection is lost emits its
+// start, the error, the reconnect and its completion, in order
+func TestEvents(t *testing.T) {
+	server := newFakeServer(t, 0)
+	server.drop = 1
+	client := newTestClient(t, server.addr)
+	publisher := &recordingPublisher{}
+	client.events = newEventBus(publisher, 100)
+	if response := client.submit("get A", false); response != "0" {
+		t.Errorf("Response was %q", response)
+	}
+	client.events.Close()
+
+	expected := []Event{
+		{Type: "start", ClientID: 0, RequestID: 1, Command: "get"},
+		{Type: "error", ClientID: 0, RequestID: 1, Command: "get", ErrorKind: "server"},
+		{Type: "reconnect", ClientID: 0, RequestID: 1},
+		{Type: "complete", ClientID: 0, RequestID: 1, Command: "get", Tries: 2},
+	}
+	if !publisher.closed {
+		t.Error("Publisher was not closed")
+	}
+	if len(publisher.events) != len(expected) {
+		t.Fatalf("Events were %+v, expected %+v", publisher.events, expected)
+	}
+	traceID := publisher.events[0].TraceID
+	if traceID == "" {
+		t.Error("Start event has no trace ID")
+	}
+	for i, e := range publisher.events {
+		x := expected[i]
+		if e.Type != x.Type || e.ClientID != x.ClientID || e.RequestID != x.RequestID || e.Command != x.Command ||
+			e.ErrorKind != x.ErrorKind || e.Tries != x.Tries || e.Time.IsZero() {
+			t.Errorf("Event %d was %+v, expected %+v", i, e, x)
+		}
+		if x.Command != "" && e.TraceID != traceID {
+			t.Errorf("Event %d has trace ID %s, expected %s", i, e.TraceID, traceID)
+		}
+		if (e.Type == "error") != (e.Error != "") || (e.Type == "complete") != (e.Latency > 0) {
+			t.Errorf("Event %d has error %q and latency %v", i, e.Error, e.Latency)
+		}
+	}
+}
+
+// check that events are dropped rather than blocking while the publisher is
+func TestEventBusDrops(t *testing.T) {
+	publisher := &recordingPublisher{release: make(chan bool)}
+	bus := newEventBus(publisher, 2)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10; i++ {
+			bus.Emit(Event{Type: "start", RequestID: i})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Emitting events blocked")
+	}
+	close(publisher.release)
+	bus.Close()
+	dropped := bus.Dropped()
+	if dropped < 7 || int(dropped)+len(publisher.events) != 10 {
+		t.Errorf("%d events dropped and %d published, expected at least 7 of 10 dropped", dropped, len(publisher.events))
+	}
+	for i := 1; i < len(publisher.events); i++ {
+		if publisher.events[i].RequestID <= publisher.events[i-1].RequestID {
+			t.Errorf("Events published out of order: %+v", publisher.events)
+		}
+	}
+	var nilBus *eventBus
+	nilBus.Emit(Event{})
+	nilBus.Close()
+}
+
+func TestNewEventPublisher(t *testing.T) {
+	cases := []struct {
+		url     string
+		subject string
+		valid   bool
+	}{
+		{"nats://localhost:4222", "hydra.events", true},
+		{"kafka://localhost:9092", "hydra.events", false},
+		{"localhost:4222", "hydra.events", false},
+		{"nats://localhost:4222", "hydra events", false},
+		{"nats://localhost:4222", "", false},
+	}
+	for _, c := range cases {
+		if _, err := newEventPublisher(c.url, c.subject); (err == nil) != c.valid {
+			t.Errorf("%s on %q: error %v", c.url, c.subject, err)
+		}
+	}
+}
+
+// check that events are published to a NATS server, and its pings answered
+func TestNATSPublisher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rd := bufio.NewReader(conn)
+		io.WriteString(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		io.WriteString(conn, "PING\r\n")
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\r\n")
+			if args := strings.Fields(line); len(args) == 3 && args[0] == "PUB" {
+				n, _ := strconv.Atoi(args[2])
+				payload := make([]byte, n+2)
+				if _, err = io.ReadFull(rd, payload); err != nil {
+					return
+				}
+				line = args[1] + " " + string(payload[:n])
+			}
+			received <- line
+		}
+	}()
+
+	publisher := newNATSPublisher(ln.Addr().String(), "hydra.test")
+	defer publisher.Close()
+	if err = publisher.Publish(Event{Type: "complete", ClientID: 3, RequestID: 7, Latency: time.Millisecond, Tries: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for len(lines) < 3 {
+		select {
+		case line := <-received:
+			lines = append(lines, line)
+		case <-time.After(time.Second):
+			t.Fatalf("Received %q, expected CONNECT, PONG and PUB", lines)
+		}
+	}
+	var pub string
+	pong := false
+	for _, line := range lines {
+		switch {
+		case line == "PONG":
+			pong = true
+		case strings.HasPrefix(line, "hydra.test "):
+			pub = strings.TrimPrefix(line, "hydra.test ")
+		}
+	}
+	if !strings.HasPrefix(lines[0], "CONNECT {") || !pong {
+		t.Errorf("Received %q, expected CONNECT then PONG", lines)
+	}
+	var e Event
+	if err = json.Unmarshal([]byte(pub), &e); err != nil {
+		t.Fatalf("Published %q: %v", pub, err)
+	}
+	if e.Type != "complete" || e.ClientID != 3 || e.RequestID != 7 || e.Latency != time.Millisecond || e.Tries != 1 {
+		t.Errorf("Published %+v", e)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// faultInjector dials connections which are killed deterministically, when
+// sending every nth request across all connections. It is used to check that
+// the client recovers from connection failures
+type faultInjector struct {
+	every    int64
+	sent     int64 // requests sent
+	injected int64 // connections killed
+	dials    int64 // connections established
+	next     Dialer
+}
+
+// newFaultInjector returns a Dialer wrapping next
+func newFaultInjector(every int, next Dialer) *faultInjector {
+	return &faultInjector{every: int64(every), next: next}
+}
+
+func (f *faultInjector) Dial(addr string) (net.Conn, error) {
+	return f.wrap(f.next.Dial(addr))
+}
+
+func (f *faultInjector) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	return f.wrap(f.next.DialTimeout(addr, timeout))
+}
+
+func (f *faultInjector) wrap(conn net.Conn, err error) (net.Conn, error) {
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&f.dials, 1)
+	return &faultConn{conn, f}, nil
+}
+
+// Injected returns the number of connections killed
+func (f *faultInjector) Injected() int {
+	return int(atomic.LoadInt64(&f.injected))
+}
+
+// Reconnects returns the number of connections made after the first
+func (f *faultInjector) Reconnects() int {
+	return int(atomic.LoadInt64(&f.dials)) - 1
+}
+
+// faultConn is a connection which the faultInjector may kill
+type faultConn struct {
+	net.Conn
+	f *faultInjector
+}
+
+// NetConn returns the connection wrapped
+func (c *faultConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Write counts requests as their terminating newline is written
+func (c *faultConn) Write(b []byte) (int, error) {
+	if len(b) > 0 && b[len(b)-1] == '\n' && c.f.every > 0 {
+		if atomic.AddInt64(&c.f.sent, 1)%c.f.every == 0 {
+			glog.Warning("Injecting connection failure")
+			atomic.AddInt64(&c.f.injected, 1)
+			c.Conn.Close()
+			return 0, errInjectedFault
+		}
+	}
+	return c.Conn.Write(b)
+}
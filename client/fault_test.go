@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// check every request completes despite every third request failing
+func TestFaultInjection(t *testing.T) {
+	server := newFakeServer(t, 0)
+	faults := newFaultInjector(3, defaultDialer)
+	dialer = faults
+	defer func() { dialer = defaultDialer }()
+
+	stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Close()
+	var conf config.Config
+	conf.Addresses.Address = []string{server.addr}
+	conf.Parameters.Retries = 1
+
+	api := &commandList{commands: []string{"update A 1", "update A 2", "update A 3", "update A 4", "update A 5", "update A 6"}, replicate: true}
+	c := newClient(1, conf, time.Second, stats)
+	c.run(api)
+
+	if len(api.responses) != len(api.commands) {
+		t.Errorf("%d of %d requests completed", len(api.responses), len(api.commands))
+	}
+	// 6 requests need 8 sends, as the 3rd and 6th sends fail
+	if faults.Injected() != 2 {
+		t.Errorf("%d faults were injected but 2 were expected", faults.Injected())
+	}
+	if faults.Reconnects() != 2 {
+		t.Errorf("Client reconnected %d times but 2 were expected", faults.Reconnects())
+	}
+	if len(server.Received()) != 6 {
+		t.Errorf("Server received %d requests but 6 were expected", len(server.Received()))
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/heidi-ann/hydra/config"
+	"github.com/heidi-ann/hydra/msgs"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+var frame_file = flag.String("framefile", "", "In blast mode, file of pre-encoded requests to send, and in genframes mode, file to write them to")
+var frame_count = flag.Int("framecount", 0, "In genframes mode, number of requests to generate, 0 for those of the workload")
+
+// A frame file holds requests encoded ahead of time, so that blast mode can
+// send them without marshalling. After a header of frameMagic, the number of
+// frames as a big endian uint32, and the length of the codec name as a byte
+// followed by the name, are the frames: encoded requests, each terminated by
+// a newline, exactly as sent on the wire
+const frameMagic = "HYDRAFR1"
+
+// frameFile is a frame file, mapped into memory if possible
+type frameFile struct {
+	codec string
+	count int
+	// the frames, back to back, sent as they are
+	body  []byte
+	close func() error
+}
+
+// codecName returns the name of the wire format of conf
+func codecName(conf config.Config) string {
+	if conf.Parameters.Codec == "" {
+		return "json"
+	}
+	return conf.Parameters.Codec
+}
+
+// writeFrames writes a frame file of frames, encoded with codec
+func writeFrames(w io.Writer, codec string, frames [][]byte) error {
+	if len(codec) > 255 {
+		return errors.New("Codec name " + codec + " is too long")
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(frameMagic)
+	binary.Write(bw, binary.BigEndian, uint32(len(frames)))
+	bw.WriteByte(byte(len(codec)))
+	bw.WriteString(codec)
+	for i, frame := range frames {
+		if bytes.IndexByte(frame, '\n') >= 0 {
+			return fmt.Errorf("Frame %d contains a newline", i)
+		}
+		bw.Write(frame)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// parseFrames reads the frame file in data, whose body is a slice of data
+func parseFrames(data []byte) (*frameFile, error) {
+	header := len(frameMagic) + 5
+	if len(data) < header || string(data[:len(frameMagic)]) != frameMagic {
+		return nil, errors.New("Not a frame file")
+	}
+	count := binary.BigEndian.Uint32(data[len(frameMagic):])
+	n := int(data[header-1])
+	if len(data) < header+n {
+		return nil, errors.New("Frame file header is truncated")
+	}
+	f := &frameFile{codec: string(data[header : header+n]), count: int(count), body: data[header+n:]}
+	if frames := bytes.Count(f.body, []byte{'\n'}); frames != f.count || (len(f.body) > 0 && f.body[len(f.body)-1] != '\n') {
+		return nil, fmt.Errorf("Frame file has %d complete frames, expected %d", frames, f.count)
+	}
+	return f, nil
+}
+
+// openFrames maps the frame file filename into memory
+func openFrames(filename string) (*frameFile, error) {
+	data, unmap, err := mapFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseFrames(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	f.close = unmap
+	return f, nil
+}
+
+// Close unmaps the frame file
+func (f *frameFile) Close() error {
+	if f.close == nil {
+		return nil
+	}
+	return f.close()
+}
+
+// genFrames encodes count requests of ioapi from client id as frames,
+// signed if messages are signed. If count is 0, all of the requests of
+// ioapi are encoded, which must end
+func genFrames(ioapi API, id int, count int) ([][]byte, error) {
+	var frames [][]byte
+	for count <= 0 || len(frames) < count {
+		text, replicate, ok := ioapi.Next()
+		if !ok {
+			if count > 0 {
+				return nil, fmt.Errorf("Workload ended after %d of %d requests", len(frames), count)
+			}
+			break
+		}
+		req := msgs.ClientRequest{
+			ClientID:  id,
+			RequestID: len(frames) + 1,
+			Replicate: replicate,
+			Request:   text}
+		if secret != nil {
+			msgs.Sign(&req, secret)
+		}
+		b, err := msgs.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, b)
+	}
+	return frames, nil
+}
+
+// writeFrameFile writes the frames of ioapi to filename
+func writeFrameFile(filename string, codec string, ioapi API, id int, count int) (int, error) {
+	frames, err := genFrames(ioapi, id, count)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	if err = writeFrames(file, codec, frames); err != nil {
+		file.Close()
+		return 0, err
+	}
+	return len(frames), file.Close()
+}
+
+// blastResult is the outcome of a blast
+type blastResult struct {
+	sent    int
+	replies int
+	elapsed time.Duration
+}
+
+func (r blastResult) String() string {
+	return fmt.Sprintf("%d requests sent and %d replies received in %v, %.0f replies/s",
+		r.sent, r.replies, r.elapsed, float64(r.replies)/r.elapsed.Seconds())
+}
+
+// blast writes every frame of f to conn at once, and reads their replies
+// from rd, until all are received, or none are for timeout. Replies are
+// counted without being decoded, so each is taken to be a whole reply, and
+// streamed replies are counted once for each chunk
+func blast(conn net.Conn, rd *bufio.Reader, f *frameFile, timeout time.Duration) (blastResult, error) {
+	result := blastResult{sent: f.count}
+	start := time.Now()
+	written := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(f.body)
+		written <- err
+	}()
+	for result.replies < f.count {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		if _, err := readMsg(rd, *max_msg_size); err != nil {
+			result.elapsed = time.Since(start)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				err = ErrTimeout
+			}
+			return result, fmt.Errorf("%w after %d replies", err, result.replies)
+		}
+		result.replies++
+	}
+	result.elapsed = time.Since(start)
+	conn.SetReadDeadline(time.Time{})
+	return result, <-written
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "io/ioutil"
+
+// mapFile reads filename into memory, as it cannot be mapped
+func mapFile(filename string) ([]byte, func() error, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
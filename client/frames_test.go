@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/heidi-ann/hydra/api/null"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check that frames written are read back as written, and that files which
+// are not frame files, or are truncated, are rejected
+func TestFrameFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "frames")
+	if n, err := writeFrameFile(filename, "json", null.Create(3), 7, 0); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	f, err := openFrames(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.codec != "json" || f.count != 3 {
+		t.Errorf("Frame file has %d frames in %s", f.count, f.codec)
+	}
+	for i, frame := range bytes.SplitAfter(f.body, []byte{'\n'})[:f.count] {
+		var req msgs.ClientRequest
+		if err := msgs.Unmarshal(frame, &req); err != nil {
+			t.Fatal(err)
+		}
+		if req.ClientID != 7 || req.RequestID != i+1 || req.Request != null.Command || req.Replicate {
+			t.Errorf("Frame %d was %+v", i, req)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := writeFrames(&b, "json", [][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	valid := b.Bytes()
+	cases := [][]byte{
+		nil,
+		[]byte("HYDRAFR0" + string(valid[8:])),
+		valid[:10],
+		valid[:len(valid)-1],
+		append(append([]byte{}, valid...), "c\n"...),
+	}
+	for i, data := range cases {
+		if _, err := parseFrames(data); err == nil {
+			t.Errorf("case %d: %q was parsed", i, data)
+		}
+	}
+	if _, err := parseFrames(valid); err != nil {
+		t.Error(err)
+	}
+	if err := writeFrames(&b, "json", [][]byte{[]byte("a\nb")}); err == nil {
+		t.Error("Frame with a newline was written")
+	}
+}
+
+// check that frames are signed when messages are signed
+func TestSignedFrames(t *testing.T) {
+	defer func(s []byte) { secret = s }(secret)
+	secret = []byte("secret")
+	frames, err := genFrames(null.Create(3), 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range frames {
+		var req msgs.ClientRequest
+		if err := msgs.Unmarshal(frame, &req); err != nil {
+			t.Fatal(err)
+		}
+		if !msgs.Verify(&req, secret) || msgs.Verify(&req, []byte("other")) {
+			t.Errorf("Frame %d was not signed with the secret: %+v", i, req)
+		}
+	}
+}
+
+// check that every frame is sent and replied to, and that a blast stops if
+// replies stop arriving
+func TestBlast(t *testing.T) {
+	for _, silent := range []int{0, 1} {
+		server := newFakeServer(t, 0)
+		server.silent = silent
+		frames, err := genFrames(null.Create(100), 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err = writeFrames(&b, "json", frames); err != nil {
+			t.Fatal(err)
+		}
+		f, err := parseFrames(b.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := net.Dial("tcp", server.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := blast(conn, bufio.NewReader(conn), f, 200*time.Millisecond)
+		conn.Close()
+		if result.sent != 100 || result.replies != 100-silent || len(server.Received()) != 100 {
+			t.Errorf("Blast was %v, and %d requests were received", result, len(server.Received()))
+		}
+		if silent > 0 && !errors.Is(err, ErrTimeout) || silent == 0 && err != nil {
+			t.Errorf("Blast with %d unanswered returned %v", silent, err)
+		}
+		if !strings.Contains(result.String(), "replies/s") {
+			t.Errorf("Blast was %q", result)
+		}
+	}
+}
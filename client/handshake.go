@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+	"strings"
+	"time"
+)
+
+// time allowed for the server to reply to a handshake
+const handshakeTimeout = 5 * time.Second
+
+// parseCompressions parses a list of compressions, separated by commas
+func parseCompressions(list string) ([]string, error) {
+	offered := strings.Split(list, ",")
+	for _, c := range offered {
+		if msgs.NegotiateCompression([]string{c}, msgs.Compressions) == "" {
+			return nil, errors.New("Unsupported compression: " + c)
+		}
+	}
+	return offered, nil
+}
+
+// negotiate offers compressions to the server on a new connection, returning
+// the connection compressed with the one it chose, if any
+func negotiate(conn net.Conn, offered []string) (net.Conn, error) {
+	b, err := msgs.HandshakeToBytes(msgs.Handshake{Compression: offered})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+
+	// read the reply a byte at a time, as what follows it may be compressed
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	var line bytes.Buffer
+	c := make([]byte, 1)
+	for c[0] != '\n' {
+		if _, err = conn.Read(c); err != nil {
+			return nil, err
+		}
+		line.Write(c)
+	}
+	var reply msgs.HandshakeResponse
+	if err = msgs.Unmarshal(line.Bytes(), &reply); err != nil {
+		return nil, fmt.Errorf("%w: unable to decode handshake reply: %v", ErrVersionMismatch, err)
+	}
+	if reply.Compression == "" {
+		return conn, nil
+	}
+	return msgs.Compress(conn, reply.Compression)
+}
+
+// negotiatingDialer wraps a Dialer so that new connections offer compressions
+type negotiatingDialer struct {
+	next    Dialer
+	offered []string
+}
+
+func (n *negotiatingDialer) Dial(addr string) (net.Conn, error) {
+	return n.negotiate(n.next.Dial(addr))
+}
+
+func (n *negotiatingDialer) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	return n.negotiate(n.next.DialTimeout(addr, timeout))
+}
+
+func (n *negotiatingDialer) negotiate(conn net.Conn, err error) (net.Conn, error) {
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := negotiate(conn, n.offered)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return compressed, nil
+}
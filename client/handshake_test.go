@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+	"testing"
+)
+
+// serve a handshake on conn, supporting compressions, then echo messages
+func serveHandshake(t *testing.T, conn net.Conn, supported []string) {
+	rd := bufio.NewReader(conn)
+	text, err := rd.ReadBytes('\n')
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	h, ok, err := msgs.BytesToHandshake(text)
+	if !ok || err != nil {
+		t.Errorf("Invalid handshake %q", text)
+		return
+	}
+	b, _ := msgs.Marshal(msgs.HandshakeResponse{Compression: msgs.NegotiateCompression(h.Compression, supported)})
+	conn.Write(append(b, '\n'))
+	var c net.Conn = conn
+	if chosen := msgs.NegotiateCompression(h.Compression, supported); chosen != "" {
+		c, _ = msgs.Compress(conn, chosen)
+		rd = bufio.NewReader(c)
+	}
+	for {
+		msg, err := rd.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		c.Write(msg)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		offered   []string
+		supported []string
+		chosen    string
+	}{
+		{[]string{"zstd", "gzip"}, []string{"gzip"}, "gzip"},
+		{[]string{"zstd", "gzip"}, []string{"zstd", "gzip"}, "zstd"},
+		{[]string{"gzip"}, []string{"zstd"}, ""},
+		{[]string{"gzip"}, nil, ""},
+	}
+	for _, c := range cases {
+		client, server := net.Pipe()
+		go serveHandshake(t, server, c.supported)
+		conn, err := negotiate(client, c.offered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chosen := ""
+		if compressed, ok := conn.(*msgs.CompressedConn); ok {
+			chosen = compressed.Compression()
+		}
+		if chosen != c.chosen {
+			t.Errorf("%v offered to %v negotiated %q, expected %q", c.offered, c.supported, chosen, c.chosen)
+		}
+		conn.Write([]byte("get A\n"))
+		if echo, err := bufio.NewReader(conn).ReadString('\n'); err != nil || echo != "get A\n" {
+			t.Errorf("%v offered to %v: echo %q (%v)", c.offered, c.supported, echo, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestParseCompressions(t *testing.T) {
+	if _, err := parseCompressions("zstd,gzip"); err != nil {
+		t.Error(err)
+	}
+	if _, err := parseCompressions("zstd,lz4"); err == nil {
+		t.Error("Unsupported compression was accepted")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"sync"
+	"time"
+)
+
+var hdr_file = flag.String("hdrfile", "", "File to write an HDR histogram of the latencies of the run to, on exit, in the HdrHistogram log format")
+
+// latencies above this are recorded as this
+const hdrHighest = int64(time.Hour)
+
+// hdrDigits is the number of significant decimal digits kept of each value
+const hdrDigits = 3
+
+// cookies of the V2 encoding, with the word size set as by HdrHistogram
+const (
+	hdrEncodingCookie   = 0x1c849303 | 0x10
+	hdrCompressedCookie = 0x1c849304 | 0x10
+)
+
+// hdrHistogram is a high dynamic range histogram of latencies, in
+// nanoseconds from 1ns to an hour, with hdrDigits significant digits. Its
+// buckets are laid out as HdrHistogram's, so that it can be written in the
+// standard encoding and read by HdrHistogram tools. It is safe for
+// concurrent access, and a nil *hdrHistogram records nothing
+type hdrHistogram struct {
+	start time.Time
+	// layout of the buckets, each of which has subBucketCount sub-buckets,
+	// the first half of them overlapping with the previous bucket
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount          int64
+	subBucketMask               int64
+	counts                      []int64
+	total                       int64
+	max                         int64
+	sync.Mutex
+}
+
+func newHDRHistogram(start time.Time) *hdrHistogram {
+	largestSingleUnit := 2 * int64(math.Pow10(hdrDigits))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestSingleUnit))))
+	subBucketCount := int64(1) << subBucketCountMagnitude
+	buckets := 1
+	for smallestUntrackable := subBucketCount; smallestUntrackable <= hdrHighest; smallestUntrackable <<= 1 {
+		buckets++
+	}
+	return &hdrHistogram{
+		start:                       start,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketHalfCount:          subBucketCount / 2,
+		subBucketMask:               subBucketCount - 1,
+		counts:                      make([]int64, (buckets+1)*int(subBucketCount/2))}
+}
+
+// index returns the index of the count of value
+func (h *hdrHistogram) index(value int64) int {
+	bucket := 64 - bits.LeadingZeros64(uint64(value|h.subBucketMask)) - int(h.subBucketHalfCountMagnitude+1)
+	subBucket := value >> uint(bucket)
+	return int(int64(bucket+1)<<h.subBucketHalfCountMagnitude + subBucket - h.subBucketHalfCount)
+}
+
+// highestEquivalent returns the highest value counted at index i
+func (h *hdrHistogram) highestEquivalent(i int) int64 {
+	bucket := i>>h.subBucketHalfCountMagnitude - 1
+	subBucket := int64(i)&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucket < 0 {
+		subBucket -= h.subBucketHalfCount
+		bucket = 0
+	}
+	return subBucket<<uint(bucket) + int64(1)<<uint(bucket) - 1
+}
+
+// Observe records a latency
+func (h *hdrHistogram) Observe(latency time.Duration) {
+	if h == nil {
+		return
+	}
+	value := latency.Nanoseconds()
+	if value < 0 {
+		value = 0
+	} else if value > hdrHighest {
+		value = hdrHighest
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.counts[h.index(value)]++
+	h.total++
+	if value > h.max {
+		h.max = value
+	}
+}
+
+// Percentile returns the latency at percentile p of those recorded, to
+// hdrDigits significant digits
+func (h *hdrHistogram) Percentile(p float64) time.Duration {
+	h.Lock()
+	defer h.Unlock()
+	target := int64(p/100*float64(h.total) + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for i, count := range h.counts {
+		if seen += count; seen >= target {
+			return time.Duration(h.highestEquivalent(i))
+		}
+	}
+	return 0
+}
+
+// encode the histogram in the compressed V2 encoding of HdrHistogram
+func (h *hdrHistogram) encode() ([]byte, error) {
+	// counts are ZigZag LEB128 encoded, up to that of the maximum, with runs
+	// of zeros as their negated length
+	var counts []byte
+	varint := make([]byte, binary.MaxVarintLen64)
+	put := func(v int64) {
+		n := binary.PutUvarint(varint, uint64(v<<1^v>>63))
+		counts = append(counts, varint[:n]...)
+	}
+	last := h.index(h.max)
+	for i := 0; i <= last; {
+		if h.counts[i] != 0 {
+			put(h.counts[i])
+			i++
+			continue
+		}
+		zeros := 0
+		for ; i <= last && h.counts[i] == 0; i++ {
+			zeros++
+		}
+		if zeros > 1 {
+			put(-int64(zeros))
+		} else {
+			put(0)
+		}
+	}
+
+	var payload bytes.Buffer
+	binary.Write(&payload, binary.BigEndian, []int32{hdrEncodingCookie, int32(len(counts)), 0, hdrDigits})
+	binary.Write(&payload, binary.BigEndian, []int64{1, hdrHighest})
+	binary.Write(&payload, binary.BigEndian, float64(1))
+	payload.Write(counts)
+
+	var compressed bytes.Buffer
+	w, err := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(payload.Bytes())
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []int32{hdrCompressedCookie, int32(compressed.Len())})
+	b.Write(compressed.Bytes())
+	return b.Bytes(), nil
+}
+
+// Write the histogram as an HdrHistogram log of a single interval, from
+// the start of the run until end. The interval maximum is in milliseconds,
+// as by HdrHistogram's log writer
+func (h *hdrHistogram) Write(w io.Writer, end time.Time) error {
+	h.Lock()
+	defer h.Unlock()
+	b, err := h.encode()
+	if err != nil {
+		return err
+	}
+	start := float64(h.start.UnixNano()) / 1e9
+	fmt.Fprintln(w, "#[Histogram log format version 1.3]")
+	fmt.Fprintf(w, "#[StartTime: %.3f (seconds since epoch), %s]\n", start, h.start.Format(time.UnixDate))
+	fmt.Fprintln(w, `"StartTimestamp","Interval_Length","Interval_Max","Interval_Compressed_Histogram"`)
+	_, err = fmt.Fprintf(w, "%.3f,%.3f,%.3f,%s\n", 0.0, end.Sub(h.start).Seconds(), float64(h.max)/1e6,
+		base64.StdEncoding.EncodeToString(b))
+	return err
+}
+
+func writeHDR(filename string, h *hdrHistogram) {
+	glog.Info("Writing latency histogram to ", filename)
+	file, err := os.Create(filename)
+	if err != nil {
+		glog.Warning(err)
+		return
+	}
+	defer file.Close()
+	if err = h.Write(file, time.Now()); err != nil {
+		glog.Warning(err)
+	}
+}
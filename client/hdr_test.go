@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeHDR decodes the counts of a histogram in the compressed V2
+// encoding, checking its cookies
+func decodeHDR(t *testing.T, b []byte) []int64 {
+	var header [2]int32
+	if err := binary.Read(bytes.NewReader(b), binary.BigEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	if header[0] != hdrCompressedCookie || int(header[1]) != len(b)-8 {
+		t.Fatalf("Compressed header was %x", header)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(b[8:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cookie, length, offset, digits int32
+	var lowest, highest int64
+	var ratio float64
+	p := bytes.NewReader(payload)
+	for _, v := range []interface{}{&cookie, &length, &offset, &digits, &lowest, &highest, &ratio} {
+		binary.Read(p, binary.BigEndian, v)
+	}
+	if cookie != hdrEncodingCookie || int(length) != p.Len() || digits != hdrDigits || lowest != 1 || highest != hdrHighest || ratio != 1 {
+		t.Fatalf("Payload header was %x %d %d %d %d %d %f", cookie, length, offset, digits, lowest, highest, ratio)
+	}
+	var counts []int64
+	for p.Len() > 0 {
+		v, err := binary.ReadUvarint(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := int64(v>>1) ^ -int64(v&1)
+		if count < 0 {
+			counts = append(counts, make([]int64, -count)...)
+		} else {
+			counts = append(counts, count)
+		}
+	}
+	return counts
+}
+
+// check percentiles of known latencies, before and after being written
+// and read back in the HdrHistogram log format
+func TestHDRHistogram(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	h := newHDRHistogram(start)
+	for i := 1; i <= 10000; i++ {
+		h.Observe(time.Duration(i) * time.Microsecond)
+	}
+	h.Observe(2 * time.Hour)
+	percentiles := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{50, 5 * time.Millisecond},
+		{90, 9 * time.Millisecond},
+		{99, 9900 * time.Microsecond},
+		{100, time.Hour},
+	}
+	check := func(name string, h *hdrHistogram) {
+		for _, c := range percentiles {
+			got := h.Percentile(c.p)
+			// within the 3 significant digits kept
+			if diff := got - c.expected; diff < 0 || diff > c.expected/1000 {
+				t.Errorf("%s: p%g was %v, expected %v", name, c.p, got, c.expected)
+			}
+		}
+	}
+	check("recorded", h)
+
+	var b bytes.Buffer
+	if err := h.Write(&b, start.Add(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for s := bufio.NewScanner(&b); s.Scan(); {
+		lines = append(lines, s.Text())
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "#[Histogram log format version") ||
+		!strings.HasPrefix(lines[1], "#[StartTime: 1700000000.000 ") {
+		t.Fatalf("Log was %q", lines)
+	}
+	fields := strings.Split(lines[3], ",")
+	if len(fields) != 4 || fields[0] != "0.000" || fields[1] != "90.000" || fields[2] != "3600000.000" {
+		t.Fatalf("Interval was %q", lines[3])
+	}
+	encoded, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := newHDRHistogram(start)
+	for i, count := range decodeHDR(t, encoded) {
+		decoded.counts[i] = count
+		decoded.total += count
+	}
+	check("decoded", decoded)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"sync/atomic"
+	"time"
+)
+
+// hedger decides when to hedge reads, from the latency of recent reads.
+// It is safe for concurrent access
+type hedger struct {
+	latency *adaptiveTimeout
+	fired   int64 // hedges sent
+	won     int64 // hedges which replied first
+}
+
+// newHedger hedges reads which take longer than percentile of recent reads,
+// up to max
+func newHedger(percentile float64, max time.Duration) *hedger {
+	return &hedger{latency: newAdaptiveTimeout(1000, percentile, 1, time.Millisecond, max)}
+}
+
+func (h *hedger) Fired() int { return int(atomic.LoadInt64(&h.fired)) }
+func (h *hedger) Won() int   { return int(atomic.LoadInt64(&h.won)) }
+
+type hedgeResult struct {
+	reply  *msgs.ClientResponse
+	err    error
+	hedged bool // the reply is the hedge's
+}
+
+// hedgeRead sends the request to another server and waits up to remaining
+// for either it or the original request to reply. The first reply is used
+// and the connection of the other is closed, the client keeps the winner's
+// connection. sent is false if there is no other server to hedge on
+func (c *client) hedgeRead(b []byte, replyCh <-chan []byte, errCh <-chan error, remaining time.Duration) (result hedgeResult, sent bool) {
+	addrs := c.addrs()
+	conn, leader, err := connect(addrs, 1, (c.leader+1)%len(addrs))
+	if err != nil || leader == c.leader {
+		// there is no other server to hedge on
+		if err == nil {
+			conn.Close()
+		}
+		reply, err := receive(replyCh, errCh, remaining)
+		return hedgeResult{reply, err, false}, false
+	}
+	glog.Info("Hedging request ", c.requestID, " on server ", leader)
+	atomic.AddInt64(&c.hedge.fired, 1)
+
+	rd := bufio.NewReader(conn)
+	hedgeCh, hedgeErrCh := c.dispatchCurrent(b, conn, rd)
+	results := make(chan hedgeResult, 2)
+	go func() {
+		reply, err := receive(replyCh, errCh, remaining)
+		results <- hedgeResult{reply, err, false}
+	}()
+	go func() {
+		reply, err := receive(hedgeCh, hedgeErrCh, remaining)
+		results <- hedgeResult{reply, err, true}
+	}()
+
+	result = <-results
+	if result.err != nil {
+		result = <-results
+	}
+	if result.err == nil && result.hedged {
+		// cancel the original request, and use the hedge's connection from now on
+		atomic.AddInt64(&c.hedge.won, 1)
+		c.conn.Close()
+		c.use(conn, rd, leader)
+	} else {
+		conn.Close()
+	}
+	return result, true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	tests := []struct {
+		primaryDelay time.Duration
+		response     string
+		hedged       int
+		won          int
+	}{
+		// primary is slower than the threshold, so the hedge replies first
+		{200 * time.Millisecond, "fast", 1, 1},
+		// primary replies within the threshold, so no hedge is sent
+		{0, "0", 0, 0},
+	}
+	for _, test := range tests {
+		primary := newFakeServer(t, test.primaryDelay)
+		second := newFakeServer(t, 0)
+		second.response = "fast"
+		c := newTestClient(t, primary.addr, second.addr)
+		c.hedge = newHedger(95, c.timeout)
+		for i := 0; i < 10; i++ {
+			c.hedge.latency.Observe(20 * time.Millisecond)
+		}
+
+		api := &oneCommand{text: "get A"}
+		c.run(api)
+		if api.response != test.response {
+			t.Errorf("Primary delay %s: response %q, expected %q", test.primaryDelay, api.response, test.response)
+		}
+		if c.hedge.Fired() != test.hedged || c.hedge.Won() != test.won {
+			t.Errorf("Primary delay %s: %d hedges fired and %d won, expected %d and %d",
+				test.primaryDelay, c.hedge.Fired(), c.hedge.Won(), test.hedged, test.won)
+		}
+		if n := len(second.Received()); n != test.hedged {
+			t.Errorf("Primary delay %s: second server received %d requests, expected %d", test.primaryDelay, n, test.hedged)
+		}
+		if test.won > 0 && c.leader != 1 {
+			t.Errorf("Client did not switch to the hedge's server, leader is %d", c.leader)
+		}
+	}
+}
+
+// check that a hedged read whose hedge replies first with a rejection is
+// retried as other requests are, refreshing the token or by the retry policy
+func TestHedgeRetried(t *testing.T) {
+	for _, rejection := range []string{"unauthorized", "busy"} {
+		primary := newFakeServer(t, 200*time.Millisecond)
+		second := newFakeServer(t, 0)
+		second.response = "fast"
+		c := newTestClient(t, primary.addr, second.addr)
+		c.hedge = newHedger(95, c.timeout)
+		for i := 0; i < 10; i++ {
+			c.hedge.latency.Observe(20 * time.Millisecond)
+		}
+		if rejection == "unauthorized" {
+			filename := filepath.Join(t.TempDir(), "token")
+			if err := ioutil.WriteFile(filename, []byte("old\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			c.auth, _ = newTokenSource("", filename)
+			if err := ioutil.WriteFile(filename, []byte("new\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			// as if unmodified, so the token is only reread on rejection
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.auth.modTime = info.ModTime()
+			primary.token, second.token = "new", "new"
+		} else {
+			second.overloaded = 1
+		}
+
+		if response := c.submit("get A", false); response != "fast" {
+			t.Errorf("Hedge replied %s: response %q, expected %q", rejection, response, "fast")
+		}
+		if n := len(second.Received()); n != 2 {
+			t.Errorf("Hedge replied %s: second server received %d requests, expected 2", rejection, n)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"github.com/heidi-ann/hydra/config"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer records the requests it receives and replies after delay
+type fakeServer struct {
+	addr     string
+	delay    time.Duration
+	drop     int      // close the connection instead of replying to this many requests
+	stale    int      // send a reply to the previous request first, for this many requests
+	response string   // response to each request, "0" if empty
+	chunks   []string // if not nil, the response is streamed as these chunks
+	conns    int      // connections accepted
+	token    string   // if not empty, requests without this token are rejected
+	closed   int      // connections closed by the client
+	serial   bool     // handle one request at a time across all connections
+	busy     sync.Mutex
+	requests []msgs.ClientRequest
+	// status of each response, StatusOK if not set, or none if legacy
+	status msgs.Status
+	legacy bool
+	// requests being handled, and the most handled at once
+	active, maxActive int
+	// send a reply to an earlier try of the request first, with the same
+	// RequestID, for this many requests
+	retried int
+	// do not echo correlation tokens, as older servers
+	uncorrelated bool
+	// transactions received, which are aborted with abort if it is set,
+	// or committed otherwise
+	txns  []msgs.TxnRequest
+	abort string
+	// if not nil, requests with another signature close the connection, and
+	// replies are signed, with this many changed after being signed
+	secret   []byte
+	tamper   int
+	rejected int // requests with an invalid signature
+	// members in replies to membership requests, the server being the master
+	members []msgs.Member
+	// reply that the server is busy to this many requests, and do not reply
+	// at all, leaving the connection open, to this many more after them
+	overloaded int
+	silent     int
+	// respond with the text of each request, instead of response
+	echo bool
+	// wait this long between writing the first half of each reply and the
+	// rest of it
+	trickle time.Duration
+	// backpressure hint of this many replies
+	hints      int
+	throttle   float64
+	retryAfter time.Duration
+	// report delay as the processing time of each reply
+	reportDelay bool
+	// delay only this many requests, all of them if zero
+	delayed int
+	// version of each reply in turn, none once they are used up
+	versions []uint64
+	// size of each request received and of each reply or chunk written,
+	// without their newlines
+	requestSizes []int
+	replySizes   []int
+	sync.Mutex
+}
+
+func newFakeServer(t *testing.T, delay time.Duration) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeServer{addr: ln.Addr().String(), delay: delay}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.Lock()
+			s.conns++
+			s.Unlock()
+			go s.handle(t, conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) handle(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		b, err := rd.ReadBytes('\n')
+		if err != nil {
+			s.Lock()
+			s.closed++
+			s.Unlock()
+			return
+		}
+		if _, ok, _ := msgs.BytesToMembershipRequest(b); ok {
+			s.Lock()
+			reply, _ := msgs.Marshal(msgs.MembershipResponse{Members: s.members})
+			s.Unlock()
+			conn.Write(append(reply, '\n'))
+			continue
+		}
+		if txn, ok, err := msgs.BytesToTxnRequest(b); ok || err != nil {
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s.handleTxn(conn, txn)
+			continue
+		}
+		var req msgs.ClientRequest
+		if err := msgs.Unmarshal(b, &req); err != nil {
+			t.Error(err)
+			return
+		}
+		s.Lock()
+		if s.secret != nil && !msgs.Verify(&req, s.secret) {
+			s.rejected++
+			s.Unlock()
+			return
+		}
+		s.requests = append(s.requests, req)
+		s.requestSizes = append(s.requestSizes, len(b)-1)
+		delay := s.delay
+		if s.delayed > 0 && len(s.requests) > s.delayed {
+			delay = 0
+		}
+		drop := s.drop > 0
+		s.drop--
+		stale := s.stale > 0
+		s.stale--
+		retried := s.retried > 0
+		s.retried--
+		overloaded := s.overloaded > 0
+		s.overloaded--
+		silent := !overloaded && s.silent > 0
+		if silent {
+			s.silent--
+		}
+		correlation := req.Correlation
+		if s.uncorrelated {
+			correlation = ""
+		}
+		response := "0"
+		if s.response != "" {
+			response = s.response
+		}
+		if s.echo {
+			response = req.Request
+		}
+		chunks := s.chunks
+		serial := s.serial
+		status := msgs.StatusOK
+		if s.status != msgs.StatusNone || s.legacy {
+			status = s.status
+		}
+		unauthorized := s.token != "" && req.Auth != s.token
+		s.active++
+		if s.active > s.maxActive {
+			s.maxActive = s.active
+		}
+		s.Unlock()
+		if drop {
+			s.done()
+			return
+		}
+		if silent {
+			s.done()
+			continue
+		}
+
+		if serial {
+			s.busy.Lock()
+			time.Sleep(delay)
+			s.busy.Unlock()
+		} else {
+			time.Sleep(delay)
+		}
+		s.done()
+		if overloaded {
+			s.reply(conn, msgs.ClientResponse{
+				ClientID:    req.ClientID,
+				RequestID:   req.RequestID,
+				Status:      msgs.StatusBusy,
+				Correlation: correlation})
+			continue
+		}
+		if unauthorized {
+			s.reply(conn, msgs.ClientResponse{
+				ClientID:     req.ClientID,
+				RequestID:    req.RequestID,
+				Unauthorized: true,
+				Status:       msgs.StatusError,
+				Correlation:  correlation})
+			continue
+		}
+		if stale {
+			s.reply(conn, msgs.ClientResponse{
+				ClientID:  req.ClientID,
+				RequestID: req.RequestID - 1,
+				Response:  "stale",
+				Status:    msgs.StatusOK})
+		}
+		if retried {
+			s.reply(conn, msgs.ClientResponse{
+				ClientID:    req.ClientID,
+				RequestID:   req.RequestID,
+				Response:    "retried",
+				Status:      msgs.StatusOK,
+				Correlation: "earlier try"})
+		}
+		if chunks == nil {
+			chunks = []string{response}
+		} else if len(chunks) == 0 {
+			chunks = []string{""}
+		}
+		for i, chunk := range chunks {
+			s.reply(conn, msgs.ClientResponse{
+				ClientID:    req.ClientID,
+				RequestID:   req.RequestID,
+				Response:    chunk,
+				More:        i < len(chunks)-1,
+				Status:      status,
+				Correlation: correlation})
+		}
+	}
+}
+
+// handleTxn replies to a transaction after delay, with the response to
+// each of its commands if it is committed
+func (s *fakeServer) handleTxn(conn net.Conn, txn msgs.TxnRequest) {
+	s.Lock()
+	s.txns = append(s.txns, txn)
+	abort := s.abort
+	s.Unlock()
+	time.Sleep(s.delay)
+	res := msgs.TxnResponse{
+		ClientID:    txn.ClientID,
+		RequestID:   txn.RequestID,
+		Committed:   abort == "",
+		Reason:      abort,
+		Correlation: txn.Correlation}
+	if res.Committed {
+		for range txn.Commands {
+			res.Responses = append(res.Responses, "0")
+		}
+	}
+	s.Lock()
+	if s.secret != nil {
+		msgs.Sign(&res, s.secret)
+	}
+	s.Unlock()
+	reply, _ := msgs.Marshal(res)
+	conn.Write(append(reply, '\n'))
+}
+
+// reply writes res to conn, signed if replies are signed
+func (s *fakeServer) reply(conn net.Conn, res msgs.ClientResponse) {
+	s.Lock()
+	if s.hints > 0 {
+		s.hints--
+		res.Throttle, res.RetryAfter = s.throttle, s.retryAfter
+	}
+	if s.reportDelay {
+		res.ServerProcessingTime = s.delay
+	}
+	if len(s.versions) > 0 {
+		res.Version, s.versions = s.versions[0], s.versions[1:]
+	}
+	if s.secret != nil {
+		msgs.Sign(&res, s.secret)
+		if s.tamper > 0 {
+			s.tamper--
+			res.Response = "tampered"
+		}
+	}
+	trickle := s.trickle
+	b, _ := msgs.Marshal(res)
+	s.replySizes = append(s.replySizes, len(b))
+	s.Unlock()
+	b = append(b, '\n')
+	if trickle > 0 {
+		conn.Write(b[:len(b)/2])
+		time.Sleep(trickle)
+		b = b[len(b)/2:]
+	}
+	conn.Write(b)
+}
+
+// Txns returns the transactions received so far
+func (s *fakeServer) Txns() []msgs.TxnRequest {
+	s.Lock()
+	defer s.Unlock()
+	return append([]msgs.TxnRequest{}, s.txns...)
+}
+
+// done finishes handling a request
+func (s *fakeServer) done() {
+	s.Lock()
+	s.active--
+	s.Unlock()
+}
+
+// MaxActive returns the most requests handled at once
+func (s *fakeServer) MaxActive() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.maxActive
+}
+
+// Received returns the requests received so far
+func (s *fakeServer) Received() []msgs.ClientRequest {
+	s.Lock()
+	defer s.Unlock()
+	return append([]msgs.ClientRequest{}, s.requests...)
+}
+
+// API issuing a single command
+type oneCommand struct {
+	text      string
+	replicate bool
+	done      bool
+	response  string
+}
+
+func (o *oneCommand) Next() (string, bool, bool) {
+	if o.done {
+		return "", false, false
+	}
+	o.done = true
+	return o.text, o.replicate, true
+}
+
+func (o *oneCommand) Return(str string) {
+	o.response = str
+}
+
+func (o *oneCommand) ReturnStream(chunks chan string) {
+	o.Return(reassemble(chunks))
+}
+
+// run a client for each API concurrently, sharing a coalescer, setup is
+// called for each client before it is run if not nil
+func runClients(t *testing.T, addr string, apis []*oneCommand, setup func(*client)) []*client {
+	stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Close()
+
+	var conf config.Config
+	conf.Addresses.Address = []string{addr}
+	conf.Parameters.Retries = 1
+	reads := newCoalescer()
+
+	cs := make([]*client, len(apis))
+	var wg sync.WaitGroup
+	for i := range apis {
+		cs[i] = newClient(i, conf, time.Second, stats)
+		cs[i].reads = reads
+		if setup != nil {
+			setup(cs[i])
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cs[i].run(apis[i])
+		}(i)
+	}
+	wg.Wait()
+	return cs
+}
+
+// API issuing a list of commands
+type commandList struct {
+	commands  []string
+	replicate bool
+	responses []string
+}
+
+func (l *commandList) Next() (string, bool, bool) {
+	if len(l.responses) == len(l.commands) {
+		return "", false, false
+	}
+	return l.commands[len(l.responses)], l.replicate, true
+}
+
+func (l *commandList) Return(str string) {
+	l.responses = append(l.responses, str)
+}
+
+func (l *commandList) ReturnStream(chunks chan string) {
+	l.Return(reassemble(chunks))
+}
+
+// newTestClient connects a client to addrs, with stats written to a
+// temporary file
+func newTestClient(t *testing.T, addrs ...string) *client {
+	stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stats.Close() })
+	var conf config.Config
+	conf.Addresses.Address = addrs
+	conf.Parameters.Retries = 1
+	return newClient(0, conf, time.Second, stats)
+}
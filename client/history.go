@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/heidi-ann/hydra/history"
+	"io"
+	"time"
+)
+
+var history_file = flag.String("history", "", "File to record the history of operations to, for checking linearizability. In checklin mode, the history to check")
+
+// historyAPI records the result of the current operation of a client to
+// the history when it is returned to the API
+type historyAPI struct {
+	API
+	w      *history.Writer
+	client *client
+	op     history.Operation
+}
+
+// track starts recording text as an operation of c, returning the API to
+// pass its result to. If there is no history, ioapi is returned
+func (c *client) track(ioapi API, text string) API {
+	if c.history == nil {
+		return ioapi
+	}
+	return &historyAPI{ioapi, c.history, c, history.Operation{
+		Client:  c.id,
+		Start:   c.history.Since(time.Now()),
+		Command: text}}
+}
+
+// Return records the operation unless it failed before it was sent, in
+// which case it cannot have taken effect, or was cancelled, in which case
+// its result is unknown
+func (h *historyAPI) Return(str string) {
+	h.op.End = h.w.Since(time.Now())
+	h.op.Result = str
+	h.API.Return(str)
+	if str == ErrMsgTooLarge.Error() || str == ErrUnauthorized.Error() || str == ErrCancelled.Error() {
+		return
+	}
+	if err := h.w.Record(h.op); err != nil {
+		h.client.fatal(err)
+	}
+}
+
+func (h *historyAPI) ReturnStream(chunks chan string) {
+	h.Return(reassemble(chunks))
+}
+
+// reassemble the chunks of a streamed response
+func reassemble(chunks chan string) string {
+	str := ""
+	for chunk := range chunks {
+		str += chunk
+	}
+	return str
+}
+
+// checkHistory checks whether the history in filename is linearizable,
+// writing the minimal violation to w if it is not
+func checkHistory(w io.Writer, filename string) (bool, error) {
+	ops, err := history.Load(filename)
+	if err != nil {
+		return false, err
+	}
+	ok, violation := history.Check(ops)
+	if ok {
+		fmt.Fprintf(w, "History of %d operations is linearizable\n", len(ops))
+		return true, nil
+	}
+	fmt.Fprintf(w, "History of %d operations is not linearizable, minimal violation:\n", len(ops))
+	for _, op := range violation {
+		fmt.Fprintf(w, "  client %d [%s, %s] %s => %s\n", op.Client, op.Start, op.End, op.Command, op.Result)
+	}
+	return false, nil
+}
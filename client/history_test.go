@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"github.com/heidi-ann/hydra/history"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// check that the client records the history of its operations, which is
+// then checked for linearizability
+func TestHistory(t *testing.T) {
+	tests := []struct {
+		response string
+		ok       bool
+	}{
+		{"0", true},
+		{"5", false},
+	}
+	for _, test := range tests {
+		s := newFakeServer(t, 0)
+		s.response = test.response
+		filename := filepath.Join(t.TempDir(), "history.csv")
+		w, err := history.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newTestClient(t, s.addr)
+		c.history = w
+		c.run(&commandList{commands: []string{"get A", "get B", "get A"}})
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		ops, err := history.Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ops) != 3 || ops[0].Command != "get A" || ops[0].Result != test.response || ops[0].End < ops[0].Start {
+			t.Errorf("Recorded history %v", ops)
+		}
+		var out bytes.Buffer
+		ok, err := checkHistory(&out, filename)
+		if err != nil || ok != test.ok {
+			t.Errorf("Response %s: history linearizable %t (%v), expected %t", test.response, ok, err, test.ok)
+		}
+		if !test.ok && !strings.Contains(out.String(), "client 0") {
+			t.Errorf("Violation not reported: %s", out.String())
+		}
+	}
+}
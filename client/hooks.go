@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+)
+
+// Hooks are called around each request, for custom instrumentation
+type Hooks interface {
+	// BeforeSend is called once per request before it is first sent, it may
+	// modify the request but not its ClientID or RequestID. If it changes the
+	// Request but not the Command, the Command is parsed again from it
+	BeforeSend(req *msgs.ClientRequest)
+	// AfterReply is called after each failed attempt with the error, and
+	// after the reply is received
+	AfterReply(req *msgs.ClientRequest, resp *msgs.ClientResponse, err error)
+}
+
+// noHooks is the default Hooks, doing nothing
+type noHooks struct{}
+
+func (_ noHooks) BeforeSend(_ *msgs.ClientRequest) {}
+
+func (_ noHooks) AfterReply(_ *msgs.ClientRequest, _ *msgs.ClientResponse, _ error) {}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"github.com/heidi-ann/hydra/msgs"
+	"testing"
+)
+
+// hooks recording the order they are called in
+type recordingHooks struct {
+	calls []string
+}
+
+func (h *recordingHooks) BeforeSend(req *msgs.ClientRequest) {
+	h.calls = append(h.calls, "before "+req.Request)
+	req.Request = "get B"
+}
+
+func (h *recordingHooks) AfterReply(req *msgs.ClientRequest, resp *msgs.ClientResponse, err error) {
+	if err != nil {
+		h.calls = append(h.calls, "failed "+req.Request)
+		return
+	}
+	h.calls = append(h.calls, "reply "+req.Request+" "+resp.Response)
+}
+
+func TestHooks(t *testing.T) {
+	server := newFakeServer(t, 0)
+	server.drop = 1
+	hooks := &recordingHooks{}
+	runClients(t, server.addr, []*oneCommand{{text: "get A"}}, func(c *client) { c.hooks = hooks })
+
+	expected := []string{"before get A", "failed get B", "reply get B 0"}
+	if len(hooks.calls) != len(expected) {
+		t.Fatalf("Hooks called %v but %v was expected", hooks.calls, expected)
+	}
+	for i := range expected {
+		if hooks.calls[i] != expected[i] {
+			t.Errorf("Hook call %d was '%s' but '%s' was expected", i, hooks.calls[i], expected[i])
+		}
+	}
+
+	// the modified request was sent
+	for _, req := range server.Received() {
+		if req.Request != "get B" {
+			t.Errorf("Server received '%s' but the hook changed it to 'get B'", req.Request)
+		}
+	}
+
+	// and its structured form, parsed again from it
+	flag.Set("structured", "true")
+	defer flag.Set("structured", "false")
+	server = newFakeServer(t, 0)
+	runClients(t, server.addr, []*oneCommand{{text: "get A"}}, func(c *client) { c.hooks = &recordingHooks{} })
+	for _, req := range server.Received() {
+		if req.Command == nil || req.Text() != "get B" {
+			t.Errorf("Server received %+v but the hook changed it to 'get B'", req)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// inFlight counts the requests sent but not yet replied to, across all the
+// clients sharing it. A nil *inFlight counts each request on its own
+type inFlight struct {
+	n int64
+}
+
+// Start counts a request as sent, returning the number in flight including it
+func (f *inFlight) Start() int64 {
+	if f == nil {
+		return 1
+	}
+	return atomic.AddInt64(&f.n, 1)
+}
+
+// Done counts a request as replied to, or abandoned
+func (f *inFlight) Done() {
+	if f != nil {
+		atomic.AddInt64(&f.n, -1)
+	}
+}
+
+// Get returns the number of requests in flight
+func (f *inFlight) Get() int64 {
+	if f == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&f.n)
+}
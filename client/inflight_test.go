@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// check that the in flight column counts the requests outstanding across
+// clients in an open loop run
+func TestInFlight(t *testing.T) {
+	const clients = 4
+	filename := filepath.Join(t.TempDir(), "latency.csv")
+	stats, err := OpenStatsWriter(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeServer(t, 20*time.Millisecond)
+	q := newArrivalQueue(1000, 100)
+	defer q.Close()
+	inflight := new(inFlight)
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		c := newTestClient(t, s.addr)
+		c.id = i
+		c.stats = stats
+		c.queue = q
+		c.inflight = inflight
+		commands := make([]string, 5)
+		for j := range commands {
+			commands[j] = fmt.Sprint("get ", j)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.run(&commandList{commands: commands})
+		}()
+	}
+	wg.Wait()
+	if err = stats.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := inflight.Get(); n != 0 {
+		t.Errorf("%d requests in flight after the run", n)
+	}
+	records := readStats(t, filename, "")
+	if len(records) != clients*5 {
+		t.Fatalf("%d stats records, expected %d", len(records), clients*5)
+	}
+	max := 0
+	column := statsColumn(t, "in_flight")
+	for _, record := range records {
+		n, err := strconv.Atoi(record[column])
+		if err != nil || n < 1 || n > clients {
+			t.Errorf("In flight column was %q, expected 1 to %d", record[column], clients)
+		}
+		if n > max {
+			max = n
+		}
+	}
+	if max != clients {
+		t.Errorf("At most %d requests were in flight, expected %d", max, clients)
+	}
+}
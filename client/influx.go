@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// points queued for the InfluxDB sink, beyond which they are dropped
+const influxQueue = 10000
+
+// points written to InfluxDB in each request, at most
+const influxBatch = 1000
+
+// measurement name of the points
+const influxMeasurement = "hydra_request"
+
+// influxPoint is a completed request, as written to InfluxDB
+type influxPoint struct {
+	time    time.Time // when the request was generated
+	client  int
+	command string // first word of the command, e.g. get
+	latency time.Duration
+	tries   int
+}
+
+// influxSink writes the latency and tries of each request to InfluxDB, in
+// line protocol over HTTP. Points are batched and written every interval,
+// or once a batch is full. Writing never blocks the requests, points are
+// dropped if the queue is full and batches are dropped if writing fails.
+// It is safe for concurrent access, and a nil *influxSink writes nothing
+type influxSink struct {
+	write    string // URL of the write endpoint
+	http     *http.Client
+	interval time.Duration
+	points   chan influxPoint
+	dropped  int64 // points dropped as the queue was full
+	failed   int64 // points dropped as writing them failed
+	done     chan bool
+}
+
+// parseInflux parses the -influx flag, url,db, into the URL of the write
+// endpoint for the database
+func parseInflux(s string) (string, error) {
+	i := strings.LastIndex(s, ",")
+	if i < 0 || s[i+1:] == "" {
+		return "", errors.New("InfluxDB should be given as url,db: " + s)
+	}
+	base, err := url.Parse(s[:i])
+	if err != nil {
+		return "", err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return "", errors.New("InfluxDB URL should be http or https: " + s[:i])
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/write"
+	base.RawQuery = url.Values{"db": {s[i+1:]}, "precision": {"ns"}}.Encode()
+	return base.String(), nil
+}
+
+// newInfluxSink writes points to the InfluxDB write endpoint every interval
+func newInfluxSink(write string, interval time.Duration) *influxSink {
+	s := &influxSink{
+		write:    write,
+		http:     &http.Client{Timeout: 10 * time.Second},
+		interval: interval,
+		points:   make(chan influxPoint, influxQueue),
+		done:     make(chan bool)}
+	go s.run()
+	return s
+}
+
+func (s *influxSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	var batch []influxPoint
+	for {
+		select {
+		case p, ok := <-s.points:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, p)
+			if len(batch) < influxBatch {
+				continue
+			}
+		case <-ticker.C:
+		}
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes a batch of points. Failures are logged, and the batch dropped
+func (s *influxSink) flush(batch []influxPoint) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.post(formatInflux(batch)); err != nil {
+		glog.Warning("Unable to write ", len(batch), " points to InfluxDB: ", err)
+		atomic.AddInt64(&s.failed, int64(len(batch)))
+	}
+}
+
+func (s *influxSink) post(body string) error {
+	resp, err := s.http.Post(s.write, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Observe queues a completed request, generated at when, which took tries
+// attempts
+func (s *influxSink) Observe(when time.Time, client int, command string, latency time.Duration, tries int) {
+	if s == nil {
+		return
+	}
+	p := influxPoint{when, client, commandName(command), latency, tries}
+	select {
+	case s.points <- p:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// Failed returns the number of points dropped as writing them failed
+func (s *influxSink) Failed() int64 {
+	return atomic.LoadInt64(&s.failed)
+}
+
+// Close writes the queued points
+func (s *influxSink) Close() {
+	if s == nil {
+		return
+	}
+	close(s.points)
+	<-s.done
+	if dropped := atomic.LoadInt64(&s.dropped); dropped > 0 {
+		glog.Warning(dropped, " InfluxDB points were dropped as the queue was full")
+	}
+	if failed := s.Failed(); failed > 0 {
+		glog.Warning(failed, " InfluxDB points were dropped as writing them failed")
+	}
+}
+
+// influxEscape escapes a tag value for line protocol
+var influxEscape = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\\", `\\`)
+
+// formatInflux formats a batch of points in line protocol, one per line.
+// Tags with no value are left out, as line protocol does not allow them
+func formatInflux(batch []influxPoint) string {
+	var b strings.Builder
+	for _, p := range batch {
+		b.WriteString(influxMeasurement)
+		b.WriteString(",client=")
+		b.WriteString(strconv.Itoa(p.client))
+		if p.command != "" {
+			b.WriteString(",command=")
+			b.WriteString(influxEscape.Replace(p.command))
+		}
+		fmt.Fprintf(&b, " latency_ns=%di,tries=%di %d\n", p.latency.Nanoseconds(), p.tries, p.time.UnixNano())
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInfluxFormat(t *testing.T) {
+	when := time.Unix(1700000000, 5)
+	batch := []influxPoint{
+		{when, 0, "get", 12500 * time.Microsecond, 1},
+		{when.Add(time.Millisecond), 3, "update", time.Second, 2},
+		{when, 1, "", time.Millisecond, 1},
+		{when, 2, "a,b c=d", time.Millisecond, 1},
+	}
+	expected := []string{
+		"hydra_request,client=0,command=get latency_ns=12500000i,tries=1i 1700000000000000005",
+		"hydra_request,client=3,command=update latency_ns=1000000000i,tries=2i 1700000000001000005",
+		"hydra_request,client=1 latency_ns=1000000i,tries=1i 1700000000000000005",
+		`hydra_request,client=2,command=a\,b\ c\=d latency_ns=1000000i,tries=1i 1700000000000000005`,
+	}
+	lines := strings.Split(strings.TrimSuffix(formatInflux(batch), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Formatted %d lines, expected %d: %q", len(lines), len(expected), lines)
+	}
+	for i := range lines {
+		if lines[i] != expected[i] {
+			t.Errorf("Point %d formatted as %q, expected %q", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestParseInflux(t *testing.T) {
+	cases := []struct {
+		flag  string
+		write string // empty if invalid
+	}{
+		{"http://localhost:8086,hydra", "http://localhost:8086/write?db=hydra&precision=ns"},
+		{"https://influx:8086/,my db", "https://influx:8086/write?db=my+db&precision=ns"},
+		{"http://localhost:8086", ""},
+		{"http://localhost:8086,", ""},
+		{"localhost:8086,hydra", ""},
+	}
+	for _, c := range cases {
+		write, err := parseInflux(c.flag)
+		if c.write == "" {
+			if err == nil {
+				t.Errorf("%q was parsed as %q, expected an error", c.flag, write)
+			}
+			continue
+		}
+		if err != nil || write != c.write {
+			t.Errorf("%q was parsed as %q (%v), expected %q", c.flag, write, err, c.write)
+		}
+	}
+}
+
+// check that points are batched, and that failed writes do not block
+func TestInfluxSink(t *testing.T) {
+	cases := []struct {
+		status  int
+		points  int
+		batches int // at most
+		failed  int64
+	}{
+		{http.StatusNoContent, 5, 1, 0},
+		{http.StatusNoContent, influxBatch + 1, 2, 0},
+		{http.StatusInternalServerError, 5, 1, 5},
+	}
+	for i, c := range cases {
+		var lock sync.Mutex
+		var bodies []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			lock.Lock()
+			bodies = append(bodies, string(b))
+			lock.Unlock()
+			if r.URL.Path != "/write" || r.URL.Query().Get("db") != "hydra" {
+				t.Errorf("case %d: written to %s", i, r.URL)
+			}
+			w.WriteHeader(c.status)
+		}))
+		write, err := parseInflux(srv.URL + ",hydra")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newInfluxSink(write, time.Hour)
+		for j := 0; j < c.points; j++ {
+			s.Observe(time.Now(), j, "get A", time.Millisecond, 1)
+		}
+		s.Close()
+		srv.Close()
+
+		lines := strings.Count(strings.Join(bodies, ""), "\n")
+		if lines != c.points {
+			t.Errorf("case %d: %d points written, expected %d", i, lines, c.points)
+		}
+		if len(bodies) > c.batches {
+			t.Errorf("case %d: %d batches written, expected at most %d", i, len(bodies), c.batches)
+		}
+		if s.Failed() != c.failed {
+			t.Errorf("case %d: %d points failed, expected %d", i, s.Failed(), c.failed)
+		}
+	}
+}
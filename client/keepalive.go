@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/config"
+	"net"
+	"time"
+)
+
+// keepAliveConfig returns the TCP keepalive of the [keepalive] section of
+// conf, or false if it is not enabled, so Go's defaults are kept
+func keepAliveConfig(conf config.Config) (net.KeepAliveConfig, bool) {
+	k := conf.KeepAlive
+	if !k.Enable {
+		return net.KeepAliveConfig{}, false
+	}
+	return net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     time.Duration(k.Idle) * time.Millisecond,
+		Interval: time.Duration(k.Interval) * time.Millisecond,
+		Count:    k.Count}, true
+}
+
+// keepAliveDialer wraps a Dialer so that the TCP keepalive of each new
+// connection is set after dialing, with the idle time, interval and count
+// of probes set by socket options where the OS supports them
+type keepAliveDialer struct {
+	next   Dialer
+	config net.KeepAliveConfig
+}
+
+func (k *keepAliveDialer) Dial(addr string) (net.Conn, error) {
+	return k.apply(k.next.Dial(addr))
+}
+
+func (k *keepAliveDialer) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	return k.apply(k.next.DialTimeout(addr, timeout))
+}
+
+func (k *keepAliveDialer) apply(conn net.Conn, err error) (net.Conn, error) {
+	if err != nil {
+		return nil, err
+	}
+	tcp := tcpConn(conn)
+	if tcp == nil {
+		glog.Warning("Connection to ", conn.RemoteAddr(), " is not TCP, keepalive not set")
+		return conn, nil
+	}
+	if err := tcp.SetKeepAliveConfig(k.config); err != nil {
+		// the connection is still usable, with the default keepalive
+		glog.Warning("Unable to set keepalive of connection to ", conn.RemoteAddr(), ": ", err)
+	}
+	return conn, nil
+}
+
+// tcpConn returns the TCP connection under conn, which may be wrapped, e.g.
+// by TLS, or nil if it is not over TCP
+func tcpConn(conn net.Conn) *net.TCPConn {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+}
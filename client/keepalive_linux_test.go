@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// check that the keepalive settings are applied to the socket
+func TestKeepAliveSocket(t *testing.T) {
+	s := newFakeServer(t, 0)
+	k := &keepAliveDialer{defaultDialer, net.KeepAliveConfig{Enable: true, Idle: 7 * time.Second, Interval: 3 * time.Second, Count: 4}}
+	conn, err := k.DialTimeout(s.addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	raw, err := tcpConn(conn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := []struct {
+		name     string
+		level    int
+		opt      int
+		expected int
+	}{
+		{"SO_KEEPALIVE", syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1},
+		{"TCP_KEEPIDLE", syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 7},
+		{"TCP_KEEPINTVL", syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, 3},
+		{"TCP_KEEPCNT", syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, 4},
+	}
+	raw.Control(func(fd uintptr) {
+		for _, o := range options {
+			value, err := syscall.GetsockoptInt(int(fd), o.level, o.opt)
+			if err != nil || value != o.expected {
+				t.Errorf("%s was %d (%v), expected %d", o.name, value, err, o.expected)
+			}
+		}
+	})
+}
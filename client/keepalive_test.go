@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/tls"
+	"github.com/heidi-ann/hydra/config"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveConfig(t *testing.T) {
+	var conf config.Config
+	if _, ok := keepAliveConfig(conf); ok {
+		t.Error("Keepalive enabled without a [keepalive] section")
+	}
+	conf.KeepAlive.Enable = true
+	conf.KeepAlive.Idle, conf.KeepAlive.Interval, conf.KeepAlive.Count = 2000, 500, 4
+	k, ok := keepAliveConfig(conf)
+	expected := net.KeepAliveConfig{Enable: true, Idle: 2 * time.Second, Interval: 500 * time.Millisecond, Count: 4}
+	if !ok || k != expected {
+		t.Errorf("Keepalive was %+v, expected %+v", k, expected)
+	}
+}
+
+// check that the TCP connection is found under the wrappers of connections
+func TestTCPConn(t *testing.T) {
+	s := newFakeServer(t, 0)
+	conn, err := net.Dial("tcp", s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	wrapped := []net.Conn{
+		conn,
+		tls.Client(conn, &tls.Config{InsecureSkipVerify: true}),
+		&faultConn{tls.Client(conn, &tls.Config{InsecureSkipVerify: true}), nil},
+	}
+	for i, c := range wrapped {
+		if tcpConn(c) != conn {
+			t.Errorf("case %d: TCP connection not found under %T", i, c)
+		}
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if tcpConn(&faultConn{client, nil}) != nil {
+		t.Error("Pipe was taken for a TCP connection")
+	}
+}
+
+// check that requests are sent over connections with keepalive set, and
+// that connections which are not TCP are kept
+func TestKeepAliveDialer(t *testing.T) {
+	keepAlive := net.KeepAliveConfig{Enable: true, Idle: time.Second, Interval: time.Second, Count: 3}
+	s := newFakeServer(t, 0)
+	dialer = &keepAliveDialer{defaultDialer, keepAlive}
+	defer func() { dialer = defaultDialer }()
+	c := newTestClient(t, s.addr)
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Response was %q", response)
+	}
+
+	pipes := newPipeServers(t, 1, 0)
+	k := &keepAliveDialer{dialer, keepAlive}
+	conn, err := k.Dial(pipes[0].addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+var log_sample = flag.Float64("logsample", 1, "Fraction of requests, from 0 to 1, whose full request and response are logged at INFO level, the rest being left unlogged")
+var log_sample_seed = flag.Int64("logsampleseed", 0, "Seed of the choice of requests logged by -logsample, so that the same requests are logged in each run, 0 for a random seed")
+
+// logSample chooses the requests to log, nil if all are logged
+var logSample *logSampler
+
+// logSampler chooses a fraction of requests to log, by a hash of the seed
+// and the IDs of the client and request, so each request is logged on
+// every try or on none, and the same requests are logged for the same
+// seed. It is safe for concurrent access, and a nil *logSampler logs all
+type logSampler struct {
+	rate   float64
+	seed   int64
+	logged int64 // requests chosen
+}
+
+// newLogSampler returns a sampler logging rate of requests, chosen by seed,
+// or nil if all are logged. A seed of 0 is replaced by a random seed
+func newLogSampler(rate float64, seed int64) (*logSampler, error) {
+	if rate < 0 || rate > 1 {
+		return nil, errors.New("Log sample rate should be from 0 to 1")
+	}
+	if rate == 1 {
+		return nil, nil
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &logSampler{rate: rate, seed: seed}, nil
+}
+
+// Sampled returns true if request requestID of client id is to be logged,
+// counting it if so
+func (s *logSampler) Sampled(id int, requestID int) bool {
+	sampled := s.chosen(id, requestID)
+	if sampled && s != nil {
+		atomic.AddInt64(&s.logged, 1)
+	}
+	return sampled
+}
+
+// chosen is Sampled without counting the request, for its sends
+func (s *logSampler) chosen(id int, requestID int) bool {
+	if s == nil {
+		return true
+	}
+	var b [24]byte
+	binary.LittleEndian.PutUint64(b[0:], uint64(s.seed))
+	binary.LittleEndian.PutUint64(b[8:], uint64(id))
+	binary.LittleEndian.PutUint64(b[16:], uint64(requestID))
+	h := fnv.New64a()
+	h.Write(b[:])
+	// the top 53 bits, as a uniform fraction from 0 to 1
+	return float64(h.Sum64()>>11)/(1<<53) < s.rate
+}
+
+// Logged returns the number of requests chosen to be logged
+func (s *logSampler) Logged() int {
+	return int(atomic.LoadInt64(&s.logged))
+}
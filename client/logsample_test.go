@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+// check that the fraction of requests logged matches the rate, and that
+// the choice is the same for the same seed
+func TestLogSampler(t *testing.T) {
+	n := 100000
+	for _, rate := range []float64{0, 0.01, 0.1, 0.5} {
+		s, err := newLogSampler(rate, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _ := newLogSampler(rate, 42)
+		other, _ := newLogSampler(rate, 43)
+		differ := 0
+		for i := 0; i < n; i++ {
+			id, requestID := i%4, i/4
+			sampled := s.Sampled(id, requestID)
+			if again.Sampled(id, requestID) != sampled {
+				t.Fatalf("Rate %v: request %d of client %d sampled differently with the same seed", rate, requestID, id)
+			}
+			if other.Sampled(id, requestID) != sampled {
+				differ++
+			}
+		}
+		if observed := float64(s.Logged()) / float64(n); observed < rate*0.9 || observed > rate*1.1 {
+			t.Errorf("Rate %v: logged %v of requests", rate, observed)
+		}
+		if rate > 0 && differ == 0 {
+			t.Errorf("Rate %v: the same requests were sampled with another seed", rate)
+		}
+	}
+	if s, err := newLogSampler(1, 0); s != nil || err != nil || !s.Sampled(0, 0) {
+		t.Errorf("Sampler logging all was %+v, %v", s, err)
+	}
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := newLogSampler(rate, 0); err == nil {
+			t.Errorf("Rate %v was accepted", rate)
+		}
+	}
+}
+
+// check that clients log a sample of their requests
+func TestLogSample(t *testing.T) {
+	defer func() { logSample = nil }()
+	logSample, _ = newLogSampler(0.2, 7)
+	s := newFakeServer(t, 0)
+	c := newTestClient(t, s.addr)
+	commands := make([]string, 500)
+	for i := range commands {
+		commands[i] = "get A"
+	}
+	c.run(&commandList{commands: commands})
+	if logged := float64(logSample.Logged()) / float64(len(commands)); logged < 0.15 || logged > 0.25 {
+		t.Errorf("Logged %v of requests, expected 0.2", logged)
+	}
+}
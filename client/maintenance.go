@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"sort"
+	"sync"
+)
+
+// drained holds the servers drained for maintenance, shared by all clients
+var drained = newDrainSet()
+
+// drainSet is the set of addresses of servers which clients should move
+// off and not connect to, e.g. while they are under maintenance. Drained
+// servers are only used if every server is drained. It is safe for
+// concurrent access
+type drainSet struct {
+	addrs map[string]bool
+	sync.Mutex
+}
+
+func newDrainSet() *drainSet {
+	return &drainSet{addrs: map[string]bool{}}
+}
+
+// Drain stops clients using the server at addr
+func (d *drainSet) Drain(addr string) {
+	d.Lock()
+	defer d.Unlock()
+	d.addrs[addr] = true
+}
+
+// Undrain lets clients use the server at addr again
+func (d *drainSet) Undrain(addr string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.addrs, addr)
+}
+
+// Drained returns true if the server at addr is drained
+func (d *drainSet) Drained(addr string) bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.addrs[addr]
+}
+
+// List returns the drained addresses, sorted
+func (d *drainSet) List() []string {
+	d.Lock()
+	defer d.Unlock()
+	var addrs []string
+	for addr := range d.addrs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// Filter returns order, indexes of addrs, without those of drained
+// servers, or all of order if every server is drained
+func (d *drainSet) Filter(addrs []string, order []int) []int {
+	d.Lock()
+	defer d.Unlock()
+	var usable []int
+	for _, i := range order {
+		if !d.addrs[addrs[i]] {
+			usable = append(usable, i)
+		}
+	}
+	if len(usable) == 0 {
+		return order
+	}
+	return usable
+}
+
+// Avoid returns true if the server at index i of addrs is drained and
+// another is not, so clients should move off it
+func (d *drainSet) Avoid(addrs []string, i int) bool {
+	d.Lock()
+	defer d.Unlock()
+	if i < 0 || i >= len(addrs) || !d.addrs[addrs[i]] {
+		return false
+	}
+	for _, addr := range addrs {
+		if !d.addrs[addr] {
+			return true
+		}
+	}
+	return false
+}
+
+// drainServer drains, or undrains, the server target, by index in the
+// config or address, and returns the result for the API. If the client is
+// connected to a server it drains, it moves to another at once, other
+// clients moving before their next request
+func (c *client) drainServer(target string, drain bool) string {
+	addrs := c.addrs()
+	server, err := serverIndex(addrs, target)
+	if err != nil {
+		glog.Warning(err)
+		return err.Error()
+	}
+	if !drain {
+		drained.Undrain(addrs[server])
+		glog.Info("Undrained server ", server)
+		return fmt.Sprintf("Undrained server %d (%s)", server, addrs[server])
+	}
+	drained.Drain(addrs[server])
+	glog.Info("Drained server ", server)
+	if c.conn != nil && drained.Avoid(addrs, c.leader) {
+		glog.Info("Moving client ", c.id, " off drained server ", server)
+		c.reconnect()
+	}
+	return fmt.Sprintf("Drained server %d (%s)", server, addrs[server])
+}
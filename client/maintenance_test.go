@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDrainSet(t *testing.T) {
+	addrs := []string{"a:1", "b:1", "c:1"}
+	d := newDrainSet()
+	d.Drain("c:1")
+	d.Drain("a:1")
+	if list := d.List(); !reflect.DeepEqual(list, []string{"a:1", "c:1"}) {
+		t.Errorf("Drained %v", list)
+	}
+	if order := d.Filter(addrs, []int{2, 1, 0}); !reflect.DeepEqual(order, []int{1}) {
+		t.Errorf("Filtered order was %v, expected [1]", order)
+	}
+	if !d.Avoid(addrs, 0) || d.Avoid(addrs, 1) || d.Avoid(addrs, 3) {
+		t.Error("Wrong servers avoided")
+	}
+	// if every server is drained, they are all used
+	d.Drain("b:1")
+	if order := d.Filter(addrs, []int{2, 1, 0}); !reflect.DeepEqual(order, []int{2, 1, 0}) || d.Avoid(addrs, 0) {
+		t.Errorf("Filtered order with all drained was %v", order)
+	}
+	d.Undrain("a:1")
+	if d.Drained("a:1") || !d.Drained("b:1") {
+		t.Errorf("Drained %v after undraining a:1", d.List())
+	}
+}
+
+// check that clients move off a drained server, and do not use it until it
+// is undrained
+func TestDrainServer(t *testing.T) {
+	defer func() { drained = newDrainSet() }()
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0), newFakeServer(t, 0)}
+	addrs := []string{servers[0].addr, servers[1].addr, servers[2].addr}
+	c := newTestClient(t, addrs...)
+	other := newTestClient(t, addrs...)
+	if c.leader != 0 || other.leader != 0 {
+		t.Fatalf("Connected to servers %d and %d, expected 0", c.leader, other.leader)
+	}
+
+	// the client draining the server moves at once, others before their
+	// next request
+	if out := c.runControl("drain 0"); out != "Drained server 0 ("+addrs[0]+")" {
+		t.Errorf("Drain returned %q", out)
+	}
+	if c.leader != 1 {
+		t.Errorf("Moved to server %d, expected 1", c.leader)
+	}
+	other.run(&commandList{commands: []string{"get A"}})
+	if other.leader != 1 {
+		t.Errorf("Other client moved to server %d, expected 1", other.leader)
+	}
+	late := newTestClient(t, addrs...)
+	if late.leader != 1 {
+		t.Errorf("New client connected to server %d, expected 1", late.leader)
+	}
+	c.submit("get A", false)
+	if len(servers[0].Received()) != 0 || len(servers[1].Received()) != 2 {
+		t.Errorf("Servers received %d and %d requests, expected 0 and 2", len(servers[0].Received()), len(servers[1].Received()))
+	}
+
+	// once undrained, the server is failed over to again, skipping the one
+	// drained next
+	if out := c.runControl("undrain 0"); !strings.HasPrefix(out, "Undrained server 0") {
+		t.Errorf("Undrain returned %q", out)
+	}
+	c.runControl("drain " + addrs[2])
+	servers[1].Lock()
+	servers[1].drop = 1
+	servers[1].Unlock()
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Response was %q", response)
+	}
+	if c.leader != 0 || len(servers[0].Received()) != 1 || len(servers[2].Received()) != 0 {
+		t.Errorf("Failed over to server %d, expected undrained server 0", c.leader)
+	}
+
+	// servers which are not in the config are refused
+	if out := c.runControl("drain 3"); !strings.Contains(out, "not in the config") {
+		t.Errorf("Drain of unknown server returned %q", out)
+	}
+	if list := drained.List(); !reflect.DeepEqual(list, []string{addrs[2]}) {
+		t.Errorf("Drained %v", list)
+	}
+}
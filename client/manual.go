@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/golang/glog"
+	"strconv"
+)
+
+// ConnectAPI is implemented by APIs which move the client to a server of
+// their choosing, e.g. to debug how a given server responds
+type ConnectAPI interface {
+	// Connect returns the server to connect to, by index in the config or
+	// address, if the last command from Next was to connect, or "" otherwise
+	Connect() string
+}
+
+// serverIndex returns the index of target in addrs, which is either an
+// index or one of the addresses
+func serverIndex(addrs []string, target string) (int, error) {
+	if i, err := strconv.Atoi(target); err == nil {
+		if i < 0 || i >= len(addrs) {
+			return 0, fmt.Errorf("Server index %d is %w, which has %d servers", i, ErrUnknownServer, len(addrs))
+		}
+		return i, nil
+	}
+	for i, addr := range addrs {
+		if addr == target {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Server %s is %w", target, ErrUnknownServer)
+}
+
+// connectTo moves the client to the server target, overriding the choice
+// of leader, and returns the result for the API. The client still fails
+// over from it as usual. If it cannot be reached, the client stays on its
+// current server
+func (c *client) connectTo(target string) string {
+	addrs := c.addrs()
+	server, err := serverIndex(addrs, target)
+	if err != nil {
+		glog.Warning(err)
+		return err.Error()
+	}
+	conn, err := dialServer(addrs[server])
+	if err != nil {
+		glog.Warning("Unable to connect to server ", server, ": ", err)
+		return fmt.Sprintf("Unable to connect to server %d (%s): %v", server, addrs[server], err)
+	}
+	glog.Info("Moving client ", c.id, " to server ", server, " as requested")
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.use(conn, bufio.NewReader(conn), server)
+	return fmt.Sprintf("Connected to server %d (%s)", server, addrs[server])
+}
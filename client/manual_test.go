@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// API issuing commands, where those starting with ":connect " move the
+// client to a server
+type connectList struct {
+	commandList
+	target string
+}
+
+func (l *connectList) Next() (string, bool, bool) {
+	text, replicate, ok := l.commandList.Next()
+	l.target = ""
+	if strings.HasPrefix(text, ":connect ") {
+		l.target = strings.TrimPrefix(text, ":connect ")
+	}
+	return text, replicate, ok
+}
+
+func (l *connectList) Connect() string {
+	return l.target
+}
+
+// check the client moves to a server by index or address, and stays put
+// if the server is unknown
+func TestConnectTo(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0), newFakeServer(t, 0)}
+	c := newTestClient(t, servers[0].addr, servers[1].addr, servers[2].addr)
+	api := &connectList{commandList: commandList{commands: []string{
+		"update A 1",
+		":connect 2", "update A 2",
+		":connect " + servers[1].addr, "update A 3",
+		":connect 3", ":connect 127.0.0.1:1", "update A 4",
+	}, replicate: true}}
+	c.run(api)
+
+	expected := []string{"0", "Connected to server 2 (" + servers[2].addr + ")", "0",
+		"Connected to server 1 (" + servers[1].addr + ")", "0",
+		"Server index 3 is not in the config, which has 3 servers", "Server 127.0.0.1:1 is not in the config", "0"}
+	for i, response := range api.responses {
+		if i >= len(expected) || response != expected[i] {
+			t.Errorf("Response %d to %q was %q", i, api.commands[i], response)
+		}
+	}
+	for i, n := range []int{1, 2, 1} {
+		if received := servers[i].Received(); len(received) != n {
+			t.Errorf("Server %d received %d requests, expected %d", i, len(received), n)
+		}
+	}
+	if c.leader != 1 {
+		t.Errorf("Client is on server %d, expected 1", c.leader)
+	}
+}
+
+// check the client fails over as usual from a server it was moved to
+func TestConnectToFailover(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0), newFakeServer(t, 0)}
+	servers[1].drop = 1
+	c := newTestClient(t, servers[0].addr, servers[1].addr, servers[2].addr)
+	if result := c.connectTo("1"); !strings.HasPrefix(result, "Connected") {
+		t.Fatalf("Connecting to server 1 returned %q", result)
+	}
+	if response := c.submit("update A 1", true); response != "0" {
+		t.Errorf("Request returned %q", response)
+	}
+	if c.leader != 2 || len(servers[2].Received()) != 1 {
+		t.Errorf("Client failed over to server %d, expected 2", c.leader)
+	}
+}
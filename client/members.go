@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"github.com/heidi-ann/hydra/config"
+	"github.com/heidi-ann/hydra/msgs"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// fetch the cluster membership, following redirects until the master replies
+func fetchMembership(conf config.Config, timeout time.Duration) (*msgs.MembershipResponse, error) {
+	cc := newControlConn(func() []string { return conf.Addresses.Address }, conf.Parameters.Retries, timeout)
+	defer cc.Close()
+	return cc.Membership()
+}
+
+// write the membership table, noting any disagreement with the config
+func printMembership(w io.Writer, reply *msgs.MembershipResponse, conf config.Config) {
+	fmt.Fprintf(w, "Membership reported by node %d:\n", reply.SenderID)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPEER ADDRESS\tCLIENT ADDRESS\tROLE\tLIVE")
+	for _, m := range reply.Members {
+		client := "-"
+		if m.ID >= 0 && m.ID < len(conf.Addresses.Address) {
+			client = conf.Addresses.Address[m.ID]
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%t\n", m.ID, m.Address, client, m.Role, m.Live)
+	}
+	tw.Flush()
+
+	if len(reply.Members) != len(conf.Addresses.Address) {
+		fmt.Fprintf(w, "WARNING: cluster has %d members but config has %d addresses\n",
+			len(reply.Members), len(conf.Addresses.Address))
+	}
+}
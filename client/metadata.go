@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+var request_metadata = flag.String("metadata", "", "Metadata to attach to every request, as comma separated key=value pairs")
+
+// MetadataAPI is implemented by APIs which attach metadata, such as routing
+// hints or feature flags, to their requests
+type MetadataAPI interface {
+	// Metadata returns the metadata of the last command from Next, or nil
+	// if it has none
+	Metadata() map[string]string
+}
+
+// parseMetadata parses comma separated key=value pairs
+func parseMetadata(spec string) (map[string]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.New("Invalid metadata, expected key=value: " + pair)
+		}
+		metadata[kv[0]] = kv[1]
+	}
+	return metadata, nil
+}
+
+// requestMetadata merges the metadata of the client with that given by the
+// API for the current command, which takes precedence
+func (c *client) requestMetadata(ioapi API) map[string]string {
+	mapi, ok := ioapi.(MetadataAPI)
+	if !ok {
+		return c.defaultMetadata
+	}
+	metadata := mapi.Metadata()
+	if len(c.defaultMetadata) == 0 {
+		return metadata
+	}
+	merged := make(map[string]string, len(c.defaultMetadata)+len(metadata))
+	for k, v := range c.defaultMetadata {
+		merged[k] = v
+	}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// API issuing commands with metadata
+type metadataList struct {
+	commandList
+	metadata []map[string]string
+}
+
+func (l *metadataList) Metadata() map[string]string {
+	return l.metadata[len(l.responses)]
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		spec     string
+		metadata map[string]string
+		ok       bool
+	}{
+		{"", nil, true},
+		{"route=eu", map[string]string{"route": "eu"}, true},
+		{"a=1,b=x=y,c=", map[string]string{"a": "1", "b": "x=y", "c": ""}, true},
+		{"route", nil, false},
+		{"=1", nil, false},
+	}
+	for _, test := range tests {
+		metadata, err := parseMetadata(test.spec)
+		if (err == nil) != test.ok || !reflect.DeepEqual(metadata, test.metadata) {
+			t.Errorf("%q parsed as %v (%v), expected %v", test.spec, metadata, err, test.metadata)
+		}
+	}
+}
+
+// check that metadata from the API and the client reach the server, with
+// the API's taking precedence
+func TestRequestMetadata(t *testing.T) {
+	s := newFakeServer(t, 0)
+	c := newTestClient(t, s.addr)
+	c.defaultMetadata = map[string]string{"route": "eu", "flag": "on"}
+	api := &metadataList{
+		commandList: commandList{commands: []string{"get A", "get B", "get C"}},
+		metadata:    []map[string]string{nil, {"route": "us"}, {"trace": "x"}},
+	}
+	c.run(api)
+
+	expected := []map[string]string{
+		{"route": "eu", "flag": "on"},
+		{"route": "us", "flag": "on"},
+		{"route": "eu", "flag": "on", "trace": "x"},
+	}
+	received := s.Received()
+	if len(received) != len(expected) {
+		t.Fatalf("Server received %d requests, expected %d", len(received), len(expected))
+	}
+	for i, req := range received {
+		if !reflect.DeepEqual(req.Metadata, expected[i]) {
+			t.Errorf("Request %d had metadata %v, expected %v", i, req.Metadata, expected[i])
+		}
+	}
+
+	// without metadata, none is sent
+	c = newTestClient(t, s.addr)
+	c.run(&commandList{commands: []string{"get A"}})
+	if received = s.Received(); received[len(received)-1].Metadata != nil {
+		t.Errorf("Request had metadata %v, expected none", received[len(received)-1].Metadata)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var max_samples = flag.Int("maxsamples", 1000000, "Most latency samples to keep in memory for percentiles, beyond which a uniform random sample of them is kept. 0 for no limit")
+
+// upper bounds of the latency histogram buckets, in seconds
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// metrics counts requests and their latency for the whole client process.
+// It is safe for concurrent access, and a nil *metrics records nothing
+type metrics struct {
+	requests int64
+	attempts int64
+	goodput  int64            // requests which succeeded without retrying
+	failures map[string]int64 // failed attempts, by errorKind
+	counts   []int64          // per latency bucket, not cumulative
+	sum      float64          // total latency in seconds
+	samplers []*latencySamples
+	// most samples kept by each sampler, 0 for no limit
+	maxSamples int
+	rand       *rand.Rand
+	sync.Mutex
+}
+
+// latencySamples keeps the latencies observed by metrics since they were
+// last taken, for one consumer. Beyond the most samples kept, it is a
+// reservoir of the seen latencies, replaced at random
+type latencySamples struct {
+	m       *metrics
+	samples []time.Duration
+	seen    int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{counts: make([]int64, len(latencyBuckets)+1), failures: make(map[string]int64),
+		rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Fail records an attempt which failed with err
+func (m *metrics) Fail(err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.failures[errorKind(err)]++
+}
+
+// Failures returns the number of failed attempts, by kind of error
+func (m *metrics) Failures() map[string]int64 {
+	m.Lock()
+	defer m.Unlock()
+	failures := make(map[string]int64, len(m.failures))
+	for kind, n := range m.failures {
+		failures[kind] = n
+	}
+	return failures
+}
+
+// Observe records a completed request which took tries attempts
+func (m *metrics) Observe(latency time.Duration, tries int) {
+	if m == nil {
+		return
+	}
+	secs := latency.Seconds()
+	m.Lock()
+	defer m.Unlock()
+	m.requests++
+	m.attempts += int64(tries)
+	if tries == 1 {
+		m.goodput++
+	}
+	m.sum += secs
+	for _, s := range m.samplers {
+		s.sample(latency)
+	}
+	for i, bound := range latencyBuckets {
+		if secs <= bound {
+			m.counts[i]++
+			return
+		}
+	}
+	m.counts[len(latencyBuckets)]++
+}
+
+// Requests returns the number of completed requests
+func (m *metrics) Requests() int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.requests
+}
+
+// Attempts returns the number of attempts to send requests
+func (m *metrics) Attempts() int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.attempts
+}
+
+// Sampler returns a new consumer of the latencies observed from now on, so
+// that each consumer takes its own
+func (m *metrics) Sampler() *latencySamples {
+	m.Lock()
+	defer m.Unlock()
+	s := &latencySamples{m: m}
+	m.samplers = append(m.samplers, s)
+	return s
+}
+
+// sample keeps latency, or once maxSamples are kept, replaces one of them
+// with it at random, so that each latency seen is equally likely to be kept.
+// It is called with the lock of metrics held
+func (s *latencySamples) sample(latency time.Duration) {
+	s.seen++
+	if s.m.maxSamples <= 0 || len(s.samples) < s.m.maxSamples {
+		s.samples = append(s.samples, latency)
+		return
+	}
+	if i := s.m.rand.Int63n(s.seen); i < int64(s.m.maxSamples) {
+		s.samples[i] = latency
+	}
+}
+
+// Take returns the latencies observed since it was last called, or since
+// the sampler was created. If more than maxSamples were observed, only a
+// uniform random sample of them is returned
+func (s *latencySamples) Take() []time.Duration {
+	s.m.Lock()
+	defer s.m.Unlock()
+	samples := s.samples
+	if int64(len(samples)) < s.seen {
+		glog.Infof("Kept %d of %d latency samples (%d KiB), percentiles are estimated from them",
+			len(samples), s.seen, len(samples)*8/1024)
+	}
+	s.samples = nil
+	s.seen = 0
+	return samples
+}
+
+// Goodput returns the number of requests which succeeded without retrying
+func (m *metrics) Goodput() int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.goodput
+}
+
+// Amplification returns the retry amplification factor, the number of
+// attempts per completed request
+func (m *metrics) Amplification() float64 {
+	m.Lock()
+	defer m.Unlock()
+	if m.requests == 0 {
+		return 0
+	}
+	return float64(m.attempts) / float64(m.requests)
+}
+
+// Summary describes the throughput and goodput over a run of length elapsed
+func (m *metrics) Summary(elapsed time.Duration) string {
+	requests, goodput := m.Requests(), m.Goodput()
+	secs := elapsed.Seconds()
+	return fmt.Sprintf("Throughput: %d requests (%.1f/s), goodput: %d requests (%.1f/s), retry amplification: %.2f",
+		requests, float64(requests)/secs, goodput, float64(goodput)/secs, m.Amplification())
+}
+
+// WriteOpenMetrics writes the current metric values in the OpenMetrics text format
+func (m *metrics) WriteOpenMetrics(w io.Writer) error {
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintln(w, "# TYPE hydra_client_requests counter")
+	fmt.Fprintln(w, "# HELP hydra_client_requests Completed requests.")
+	fmt.Fprintln(w, "hydra_client_requests_total", m.requests)
+	fmt.Fprintln(w, "# TYPE hydra_client_attempts counter")
+	fmt.Fprintln(w, "# HELP hydra_client_attempts Attempts to send requests, including retries.")
+	fmt.Fprintln(w, "hydra_client_attempts_total", m.attempts)
+	fmt.Fprintln(w, "# TYPE hydra_client_goodput counter")
+	fmt.Fprintln(w, "# HELP hydra_client_goodput Requests which succeeded without retrying.")
+	fmt.Fprintln(w, "hydra_client_goodput_total", m.goodput)
+
+	fmt.Fprintln(w, "# TYPE hydra_client_latency_seconds histogram")
+	fmt.Fprintln(w, "# HELP hydra_client_latency_seconds Latency of completed requests.")
+	var cumulative int64
+	for i, bound := range latencyBuckets {
+		cumulative += m.counts[i]
+		fmt.Fprintf(w, "hydra_client_latency_seconds_bucket{le=\"%s\"} %d\n",
+			strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	cumulative += m.counts[len(latencyBuckets)]
+	fmt.Fprintf(w, "hydra_client_latency_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintln(w, "hydra_client_latency_seconds_sum", strconv.FormatFloat(m.sum, 'g', -1, 64))
+	fmt.Fprintln(w, "hydra_client_latency_seconds_count", cumulative)
+	_, err := fmt.Fprintln(w, "# EOF")
+	return err
+}
+
+func writeMetricsDump(filename string, m *metrics) {
+	glog.Info("Writing metrics to ", filename)
+	file, err := os.Create(filename)
+	if err != nil {
+		glog.Warning(err)
+		return
+	}
+	defer file.Close()
+	err = m.WriteOpenMetrics(file)
+	if err != nil {
+		glog.Warning(err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check a dump after a few requests contains the expected metric families
+func TestMetricsDump(t *testing.T) {
+	server := newFakeServer(t, 0)
+	apis := []*oneCommand{{text: "get A"}, {text: "update A 7", replicate: true}, {text: "get B"}}
+	m := newMetrics()
+	runClients(t, server.addr, apis, func(c *client) { c.metrics = m })
+	m.Observe(2*time.Second, 2)
+
+	var buf bytes.Buffer
+	if err := m.WriteOpenMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+	for _, expected := range []string{
+		"# TYPE hydra_client_requests counter\n",
+		"hydra_client_requests_total 4\n",
+		"hydra_client_attempts_total 5\n",
+		"# TYPE hydra_client_latency_seconds histogram\n",
+		"hydra_client_latency_seconds_bucket{le=\"1\"} 3\n",
+		"hydra_client_latency_seconds_bucket{le=\"+Inf\"} 4\n",
+		"hydra_client_latency_seconds_count 4\n",
+	} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("Metrics dump does not contain %q:\n%s", expected, dump)
+		}
+	}
+	if !strings.HasSuffix(dump, "# EOF\n") {
+		t.Error("Metrics dump is not terminated by # EOF")
+	}
+}
+
+// check that retried requests count towards throughput but not goodput
+func TestGoodput(t *testing.T) {
+	cases := []struct {
+		drop          int
+		goodput       int64
+		amplification float64
+	}{
+		{0, 5, 1},
+		{1, 4, 1.2},
+		{2, 4, 1.4},
+	}
+	for i, test := range cases {
+		s := newFakeServer(t, 0)
+		s.drop = test.drop
+		c := newTestClient(t, s.addr)
+		c.metrics = newMetrics()
+		c.run(&commandList{commands: []string{"get A", "get B", "get C", "get D", "get E"}})
+
+		if c.metrics.Requests() != 5 || c.metrics.Goodput() != test.goodput {
+			t.Errorf("case %d: throughput %d and goodput %d but 5 and %d were expected",
+				i, c.metrics.Requests(), c.metrics.Goodput(), test.goodput)
+		}
+		if a := c.metrics.Amplification(); a != test.amplification {
+			t.Errorf("case %d: retry amplification %f but %f was expected", i, a, test.amplification)
+		}
+	}
+	summary := newMetrics().Summary(time.Second)
+	if !strings.Contains(summary, "goodput: 0 requests") {
+		t.Errorf("Summary is %q", summary)
+	}
+}
+
+// check that percentiles of a capped sample of exponentially distributed
+// latencies are close to the exact ones: the fraction of all latencies up
+// to each estimate is within a few standard errors of the percentile
+func TestReservoirSamples(t *testing.T) {
+	m := newMetrics()
+	m.maxSamples = 2000
+	m.rand = rand.New(rand.NewSource(1))
+	sampler := m.Sampler()
+	r := rand.New(rand.NewSource(2))
+	all := make([]time.Duration, 200000)
+	for i := range all {
+		all[i] = time.Duration(r.ExpFloat64() * float64(10*time.Millisecond))
+		m.Observe(all[i], 1)
+	}
+	samples := sampler.Take()
+	if len(samples) != m.maxSamples {
+		t.Fatalf("Kept %d samples, expected %d", len(samples), m.maxSamples)
+	}
+	sort.Sort(durations(all))
+	sort.Sort(durations(samples))
+	for _, p := range []float64{50, 90, 99} {
+		estimate := percentile(samples, p)
+		rank := float64(sort.Search(len(all), func(i int) bool { return all[i] > estimate })) / float64(len(all))
+		// 4 standard errors of the rank of a sample percentile
+		bound := 4 * math.Sqrt(p/100*(1-p/100)/float64(m.maxSamples))
+		if math.Abs(rank-p/100) > bound {
+			t.Errorf("p%g was %v, the p%.2f of all latencies, exact p%g is %v", p, estimate, rank*100, p, percentile(all, p))
+		}
+	}
+
+	// below the cap, every latency is kept
+	m.Observe(time.Millisecond, 1)
+	if samples = sampler.Take(); len(samples) != 1 || samples[0] != time.Millisecond {
+		t.Errorf("Samples were %v", samples)
+	}
+}
+
+// check that each sampler takes every latency, whatever the others take
+func TestSamplers(t *testing.T) {
+	m := newMetrics()
+	run := m.Sampler()
+	m.Observe(time.Millisecond, 1)
+	step := m.Sampler()
+	m.Observe(2*time.Millisecond, 1)
+	if samples := step.Take(); len(samples) != 1 || samples[0] != 2*time.Millisecond {
+		t.Errorf("Step samples were %v", samples)
+	}
+	m.Observe(3*time.Millisecond, 1)
+	step.Take()
+	if samples := run.Take(); len(samples) != 3 {
+		t.Errorf("Run samples were %v", samples)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"sync/atomic"
+)
+
+var monotonic_reads = flag.Bool("monotonicreads", false, "Check that successive reads of a key within a session never return an older version than an earlier read, from the version in each response, and exit with status 1 if one does")
+
+// monotonicReads checks the reads of a client's sessions for monotonic
+// reads: once a read of a key has returned a version, later reads of it in
+// the same session must not return an older one. Responses without a
+// version are not checked, and a nil *monotonicReads checks nothing
+type monotonicReads struct {
+	session    string
+	seen       map[string]uint64 // latest version read of each key in the session
+	checked    int64
+	violations int64
+}
+
+func newMonotonicReads() *monotonicReads {
+	return &monotonicReads{seen: map[string]uint64{}}
+}
+
+// Observe checks the reply to req, a request of session, returning false if
+// it read an older version than already seen
+func (m *monotonicReads) Observe(session string, req *msgs.ClientRequest, reply *msgs.ClientResponse) bool {
+	if m == nil {
+		return true
+	}
+	if session != m.session {
+		m.session = session
+		m.seen = map[string]uint64{}
+	}
+	if session == "" || req.Replicate || reply.Version == 0 || reply.Status != msgs.StatusOK {
+		return true
+	}
+	cmd, err := msgs.ParseCommand(req.Text())
+	if err != nil || cmd.Op != msgs.OpGet {
+		return true
+	}
+	atomic.AddInt64(&m.checked, 1)
+	if seen := m.seen[cmd.Key]; reply.Version < seen {
+		glog.Errorf("Monotonic reads violated in session %s: read of %s (trace %s) returned version %d after version %d",
+			session, cmd.Key, req.TraceID, reply.Version, seen)
+		atomic.AddInt64(&m.violations, 1)
+		return false
+	}
+	m.seen[cmd.Key] = reply.Version
+	return true
+}
+
+// Checked returns the number of reads checked
+func (m *monotonicReads) Checked() int { return int(atomic.LoadInt64(&m.checked)) }
+
+// Violations returns the number of reads which returned an older version
+func (m *monotonicReads) Violations() int { return int(atomic.LoadInt64(&m.violations)) }
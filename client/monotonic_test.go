@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"testing"
+)
+
+func TestMonotonicReads(t *testing.T) {
+	m := newMonotonicReads()
+	cases := []struct {
+		session string
+		request string
+		version uint64
+		ok      bool
+	}{
+		{"s", "get A", 5, true},
+		{"s", "get B", 3, true},
+		{"s", "get A", 5, true},
+		{"s", "get A", 4, false},
+		{"s", "update A 1", 2, true},
+		{"s", "get A", 0, true},
+		{"s", "get A", 6, true},
+		{"", "get A", 1, true},
+		// a new session starts from no versions seen
+		{"t", "get A", 1, true},
+		{"t", "get A", 0, true},
+		{"t", "get B; get A", 0, true},
+		{"t", "get A", 1, true},
+	}
+	for i, c := range cases {
+		req := &msgs.ClientRequest{Request: c.request}
+		reply := &msgs.ClientResponse{Status: msgs.StatusOK, Version: c.version}
+		if ok := m.Observe(c.session, req, reply); ok != c.ok {
+			t.Errorf("case %d: %q in session %q at version %d was %t, expected %t", i, c.request, c.session, c.version, ok, c.ok)
+		}
+	}
+	if m.Checked() != 7 || m.Violations() != 1 {
+		t.Errorf("%d reads checked and %d violations, expected 7 and 1", m.Checked(), m.Violations())
+	}
+	var nilReads *monotonicReads
+	nilReads.Observe("s", &msgs.ClientRequest{Request: "get A"}, &msgs.ClientResponse{Version: 1})
+}
+
+// check that a read in a session returning an older version than an earlier
+// read of the key is detected, and reads outside sessions are not checked
+func TestMonotonicReadsSession(t *testing.T) {
+	for _, session := range []string{"s", ""} {
+		s := newFakeServer(t, 0)
+		s.versions = []uint64{5, 3, 4, 6, 6}
+		c := newTestClient(t, s.addr)
+		c.monotonic = newMonotonicReads()
+		c.run(&sessionCommands{commandList{commands: []string{"get A", "get B", "get A", "update A 1", "get A"}}, session})
+
+		checked, violations := 4, 1
+		if session == "" {
+			checked, violations = 0, 0
+		}
+		if c.monotonic.Checked() != checked || c.monotonic.Violations() != violations {
+			t.Errorf("Session %q: %d reads checked and %d violations, expected %d and %d",
+				session, c.monotonic.Checked(), c.monotonic.Violations(), checked, violations)
+		}
+	}
+}
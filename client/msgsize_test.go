@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMsg(t *testing.T) {
+	cases := []struct {
+		input string
+		max   int
+		msg   string
+		err   error
+	}{
+		{"hello\n", 5, "hello\n", nil},
+		{"hello\n", 4, "", ErrMsgTooLarge},
+		{strings.Repeat("a", 10000) + "\n", 10000, strings.Repeat("a", 10000) + "\n", nil},
+		{strings.Repeat("a", 10001) + "\n", 10000, "", ErrMsgTooLarge},
+	}
+	for i, c := range cases {
+		msg, err := readMsg(bufio.NewReaderSize(strings.NewReader(c.input), 16), c.max)
+		if string(msg) != c.msg || err != c.err {
+			t.Errorf("case %d: read %d bytes (%v) but %d bytes (%v) were expected", i, len(msg), err, len(c.msg), c.err)
+		}
+	}
+}
+
+// endless reader, which would exhaust memory if read to the newline
+type endless struct{ read int }
+
+func (e *endless) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 'a'
+	}
+	e.read += len(b)
+	return len(b), nil
+}
+
+// check that a runaway response is rejected after reading at most the limit
+func TestReadMsgRunaway(t *testing.T) {
+	e := new(endless)
+	_, err := readMsg(bufio.NewReader(e), 1<<20)
+	if err != ErrMsgTooLarge {
+		t.Errorf("Runaway response returned %v", err)
+	}
+	if e.read > 1<<20+4096 {
+		t.Errorf("Read %d bytes of a runaway response with a limit of %d", e.read, 1<<20)
+	}
+}
+
+// check that an oversized request fails without being sent, and an
+// oversized response fails the request and reconnects
+func TestMaxMsgSize(t *testing.T) {
+	s := newFakeServer(t, 0)
+	stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Close()
+	var conf config.Config
+	conf.Addresses.Address = []string{s.addr}
+	conf.Parameters.Retries = 1
+	c := newClient(0, conf, time.Second, stats)
+
+	old := *max_msg_size
+	defer func() { *max_msg_size = old }()
+	*max_msg_size = 64
+	if response := c.submit("update A "+strings.Repeat("a", 64), true); response != ErrMsgTooLarge.Error() {
+		t.Errorf("Oversized request returned %q", response)
+	}
+	if n := len(s.Received()); n != 0 {
+		t.Errorf("Oversized request was sent %d times", n)
+	}
+
+	*max_msg_size = 1 << 10
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Normal request returned %q", response)
+	}
+	s.Lock()
+	s.response = strings.Repeat("a", 1<<10)
+	s.Unlock()
+	conn := c.conn
+	if response := c.submit("get A", false); response != ErrMsgTooLarge.Error() {
+		t.Errorf("Oversized response returned %q", response)
+	}
+	if c.conn == conn {
+		t.Error("Client did not reconnect after an oversized response")
+	}
+
+	// the next request has its own RequestID, so is not answered with the
+	// oversized response from the server's cache
+	s.Lock()
+	s.response = ""
+	s.Unlock()
+	if response := c.submit("get B", false); response != "0" {
+		t.Errorf("Request after an oversized response returned %q", response)
+	}
+	received := s.Received()
+	if last := len(received) - 1; received[last].RequestID == received[last-1].RequestID {
+		t.Errorf("Request after an oversized response reused RequestID %d", received[last].RequestID)
+	}
+}
+
+// check that commands longer than maxrequestlen are rejected without being
+// sent, and those up to it are sent
+func TestMaxRequestLength(t *testing.T) {
+	s := newFakeServer(t, 0)
+	c := newTestClient(t, s.addr)
+	c.metrics = newMetrics()
+	defer func() { *max_request_len = 0 }()
+	*max_request_len = 11
+
+	l := &commandList{commands: []string{"put A 12345\n", "put AB 12345", "put A 123456", "get A"}, replicate: true}
+	c.run(l)
+	tooLong := ErrRequestTooLong.Error() + ": 12 bytes, the maximum is 11"
+	expected := []string{"0", tooLong, tooLong, "0"}
+	for i, response := range l.responses {
+		if response != expected[i] {
+			t.Errorf("Command %q returned %q, expected %q", l.commands[i], response, expected[i])
+		}
+	}
+	if n := len(s.Received()); n != 2 {
+		t.Errorf("%d requests sent, expected 2", n)
+	}
+	if failures := c.metrics.Failures()["request_too_long"]; failures != 2 {
+		t.Errorf("%d failures counted, expected 2", failures)
+	}
+	if response := c.submitTxn([]string{"put A 1", "put B 2"}); !strings.HasPrefix(response, ErrRequestTooLong.Error()) {
+		t.Errorf("Long transaction returned %q", response)
+	}
+}
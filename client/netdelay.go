@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+var inject_latency = flag.String("injectlatency", "", "Round trip latency to add to each request, to simulate distant clients: a duration such as 50ms, exponential:50ms for a mean, or uniform:10ms,100ms")
+
+// netDelay is the latency injected into each round trip, nil if none
+var netDelay *latencyInjector
+
+// latencyInjector draws the round trip latency added to each request,
+// fixed, exponential with a mean, or uniform from min to max. It is safe
+// for concurrent access, and a nil *latencyInjector adds none
+type latencyInjector struct {
+	distribution string
+	mean         time.Duration
+	min, max     time.Duration
+	rand         *rand.Rand
+	sync.Mutex
+}
+
+// parseLatency parses the -injectlatency flag, returning nil if it is empty
+func parseLatency(s string) (*latencyInjector, error) {
+	if s == "" {
+		return nil, nil
+	}
+	l := &latencyInjector{distribution: "fixed", rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if i := strings.Index(s, ":"); i >= 0 {
+		l.distribution, s = s[:i], s[i+1:]
+	}
+	var err error
+	switch l.distribution {
+	case "fixed", "exponential":
+		if l.mean, err = time.ParseDuration(s); err != nil {
+			return nil, err
+		}
+		if l.mean < 0 {
+			return nil, errors.New("Injected latency must not be negative: " + s)
+		}
+	case "uniform":
+		bounds := strings.Split(s, ",")
+		if len(bounds) != 2 {
+			return nil, errors.New("Uniform injected latency should be given as uniform:min,max")
+		}
+		if l.min, err = time.ParseDuration(bounds[0]); err != nil {
+			return nil, err
+		}
+		if l.max, err = time.ParseDuration(bounds[1]); err != nil {
+			return nil, err
+		}
+		if l.min < 0 || l.max < l.min {
+			return nil, errors.New("Uniform injected latency must have 0 <= min <= max")
+		}
+	default:
+		return nil, errors.New("Unknown injected latency distribution \"" + l.distribution + "\", expected fixed, uniform or exponential")
+	}
+	return l, nil
+}
+
+// Draw the latency of a round trip
+func (l *latencyInjector) Draw() time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	switch l.distribution {
+	case "uniform":
+		return l.min + time.Duration(l.rand.Int63n(int64(l.max-l.min)+1))
+	case "exponential":
+		return time.Duration(l.rand.ExpFloat64() * float64(l.mean))
+	}
+	return l.mean
+}
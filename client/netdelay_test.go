@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseLatency(t *testing.T) {
+	cases := []struct {
+		flag     string
+		min, max time.Duration // of the latencies drawn
+		valid    bool
+	}{
+		{"", 0, 0, true},
+		{"50ms", 50 * time.Millisecond, 50 * time.Millisecond, true},
+		{"fixed:2ms", 2 * time.Millisecond, 2 * time.Millisecond, true},
+		{"uniform:10ms,20ms", 10 * time.Millisecond, 20 * time.Millisecond, true},
+		{"uniform:5ms,5ms", 5 * time.Millisecond, 5 * time.Millisecond, true},
+		{"exponential:1ms", 0, time.Hour, true},
+		{"-1ms", 0, 0, false},
+		{"uniform:20ms,10ms", 0, 0, false},
+		{"uniform:10ms", 0, 0, false},
+		{"normal:10ms", 0, 0, false},
+		{"fast", 0, 0, false},
+	}
+	for _, c := range cases {
+		l, err := parseLatency(c.flag)
+		if (err == nil) != c.valid {
+			t.Errorf("%q: error %v", c.flag, err)
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			if d := l.Draw(); d < c.min || d > c.max {
+				t.Errorf("%q: drew %v, expected from %v to %v", c.flag, d, c.min, c.max)
+				break
+			}
+		}
+	}
+}
+
+// check that injected latency is added to requests, and recorded apart in
+// the stats
+func TestInjectLatency(t *testing.T) {
+	rtt := 40 * time.Millisecond
+	netDelay, _ = parseLatency(rtt.String())
+	defer func() { netDelay = nil }()
+
+	filename := filepath.Join(t.TempDir(), "latency.csv")
+	stats, err := OpenStatsWriter(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeServer(t, 0)
+	c := newTestClient(t, s.addr)
+	c.stats = stats
+	c.run(&commandList{commands: []string{"get A", "get B"}})
+	stats.Close()
+
+	records := readStats(t, filename, "")
+	if len(records) != 2 {
+		t.Fatalf("%d stats records, expected 2", len(records))
+	}
+	for i, record := range records {
+		latency, _ := strconv.ParseInt(record[statsColumn(t, "latency_ns")], 10, 64)
+		injected, _ := strconv.ParseInt(record[statsColumn(t, "injected_ns")], 10, 64)
+		if injected != rtt.Nanoseconds() || latency < injected {
+			t.Errorf("Request %d: latency %v with %v injected, expected %v injected", i, time.Duration(latency), time.Duration(injected), rtt)
+		}
+	}
+}
+
+// check that a reply delayed by injected latency beyond the timeout times out
+func TestInjectLatencyTimeout(t *testing.T) {
+	s := newFakeServer(t, 0)
+	c := newTestClient(t, s.addr)
+	replyCh, errCh := dispatchDelayed([]byte(`{"ClientID":0,"RequestID":1,"Request":"get A"}`), c.conn, c.rd, 200*time.Millisecond)
+	start := time.Now()
+	if _, err := receive(replyCh, errCh, 50*time.Millisecond); err != ErrTimeout {
+		t.Errorf("Error was %v, expected a timeout", err)
+	}
+	if _, err := receive(replyCh, errCh, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("Reply received after %v, expected 200ms", elapsed)
+	}
+	if len(s.Received()) != 1 {
+		t.Errorf("Server received %d requests, expected 1", len(s.Received()))
+	}
+}
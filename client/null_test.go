@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/api/null"
+	"testing"
+)
+
+// check that the null API drives the client loop with its constant command
+func TestNullAPI(t *testing.T) {
+	s := newFakeServer(t, 0)
+	c := newTestClient(t, s.addr)
+	c.metrics = newMetrics()
+	c.run(null.Create(50))
+	received := s.Received()
+	if len(received) != 50 || c.metrics.Requests() != 50 {
+		t.Fatalf("Server received %d requests and %d completed, expected 50", len(received), c.metrics.Requests())
+	}
+	for _, req := range received {
+		if req.Request != null.Command || req.Replicate {
+			t.Errorf("Null API sent '%s' (replicate %t)", req.Request, req.Replicate)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"sync/atomic"
+	"time"
+)
+
+// arrivalQueue issues requests at a fixed rate regardless of whether earlier
+// requests have completed, queueing them until a client is free to send them.
+// Requests arriving when the queue is full are dropped.
+// It is safe for concurrent access
+type arrivalQueue struct {
+	arrivals chan time.Time
+	overflow int64 // requests dropped as the queue was full
+	interval int64 // between requests, in nanoseconds
+	closing  chan bool
+	closed   chan bool
+}
+
+// newArrivalQueue starts issuing rate requests per second, queueing up to size
+func newArrivalQueue(rate float64, size int) *arrivalQueue {
+	q := &arrivalQueue{
+		arrivals: make(chan time.Time, size),
+		closing:  make(chan bool),
+		closed:   make(chan bool)}
+	q.SetRate(rate)
+	go q.run()
+	return q
+}
+
+// SetRate changes the rate to rate requests per second
+func (q *arrivalQueue) SetRate(rate float64) {
+	atomic.StoreInt64(&q.interval, int64(float64(time.Second)/rate))
+}
+
+func (q *arrivalQueue) run() {
+	defer close(q.closed)
+	defer close(q.arrivals)
+	next := time.Now()
+	for {
+		select {
+		case <-q.closing:
+			return
+		case <-time.After(time.Until(next)):
+		}
+		select {
+		case q.arrivals <- next:
+		default:
+			atomic.AddInt64(&q.overflow, 1)
+		}
+		next = next.Add(time.Duration(atomic.LoadInt64(&q.interval)))
+	}
+}
+
+// Wait blocks until a request is due and takes it, returning when it
+// arrived, or false if stop is closed or the queue is closed and empty
+func (q *arrivalQueue) Wait(stop chan bool) (time.Time, bool) {
+	select {
+	case <-stop:
+		return time.Time{}, false
+	default:
+	}
+	select {
+	case <-stop:
+		return time.Time{}, false
+	case arrival, ok := <-q.arrivals:
+		return arrival, ok
+	}
+}
+
+// Close stops issuing requests, those already queued can still be taken
+func (q *arrivalQueue) Close() {
+	select {
+	case <-q.closing:
+	default:
+		close(q.closing)
+	}
+	<-q.closed
+}
+
+// Drop discards the queued requests, returning how many there were
+func (q *arrivalQueue) Drop() int {
+	dropped := 0
+	for range q.arrivals {
+		dropped++
+	}
+	return dropped
+}
+
+// Depth returns the number of queued requests
+func (q *arrivalQueue) Depth() int {
+	return len(q.arrivals)
+}
+
+// Overflow returns the number of requests dropped as the queue was full
+func (q *arrivalQueue) Overflow() int {
+	return int(atomic.LoadInt64(&q.overflow))
+}
+
+// shutdownQueue closes q and waits for up to drain for clients to send the
+// queued requests, reporting on finish when they have. The remaining queued
+// requests are dropped and their number returned, along with whether
+// the clients finished
+func shutdownQueue(q *arrivalQueue, drain time.Duration, finish <-chan bool) (int, bool) {
+	q.Close()
+	glog.Info("Shutting down with ", q.Depth(), " queued requests")
+	finished := false
+	if drain > 0 {
+		select {
+		case <-finish:
+			finished = true
+		case <-time.After(drain):
+			glog.Warning("Queued requests were not drained within ", drain)
+		}
+	}
+	return q.Drop(), finished
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fill an open loop queue, then shut it down with and without draining
+func TestShutdownQueue(t *testing.T) {
+	tests := []struct {
+		drain    time.Duration
+		dropped  int
+		sent     int
+		finished bool
+	}{
+		{0, 5, 0, false},
+		{time.Second, 0, 5, true},
+	}
+	for _, test := range tests {
+		q := newArrivalQueue(1000, 5)
+		for q.Depth() < 5 {
+			time.Sleep(time.Millisecond)
+		}
+		// stop further arrivals, so exactly the queued requests remain
+		q.Close()
+
+		s := newFakeServer(t, 0)
+		c := newTestClient(t, s.addr)
+		c.queue = q
+		c.stop = make(chan bool)
+		commands := make([]string, 20)
+		for i := range commands {
+			commands[i] = fmt.Sprint("update A ", i)
+		}
+		api := &commandList{commands: commands, replicate: true}
+		finish := make(chan bool, 1)
+		start := func() {
+			go func() {
+				c.run(api)
+				finish <- true
+			}()
+		}
+		if test.drain > 0 {
+			start()
+		}
+		dropped, finished := shutdownQueue(q, test.drain, finish)
+		if test.drain == 0 {
+			start()
+		}
+		close(c.stop)
+		if !finished {
+			<-finish
+		}
+
+		if dropped != test.dropped || finished != test.finished {
+			t.Errorf("Drain %s: %d requests dropped (finished %t), expected %d (%t)",
+				test.drain, dropped, finished, test.dropped, test.finished)
+		}
+		if n := len(s.Received()); n != test.sent {
+			t.Errorf("Drain %s: %d queued requests sent, expected %d", test.drain, n, test.sent)
+		}
+	}
+}
+
+// check that the latency of queued requests is split into the time they
+// were queued and the time taken to serve them
+func TestQueueDelay(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "latency.csv")
+	stats, err := OpenStatsWriter(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeServer(t, 10*time.Millisecond)
+	// requests arrive faster than the client can serve them
+	q := newArrivalQueue(1000, 100)
+	defer q.Close()
+	c := newTestClient(t, s.addr)
+	c.stats = stats
+	c.queue = q
+	c.run(&commandList{commands: []string{"get A", "get B", "get C", "get A", "get B"}})
+	stats.Close()
+
+	records := readStats(t, filename, "")
+	if len(records) != 5 {
+		t.Fatalf("%d stats records, expected 5", len(records))
+	}
+	column := func(record []string, name string) int64 {
+		v, err := strconv.ParseInt(record[statsColumn(t, name)], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for i, record := range records {
+		latency, queued, service := column(record, "latency_ns"), column(record, "queue_ns"), column(record, "service_ns")
+		if queued+service != latency || queued < 0 || service < int64(10*time.Millisecond) {
+			t.Errorf("Request %d: queued %d + service %d != latency %d", i, queued, service, latency)
+		}
+		// each request waits for those before it to be served
+		if i > 1 && queued < int64(5*time.Millisecond) {
+			t.Errorf("Request %d was queued for %s, expected it to wait for earlier requests", i, time.Duration(queued))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var key_order = flag.String("keyorder", "", "Issue operations on the same key one at a time, in the order they were taken from the APIs, across all clients, with the key parsed from each command by word:N, its Nth word counting from 0, or regexp:<re>, the first group of a match, or all of it if it has none. Not ordered if empty")
+
+// keyParser extracts the key of a command, by the position of the key in
+// the words of the command, or by a regular expression
+type keyParser struct {
+	word int
+	re   *regexp.Regexp // nil if the key is a word
+}
+
+// parseKeyParser parses the -keyorder flag
+func parseKeyParser(spec string) (*keyParser, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return nil, errors.New("Key parser should be given as word:N or regexp:<re>: " + spec)
+	}
+	switch spec[:i] {
+	case "word":
+		word, err := strconv.Atoi(spec[i+1:])
+		if err != nil || word < 0 {
+			return nil, errors.New("Invalid key word position: " + spec[i+1:])
+		}
+		return &keyParser{word: word}, nil
+	case "regexp":
+		re, err := regexp.Compile(spec[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		return &keyParser{re: re}, nil
+	}
+	return nil, errors.New("Unknown key parser \"" + spec[:i] + "\", expected word or regexp")
+}
+
+// Key returns the key of command, or false if it has none
+func (p *keyParser) Key(command string) (string, bool) {
+	if p.re == nil {
+		words := strings.Fields(command)
+		if p.word >= len(words) {
+			return "", false
+		}
+		return words[p.word], true
+	}
+	match := p.re.FindStringSubmatch(command)
+	if match == nil {
+		return "", false
+	}
+	if len(match) > 1 {
+		return match[1], true
+	}
+	return match[0], true
+}
+
+// keyOrder issues operations on the same key one at a time, in the order
+// they wait for their keys, while those on different keys go ahead
+// concurrently. Each key holds the channel closed when its last waiting
+// operation completes, which the next to wait waits on. It is safe for
+// concurrent access, and a nil *keyOrder orders nothing
+type keyOrder struct {
+	parser *keyParser
+	last   map[string]chan bool
+	waited int64 // operations which waited for an earlier one
+	sync.Mutex
+}
+
+func newKeyOrder(parser *keyParser) *keyOrder {
+	return &keyOrder{parser: parser, last: map[string]chan bool{}}
+}
+
+// Keys returns the keys of commands, those without a key being left out
+func (o *keyOrder) Keys(commands []string) []string {
+	if o == nil {
+		return nil
+	}
+	var keys []string
+	for _, command := range commands {
+		if key, ok := o.parser.Key(command); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Wait blocks until the operations which waited earlier on any of keys
+// have completed, and returns the function to call once this one has. All
+// of the keys are taken at once, so operations on several keys are ordered
+// consistently with each other and cannot deadlock
+func (o *keyOrder) Wait(keys ...string) (release func()) {
+	if o == nil || len(keys) == 0 {
+		return func() {}
+	}
+	done := make(chan bool)
+	var earlier []chan bool
+	o.Lock()
+	for _, key := range keys {
+		prev, ok := o.last[key]
+		if prev == done {
+			// the key is repeated
+			continue
+		}
+		if ok {
+			earlier = append(earlier, prev)
+		}
+		o.last[key] = done
+	}
+	o.Unlock()
+	if len(earlier) > 0 {
+		atomic.AddInt64(&o.waited, 1)
+	}
+	for _, prev := range earlier {
+		<-prev
+	}
+	return func() {
+		close(done)
+		o.Lock()
+		for _, key := range keys {
+			if o.last[key] == done {
+				delete(o.last, key)
+			}
+		}
+		o.Unlock()
+	}
+}
+
+// Waited returns the number of operations which waited for an earlier one
+func (o *keyOrder) Waited() int {
+	return int(atomic.LoadInt64(&o.waited))
+}
+
+// orderKeys returns the keys of the command text from ioapi, or of each
+// command of its transaction
+func (c *client) orderKeys(ioapi API, text string) []string {
+	if c.order == nil {
+		return nil
+	}
+	commands := []string{text}
+	if tapi, ok := ioapi.(TxnAPI); ok {
+		if txn := tapi.Transaction(); txn != nil {
+			commands = txn
+		}
+	}
+	return c.order.Keys(commands)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyParser(t *testing.T) {
+	cases := []struct {
+		spec    string
+		command string
+		key     string // "" if the command has no key
+	}{
+		{"word:1", "get A", "A"},
+		{"word:1", "put B 2", "B"},
+		{"word:1", "ping", ""},
+		{"word:0", "A", "A"},
+		{"regexp:^\\w+ (\\S+)", "put B 2", "B"},
+		{"regexp:^(?:get|put) (\\S+)", "delete B", ""},
+		{"regexp:user[0-9]+", "get user42:name", "user42"},
+	}
+	for _, c := range cases {
+		p, err := parseKeyParser(c.spec)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		if key, ok := p.Key(c.command); key != c.key || ok != (c.key != "") {
+			t.Errorf("%s: key of %q is %q, %t, expected %q", c.spec, c.command, key, ok, c.key)
+		}
+	}
+	for _, spec := range []string{"", "1", "word:-1", "word:x", "regexp:(", "field:1"} {
+		if _, err := parseKeyParser(spec); err == nil {
+			t.Errorf("%q was parsed", spec)
+		}
+	}
+}
+
+// check that operations on a key are released in the order they waited,
+// while those on other keys go ahead
+func TestKeyOrder(t *testing.T) {
+	order := newKeyOrder(&keyParser{word: 1})
+	release := order.Wait("A")
+
+	var completed []int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys := []string{"A"}
+			if i == 3 {
+				// a transaction on several keys waits for each
+				keys = []string{"B", "A", "B"}
+			}
+			done := order.Wait(keys...)
+			mu.Lock()
+			completed = append(completed, i)
+			mu.Unlock()
+			done()
+		}(i)
+		// wait until it is queued, so that each waits in turn
+		for order.Waited() < i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	other := make(chan bool)
+	go func() {
+		order.Wait("C")()
+		close(other)
+	}()
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatal("Operation on another key waited")
+	}
+	mu.Lock()
+	if len(completed) != 0 {
+		t.Errorf("Operations %v completed before the first on their key", completed)
+	}
+	mu.Unlock()
+
+	release()
+	wg.Wait()
+	if expected := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(completed, expected) {
+		t.Errorf("Operations completed in order %v, expected %v", completed, expected)
+	}
+	if len(order.last) != 0 {
+		t.Errorf("Keys %v still held", order.last)
+	}
+	if keys := order.Keys([]string{"put A 1", "ping", "get B"}); !reflect.DeepEqual(keys, []string{"A", "B"}) {
+		t.Errorf("Keys were %v", keys)
+	}
+	var nilOrder *keyOrder
+	nilOrder.Wait(nilOrder.Keys([]string{"get A"})...)()
+}
+
+// check that clients send operations on the same key one at a time, and on
+// different keys concurrently
+func TestKeyOrderClients(t *testing.T) {
+	for _, sameKey := range []bool{true, false} {
+		s := newFakeServer(t, 50*time.Millisecond)
+		order := newKeyOrder(&keyParser{word: 1})
+		apis := make([]*oneCommand, 4)
+		for i := range apis {
+			key := "A"
+			if !sameKey {
+				key = strconv.Itoa(i)
+			}
+			apis[i] = &oneCommand{text: "put " + key + " " + strconv.Itoa(i), replicate: true}
+		}
+		runClients(t, s.addr, apis, func(c *client) { c.order = order })
+		if len(s.Received()) != len(apis) {
+			t.Errorf("Server received %d requests, expected %d", len(s.Received()), len(apis))
+		}
+		if sameKey && (s.MaxActive() != 1 || order.Waited() != len(apis)-1) {
+			t.Errorf("Requests on one key: %d at once, %d waited", s.MaxActive(), order.Waited())
+		}
+		if !sameKey && (s.MaxActive() < 2 || order.Waited() != 0) {
+			t.Errorf("Requests on different keys: %d at once, %d waited", s.MaxActive(), order.Waited())
+		}
+	}
+}
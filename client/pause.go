@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"sync"
+	"time"
+)
+
+// pauser pauses and resumes the request loops of clients.
+// It is safe for concurrent access
+type pauser struct {
+	resumed chan bool // closed on resume, nil if not paused
+	since   time.Time
+	sync.Mutex
+}
+
+func newPauser() *pauser {
+	return &pauser{}
+}
+
+// Toggle pauses the clients if they are running, or resumes them otherwise
+func (p *pauser) Toggle() {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	if p.resumed == nil {
+		p.resumed = make(chan bool)
+		p.since = now
+		glog.Warning("Paused issuing requests at ", wallTime(now))
+	} else {
+		close(p.resumed)
+		p.resumed = nil
+		glog.Warning("Resumed issuing requests at ", wallTime(now), ", after a pause of ", now.Sub(p.since))
+	}
+}
+
+// Paused returns true if the clients are paused
+func (p *pauser) Paused() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.resumed != nil
+}
+
+// Wait blocks while the clients are paused, unless stop is closed
+func (p *pauser) Wait(stop chan bool) {
+	p.Lock()
+	resumed := p.resumed
+	p.Unlock()
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-stop:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// check that no requests are issued while paused
+func TestPause(t *testing.T) {
+	s := newFakeServer(t, time.Millisecond)
+	api := &commandList{}
+	for i := 0; i < 1000; i++ {
+		api.commands = append(api.commands, "get A")
+	}
+	pause := newPauser()
+	pause.Toggle()
+	if !pause.Paused() {
+		t.Fatal("Pauser is not paused after toggling")
+	}
+
+	done := make(chan bool)
+	c := newTestClient(t, s.addr)
+	c.pause = pause
+	go func() {
+		c.run(api)
+		done <- true
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := len(s.Received()); n != 0 {
+		t.Fatalf("%d requests issued while paused", n)
+	}
+
+	// resume and pause again
+	pause.Toggle()
+	time.Sleep(50 * time.Millisecond)
+	pause.Toggle()
+	time.Sleep(10 * time.Millisecond)
+	n := len(s.Received())
+	if n == 0 {
+		t.Fatal("No requests issued after resuming")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if m := len(s.Received()); m != n {
+		t.Errorf("%d requests issued while paused again", m-n)
+	}
+
+	// stopping a paused client
+	close(c.stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Paused client did not stop")
+	}
+}
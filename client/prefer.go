@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"github.com/golang/glog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var prefer_fast = flag.Bool("preferfast", false, "Send reads to the server with the lowest recent read latency")
+var fast_alpha = flag.Float64("fastalpha", 0.2, "With -preferfast, weight of each read in the moving average of a server's latency")
+var fast_explore = flag.Float64("fastexplore", 0.05, "With -preferfast, fraction of reads sent to a random server, so that its latency is kept up to date")
+
+// another server is only preferred if it is faster by this factor, so that
+// the client does not switch between servers of similar latency
+const fastMargin = 0.9
+
+// serverLatency keeps an exponentially weighted moving average of the read
+// latency of each server, by address, so that reads can be sent to the
+// fastest. It is safe for concurrent access
+type serverLatency struct {
+	alpha     float64
+	explore   float64
+	estimates map[string]time.Duration
+	sync.Mutex
+}
+
+func newServerLatency(alpha float64, explore float64) *serverLatency {
+	return &serverLatency{alpha: alpha, explore: explore, estimates: make(map[string]time.Duration)}
+}
+
+// Observe records the latency of a read from the server at addr
+func (l *serverLatency) Observe(addr string, latency time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	estimate, ok := l.estimates[addr]
+	if !ok {
+		l.estimates[addr] = latency
+		return
+	}
+	l.estimates[addr] = estimate + time.Duration(l.alpha*float64(latency-estimate))
+}
+
+// Estimate returns the latency estimate of the server at addr, false if it
+// has not been measured
+func (l *serverLatency) Estimate(addr string) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+	estimate, ok := l.estimates[addr]
+	return estimate, ok
+}
+
+// Pick returns the server of addrs to send a read to, given that the client
+// is connected to current. Servers which have not been measured are picked
+// first, starting from current, then the fastest.
+func (l *serverLatency) Pick(addrs []string, current int) int {
+	if l.explore > 0 && rand.Float64() < l.explore {
+		return rand.Intn(len(addrs))
+	}
+	l.Lock()
+	defer l.Unlock()
+	best := current
+	for j := range addrs {
+		i := (current + j) % len(addrs)
+		if _, ok := l.estimates[addrs[i]]; !ok {
+			return i
+		}
+		if l.estimates[addrs[i]] < l.estimates[addrs[best]] {
+			best = i
+		}
+	}
+	if float64(l.estimates[addrs[best]]) < fastMargin*float64(l.estimates[addrs[current]]) {
+		return best
+	}
+	return current
+}
+
+// preferFast moves the client onto its connection to the server picked for
+// a read, if it is not the current one, returning the time taken to connect
+// and a func which moves it back, so that writes stay on their server. The
+// fast server's connection is kept for later reads. If the server cannot be
+// reached, its estimate is penalized and the read is sent as usual
+func (c *client) preferFast() (time.Duration, func()) {
+	addrs := c.addrs()
+	current := c.leader % len(addrs)
+	if c.fastConn != nil {
+		current = c.fastConn.server
+	}
+	server := c.fast.Pick(addrs, current)
+	if server == c.leader%len(addrs) {
+		return 0, func() {}
+	}
+	var setup time.Duration
+	if c.fastConn == nil || c.fastConn.server != server {
+		if c.fastConn != nil {
+			c.fastConn.conn.Close()
+			c.fastConn = nil
+		}
+		start := time.Now()
+		conn, err := dialServer(addrs[server])
+		setup = time.Since(start)
+		if err != nil {
+			glog.Warning(err)
+			c.fast.Observe(addrs[server], c.timeout)
+			return setup, func() {}
+		}
+		c.fastConn = &serverConn{conn, bufio.NewReader(conn), server}
+	}
+	glog.Info("Sending read of client ", c.id, " to server ", server)
+	leader := serverConn{c.conn, c.rd, c.leader}
+	c.conn, c.rd, c.leader = c.fastConn.conn, c.fastConn.rd, server
+	return setup, c.moveBack(leader, &c.fastConn)
+}
+
+// observeRead records the latency of a try of a read from the current
+// server. A failed try counts as taking the whole timeout, so that servers
+// which are failing are avoided
+func (c *client) observeRead(latency time.Duration, err error) {
+	if errors.Is(err, ErrCancelled) {
+		return
+	}
+	if err != nil {
+		latency = c.timeout
+	}
+	addrs := c.addrs()
+	c.fast.Observe(addrs[c.leader%len(addrs)], latency)
+}
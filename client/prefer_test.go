@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerLatencyPick(t *testing.T) {
+	ms := time.Millisecond
+	addrs := []string{"a", "b", "c"}
+	cases := []struct {
+		estimates map[string]time.Duration
+		current   int
+		pick      int
+	}{
+		// unmeasured servers first, starting from current
+		{map[string]time.Duration{}, 1, 1},
+		{map[string]time.Duration{"a": ms}, 0, 1},
+		{map[string]time.Duration{"a": ms, "b": ms}, 1, 2},
+		// then the fastest
+		{map[string]time.Duration{"a": 40 * ms, "b": 5 * ms, "c": 20 * ms}, 0, 1},
+		{map[string]time.Duration{"a": 40 * ms, "b": 5 * ms, "c": 20 * ms}, 2, 1},
+		{map[string]time.Duration{"a": 40 * ms, "b": 5 * ms, "c": 20 * ms}, 1, 1},
+		// unless it is only slightly faster
+		{map[string]time.Duration{"a": 20 * ms, "b": 19 * ms, "c": 40 * ms}, 0, 0},
+	}
+	for i, test := range cases {
+		l := newServerLatency(0.5, 0)
+		l.estimates = test.estimates
+		if pick := l.Pick(addrs, test.current); pick != test.pick {
+			t.Errorf("case %d: picked %d, expected %d", i, pick, test.pick)
+		}
+	}
+}
+
+func TestServerLatencyObserve(t *testing.T) {
+	ms := time.Millisecond
+	l := newServerLatency(0.5, 0)
+	for _, latency := range []time.Duration{10 * ms, 20 * ms, 20 * ms} {
+		l.Observe("a", latency)
+	}
+	if estimate, ok := l.Estimate("a"); !ok || estimate != 17500*time.Microsecond {
+		t.Errorf("Estimate was %s, expected 17.5ms", estimate)
+	}
+	if _, ok := l.Estimate("b"); ok {
+		t.Error("Unmeasured server has an estimate")
+	}
+}
+
+// check that reads converge on the fastest server, and writes are not
+// measured
+func TestPreferFast(t *testing.T) {
+	servers := []*fakeServer{
+		newFakeServer(t, 40*time.Millisecond),
+		newFakeServer(t, 5*time.Millisecond),
+		newFakeServer(t, 20*time.Millisecond),
+	}
+	c := newTestClient(t, servers[0].addr, servers[1].addr, servers[2].addr)
+	c.fast = newServerLatency(0.2, 0)
+
+	c.submit("update A 1", true)
+	if _, ok := c.fast.Estimate(servers[0].addr); ok {
+		t.Error("Write latency was measured")
+	}
+	reads := 20
+	for i := 0; i < reads; i++ {
+		c.submit("get A", false)
+	}
+	// each server is measured once, then the fastest is used
+	if n := len(servers[1].Received()); n != reads-2 {
+		t.Errorf("Fastest server received %d of %d reads", n, reads)
+	}
+	if c.leader != 0 || c.fastConn == nil || c.fastConn.server != 1 {
+		t.Errorf("Client ended on server %d, reading from %+v", c.leader, c.fastConn)
+	}
+	// writes stay on their server
+	c.submit("update A 2", true)
+	if n := len(servers[0].Received()); n != 3 {
+		t.Errorf("Server 0 received %d requests, expected the two writes and a read", n)
+	}
+
+	// a failing server is avoided
+	c.fast = newServerLatency(0.2, 0)
+	servers[1].Lock()
+	servers[1].drop = 1
+	servers[1].Unlock()
+	for i := 0; i < 5; i++ {
+		c.submit("get A", false)
+	}
+	if estimate, _ := c.fast.Estimate(servers[1].addr); estimate != c.timeout {
+		t.Errorf("Failing server has an estimate of %s", estimate)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"github.com/heidi-ann/hydra/config"
+	"sync"
+	"time"
+)
+
+var max_reconnects = flag.Int("maxconcurrentreconnects", 0, "Most clients reconnecting at once, others wait for their turn, 0 for no limit")
+var connect_concurrency = flag.Int("connectconcurrency", 1, "Most logical clients connecting at once on startup, so that many clients do not overwhelm the accept backlog of the servers, 0 for no limit")
+
+// semaphore limits the clients sharing it to a number at once. A nil
+// semaphore does not limit them
+type semaphore chan bool
+
+func newSemaphore(n int) semaphore {
+	return make(semaphore, n)
+}
+
+// Acquire waits until there is room, and takes it
+func (s semaphore) Acquire() {
+	if s != nil {
+		s <- true
+	}
+}
+
+// Release gives up the room taken by Acquire
+func (s semaphore) Release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// newClients creates n clients, with IDs from first, connecting up to limit
+// of them at once, or all at once if limit is 0
+func newClients(first int, n int, conf config.Config, timeout time.Duration, stats *StatsWriter, limit int) []*client {
+	var connecting semaphore
+	if limit > 0 {
+		connecting = newSemaphore(limit)
+	}
+	cs := make([]*client, n)
+	var wg sync.WaitGroup
+	for i := range cs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			connecting.Acquire()
+			defer connecting.Release()
+			cs[i] = newClient(first+i, conf, timeout, stats)
+		}(i)
+	}
+	wg.Wait()
+	return cs
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"github.com/heidi-ann/hydra/config"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowDNS resolves every host to 127.0.0.1 after a delay, counting the
+// most lookups at once
+type slowDNS struct {
+	delay             time.Duration
+	active, maxActive int
+	sync.Mutex
+}
+
+func (s *slowDNS) LookupHost(ctx context.Context, host string) ([]string, error) {
+	s.Lock()
+	s.active++
+	if s.active > s.maxActive {
+		s.maxActive = s.active
+	}
+	s.Unlock()
+	time.Sleep(s.delay)
+	s.Lock()
+	s.active--
+	s.Unlock()
+	return []string{"127.0.0.1"}, nil
+}
+
+// check that no more than the limit of clients reconnect at once
+func TestMaxReconnects(t *testing.T) {
+	cases := []struct {
+		limit   int // 0 for no limit
+		clients int
+	}{
+		{1, 8},
+		{3, 8},
+		{0, 8},
+	}
+	s := newFakeServer(t, 0)
+	_, port, _ := net.SplitHostPort(s.addr)
+	addr := net.JoinHostPort("hydra.test", port)
+	for i, test := range cases {
+		dns := &slowDNS{delay: 20 * time.Millisecond}
+		oldLookup, oldServers, oldTTL := lookupHost, servers, *dns_ttl
+		lookupHost = dns.LookupHost
+		servers = &dnsCache{entries: make(map[string]dnsEntry)}
+		*dns_ttl = 0
+
+		var reconnects semaphore
+		if test.limit > 0 {
+			reconnects = newSemaphore(test.limit)
+		}
+		cs := make([]*client, test.clients)
+		for j := range cs {
+			cs[j] = newTestClient(t, addr)
+			cs[j].reconnects = reconnects
+		}
+		dns.maxActive = 0
+		var wg sync.WaitGroup
+		for _, c := range cs {
+			wg.Add(1)
+			go func(c *client) {
+				defer wg.Done()
+				c.reconnect()
+			}(c)
+		}
+		wg.Wait()
+		lookupHost, servers, *dns_ttl = oldLookup, oldServers, oldTTL
+
+		if test.limit > 0 && dns.maxActive > test.limit {
+			t.Errorf("case %d: %d clients reconnected at once, limit is %d", i, dns.maxActive, test.limit)
+		}
+		if test.limit == 0 && dns.maxActive <= 1 {
+			t.Errorf("case %d: clients did not reconnect at once without a limit", i)
+		}
+		for j, c := range cs {
+			if c.conn == nil {
+				t.Errorf("case %d: client %d did not reconnect", i, j)
+			}
+		}
+	}
+}
+
+// check that no more than the limit of clients connect at once on startup
+func TestConnectConcurrency(t *testing.T) {
+	cases := []struct {
+		limit   int // 0 for no limit
+		clients int
+	}{
+		{1, 6},
+		{3, 10},
+		{0, 10},
+	}
+	s := newFakeServer(t, 0)
+	_, port, _ := net.SplitHostPort(s.addr)
+	var conf config.Config
+	conf.Addresses.Address = []string{net.JoinHostPort("hydra.test", port)}
+	conf.Parameters.Retries = 1
+	for i, test := range cases {
+		dns := &slowDNS{delay: 20 * time.Millisecond}
+		oldLookup, oldServers, oldTTL := lookupHost, servers, *dns_ttl
+		lookupHost = dns.LookupHost
+		servers = &dnsCache{entries: make(map[string]dnsEntry)}
+		*dns_ttl = 0
+		cs := newClients(10, test.clients, conf, time.Second, nil, test.limit)
+		lookupHost, servers, *dns_ttl = oldLookup, oldServers, oldTTL
+
+		if test.limit > 0 && dns.maxActive != test.limit {
+			t.Errorf("case %d: %d clients connected at once, expected the limit of %d", i, dns.maxActive, test.limit)
+		}
+		if test.limit == 0 && dns.maxActive <= test.clients/2 {
+			t.Errorf("case %d: only %d clients connected at once without a limit", i, dns.maxActive)
+		}
+		for j, c := range cs {
+			if c.id != 10+j || c.conn == nil {
+				t.Errorf("case %d: client %d has ID %d, connected %t", i, j, c.id, c.conn != nil)
+			}
+		}
+	}
+}
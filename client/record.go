@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var record_file = flag.String("record", "", "File to record each request issued to, with its time and client, for replay")
+var replay_file = flag.String("replay", "", "In replay mode, recording to replay, with a client for each recorded client")
+var replay_rate = flag.Float64("replayrate", 0, "In replay mode, aggregate requests per second to replay at, instead of the recorded timing, 0 to keep it")
+
+// recordHeader is the first row of each recording, as for statsHeader
+var recordHeader = []string{"#v1 offset_ns", "client_id", "replicate", "command"}
+
+// recorder writes each request issued, with the time since recording
+// started and the logical client which issued it, so that the interleaving
+// of concurrent clients can be replayed.
+// It is safe for concurrent access
+type recorder struct {
+	file   *os.File
+	csv    *csv.Writer
+	start  time.Time
+	closed bool
+	sync.Mutex
+}
+
+// newRecorder starts a recording in filename, replacing any existing file
+func newRecorder(filename string) (*recorder, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{file: file, csv: csv.NewWriter(file), start: time.Now()}
+	if err = r.csv.Write(recordHeader); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Record a request issued by client. The offset is taken under the lock,
+// so that offsets in the file are in order. Requests issued after the
+// recording is closed are not recorded
+func (r *recorder) Record(client int, text string, replicate bool) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return nil
+	}
+	offset := time.Since(r.start)
+	return r.csv.Write([]string{strconv.FormatInt(offset.Nanoseconds(), 10), strconv.Itoa(client),
+		strconv.FormatBool(replicate), text})
+}
+
+// Close flushes and closes the recording
+func (r *recorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.csv.Flush()
+	if err := r.csv.Error(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// recorded is a request read back from a recording
+type recorded struct {
+	offset    time.Duration
+	text      string
+	replicate bool
+}
+
+// replayStream is an API issuing the requests of one recorded client, each
+// at its original offset from the start of the replay
+type replayStream struct {
+	client  int // ID of the recorded client
+	records []recorded
+	next    int
+	start   time.Time
+	stop    chan bool
+}
+
+// readRecording reads a recording into a stream for each recorded client,
+// in order of their first request
+func readRecording(r io.Reader) ([]*replayStream, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(recordHeader)
+	var streams []*replayStream
+	byClient := make(map[int]*replayStream)
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(row[0], "#") {
+			if row[0] != recordHeader[0] {
+				return nil, errors.New("Unsupported recording version: " + row[0])
+			}
+			continue
+		}
+		offset, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		client, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, err
+		}
+		replicate, err := strconv.ParseBool(row[2])
+		if err != nil {
+			return nil, err
+		}
+		s, ok := byClient[client]
+		if !ok {
+			s = &replayStream{client: client}
+			byClient[client] = s
+			streams = append(streams, s)
+		}
+		s.records = append(s.records, recorded{time.Duration(offset), row[3], replicate})
+	}
+	return streams, nil
+}
+
+// loadRecording reads the recording in filename
+func loadRecording(filename string) ([]*replayStream, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readRecording(file)
+}
+
+// paceReplay replaces the recorded offsets of streams, so that they are
+// replayed at rate requests per second in all, each at an even pace. The
+// rate is shared between the streams in proportion to their requests, so
+// that each recorded client keeps its share of the load and the mix of
+// operations is that recorded. Each stream is offset by a fraction of its
+// interval, so that their requests are spread out
+func paceReplay(streams []*replayStream, rate float64) {
+	total := 0
+	for _, s := range streams {
+		total += len(s.records)
+	}
+	for i, s := range streams {
+		interval := float64(time.Second) * float64(total) / (rate * float64(len(s.records)))
+		phase := float64(i) / float64(len(streams))
+		for j := range s.records {
+			s.records[j].offset = time.Duration((float64(j) + phase) * interval)
+		}
+	}
+}
+
+// startReplay starts the replay of all streams from now, so that their
+// requests are interleaved as they were recorded. Closing stop ends it
+func startReplay(streams []*replayStream, stop chan bool) {
+	now := time.Now()
+	for _, s := range streams {
+		s.start = now
+		s.stop = stop
+	}
+}
+
+// Next waits until the offset of the next request. If an earlier request
+// was slower than the gap to this one, it is issued immediately
+func (s *replayStream) Next() (string, bool, bool) {
+	if s.next == len(s.records) {
+		return "", false, false
+	}
+	r := s.records[s.next]
+	s.next++
+	if wait := time.Until(s.start.Add(r.offset)); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			return "", false, false
+		}
+	}
+	return r.text, r.replicate, true
+}
+
+// Return discards the response, replays only reproduce the load
+func (s *replayStream) Return(str string) {}
+
+func (s *replayStream) ReturnStream(chunks chan string) {
+	for range chunks {
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// run a client for each API concurrently, with setup called on each first
+func runAPIs(t *testing.T, addr string, apis []API, setup func(int, *client)) {
+	var wg sync.WaitGroup
+	for i := range apis {
+		c := newTestClient(t, addr)
+		c.id = i
+		setup(i, c)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.run(apis[i])
+		}(i)
+	}
+	wg.Wait()
+}
+
+// commandsBy returns the commands received from each client
+func commandsBy(s *fakeServer) map[int][]string {
+	commands := make(map[int][]string)
+	for _, req := range s.Received() {
+		commands[req.ClientID] = append(commands[req.ClientID], req.Request)
+	}
+	return commands
+}
+
+// check that a recording of concurrent clients replays with the same
+// clients, commands and concurrency
+func TestRecordReplay(t *testing.T) {
+	const clients = 3
+	filename := filepath.Join(t.TempDir(), "recording.csv")
+	rec, err := newRecorder(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeServer(t, 50*time.Millisecond)
+	apis := make([]API, clients)
+	for i := range apis {
+		apis[i] = &commandList{commands: []string{
+			fmt.Sprintf("get %d", i), fmt.Sprintf("update %d 1", i), fmt.Sprintf("get %d", i)}}
+	}
+	runAPIs(t, s.addr, apis, func(i int, c *client) { c.record = rec })
+	if err = rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	recorded := commandsBy(s)
+
+	streams, err := loadRecording(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != clients {
+		t.Fatalf("Recording has %d clients, expected %d", len(streams), clients)
+	}
+	replayed := newFakeServer(t, 50*time.Millisecond)
+	apis = make([]API, len(streams))
+	for i := range streams {
+		apis[i] = streams[i]
+	}
+	startReplay(streams, make(chan bool))
+	runAPIs(t, replayed.addr, apis, func(i int, c *client) { c.id = streams[i].client })
+
+	if got := commandsBy(replayed); !reflect.DeepEqual(got, recorded) {
+		t.Errorf("Replay sent %v, but %v was recorded", got, recorded)
+	}
+	if s.MaxActive() != clients || replayed.MaxActive() != clients {
+		t.Errorf("Recorded %d concurrent requests and replayed %d, expected %d",
+			s.MaxActive(), replayed.MaxActive(), clients)
+	}
+}
+
+// check that replayed requests are interleaved at their recorded offsets
+func TestReplayTiming(t *testing.T) {
+	recording := recordHeader[0] + ",client_id,replicate,command\n" +
+		"0,4,false,get A\n" +
+		"50000000,7,true,update B 1\n" +
+		"100000000,4,false,get B\n"
+	streams, err := readRecording(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 2 || streams[0].client != 4 || streams[1].client != 7 {
+		t.Fatalf("Recording was read as %d streams", len(streams))
+	}
+
+	s := newFakeServer(t, 0)
+	apis := []API{streams[0], streams[1]}
+	start := time.Now()
+	startReplay(streams, make(chan bool))
+	runAPIs(t, s.addr, apis, func(i int, c *client) { c.id = streams[i].client })
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Replay took %s, expected at least 100ms", elapsed)
+	}
+	var order []string
+	for _, req := range s.Received() {
+		order = append(order, fmt.Sprintf("%d %s %t", req.ClientID, req.Request, req.Replicate))
+	}
+	expected := []string{"4 get A false", "7 update B 1 true", "4 get B false"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Replay sent %v, expected %v", order, expected)
+	}
+}
+
+// check that recordings of an unknown version are rejected
+func TestReplayVersion(t *testing.T) {
+	if _, err := readRecording(strings.NewReader("#v9 offset_ns,client_id,replicate,command\n")); err == nil {
+		t.Error("Recording of an unknown version was read")
+	}
+}
+
+// check that a paced replay is issued at the target aggregate rate, with
+// the requests of each recorded client in their recorded order
+func TestReplayRate(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(strings.Join(recordHeader, ",") + "\n")
+	// one client issues three times the requests of the other, a third of
+	// them writes, all at once
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&b, "0,1,%t,update %d 1\n", i%3 == 0, i)
+		if i%3 == 0 {
+			fmt.Fprintf(&b, "0,2,false,get %d\n", i)
+		}
+	}
+	streams, err := readRecording(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([][]recorded, len(streams))
+	for i, s := range streams {
+		want[i] = append([]recorded{}, s.records...)
+	}
+
+	rate := 2000.0
+	paceReplay(streams, rate)
+	start := time.Now()
+	startReplay(streams, make(chan bool))
+	issued := make([][]recorded, len(streams))
+	var wg sync.WaitGroup
+	for i, s := range streams {
+		wg.Add(1)
+		go func(i int, s *replayStream) {
+			defer wg.Done()
+			for {
+				text, replicate, ok := s.Next()
+				if !ok {
+					return
+				}
+				issued[i] = append(issued[i], recorded{text: text, replicate: replicate})
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	// the last request is issued an interval before the end
+	elapsed := time.Since(start) + time.Duration(float64(time.Second)/rate)
+	if achieved := 400 / elapsed.Seconds(); achieved < 0.9*rate || achieved > 1.1*rate {
+		t.Errorf("Replayed at %.0f requests/s, expected %.0f", achieved, rate)
+	}
+	for i := range streams {
+		if len(issued[i]) != len(want[i]) {
+			t.Fatalf("Client %d issued %d requests, expected %d", streams[i].client, len(issued[i]), len(want[i]))
+		}
+		for j, r := range want[i] {
+			if issued[i][j].text != r.text || issued[i][j].replicate != r.replicate {
+				t.Errorf("Client %d request %d was %q, expected %q", streams[i].client, j, issued[i][j].text, r.text)
+			}
+		}
+	}
+	// each client keeps its share of the rate, so all finish together
+	for _, s := range streams {
+		if last := s.records[len(s.records)-1].offset; last < 190*time.Millisecond || last > 200*time.Millisecond {
+			t.Errorf("Client %d issued its last request at %v, expected just before 200ms", s.client, last)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+// check that connections are recycled after exactly maxPerConn requests
+func TestMaxRequestsPerConnection(t *testing.T) {
+	for _, max := range []int{0, 1, 3} {
+		s := newFakeServer(t, 0)
+		c := newTestClient(t, s.addr)
+		c.maxPerConn = max
+		for i := 1; i <= 7; i++ {
+			c.submit("get A", false)
+			// the connection is reopened by the next request
+			conns := 1
+			if max > 0 {
+				conns += (i - 1) / max
+			}
+			s.Lock()
+			if s.conns != conns {
+				t.Errorf("max %d: %d connections opened after %d requests, expected %d", max, s.conns, i, conns)
+			}
+			s.Unlock()
+		}
+	}
+}
+
+// check that a session stays on its server when its connection is recycled
+func TestRecycledSessionPinned(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0)}
+	c := newTestClient(t, servers[0].addr, servers[1].addr)
+	c.maxPerConn = 1
+	// move to the second server before the session starts
+	c.reconnect()
+	api := &sessionCommands{commandList{commands: []string{"get A", "get B", "get C"}}, "s"}
+	c.run(api)
+	if n := len(servers[1].Received()); n != 3 {
+		t.Errorf("Session's server received %d of its 3 requests", n)
+	}
+	if n := len(servers[0].Received()); n != 0 {
+		t.Errorf("Other server received %d requests", n)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"sync"
+)
+
+// addressBook holds the server addresses, which may change when the config
+// file is reloaded. It is safe for concurrent access
+type addressBook struct {
+	addrs []string
+	sync.RWMutex
+}
+
+func newAddressBook(addrs []string) *addressBook {
+	return &addressBook{addrs: addrs}
+}
+
+func (b *addressBook) Get() []string {
+	b.RLock()
+	defer b.RUnlock()
+	return b.addrs
+}
+
+func (b *addressBook) Set(addrs []string) {
+	b.Lock()
+	defer b.Unlock()
+	b.addrs = addrs
+}
+
+// watchConfig reloads the addresses into book whenever the config file
+// changes. Existing connections are unaffected, the new addresses are used
+// when clients next connect.
+func watchConfig(filename string, book *addressBook) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// watch the directory, as editors often replace the file
+	if err = watcher.Add(filepath.Dir(filename)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(filename) ||
+					!event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				conf, err := config.ReadClientConfig(filename)
+				if err != nil {
+					glog.Warning("Not reloading addresses, ", err)
+					continue
+				}
+				if len(conf.Addresses.Address) == 0 {
+					glog.Warning("Not reloading addresses, ", filename, " has none")
+					continue
+				}
+				glog.Info("Reloaded addresses from ", filename, ": ", conf.Addresses.Address)
+				book.Set(conf.Addresses.Address)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				glog.Warning(err)
+			}
+		}
+	}()
+	return watcher, nil
+}
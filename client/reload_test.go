@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, filename string, addrs ...string) {
+	conf := "[addresses]\n"
+	for _, addr := range addrs {
+		conf += "address = " + addr + "\n"
+	}
+	conf += "[parameters]\nretries = 1\ntimeout = 500\n"
+	if err := ioutil.WriteFile(filename, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// check that addresses changed in the config file during a run are used on
+// the next reconnect, without disturbing the current connection
+func TestReloadAddresses(t *testing.T) {
+	old := newFakeServer(t, 0)
+	added := newFakeServer(t, 0)
+	filename := filepath.Join(t.TempDir(), "client.conf")
+	writeConfig(t, filename, old.addr)
+
+	c := newTestClient(t, old.addr)
+	c.book = newAddressBook([]string{old.addr})
+	watcher, err := watchConfig(filename, c.book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	writeConfig(t, filename, added.addr)
+	for i := 0; fmt.Sprint(c.book.Get()) != fmt.Sprint([]string{added.addr}); i++ {
+		if i == 100 {
+			t.Fatalf("Addresses were not reloaded: %v", c.book.Get())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the current connection is still used
+	if c.submit("get A", false) != "0" || len(old.Received()) != 1 {
+		t.Fatal("Request was not sent on the existing connection")
+	}
+
+	// on failure, the client reconnects to the new address
+	old.Lock()
+	old.drop = 100
+	old.Unlock()
+	if c.submit("get B", false) != "0" {
+		t.Fatal("Request failed after reloading addresses")
+	}
+	if n := len(added.Received()); n != 1 {
+		t.Errorf("New server received %d requests after the reconnect", n)
+	}
+}
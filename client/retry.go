@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// retryAction is how a request failing with an error is retried
+type retryAction int
+
+const (
+	// reconnect to the next server and retry there
+	retryFailover retryAction = iota
+	// retry on the same connection, e.g. after a timeout of a server which
+	// is still up but slow
+	retrySame
+	// wait, for longer each time, and retry on the same connection
+	retryBackoff
+	// fail the request without retrying it
+	retryFail
+)
+
+var retryActions = []string{"failover", "retry-same", "backoff-retry", "fail"}
+
+func (a retryAction) String() string {
+	if int(a) < len(retryActions) {
+		return retryActions[a]
+	}
+	return "unknown"
+}
+
+// how long to back off from a busy server, doubling on each retry of a
+// request up to the maximum
+const (
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = time.Second
+)
+
+// retryPolicy maps the kind of each error, as returned by errorKind, to how
+// requests failing with it are retried. Kinds not in the policy are retried
+// as in defaultRetryPolicy, and failed over if not in that either. A nil
+// retryPolicy is the default policy
+type retryPolicy map[string]retryAction
+
+var defaultRetryPolicy = retryPolicy{
+	"busy": retryBackoff,
+	// retrying would most likely get the same reply
+	"msg_too_large": retryFail,
+}
+
+// parseRetryPolicy parses the [retry] policy of the config, each entry of
+// which is an error kind and its action, separated by whitespace
+func parseRetryPolicy(entries []string) (retryPolicy, error) {
+	policy := retryPolicy{}
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid retry policy %q, expected an error category and an action", entry)
+		}
+		if !knownErrorKind(fields[0]) {
+			return nil, fmt.Errorf("Unknown error category %q in retry policy", fields[0])
+		}
+		action := -1
+		for i, name := range retryActions {
+			if strings.EqualFold(fields[1], name) {
+				action = i
+			}
+		}
+		if action < 0 {
+			return nil, fmt.Errorf("Unknown retry action %q, expected one of %s", fields[1], strings.Join(retryActions, ", "))
+		}
+		policy[fields[0]] = retryAction(action)
+	}
+	return policy, nil
+}
+
+// knownErrorKind returns true if kind is returned by errorKind for some
+// error. Cancelled and unauthorized requests are handled apart, so have no
+// policy
+func knownErrorKind(kind string) bool {
+	if kind == "other" {
+		return true
+	}
+	for _, k := range errorKinds {
+		if k.name == kind && k.err != ErrCancelled && k.err != ErrUnauthorized {
+			return true
+		}
+	}
+	return false
+}
+
+// Action returns how to retry a request which failed with err
+func (p retryPolicy) Action(err error) retryAction {
+	kind := errorKind(err)
+	if action, ok := p[kind]; ok {
+		return action
+	}
+	return defaultRetryPolicy[kind]
+}
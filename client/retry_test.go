@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryPolicy(t *testing.T) {
+	cases := []struct {
+		entries []string
+		policy  retryPolicy // nil if invalid
+	}{
+		{nil, retryPolicy{}},
+		{[]string{"timeout retry-same", "conn_refused failover", "busy  Backoff-Retry", "other fail"},
+			retryPolicy{"timeout": retrySame, "conn_refused": retryFailover, "busy": retryBackoff, "other": retryFail}},
+		{[]string{"timeout"}, nil},
+		{[]string{"timeout retry-same now"}, nil},
+		{[]string{"timeouts retry-same"}, nil},
+		{[]string{"cancelled fail"}, nil},
+		{[]string{"unauthorized failover"}, nil},
+		{[]string{"timeout retry"}, nil},
+	}
+	for i, c := range cases {
+		policy, err := parseRetryPolicy(c.entries)
+		if (err == nil) != (c.policy != nil) || len(policy) != len(c.policy) {
+			t.Errorf("case %d: parsed as %v, %v", i, policy, err)
+			continue
+		}
+		for kind, action := range c.policy {
+			if policy[kind] != action {
+				t.Errorf("case %d: %s is %s, expected %s", i, kind, policy[kind], action)
+			}
+		}
+	}
+}
+
+// check that errors of each category are retried as by the policy, or the
+// default policy if it has none for the category
+func TestRetryPolicy(t *testing.T) {
+	*drain_window = 0
+	defer func() { *drain_window = 10 * time.Millisecond }()
+	cases := []struct {
+		policy   []string
+		server   func(*fakeServer)
+		response string
+		failover bool // whether the client reconnected
+		received int  // tries received by the server
+	}{
+		// timeouts are failed over by default
+		{nil, func(s *fakeServer) { s.silent = 1 }, "0", true, 2},
+		// the reply owed to the first send never arrives, so the connection
+		// is closed once the second is answered
+		{[]string{"timeout retry-same"}, func(s *fakeServer) { s.silent = 1 }, "0", true, 2},
+		{[]string{"timeout fail"}, func(s *fakeServer) { s.silent = 1 }, ErrTimeout.Error(), true, 1},
+		// busy servers are backed off from by default, on the same connection
+		{nil, func(s *fakeServer) { s.overloaded = 2 }, "0", false, 3},
+		{[]string{"busy failover"}, func(s *fakeServer) { s.overloaded = 1 }, "0", true, 2},
+		{[]string{"busy fail"}, func(s *fakeServer) { s.overloaded = 1 }, ErrBusy.Error(), true, 1},
+		// connections closed without a reply
+		{nil, func(s *fakeServer) { s.drop = 1 }, "0", true, 2},
+		{[]string{"server fail"}, func(s *fakeServer) { s.drop = 1 }, "connection closed without a reply", true, 1},
+		{[]string{"server retry-same"}, func(s *fakeServer) { s.drop = 1 }, "0", true, 2},
+	}
+	for i, c := range cases {
+		policy, err := parseRetryPolicy(c.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := newFakeServer(t, 0)
+		c.server(server)
+		client := newTestClient(t, server.addr)
+		client.timeout = 100 * time.Millisecond
+		client.retry = policy
+		conn := client.conn
+		if response := client.submit("get A", false); !strings.HasSuffix(response, c.response) {
+			t.Errorf("case %d: response was %q, expected %q", i, response, c.response)
+		}
+		failover := client.conn != conn
+		if received := len(server.Received()); failover != c.failover || received != c.received {
+			t.Errorf("case %d: reconnected %t after %d tries, expected %t after %d", i, failover, received, c.failover, c.received)
+		}
+	}
+}
+
+// check that a busy server is backed off from for longer on each retry
+func TestRetryBackoff(t *testing.T) {
+	server := newFakeServer(t, 0)
+	server.overloaded = 3
+	client := newTestClient(t, server.addr)
+	start := time.Now()
+	if response := client.submit("get A", false); response != "0" {
+		t.Errorf("Response was %q", response)
+	}
+	if elapsed := time.Since(start); elapsed < 7*minRetryBackoff {
+		t.Errorf("Retried after %v, expected backing off for %v", elapsed, 7*minRetryBackoff)
+	}
+}
+
+// check that when a try sent again on the same connection is answered for
+// each send, the extra reply is discarded rather than left to be read by the
+// next request
+func TestRetrySameAnsweredTwice(t *testing.T) {
+	*drain_window = 0
+	defer func() { *drain_window = 10 * time.Millisecond }()
+	server := newFakeServer(t, 150*time.Millisecond)
+	server.echo = true
+	server.delayed = 1
+	client := newTestClient(t, server.addr)
+	client.timeout = 100 * time.Millisecond
+	client.retry = retryPolicy{"timeout": retrySame}
+	conn := client.conn
+	if response := client.submit("get A", false); response != "get A" {
+		t.Errorf("Response was %q", response)
+	}
+	if client.conn != conn || len(server.Received()) != 2 {
+		t.Fatalf("Server received %d tries, expected 2 on the same connection", len(server.Received()))
+	}
+
+	// nothing is left to be read
+	client.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if b, err := client.rd.ReadByte(); err == nil {
+		t.Errorf("Reply starting %q left on the connection", b)
+	}
+	client.conn.SetReadDeadline(time.Time{})
+	if response := client.submit("get B", false); response != "get B" {
+		t.Errorf("Response to the next request was %q", response)
+	}
+}
+
+// check that a failed resend returns its error
+func TestResend(t *testing.T) {
+	client, server := net.Pipe()
+	go io.Copy(io.Discard, server)
+	if err := resend([]byte("{}"), client); err != nil {
+		t.Error(err)
+	}
+	server.Close()
+	if err := resend([]byte("{}"), client); err == nil {
+		t.Error("Resend on a closed connection succeeded")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// retry amplification above which the server is considered saturated, as
+// requests are failing
+const maxAmplification = 1.1
+
+// rampStep is the result of a step of a saturation ramp
+type rampStep struct {
+	offered       float64 // requests per second
+	achieved      float64 // requests per second
+	p99           time.Duration
+	amplification float64
+}
+
+// saturated returns true if the server could not keep up with the step
+func (s rampStep) saturated(slo time.Duration) bool {
+	return s.p99 > slo || s.achieved < 0.9*s.offered || s.amplification > maxAmplification
+}
+
+// ramp increases the rate of q by step every duration, for up to steps steps,
+// until the p99 latency exceeds slo or the server otherwise saturates. Each
+// step is measured with m and written to w as it completes. It returns the
+// steps run and the index of the last step before saturation, the knee, or
+// -1 if the first step saturated. If stopped first, interrupted is true and
+// the knee is the last step completed, -1 if there was none.
+func ramp(w io.Writer, q *arrivalQueue, m *metrics, step float64, duration time.Duration, steps int,
+	slo time.Duration, stop <-chan bool) (results []rampStep, knee int, interrupted bool) {
+	fmt.Fprintf(w, "%12s %12s %12s\n", "offered/s", "achieved/s", "p99")
+	// samples of its own, so that those of the run are left whole
+	sampler := m.Sampler()
+	for i := 1; i <= steps; i++ {
+		rate := step * float64(i)
+		q.SetRate(rate)
+		sampler.Take()
+		requests, attempts := m.Requests(), m.Attempts()
+		start := time.Now()
+		select {
+		case <-stop:
+			return results, len(results) - 1, true
+		case <-time.After(duration):
+		}
+
+		samples := sampler.Take()
+		// counted, as beyond the most samples kept not all are
+		completed := m.Requests() - requests
+		result := rampStep{
+			offered:  rate,
+			achieved: float64(completed) / time.Since(start).Seconds()}
+		sort.Sort(durations(samples))
+		result.p99 = percentile(samples, 99)
+		if completed > 0 {
+			result.amplification = float64(m.Attempts()-attempts) / float64(completed)
+		}
+		results = append(results, result)
+		fmt.Fprintf(w, "%12.1f %12.1f %12s\n", result.offered, result.achieved, result.p99)
+		if result.saturated(slo) {
+			return results, i - 2, false
+		}
+	}
+	return results, len(results) - 1, false
+}
+
+// rampReport describes the outcome of a ramp
+func rampReport(steps []rampStep, knee int, interrupted bool) string {
+	switch {
+	case interrupted && knee < 0:
+		return "Ramp interrupted during the first step"
+	case interrupted:
+		return fmt.Sprintf("Ramp interrupted, the server kept up with %.1f requests/s", steps[knee].offered)
+	case knee < 0:
+		return "Server saturated at the first step"
+	case knee == len(steps)-1:
+		return fmt.Sprintf("Server did not saturate, up to %.1f requests/s", steps[knee].offered)
+	}
+	return fmt.Sprintf("Saturation point: %.1f requests/s, with p99 latency %s", steps[knee].achieved, steps[knee].p99)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"github.com/heidi-ann/hydra/test"
+	"testing"
+	"time"
+)
+
+// ramp against a server which handles one request at a time, so saturates
+// at no more than 1/delay, 200 requests per second
+func TestRampSaturates(t *testing.T) {
+	s := newFakeServer(t, 5*time.Millisecond)
+	s.serial = true
+	q := newArrivalQueue(100, 1000)
+	defer q.Close()
+	m := newMetrics()
+	stop := make(chan bool)
+	defer close(stop)
+	for i := 0; i < 8; i++ {
+		c := newTestClient(t, s.addr)
+		c.id = i
+		c.queue = q
+		c.metrics = m
+		c.stop = stop
+		go c.run(test.Generate(test.ConfigAuto{
+			Commands:    test.Commands{Reads: 100, Conflicts: 1},
+			Termination: test.Termination{Requests: -1}}))
+	}
+
+	var out bytes.Buffer
+	steps, knee, interrupted := ramp(&out, q, m, 50, 500*time.Millisecond, 10, 50*time.Millisecond, stop)
+	if len(steps) == 10 || interrupted {
+		t.Fatalf("Server did not saturate:\n%s", out.String())
+	}
+	last := steps[len(steps)-1]
+	if !last.saturated(50*time.Millisecond) || last.offered <= 100 || last.offered > 250 {
+		t.Errorf("Server saturated at %.1f requests/s, expected about 200:\n%s", last.offered, out.String())
+	}
+	if knee != len(steps)-2 || steps[knee].saturated(50*time.Millisecond) {
+		t.Errorf("Knee is step %d:\n%s", knee, out.String())
+	}
+}
+
+// check that a ramp stopped before saturating is reported as interrupted,
+// not as saturating or not
+func TestRampInterrupted(t *testing.T) {
+	q := newArrivalQueue(100, 1000)
+	defer q.Close()
+	stop := make(chan bool)
+	close(stop)
+	var out bytes.Buffer
+	steps, knee, interrupted := ramp(&out, q, newMetrics(), 50, time.Second, 10, 50*time.Millisecond, stop)
+	if len(steps) != 0 || knee != -1 || !interrupted {
+		t.Errorf("Ramp stopped during the first step returned %d steps, knee %d, interrupted %t", len(steps), knee, interrupted)
+	}
+	if report := rampReport(steps, knee, interrupted); report != "Ramp interrupted during the first step" {
+		t.Errorf("Ramp stopped during the first step reported %q", report)
+	}
+
+	steps = []rampStep{{offered: 50, achieved: 50}, {offered: 100, achieved: 100}}
+	if report := rampReport(steps, 1, true); report != "Ramp interrupted, the server kept up with 100.0 requests/s" {
+		t.Errorf("Ramp stopped after two steps reported %q", report)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// startDelay picks how long client id waits before issuing requests,
+// uniformly from [0, jitter]. It is seeded by the client id so that runs
+// are reproducible.
+func startDelay(jitter time.Duration, id int) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	r := rand.New(rand.NewSource(int64(id)))
+	return time.Duration(r.Int63n(int64(jitter) + 1))
+}
+
+// tokenBucket limits the rate at which requests are issued, while allowing
+// bursts of up to burst requests. It is safe for concurrent access
+type tokenBucket struct {
+	rate   float64 // tokens added per second
+	burst  float64 // maximum tokens
+	tokens float64
+	last   time.Time
+	// fraction of rate added while throttled, until the time given
+	throttle float64
+	until    time.Time
+	sync.Mutex
+}
+
+// newTokenBucket creates a full bucket for rate requests per second
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now()}
+}
+
+// Wait blocks until a token is available and takes it
+func (b *tokenBucket) Wait() {
+	b.Lock()
+	now := time.Now()
+	rate := b.current(now)
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	// take the token now, waiting for it to be refilled if needed
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / rate * float64(time.Second))
+	}
+	b.Unlock()
+	time.Sleep(wait)
+}
+
+// current returns the rate at now, with the lock held
+func (b *tokenBucket) current(now time.Time) float64 {
+	if now.Before(b.until) {
+		return b.rate * b.throttle
+	}
+	return b.rate
+}
+
+// Throttle reduces the rate to fraction of it, from 0 to 1, for d, as asked
+// by an overloaded server. A later call replaces it. Nothing is done for a
+// nil *tokenBucket
+func (b *tokenBucket) Throttle(fraction float64, d time.Duration) {
+	if b == nil {
+		return
+	}
+	// a small rate is kept, so that waits stay bounded
+	if fraction < 0.01 {
+		fraction = 0.01
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.throttle, b.until = fraction, time.Now().Add(d)
+}
+
+// Rate returns the current rate, in tokens per second
+func (b *tokenBucket) Rate() float64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.current(time.Now())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartDelay(t *testing.T) {
+	jitter := 500 * time.Millisecond
+	for id := 0; id < 100; id++ {
+		delay := startDelay(jitter, id)
+		if delay < 0 || delay > jitter {
+			t.Errorf("Client %d start delay %s is outside [0, %s]", id, delay, jitter)
+		}
+		if startDelay(jitter, id) != delay {
+			t.Errorf("Client %d start delay is not reproducible", id)
+		}
+	}
+
+	if delay := startDelay(0, 1); delay != 0 {
+		t.Errorf("Start delay is %s without jitter", delay)
+	}
+}
+
+// check the achieved rate matches the configured rate, after the initial burst
+func TestTokenBucketRate(t *testing.T) {
+	cases := []struct {
+		rate  float64
+		burst int
+	}{
+		{100, 1},
+		{200, 10},
+		{50, 5},
+	}
+
+	for _, c := range cases {
+		bucket := newTokenBucket(c.rate, c.burst)
+		n := int(c.rate/2) + c.burst // half a second of requests after the burst
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			bucket.Wait()
+		}
+		elapsed := time.Since(start).Seconds()
+		achieved := float64(n-c.burst) / elapsed
+		if achieved > c.rate*1.1 || achieved < c.rate*0.8 {
+			t.Errorf("Achieved %.1f requests/sec but %.1f was configured", achieved, c.rate)
+		}
+	}
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	bucket := newTokenBucket(1, 10)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		bucket.Wait()
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("Burst of 10 requests took %s", time.Since(start))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/golang/glog"
+)
+
+// SessionAPI is implemented by APIs which group related commands into
+// sessions. The commands of a session are pinned to a single server, and
+// only move to another server on failure.
+type SessionAPI interface {
+	// Session returns the token of the session of the last command from
+	// Next, or "" if it is not part of a session
+	Session() string
+}
+
+// setSession updates the session of the client, pinning the session to the
+// current server when it starts
+func (c *client) setSession(token string) {
+	if token == c.session {
+		return
+	}
+	if c.session != "" {
+		glog.Info("Client ", c.id, " ending session ", c.session)
+	}
+	c.session = token
+	if token != "" {
+		c.sessionServer = c.leader
+		glog.Info("Client ", c.id, " starting session ", token, " on server ", c.leader)
+	}
+}
+
+// pinned returns true if the client should not voluntarily change server
+func (c *client) pinned() bool {
+	return c.session != ""
+}
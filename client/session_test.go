@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// API issuing a list of reads as a single session
+type sessionCommands struct {
+	commandList
+	token string
+}
+
+func (s *sessionCommands) Session() string {
+	return s.token
+}
+
+func sessionConfig(addrs ...string) config.Config {
+	var conf config.Config
+	conf.Addresses.Address = addrs
+	conf.Parameters.Retries = 1
+	return conf
+}
+
+// check that concurrent sessions reading the same keys each hit their own
+// server, instead of sharing a response from another client's server
+func TestSessionPinnedToServer(t *testing.T) {
+	stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Close()
+
+	servers := []*fakeServer{
+		newFakeServer(t, 50*time.Millisecond),
+		newFakeServer(t, 50*time.Millisecond)}
+	reads := newCoalescer()
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		c := newClient(i, sessionConfig(s.addr), time.Second, stats)
+		c.reads = reads
+		api := &sessionCommands{commandList{commands: []string{"get A", "get B", "get A"}}, "s"}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.run(api)
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range servers {
+		if n := len(s.Received()); n != 3 {
+			t.Errorf("Server %d received %d of its session's 3 requests", i, n)
+		}
+	}
+	if reads.Coalesced() != 0 {
+		t.Errorf("%d session reads were coalesced", reads.Coalesced())
+	}
+}
+
+// check that a session falls back to another server when its server fails
+func TestSessionMovesOnFailure(t *testing.T) {
+	stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Close()
+
+	failing := newFakeServer(t, 0)
+	healthy := newFakeServer(t, 0)
+	failing.drop = 100
+	c := newClient(0, sessionConfig(failing.addr, healthy.addr), time.Second, stats)
+	api := &sessionCommands{commandList{commands: []string{"get A", "get B"}}, "s"}
+	c.run(api)
+
+	if len(api.responses) != 2 {
+		t.Fatalf("Session completed %d of 2 commands", len(api.responses))
+	}
+	if n := len(healthy.Received()); n != 2 {
+		t.Errorf("Healthy server received %d session requests, 2 were expected", n)
+	}
+	if c.sessionServer != 1 {
+		t.Errorf("Session is pinned to server %d after failover", c.sessionServer)
+	}
+}
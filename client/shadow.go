@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/config"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// requests queued for the shadow cluster, beyond which they are dropped
+const shadowQueue = 100
+
+type shadowRequest struct {
+	text      string
+	replicate bool
+	compare   bool   // compare the response with primary
+	primary   string // response from the primary cluster
+}
+
+// shadow mirrors the requests of a client to a second cluster. Requests are
+// sent in the background so that the shadow never delays the client, they
+// are not retried and their responses are discarded.
+type shadow struct {
+	id        int
+	conf      config.Config
+	timeout   time.Duration
+	stats     *StatsWriter
+	conn      net.Conn // nil if not connected
+	rd        *bufio.Reader
+	leader    int
+	requestID int
+	requests  chan shadowRequest
+	done      chan bool
+	sent      int64
+	failed    int64
+	dropped   int64 // requests dropped as the queue was full
+	compared  int64 // responses compared with the primary's
+	diverged  int64 // compared responses which differed
+}
+
+// newShadow starts mirroring requests to the cluster in conf, recording
+// their latency to stats
+func newShadow(id int, conf config.Config, stats *StatsWriter) *shadow {
+	s := &shadow{
+		id:        id,
+		conf:      conf,
+		timeout:   time.Millisecond * time.Duration(conf.Parameters.Timeout),
+		stats:     stats,
+		requestID: 1,
+		requests:  make(chan shadowRequest, shadowQueue),
+		done:      make(chan bool)}
+	go s.run()
+	return s
+}
+
+// Mirror queues a request for the shadow cluster, without blocking
+func (s *shadow) Mirror(text string, replicate bool) {
+	select {
+	case s.requests <- shadowRequest{text, replicate, false, ""}:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// Compare queues a read for the shadow cluster, without blocking. Its
+// response is compared with the response from the primary cluster.
+func (s *shadow) Compare(text string, response string) {
+	select {
+	case s.requests <- shadowRequest{text, false, true, response}:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// Close waits for the queued requests to be sent, for up to wait
+func (s *shadow) Close(wait time.Duration) {
+	close(s.requests)
+	select {
+	case <-s.done:
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	case <-time.After(wait):
+		glog.Warning("Shadow of client ", s.id, " did not finish in time")
+	}
+	glog.Infof("Shadow of client %d sent %d requests, %d failed and %d were dropped",
+		s.id, s.Sent(), s.Failed(), s.Dropped())
+}
+
+func (s *shadow) Sent() int     { return int(atomic.LoadInt64(&s.sent)) }
+func (s *shadow) Failed() int   { return int(atomic.LoadInt64(&s.failed)) }
+func (s *shadow) Dropped() int  { return int(atomic.LoadInt64(&s.dropped)) }
+func (s *shadow) Compared() int { return int(atomic.LoadInt64(&s.compared)) }
+func (s *shadow) Diverged() int { return int(atomic.LoadInt64(&s.diverged)) }
+
+func (s *shadow) run() {
+	for req := range s.requests {
+		atomic.AddInt64(&s.sent, 1)
+		if err := s.send(req); err != nil {
+			glog.Warning("Shadow request ", s.requestID, " failed due to: ", err)
+			atomic.AddInt64(&s.failed, 1)
+			if s.conn != nil {
+				s.conn.Close()
+				s.conn = nil
+			}
+		}
+		s.requestID++
+	}
+	close(s.done)
+}
+
+// send a single request, connecting first if needed
+func (s *shadow) send(r shadowRequest) error {
+	addrs := s.conf.Addresses.Address
+	if s.conn == nil {
+		conn, leader, err := connect(addrs, s.conf.Parameters.Retries, s.leader%len(addrs))
+		if err != nil {
+			s.leader = (s.leader + 1) % len(addrs)
+			return err
+		}
+		s.conn, s.leader, s.rd = conn, leader, bufio.NewReader(conn)
+	}
+
+	b, err := msgs.Marshal(msgs.ClientRequest{
+		ClientID:  s.id,
+		RequestID: s.requestID,
+		Replicate: r.replicate,
+		Request:   r.text,
+		TraceID:   newTraceID()})
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+	rtt := netDelay.Draw()
+	timing := new(replyTiming)
+	replyCh, errCh := dispatchTimed(b, s.conn, s.rd, rtt, timing, logSample.chosen(s.id, s.requestID))
+	replyBytes, err := await(replyCh, errCh, s.timeout)
+	if err != nil {
+		return err
+	}
+	reply := new(msgs.ClientResponse)
+	if err = msgs.Unmarshal(replyBytes, reply); err != nil {
+		return err
+	}
+	if r.compare {
+		atomic.AddInt64(&s.compared, 1)
+		if reply.Response != r.primary {
+			atomic.AddInt64(&s.diverged, 1)
+			key := r.text
+			if args := strings.Fields(r.text); len(args) > 1 {
+				key = args[1]
+			}
+			glog.Warningf("Responses diverged for key %s: primary returned %q, compared cluster returned %q",
+				key, r.primary, reply.Response)
+		}
+	}
+	elapsed := time.Since(startTime)
+	latency := strconv.FormatInt(elapsed.Nanoseconds(), 10)
+	firstByte, lastByte := timing.Latencies()
+	server, network := overhead(elapsed, reply.ServerProcessingTime)
+	requestSize, replySize := timing.Sizes()
+	// each shadow sends one request at a time, as soon as it is queued
+	return s.stats.Write([]string{wallTime(startTime), strconv.Itoa(s.requestID), latency, "1", strconv.Itoa(s.id), "0", "1", "0", latency,
+		strconv.FormatInt(rtt.Nanoseconds(), 10), strconv.FormatInt(firstByte.Nanoseconds(), 10), strconv.FormatInt(lastByte.Nanoseconds(), 10),
+		strconv.FormatInt(server.Nanoseconds(), 10), strconv.FormatInt(network.Nanoseconds(), 10),
+		strconv.Itoa(requestSize), strconv.Itoa(replySize)})
+}
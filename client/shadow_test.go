@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// check that the shadow cluster receives a mirror of each request, and that
+// its failures and latency do not affect the client
+func TestShadow(t *testing.T) {
+	cases := []struct {
+		delay  time.Duration
+		drop   int
+		failed int
+	}{
+		{0, 0, 0},
+		{0, 3, 3},
+		{200 * time.Millisecond, 0, 0},
+	}
+
+	for i, test := range cases {
+		primary := newFakeServer(t, 0)
+		mirror := newFakeServer(t, test.delay)
+		mirror.drop = test.drop
+		dir := t.TempDir()
+		stats, err := OpenStatsWriter(filepath.Join(dir, "latency.csv"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		shadowStats, err := OpenStatsWriter(filepath.Join(dir, "shadow.csv"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var conf, shadowConf config.Config
+		conf.Addresses.Address = []string{primary.addr}
+		conf.Parameters.Retries = 1
+		shadowConf.Addresses.Address = []string{mirror.addr}
+		shadowConf.Parameters.Retries = 1
+		shadowConf.Parameters.Timeout = 1000
+
+		c := newClient(0, conf, time.Second, stats)
+		c.shadow = newShadow(0, shadowConf, shadowStats)
+		api := &commandList{commands: []string{"update A 1", "get A", "get B"}}
+		start := time.Now()
+		c.run(api)
+		if took := time.Since(start); took > 100*time.Millisecond {
+			t.Errorf("case %d: client took %s, delayed by the shadow", i, took)
+		}
+		c.shadow.Close(5 * time.Second)
+		stats.Close()
+		shadowStats.Close()
+
+		if len(api.responses) != 3 || len(primary.Received()) != 3 {
+			t.Errorf("case %d: client completed %d of 3 requests", i, len(api.responses))
+		}
+		if n := len(mirror.Received()); n != 3 {
+			t.Errorf("case %d: shadow received %d of 3 requests", i, n)
+		}
+		if c.shadow.Failed() != test.failed {
+			t.Errorf("case %d: %d shadow requests failed but %d were expected", i, c.shadow.Failed(), test.failed)
+		}
+		if n := len(readStats(t, filepath.Join(dir, "shadow.csv"), "")); n != 3-test.failed {
+			t.Errorf("case %d: %d shadow stats recorded", i, n)
+		}
+		if n := len(readStats(t, filepath.Join(dir, "latency.csv"), "")); n != 3 {
+			t.Errorf("case %d: %d client stats recorded", i, n)
+		}
+	}
+}
+
+// check that reads are compared with a second cluster, and writes are not
+// sent to it
+func TestCompare(t *testing.T) {
+	for _, response := range []string{"0", "1"} {
+		primary := newFakeServer(t, 0)
+		second := newFakeServer(t, 0)
+		second.response = response
+		shadowStats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "compare.csv"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conf config.Config
+		conf.Addresses.Address = []string{second.addr}
+		conf.Parameters.Retries = 1
+		conf.Parameters.Timeout = 1000
+
+		c := newTestClient(t, primary.addr)
+		c.shadow = newShadow(0, conf, shadowStats)
+		c.compare = true
+		writes := &commandList{commands: []string{"update A 1"}, replicate: true}
+		reads := &commandList{commands: []string{"get A", "get B"}}
+		c.run(writes)
+		c.run(reads)
+		c.shadow.Close(5 * time.Second)
+		shadowStats.Close()
+
+		if !reflect.DeepEqual(reads.responses, []string{"0", "0"}) {
+			t.Errorf("Second cluster changed the responses to %v", reads.responses)
+		}
+		for _, req := range second.Received() {
+			if req.Replicate {
+				t.Errorf("Write %q was sent to the second cluster", req.Request)
+			}
+		}
+		diverged := 0
+		if response != "0" {
+			diverged = 2
+		}
+		if c.shadow.Compared() != 2 || c.shadow.Diverged() != diverged {
+			t.Errorf("%d of %d reads diverged but %d of 2 were expected", c.shadow.Diverged(), c.shadow.Compared(), diverged)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+)
+
+var secret_file = flag.String("secret", "", "File containing the secret shared with the servers, to sign requests and check the signatures of responses with, none if empty")
+
+// secret signing requests and responses, nil if messages are not signed.
+// Responses with an invalid signature are rejected and the request retried
+var secret []byte
+
+// readSecret reads the secret from filename, ignoring surrounding whitespace
+func readSecret(filename string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := bytes.TrimSpace(b)
+	if len(s) == 0 {
+		return nil, errors.New("Secret file " + filename + " is empty")
+	}
+	return s, nil
+}
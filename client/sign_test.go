@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"github.com/heidi-ann/hydra/msgs"
+	"testing"
+	"time"
+)
+
+// check signed requests are accepted, and replies tampered with after
+// being signed are rejected and the request retried
+func TestSignedRequests(t *testing.T) {
+	secret = []byte("shared secret")
+	defer func() { secret = nil }()
+	server := newFakeServer(t, 0)
+	server.secret = secret
+	server.tamper = 1
+	c := newTestClient(t, server.addr)
+	c.metrics = newMetrics()
+
+	api := &commandList{commands: []string{"update A 1", "update A 2"}, replicate: true}
+	c.run(api)
+	for i, response := range api.responses {
+		if response != "0" {
+			t.Errorf("Response to %q was %q", api.commands[i], response)
+		}
+	}
+	server.Lock()
+	rejected := server.rejected
+	server.Unlock()
+	if received := server.Received(); len(received) != 3 || rejected != 0 {
+		t.Errorf("Server received %d requests and rejected %d, expected 3 with a retry and none rejected", len(received), rejected)
+	}
+	if failures := c.metrics.Failures(); failures["bad_signature"] != 1 {
+		t.Errorf("Failures were %v, expected 1 bad signature", failures)
+	}
+}
+
+// check replies signed with another secret, or not signed, are rejected
+func TestWrongSecret(t *testing.T) {
+	secret = []byte("shared secret")
+	defer func() { secret = nil }()
+	cases := []func(*msgs.ClientResponse){
+		func(res *msgs.ClientResponse) { msgs.Sign(res, secret) },
+		func(res *msgs.ClientResponse) { msgs.Sign(res, []byte("wrong secret")) },
+		func(res *msgs.ClientResponse) {},
+	}
+	for i, sign := range cases {
+		res := msgs.ClientResponse{ClientID: 1, RequestID: 1, Response: "0", Status: msgs.StatusOK}
+		sign(&res)
+		b, err := msgs.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replyCh := make(chan []byte, 1)
+		replyCh <- b
+		_, err = receive(replyCh, make(chan error), time.Second)
+		if bad := errors.Is(err, ErrBadSignature); bad != (i > 0) {
+			t.Errorf("case %d: receive returned %v", i, err)
+		}
+	}
+}
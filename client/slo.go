@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var slo_p50 = flag.Duration("slo-p50", 0, "Fail the run if the median latency exceeds this, 0 for no limit")
+var slo_p99 = flag.Duration("slo-p99", 0, "Fail the run if the p99 latency exceeds this, 0 for no limit")
+var slo_max = flag.Duration("slo-max", 0, "Fail the run if the maximum latency exceeds this, 0 for no limit")
+
+// latencySLO is a limit on a percentile of the latency of a run
+type latencySLO struct {
+	name       string
+	percentile float64
+	limit      time.Duration
+}
+
+// sloFlags returns the SLOs set by flags
+func sloFlags() []latencySLO {
+	var slos []latencySLO
+	for _, slo := range []latencySLO{{"p50", 50, *slo_p50}, {"p99", 99, *slo_p99}, {"max", 100, *slo_max}} {
+		if slo.limit > 0 {
+			slos = append(slos, slo)
+		}
+	}
+	return slos
+}
+
+// percentile returns the pth percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p/100*float64(len(sorted)-1))]
+}
+
+// checkSLOs returns a description of each SLO the latencies do not meet
+func checkSLOs(latencies []time.Duration, slos []latencySLO) []string {
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Sort(durations(sorted))
+	var failed []string
+	for _, slo := range slos {
+		if latency := percentile(sorted, slo.percentile); latency > slo.limit {
+			failed = append(failed, fmt.Sprintf("%s latency %s exceeds the SLO of %s", slo.name, latency, slo.limit))
+		}
+	}
+	return failed
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckSLOs(t *testing.T) {
+	// 1ms to 100ms
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	cases := []struct {
+		slos   []latencySLO
+		failed []string
+	}{
+		{nil, nil},
+		{[]latencySLO{{"p50", 50, 60 * time.Millisecond}, {"p99", 99, 100 * time.Millisecond}}, nil},
+		{[]latencySLO{{"p99", 99, 50 * time.Millisecond}}, []string{"p99 latency 99ms exceeds the SLO of 50ms"}},
+		{[]latencySLO{{"p50", 50, 10 * time.Millisecond}, {"max", 100, 99 * time.Millisecond}},
+			[]string{"p50 latency 50ms exceeds the SLO of 10ms", "max latency 100ms exceeds the SLO of 99ms"}},
+	}
+	for i, c := range cases {
+		failed := checkSLOs(latencies, c.slos)
+		if len(failed) != len(c.failed) {
+			t.Errorf("case %d: failed %q, expected %q", i, failed, c.failed)
+			continue
+		}
+		for j := range failed {
+			if failed[j] != c.failed[j] {
+				t.Errorf("case %d: failed %q, expected %q", i, failed, c.failed)
+			}
+		}
+	}
+}
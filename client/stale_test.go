@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+)
+
+// check that a late reply to an earlier request, arriving before the reply
+// to the current request, is discarded instead of failing the client
+func TestStaleReplyDiscarded(t *testing.T) {
+	for _, replicate := range []bool{false, true} {
+		s := newFakeServer(t, 0)
+		s.stale = 2
+		c := newTestClient(t, s.addr)
+		c.requestID = 5
+		for i := 0; i < 3; i++ {
+			if response := c.submit("update A 1", replicate); response != "0" {
+				t.Errorf("replicate %t: response to request %d was %q", replicate, i, response)
+			}
+		}
+		if n := len(s.Received()); n != 3 {
+			t.Errorf("replicate %t: server received %d requests, expected 3 as none were resent", replicate, n)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"github.com/golang/glog"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// version of the stat file columns, bumped whenever they change
+const statsSchemaVersion = 8
+
+// statsHeader is the first row of each stat file. It names the columns,
+// with the schema version prefixed to the first. The leading '#' lets CSV
+// readers skip it as a comment.
+var statsHeader = []string{
+	"#v" + strconv.Itoa(statsSchemaVersion) + " start_time",
+	"request_id",
+	"latency_ns",
+	"tries",
+	"client_id",
+	"connect_ns",
+	"in_flight",
+	"queue_ns",
+	"service_ns",
+	"injected_ns",
+	"first_byte_ns",
+	"last_byte_ns",
+	"server_ns",
+	"network_ns",
+	"request_bytes",
+	"response_bytes",
+}
+
+// StatsWriter writes per request records to the stat file as CSV,
+// optionally compressing them with gzip or zstd.
+// It is safe for concurrent access
+type StatsWriter struct {
+	file      *os.File
+	comp      io.WriteCloser // nil if stats are not compressed
+	csv       *csv.Writer
+	rows      statsRows // nil if writing CSV
+	unflushed int       // records written since the compressor was flushed
+	closed    bool
+	sync.Mutex
+}
+
+// compressionFor returns the compression to use for filename, the compression
+// flag takes precedence over the file extension
+func compressionFor(filename string, compression string) string {
+	if compression != "" {
+		return compression
+	}
+	switch {
+	case strings.HasSuffix(filename, ".gz"):
+		return "gzip"
+	case strings.HasSuffix(filename, ".zst"):
+		return "zstd"
+	}
+	return "none"
+}
+
+// wallTime formats the wall clock time of t for the start time column, for
+// ordering requests. Latencies use the monotonic clock reading of t instead,
+// via time.Since, so are not skewed by wall clock adjustments.
+func wallTime(t time.Time) string {
+	// Round(0) strips the monotonic reading, which String would append
+	return t.Round(0).String()
+}
+
+// readStatsHeader returns the first row of an existing stat file
+func readStatsHeader(file *os.File, size int64, compression string) ([]string, error) {
+	var r io.Reader = io.NewSectionReader(file, 0, size)
+	switch compression {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return cr.Read()
+}
+
+// moveAside renames filename to the first unused filename.N
+func moveAside(filename string) (string, error) {
+	for n := 1; ; n++ {
+		old := filename + "." + strconv.Itoa(n)
+		if _, err := os.Stat(old); os.IsNotExist(err) {
+			return old, os.Rename(filename, old)
+		}
+	}
+}
+
+// statsRows writes records in a format other than CSV
+type statsRows interface {
+	Write(record []string) error
+	Close() error
+}
+
+// statsFormats creates the writers of each format other than CSV, by name.
+// Formats with heavy dependencies register themselves when built with their
+// build tag
+var statsFormats = make(map[string]func(w io.Writer, compression string) (statsRows, error))
+
+// OpenStatsWriterFormat opens filename for writing stats to in format, csv
+// or one of statsFormats. Files in other formats cannot be appended to, so
+// an existing file is moved aside to filename.N
+func OpenStatsWriterFormat(filename string, compression string, format string) (*StatsWriter, error) {
+	if format == "csv" {
+		return OpenStatsWriter(filename, compression)
+	}
+	create, ok := statsFormats[format]
+	if !ok {
+		if format == "parquet" {
+			return nil, errors.New("Parquet stats require building the client with -tags parquet")
+		}
+		return nil, errors.New("Unknown stat format: " + format)
+	}
+	if info, err := os.Stat(filename); err == nil && info.Size() > 0 {
+		old, err := moveAside(filename)
+		if err != nil {
+			return nil, err
+		}
+		glog.Warning("Stat file ", filename, " cannot be appended to as ", format, ", moved it to ", old)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := create(file, compression)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &StatsWriter{file: file, rows: rows}, nil
+}
+
+// OpenStatsWriter opens filename for appending stats to. Appending to an
+// existing compressed file adds a new gzip member or zstd frame, which
+// both formats read back as a single stream.
+// A new file starts with statsHeader. If an existing file has a different
+// header, it is moved aside to filename.N and a new file is started.
+func OpenStatsWriter(filename string, compression string) (*StatsWriter, error) {
+	compression = compressionFor(filename, compression)
+	switch compression {
+	case "none", "gzip", "zstd":
+	default:
+		return nil, errors.New("Unknown stat compression: " + compression)
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() > 0 {
+		header, err := readStatsHeader(file, info.Size(), compression)
+		if err == nil && reflect.DeepEqual(header, statsHeader) {
+			return newStatsWriter(file, compression, false)
+		}
+		file.Close()
+		old, err := moveAside(filename)
+		if err != nil {
+			return nil, err
+		}
+		glog.Warning("Stat file ", filename, " has a different schema, moved it to ", old)
+		file, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0777)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newStatsWriter(file, compression, true)
+}
+
+// newStatsWriter wraps file, writing the header first if header is true
+func newStatsWriter(file *os.File, compression string, header bool) (*StatsWriter, error) {
+	s := &StatsWriter{file: file}
+	var w io.Writer = file
+	var err error
+	switch compression {
+	case "gzip":
+		s.comp = gzip.NewWriter(file)
+		w = s.comp
+	case "zstd":
+		s.comp, err = zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		w = s.comp
+	}
+	s.csv = csv.NewWriter(w)
+
+	if header {
+		s.csv.Write(statsHeader)
+		s.csv.Flush()
+		err = s.csv.Error()
+		if err == nil && s.comp != nil {
+			err = s.comp.(flusher).Flush()
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ErrStatsClosed is returned when writing a record after the StatsWriter is closed
+var ErrStatsClosed = errors.New("Stat file is closed")
+
+// records between compressor flushes, so that an unclean exit loses at most these
+const statsFlushInterval = 100
+
+// Write writes a single record. When compressing, the compressor is flushed
+// to the file every statsFlushInterval records.
+func (s *StatsWriter) Write(record []string) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return ErrStatsClosed
+	}
+	if s.rows != nil {
+		return s.rows.Write(record)
+	}
+	err := s.csv.Write(record)
+	if err != nil {
+		return err
+	}
+	s.csv.Flush()
+	if err = s.csv.Error(); err != nil {
+		return err
+	}
+
+	s.unflushed++
+	if s.comp != nil && s.unflushed >= statsFlushInterval {
+		s.unflushed = 0
+		return s.comp.(flusher).Flush()
+	}
+	return nil
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// Close flushes any buffered records and closes the stat file. It is safe
+// to call more than once.
+func (s *StatsWriter) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.rows != nil {
+		err = s.rows.Close()
+	} else {
+		s.csv.Flush()
+		err = s.csv.Error()
+	}
+	if s.comp != nil {
+		if cerr := s.comp.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if ferr := s.file.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
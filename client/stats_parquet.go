@@ -0,0 +1,83 @@
+//go:build parquet
+// +build parquet
+
+package main
+
+import (
+	"errors"
+	"github.com/parquet-go/parquet-go"
+	"io"
+	"strconv"
+)
+
+// rows per Parquet row group, buffered in memory until the group is written
+const statsRowGroup = 10000
+
+// statsRow holds the columns of statsHeader, as Parquet types
+type statsRow struct {
+	StartTime   string `parquet:"start_time"`
+	RequestID   int64  `parquet:"request_id"`
+	LatencyNs   int64  `parquet:"latency_ns"`
+	Tries       int64  `parquet:"tries"`
+	ClientID    int64  `parquet:"client_id"`
+	ConnectNs   int64  `parquet:"connect_ns"`
+	InFlight    int64  `parquet:"in_flight"`
+	QueueNs     int64  `parquet:"queue_ns"`
+	ServiceNs   int64  `parquet:"service_ns"`
+	InjectedNs  int64  `parquet:"injected_ns"`
+	FirstByteNs int64  `parquet:"first_byte_ns"`
+	LastByteNs  int64  `parquet:"last_byte_ns"`
+	ServerNs    int64  `parquet:"server_ns"`
+	NetworkNs   int64  `parquet:"network_ns"`
+	RequestSize int64  `parquet:"request_bytes"`
+	ReplySize   int64  `parquet:"response_bytes"`
+}
+
+// parquetStats writes stats as Parquet, in row groups of statsRowGroup rows.
+// The footer is written when it is closed, so the file cannot be read after
+// an unclean exit
+type parquetStats struct {
+	w *parquet.GenericWriter[statsRow]
+}
+
+func init() {
+	statsFormats["parquet"] = newParquetStats
+}
+
+// newParquetStats writes Parquet to w, with its columns compressed with
+// compression, none, gzip or zstd
+func newParquetStats(w io.Writer, compression string) (statsRows, error) {
+	options := []parquet.WriterOption{parquet.MaxRowsPerRowGroup(statsRowGroup)}
+	switch compression {
+	case "", "none":
+	case "gzip":
+		options = append(options, parquet.Compression(&parquet.Gzip))
+	case "zstd":
+		options = append(options, parquet.Compression(&parquet.Zstd))
+	default:
+		return nil, errors.New("Unknown stat compression: " + compression)
+	}
+	return &parquetStats{parquet.NewGenericWriter[statsRow](w, options...)}, nil
+}
+
+func (p *parquetStats) Write(record []string) error {
+	if len(record) != len(statsHeader) {
+		return errors.New("Stats record has " + strconv.Itoa(len(record)) + " columns, expected " + strconv.Itoa(len(statsHeader)))
+	}
+	var columns [15]int64
+	for i := range columns {
+		n, err := strconv.ParseInt(record[i+1], 10, 64)
+		if err != nil {
+			return err
+		}
+		columns[i] = n
+	}
+	_, err := p.w.Write([]statsRow{{record[0], columns[0], columns[1], columns[2], columns[3], columns[4], columns[5],
+		columns[6], columns[7], columns[8], columns[9], columns[10],
+		columns[11], columns[12], columns[13], columns[14]}})
+	return err
+}
+
+func (p *parquetStats) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,69 @@
+//go:build parquet
+// +build parquet
+
+package main
+
+import (
+	"github.com/parquet-go/parquet-go"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// check that Parquet stats can be read back, with the columns of the CSV
+func TestParquetStats(t *testing.T) {
+	for _, compression := range []string{"", "gzip", "zstd"} {
+		filename := filepath.Join(t.TempDir(), "latency.parquet")
+		stats, err := OpenStatsWriterFormat(filename, compression, "parquet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := [][]string{
+			{"2016-05-31 10:00:00", "1", "1500000", "1", "0", "0", "1", "0", "1500000", "0", "1000000", "1400000", "1000000", "500000", "120", "45"},
+			{"2016-05-31 10:00:01", "2", "1200000", "2", "3", "250000", "4", "200000", "1000000", "50000", "300000", "900000", "0", "0", "80", "0"},
+		}
+		for _, record := range records {
+			if err := stats.Write(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := stats.Write([]string{"short"}); err == nil {
+			t.Error("Record with missing columns was written")
+		}
+		if err := stats.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := file.Stat()
+		pf, err := parquet.OpenFile(file, info.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var columns []string
+		for _, field := range pf.Schema().Fields() {
+			columns = append(columns, field.Name())
+		}
+		expected := append([]string{strings.Fields(statsHeader[0])[1]}, statsHeader[1:]...)
+		if !reflect.DeepEqual(columns, expected) {
+			t.Errorf("Parquet columns are %v, expected %v", columns, expected)
+		}
+		rows, err := parquet.Read[statsRow](file, info.Size())
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []statsRow{
+			{"2016-05-31 10:00:00", 1, 1500000, 1, 0, 0, 1, 0, 1500000, 0, 1000000, 1400000, 1000000, 500000, 120, 45},
+			{"2016-05-31 10:00:01", 2, 1200000, 2, 3, 250000, 4, 200000, 1000000, 50000, 300000, 900000, 0, 0, 80, 0},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("Compression %q: read back %v, expected %v", compression, rows, want)
+		}
+	}
+}
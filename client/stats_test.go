@@ -0,0 +1,264 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"github.com/heidi-ann/hydra/config"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readStats(t *testing.T, filename string, compression string) [][]string {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	switch compressionFor(filename, compression) {
+	case "gzip":
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	case "zstd":
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	records, err := cr.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// statsColumn returns the index of the stats column called name
+func statsColumn(t *testing.T, name string) int {
+	for i, n := range statsHeader {
+		if n == name {
+			return i
+		}
+	}
+	t.Fatal("No stats column ", name)
+	return 0
+}
+
+// check that compressed stats can be read back, including after appending
+func TestStatsWriterCompression(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		filename, compression string
+	}{
+		{"latency.csv", ""},
+		{"latency.csv.gz", ""},
+		{"latency.csv.zst", ""},
+		{"latency.csv", "gzip"},
+		{"latency.dat", "zstd"},
+	}
+
+	records := [][]string{
+		{"2016-05-31 10:00:00", "1", "1500000", "1"},
+		{"2016-05-31 10:00:01", "2", "1200000", "2"},
+	}
+
+	for i, c := range cases {
+		filename := filepath.Join(dir, c.compression+c.filename)
+		// write the records over two runs to check appending
+		for run := 0; run < 2; run++ {
+			stats, err := OpenStatsWriter(filename, c.compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range records {
+				if err := stats.Write(record); err != nil {
+					t.Error(err)
+				}
+			}
+			if err := stats.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+
+		got := readStats(t, filename, c.compression)
+		expected := append(append([][]string{}, records...), records...)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("case %d: read back %v but %v was expected", i, got, expected)
+		}
+	}
+}
+
+func TestStatsWriterUnknownCompression(t *testing.T) {
+	_, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "lz4")
+	if err == nil {
+		t.Error("Unknown compression was accepted")
+	}
+}
+
+// check that compressed records are flushed to disk periodically, so an
+// exit without Close loses at most the most recent records
+func TestStatsWriterPeriodicFlush(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "latency.csv.gz")
+	stats, err := OpenStatsWriter(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < statsFlushInterval; i++ {
+		if err := stats.Write([]string{"2016-05-31 10:00:00", "1", "1500000", "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// read without closing, the gzip trailer is missing
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := csv.NewReader(gz)
+	r.Comment = '#'
+	n := 0
+	for {
+		if _, err := r.Read(); err != nil {
+			break
+		}
+		n++
+	}
+	if n != statsFlushInterval {
+		t.Errorf("%d records readable before close but %d were expected", n, statsFlushInterval)
+	}
+
+	if err := stats.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := stats.Write([]string{"late"}); err != ErrStatsClosed {
+		t.Errorf("Write after close returned %v", err)
+	}
+	if err := stats.Close(); err != nil {
+		t.Error("Second close failed: ", err)
+	}
+}
+
+// check that each new stat file starts with a single header, which is kept
+// when appending
+func TestStatsWriterHeader(t *testing.T) {
+	dir := t.TempDir()
+	for _, filename := range []string{"latency.csv", "latency.csv.gz", "latency.csv.zst"} {
+		filename = filepath.Join(dir, filename)
+		for run := 0; run < 2; run++ {
+			stats, err := OpenStatsWriter(filename, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stats.Write([]string{"2016-05-31 10:00:00", "1", "1500000", "1", "0"})
+			stats.Close()
+		}
+
+		file, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := file.Stat()
+		header, err := readStatsHeader(file, info.Size(), compressionFor(filename, ""))
+		file.Close()
+		if err != nil || !reflect.DeepEqual(header, statsHeader) {
+			t.Errorf("%s starts with %v (%v), not the header", filename, header, err)
+		}
+		if n := len(readStats(t, filename, "")); n != 2 {
+			t.Errorf("%s has %d records after appending, 2 were expected", filename, n)
+		}
+		if _, err := os.Stat(filename + ".1"); err == nil {
+			t.Errorf("%s was moved aside when appending with the same schema", filename)
+		}
+	}
+}
+
+// check that appending to a stat file with a different schema starts a new
+// file, keeping the old one
+func TestStatsWriterSchemaMismatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "latency.csv")
+	old := "2016-05-31 10:00:00,1,1500000,1\n"
+	if err := os.WriteFile(filename, []byte(old), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := OpenStatsWriter(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.Write([]string{"2016-05-31 10:00:01", "2", "1200000", "1", "0"})
+	stats.Close()
+
+	moved, err := os.ReadFile(filename + ".1")
+	if err != nil || string(moved) != old {
+		t.Errorf("Old stat file was not moved aside intact: %q (%v)", moved, err)
+	}
+	records := readStats(t, filename, "")
+	if len(records) != 1 || records[0][1] != "2" {
+		t.Errorf("New stat file has records %v", records)
+	}
+}
+
+// check that the start time column is the wall clock time, without the
+// monotonic reading, and that latency is measured on the monotonic clock
+func TestStatsTimes(t *testing.T) {
+	s := newFakeServer(t, 20*time.Millisecond)
+	filename := filepath.Join(t.TempDir(), "latency.csv")
+	stats, err := OpenStatsWriter(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf config.Config
+	conf.Addresses.Address = []string{s.addr}
+	conf.Parameters.Retries = 1
+	c := newClient(0, conf, time.Second, stats)
+	before := time.Now()
+	if !strings.Contains(before.String(), "m=") {
+		t.Fatal("time.Now has no monotonic clock reading")
+	}
+	c.submit("get A", false)
+	stats.Close()
+
+	records := readStats(t, filename, "")
+	if len(records) != 1 {
+		t.Fatalf("%d records were written", len(records))
+	}
+	start, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", records[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start.Before(before.Round(0)) || start.After(time.Now()) {
+		t.Errorf("Start time %s is not the wall clock time of the request", records[0][0])
+	}
+	latency, err := strconv.ParseInt(records[0][2], 10, 64)
+	if err != nil || time.Duration(latency) < 20*time.Millisecond || time.Duration(latency) > time.Since(before) {
+		t.Errorf("Latency %s is not the time taken by the request", records[0][2])
+	}
+}
+
+// check that formats which were not built in are rejected
+func TestStatsWriterUnknownFormat(t *testing.T) {
+	for _, format := range []string{"json", "xml"} {
+		if _, err := OpenStatsWriterFormat(filepath.Join(t.TempDir(), "latency"), "", format); err == nil {
+			t.Errorf("Stat format %s was accepted", format)
+		}
+	}
+}
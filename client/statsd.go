@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// packets queued for the statsd sink, beyond which they are dropped
+const statsdQueue = 1000
+
+// statsdSink sends the latency and counts of requests to a statsd server
+// over UDP. Sending never blocks the requests, packets are dropped instead.
+// It is safe for concurrent access, and a nil *statsdSink sends nothing
+type statsdSink struct {
+	conn    net.Conn
+	prefix  string
+	sample  float64 // fraction of requests sent
+	packets chan string
+	dropped int64 // packets dropped as the queue was full
+	done    chan bool
+}
+
+// newStatsdSink sends a sample fraction of requests to the statsd server at
+// addr, naming the metrics with prefix
+func newStatsdSink(addr string, prefix string, sample float64) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &statsdSink{
+		conn:    conn,
+		prefix:  prefix,
+		sample:  sample,
+		packets: make(chan string, statsdQueue),
+		done:    make(chan bool)}
+	go s.run()
+	return s, nil
+}
+
+func (s *statsdSink) run() {
+	defer close(s.done)
+	for packet := range s.packets {
+		// errors, e.g. as nothing is listening, are expected with UDP
+		s.conn.Write([]byte(packet))
+	}
+}
+
+// Observe sends a completed request which took tries attempts, if sampled
+func (s *statsdSink) Observe(latency time.Duration, tries int) {
+	if s == nil || (s.sample < 1 && rand.Float64() >= s.sample) {
+		return
+	}
+	select {
+	case s.packets <- s.format(latency, tries):
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// format the statsd lines for a request, as a single packet
+func (s *statsdSink) format(latency time.Duration, tries int) string {
+	rate := ""
+	if s.sample < 1 {
+		rate = "|@" + strconv.FormatFloat(s.sample, 'g', -1, 64)
+	}
+	ms := strconv.FormatFloat(latency.Seconds()*1000, 'f', 3, 64)
+	lines := []string{
+		fmt.Sprintf("%s.latency:%s|ms%s", s.prefix, ms, rate),
+		fmt.Sprintf("%s.requests:1|c%s", s.prefix, rate)}
+	if tries > 1 {
+		lines = append(lines, fmt.Sprintf("%s.retries:%d|c%s", s.prefix, tries-1, rate))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Close sends the queued packets and closes the connection
+func (s *statsdSink) Close() {
+	close(s.packets)
+	<-s.done
+	s.conn.Close()
+	if dropped := atomic.LoadInt64(&s.dropped); dropped > 0 {
+		glog.Warning(dropped, " statsd packets were dropped as the queue was full")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var statsdLine = regexp.MustCompile(`^[a-z.]+:[0-9.]+\|(ms|c)(\|@[0-9.]+)?$`)
+
+func TestStatsd(t *testing.T) {
+	cases := []struct {
+		sample float64
+		tries  int
+		lines  []string
+	}{
+		{1, 1, []string{"hydra.client.latency:12.500|ms", "hydra.client.requests:1|c"}},
+		{1, 3, []string{"hydra.client.latency:12.500|ms", "hydra.client.requests:1|c", "hydra.client.retries:2|c"}},
+		{0.5, 2, []string{"hydra.client.latency:12.500|ms|@0.5", "hydra.client.requests:1|c|@0.5", "hydra.client.retries:1|c|@0.5"}},
+	}
+	for _, c := range cases {
+		ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		s, err := newStatsdSink(ln.LocalAddr().String(), "hydra.client", c.sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// sample until a packet is sent
+		buf := make([]byte, 1500)
+		var n int
+		for n == 0 {
+			s.Observe(12500*time.Microsecond, c.tries)
+			ln.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+			n, _, _ = ln.ReadFrom(buf)
+		}
+		s.Close()
+
+		lines := strings.Split(string(buf[:n]), "\n")
+		if strings.Join(lines, " ") != strings.Join(c.lines, " ") {
+			t.Errorf("Sample %g, tries %d: sent %q, expected %q", c.sample, c.tries, lines, c.lines)
+		}
+		for _, line := range lines {
+			if !statsdLine.MatchString(line) {
+				t.Errorf("Malformed statsd line %q", line)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"github.com/heidi-ann/hydra/msgs"
+	"github.com/heidi-ann/hydra/store"
+	"testing"
+)
+
+// check that empty, not found and error responses are returned, while a
+// response without a status fails the client
+func TestResponseStatus(t *testing.T) {
+	defer func(e func(...interface{})) { exit = e }(exit)
+	exit = func(args ...interface{}) { panic(fmt.Sprint(args...)) }
+
+	tests := []struct {
+		chunks []string
+		status msgs.Status
+		fatal  bool
+	}{
+		{[]string{""}, msgs.StatusOK, false},
+		{[]string{store.NotFound}, msgs.StatusNotFound, false},
+		{[]string{store.NotRecognised}, msgs.StatusError, false},
+		{[]string{"", ""}, msgs.StatusOK, false},
+		{[]string{""}, msgs.StatusNone, true},
+	}
+	for _, test := range tests {
+		s := newFakeServer(t, 0)
+		s.chunks = test.chunks
+		s.status = test.status
+		s.legacy = test.status == msgs.StatusNone
+		c := newTestClient(t, s.addr)
+		fatal := false
+		response := func() string {
+			defer func() {
+				if recover() != nil {
+					fatal = true
+				}
+			}()
+			return c.submit("get A", false)
+		}()
+		expected := ""
+		for _, chunk := range test.chunks {
+			expected += chunk
+		}
+		if fatal != test.fatal || (!fatal && response != expected) {
+			t.Errorf("Status %s: response %q (fatal %t), expected %q (fatal %t)", test.status, response, fatal, expected, test.fatal)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var status_file = flag.String("statusfile", "", "File to write the state of the client to as JSON every -statusinterval, for monitoring scripts, none if empty")
+var status_interval = flag.Duration("statusinterval", 5*time.Second, "Interval between rewrites of the status file")
+
+// clientStatus is the connection state of a logical client
+type clientStatus struct {
+	ID        int       `json:"id"`
+	Server    int       `json:"server"`
+	Address   string    `json:"address"`
+	Connected bool      `json:"connected"`
+	Since     time.Time `json:"since"`
+}
+
+// status is the content of the status file
+type status struct {
+	State string    `json:"state"` // running or stopped
+	Time  time.Time `json:"time"`
+	// seconds since the client started
+	Uptime float64 `json:"uptime_s"`
+	// address of the server most recently connected to
+	Leader        string         `json:"leader"`
+	Requests      int64          `json:"requests"`
+	LastError     string         `json:"last_error,omitempty"`
+	LastErrorTime *time.Time     `json:"last_error_time,omitempty"`
+	Clients       []clientStatus `json:"clients"`
+}
+
+// statusTracker follows the state of the logical clients, for the status
+// file. It is safe for concurrent access, and a nil *statusTracker tracks
+// nothing
+type statusTracker struct {
+	start         time.Time
+	metrics       *metrics
+	clients       map[int]*clientStatus
+	leader        string
+	lastError     string
+	lastErrorTime time.Time
+	sync.Mutex
+}
+
+func newStatusTracker(start time.Time, m *metrics) *statusTracker {
+	return &statusTracker{start: start, metrics: m, clients: map[int]*clientStatus{}}
+}
+
+// Connected records that client id connected to server, at address addr
+func (s *statusTracker) Connected(id int, server int, addr string) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.clients[id] = &clientStatus{id, server, addr, true, time.Now()}
+	s.leader = addr
+}
+
+// Disconnected records that client id lost its connection, and is
+// reconnecting
+func (s *statusTracker) Disconnected(id int) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if c, ok := s.clients[id]; ok && c.Connected {
+		c.Connected, c.Since = false, time.Now()
+	}
+}
+
+// Error records an error of a request
+func (s *statusTracker) Error(err error) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.lastError, s.lastErrorTime = err.Error(), time.Now()
+}
+
+// Status returns the current status, in state
+func (s *statusTracker) Status(state string) status {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	st := status{
+		State:    state,
+		Time:     now,
+		Uptime:   now.Sub(s.start).Seconds(),
+		Leader:   s.leader,
+		Requests: s.metrics.Requests(),
+		Clients:  []clientStatus{}}
+	if s.lastError != "" {
+		when := s.lastErrorTime
+		st.LastError, st.LastErrorTime = s.lastError, &when
+	}
+	for _, c := range s.clients {
+		st.Clients = append(st.Clients, *c)
+	}
+	sort.Slice(st.Clients, func(i, j int) bool { return st.Clients[i].ID < st.Clients[j].ID })
+	return st
+}
+
+// Write the status, in state, to filename, replacing it at once so that
+// readers never see a partial file
+func (s *statusTracker) Write(filename string, state string) error {
+	b, err := json.MarshalIndent(s.Status(state), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(append(b, '\n')); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Run writes the status to filename every interval, until stop is closed
+func (s *statusTracker) Run(filename string, interval time.Duration, stop <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Write(filename, "running"); err != nil {
+			glog.Warning("Unable to write status file: ", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// connected records the connection of the client in the status
+func (c *client) connected() {
+	if c.status == nil {
+		return
+	}
+	if addrs := c.addrs(); c.leader < len(addrs) {
+		c.status.Connected(c.id, c.leader, addrs[c.leader])
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readStatus reads the status file filename
+func readStatus(t *testing.T, filename string) status {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st status
+	if err = json.Unmarshal(b, &st); err != nil {
+		t.Fatalf("%s: %v", b, err)
+	}
+	return st
+}
+
+// check that the status file follows the client to a new leader
+func TestStatusFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "status.json")
+	first := newFakeServer(t, 0)
+	second := newFakeServer(t, 0)
+	first.drop = 1
+	c := newTestClient(t, first.addr, second.addr)
+	c.metrics = newMetrics()
+	c.status = newStatusTracker(time.Now(), c.metrics)
+	c.connected()
+
+	if err := c.status.Write(filename, "running"); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatus(t, filename)
+	if st.State != "running" || st.Leader != first.addr || st.Requests != 0 || st.LastError != "" || st.LastErrorTime != nil ||
+		len(st.Clients) != 1 || !st.Clients[0].Connected || st.Clients[0].Server != 0 || st.Clients[0].Address != first.addr {
+		t.Errorf("Status on starting was %+v", st)
+	}
+
+	// the connection to the first server is lost, so the client fails over
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Response was %q", response)
+	}
+	if err := c.status.Write(filename, "stopped"); err != nil {
+		t.Fatal(err)
+	}
+	st = readStatus(t, filename)
+	if st.State != "stopped" || st.Leader != second.addr || st.Requests != 1 || st.LastError == "" || st.LastErrorTime == nil ||
+		st.Uptime <= 0 || len(st.Clients) != 1 || !st.Clients[0].Connected || st.Clients[0].Server != 1 || st.Clients[0].Address != second.addr {
+		t.Errorf("Status after failing over was %+v", st)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files left in the status directory, expected 1", len(files))
+	}
+}
+
+// check that the status file is rewritten until stopped
+func TestStatusRun(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "status.json")
+	s := newStatusTracker(time.Now(), newMetrics())
+	s.Connected(1, 2, "127.0.0.1:8080")
+	s.Disconnected(1)
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		s.Run(filename, 10*time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	first := readStatus(t, filename)
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	<-done
+	last := readStatus(t, filename)
+	if !last.Time.After(first.Time) {
+		t.Errorf("Status written at %v, then %v", first.Time, last.Time)
+	}
+	if len(last.Clients) != 1 || last.Clients[0].ID != 1 || last.Clients[0].Connected || last.Leader != "127.0.0.1:8080" {
+		t.Errorf("Status was %+v", last)
+	}
+	var nilStatus *statusTracker
+	nilStatus.Connected(0, 0, "")
+	nilStatus.Disconnected(0)
+	nilStatus.Error(ErrTimeout)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/config"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// API issuing a single command and recording how the response is returned
+type streamRecorder struct {
+	oneCommand
+	chunks   []string // chunks from ReturnStream
+	streamed bool
+}
+
+func (s *streamRecorder) ReturnStream(chunks chan string) {
+	s.streamed = true
+	for chunk := range chunks {
+		s.chunks = append(s.chunks, chunk)
+	}
+}
+
+func TestStreamedResponses(t *testing.T) {
+	cases := []struct {
+		chunks   []string
+		response string
+		streamed bool
+	}{
+		{[]string{}, "", false},
+		{[]string{"a"}, "a", false},
+		{[]string{"a", "b", "c"}, "abc", true},
+		{[]string{"a", "", "c"}, "ac", true},
+	}
+
+	for i, test := range cases {
+		s := newFakeServer(t, 0)
+		s.chunks = test.chunks
+		stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conf config.Config
+		conf.Addresses.Address = []string{s.addr}
+		conf.Parameters.Retries = 1
+		c := newClient(0, conf, time.Second, stats)
+
+		// reassembled
+		if response := c.submit("scan", false); response != test.response {
+			t.Errorf("case %d: reassembled response was %q but %q was expected", i, response, test.response)
+		}
+
+		// streamed to the API
+		api := &streamRecorder{oneCommand: oneCommand{text: "scan"}}
+		c.run(api)
+		if api.streamed != test.streamed {
+			t.Errorf("case %d: streamed is %t", i, api.streamed)
+		}
+		if test.streamed && !reflect.DeepEqual(api.chunks, test.chunks) {
+			t.Errorf("case %d: streamed %q but %q was expected", i, api.chunks, test.chunks)
+		}
+		if !test.streamed && api.response != test.response {
+			t.Errorf("case %d: returned %q but %q was expected", i, api.response, test.response)
+		}
+
+		// the next request follows the stream
+		if c.requestID != 3 || len(s.Received()) != 2 {
+			t.Errorf("case %d: %d requests sent, client is at request %d", i, len(s.Received()), c.requestID)
+		}
+		stats.Close()
+	}
+}
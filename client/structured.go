@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"strings"
+)
+
+var structured = flag.Bool("structured", false, "Send commands in structured form, parsed from their text, as well as raw. Commands built in structured form by the API are always sent so, and those which cannot be parsed are sent raw")
+
+// CommandAPI is implemented by APIs which build commands in structured
+// form, rather than as raw strings
+type CommandAPI interface {
+	// Command returns the last command from Next in structured form, or
+	// nil if it is only raw
+	Command() *msgs.Command
+}
+
+// requestCommand returns the structured form of the current command from
+// ioapi, or nil if it has none
+func (c *client) requestCommand(ioapi API) *msgs.Command {
+	capi, ok := ioapi.(CommandAPI)
+	if !ok {
+		return nil
+	}
+	return capi.Command()
+}
+
+// structuredCommand returns the structured form of text: the command from
+// the API if it is for text, or text parsed if -structured is set, or nil
+// to send text raw
+func (c *client) structuredCommand(text string) *msgs.Command {
+	if c.command != nil && c.command.String() == strings.TrimSpace(text) {
+		return c.command
+	}
+	if !*structured {
+		return nil
+	}
+	cmd, err := msgs.ParseCommand(text)
+	if err != nil {
+		glog.Info("Sending command raw: ", err)
+		return nil
+	}
+	return &cmd
+}
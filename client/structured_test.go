@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"reflect"
+	"testing"
+)
+
+// API issuing commands built in structured form
+type structuredList struct {
+	commandList
+	structured []*msgs.Command
+}
+
+func (l *structuredList) Command() *msgs.Command {
+	return l.structured[len(l.responses)]
+}
+
+// check that commands from the API are sent in structured form, others
+// being parsed only with -structured, and those which cannot be parsed raw
+func TestStructuredCommands(t *testing.T) {
+	defer func() { *structured = false }()
+	update := &msgs.Command{Op: msgs.OpUpdate, Key: "A", Value: "1"}
+	get := &msgs.Command{Op: msgs.OpGet, Key: "B"}
+	tests := []struct {
+		flag     bool
+		expected []*msgs.Command
+	}{
+		{false, []*msgs.Command{update, nil, nil}},
+		{true, []*msgs.Command{update, get, nil}},
+	}
+	for _, test := range tests {
+		*structured = test.flag
+		s := newFakeServer(t, 0)
+		c := newTestClient(t, s.addr)
+		c.run(&structuredList{
+			commandList: commandList{commands: []string{"update A 1", "get B", "get"}},
+			structured:  []*msgs.Command{update, nil, nil},
+		})
+		received := s.Received()
+		if len(received) != len(test.expected) {
+			t.Fatalf("Server received %d requests, expected %d", len(received), len(test.expected))
+		}
+		for i, req := range received {
+			if !reflect.DeepEqual(req.Command, test.expected[i]) || req.Text() != req.Request {
+				t.Errorf("-structured=%t: request %q sent as %+v, expected %+v", test.flag, req.Request, req.Command, test.expected[i])
+			}
+		}
+	}
+}
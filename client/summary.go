@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/config"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+var summary_file = flag.String("summary", "", "File to write a JSON summary of the run to, on exit, for benchmark result databases")
+
+// version of the client, recorded in run summaries
+const version = "0.1"
+
+// flags which are not recorded in run summaries, as they are secret
+var secretFlags = map[string]bool{"token": true}
+
+// summaryLatency is the latency percentiles of a run, in nanoseconds
+type summaryLatency struct {
+	P50, P90, P99, P999, Max int64
+}
+
+// runSummary describes a whole run, with the effective config and flags so
+// that it can be reproduced. ConfigHash identifies runs with the same
+// config and flags
+type runSummary struct {
+	Version         string
+	Mode            string
+	Start           time.Time
+	DurationSeconds float64
+	Requests        int64
+	Attempts        int64
+	Retries         int64
+	Goodput         int64
+	Throughput      float64 // requests per second
+	LatencyNs       summaryLatency
+	Errors          map[string]int64 // failed attempts, by kind
+	Seeds           []int64          // of each workload generator
+	ConfigHash      string
+	Config          config.Config
+	Flags           map[string]string
+}
+
+// newRunSummary summarises a run from start of length elapsed, in which
+// samples are the latencies of the requests recorded by m
+func newRunSummary(m *metrics, samples []time.Duration, start time.Time, elapsed time.Duration, conf config.Config, seeds []int64) runSummary {
+	sorted := append([]time.Duration{}, samples...)
+	sort.Sort(durations(sorted))
+	s := runSummary{
+		Version:         version,
+		Mode:            *mode,
+		Start:           start,
+		DurationSeconds: elapsed.Seconds(),
+		Requests:        m.Requests(),
+		Attempts:        m.Attempts(),
+		Goodput:         m.Goodput(),
+		Errors:          m.Failures(),
+		Seeds:           seeds,
+		Config:          conf,
+		Flags:           make(map[string]string)}
+	s.Retries = s.Attempts - s.Requests
+	if s.DurationSeconds > 0 {
+		s.Throughput = float64(s.Requests) / s.DurationSeconds
+	}
+	s.LatencyNs = summaryLatency{
+		percentile(sorted, 50).Nanoseconds(),
+		percentile(sorted, 90).Nanoseconds(),
+		percentile(sorted, 99).Nanoseconds(),
+		percentile(sorted, 99.9).Nanoseconds(),
+		percentile(sorted, 100).Nanoseconds()}
+	flag.VisitAll(func(f *flag.Flag) {
+		if secretFlags[f.Name] && f.Value.String() != "" {
+			s.Flags[f.Name] = "redacted"
+			return
+		}
+		s.Flags[f.Name] = f.Value.String()
+	})
+	// maps are encoded with sorted keys, so the hash is stable
+	b, err := json.Marshal(struct {
+		Config config.Config
+		Flags  map[string]string
+	}{s.Config, s.Flags})
+	if err != nil {
+		glog.Fatal(err)
+	}
+	hash := sha256.Sum256(b)
+	s.ConfigHash = hex.EncodeToString(hash[:])
+	return s
+}
+
+// Write the summary as indented JSON
+func (s runSummary) Write(w io.Writer) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func writeSummary(filename string, s runSummary) {
+	glog.Info("Writing run summary to ", filename)
+	file, err := os.Create(filename)
+	if err != nil {
+		glog.Warning(err)
+		return
+	}
+	defer file.Close()
+	if err = s.Write(file); err != nil {
+		glog.Warning(err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/heidi-ann/hydra/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check the run summary has all its fields after a short run
+func TestRunSummary(t *testing.T) {
+	server := newFakeServer(t, 0)
+	server.drop = 1
+	m := newMetrics()
+	sampler := m.Sampler()
+	start := time.Now()
+	apis := []*oneCommand{{text: "update A 1", replicate: true}, {text: "get A"}}
+	runClients(t, server.addr, apis, func(c *client) { c.metrics = m })
+
+	flag.Set("token", "t0ken-value")
+	defer flag.Set("token", "")
+	var conf config.Config
+	conf.Addresses.Address = []string{server.addr}
+	s := newRunSummary(m, sampler.Take(), start, time.Since(start), conf, []int64{42})
+	var b bytes.Buffer
+	if err := s.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "t0ken-value") {
+		t.Errorf("Summary includes the token: %s", b.String())
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"Version", "Mode", "Start", "DurationSeconds", "Requests", "Attempts", "Retries",
+		"Goodput", "Throughput", "LatencyNs", "Errors", "Seeds", "ConfigHash", "Config", "Flags"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("Summary has no %s: %s", field, b.String())
+		}
+	}
+	for _, p := range []string{"P50", "P90", "P99", "P999", "Max"} {
+		if latency, _ := fields["LatencyNs"].(map[string]interface{})[p].(float64); latency <= 0 {
+			t.Errorf("Summary has %s latency %v", p, latency)
+		}
+	}
+	if s.Requests != 2 || s.Retries != 1 || len(s.Errors) != 1 {
+		t.Errorf("Summary has %d requests, %d retries and errors %v, expected 2 requests with 1 retry and error",
+			s.Requests, s.Retries, s.Errors)
+	}
+	if s.Flags["token"] != "redacted" {
+		t.Errorf("Token flag recorded as %q", s.Flags["token"])
+	}
+
+	// the hash only depends on the config and flags
+	if again := newRunSummary(m, nil, time.Now(), time.Second, conf, nil); again.ConfigHash != s.ConfigHash {
+		t.Errorf("Config hash changed from %s to %s", s.ConfigHash, again.ConfigHash)
+	}
+}
@@ -0,0 +1,232 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"log/syslog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// messages queued for the syslog server, beyond which they are dropped
+const syslogQueue = 1000
+
+// time to wait before reconnecting to an unavailable syslog server
+const syslogRetry = time.Second
+
+var syslogFacilities = map[string]syslog.Priority{
+	"user": syslog.LOG_USER, "daemon": syslog.LOG_DAEMON,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2, "local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5, "local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// glog severities, as the first letter of each log line, in increasing order
+const glogSeverities = "IWEF"
+
+type syslogMsg struct {
+	severity byte // one of glogSeverities, or 'N' for a notice such as the summary
+	text     string
+}
+
+// syslogSink sends log lines to a syslog server in the background, so that
+// an unavailable server never blocks the client. Messages are dropped while
+// the server cannot be reached
+type syslogSink struct {
+	network  string
+	addr     string
+	facility syslog.Priority
+	msgs     chan syslogMsg
+	done     chan bool
+	sent     int64
+	dropped  int64
+	// least severity of glog's logs sent by captureGlog, 0 if none are
+	threshold byte
+}
+
+// newSyslogSink sends to addr, host:port over UDP or tcp://host:port, with
+// the given facility
+func newSyslogSink(addr string, facility string) (*syslogSink, error) {
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, errors.New("Unknown syslog facility: " + facility)
+	}
+	network := "udp"
+	if strings.HasPrefix(addr, "tcp://") {
+		network, addr = "tcp", strings.TrimPrefix(addr, "tcp://")
+	}
+	s := &syslogSink{
+		network:  network,
+		addr:     addr,
+		facility: f,
+		msgs:     make(chan syslogMsg, syslogQueue),
+		done:     make(chan bool)}
+	go s.run()
+	return s, nil
+}
+
+// Send queues a message, without blocking
+func (s *syslogSink) Send(severity byte, text string) {
+	select {
+	case s.msgs <- syslogMsg{severity, text}:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// Notice sends text, such as the run summary, which is also logged at INFO,
+// as a notice, unless glog's INFO logs are sent already so it would be sent
+// twice
+func (s *syslogSink) Notice(text string) {
+	if s.threshold != 'I' {
+		s.Send('N', text)
+	}
+}
+
+func (s *syslogSink) Sent() int    { return int(atomic.LoadInt64(&s.sent)) }
+func (s *syslogSink) Dropped() int { return int(atomic.LoadInt64(&s.dropped)) }
+
+// run sends queued messages. It does not log itself, as its own logs may
+// be sent to the syslog server
+func (s *syslogSink) run() {
+	var w *syslog.Writer
+	var retryAt time.Time
+	for m := range s.msgs {
+		if w == nil && time.Now().After(retryAt) {
+			var err error
+			if w, err = syslog.Dial(s.network, s.addr, s.facility|syslog.LOG_INFO, "hydra-client"); err != nil {
+				w = nil
+				retryAt = time.Now().Add(syslogRetry)
+			}
+		}
+		if w == nil {
+			atomic.AddInt64(&s.dropped, 1)
+			continue
+		}
+		var err error
+		switch m.severity {
+		case 'W':
+			err = w.Warning(m.text)
+		case 'E':
+			err = w.Err(m.text)
+		case 'F':
+			err = w.Crit(m.text)
+		case 'N':
+			err = w.Notice(m.text)
+		default:
+			err = w.Info(m.text)
+		}
+		if err != nil {
+			atomic.AddInt64(&s.dropped, 1)
+			w.Close()
+			w = nil
+			retryAt = time.Now().Add(syslogRetry)
+			continue
+		}
+		atomic.AddInt64(&s.sent, 1)
+	}
+	if w != nil {
+		w.Close()
+	}
+	close(s.done)
+}
+
+// Close sends the queued messages, waiting for up to wait
+func (s *syslogSink) Close(wait time.Duration) {
+	close(s.msgs)
+	select {
+	case <-s.done:
+	case <-time.After(wait):
+	}
+}
+
+// glogSeverity returns the severity of a glog line, such as
+// "W0102 15:04:05.000000 ...", or false if it is a continuation line
+func glogSeverity(line string) (byte, bool) {
+	if len(line) < 5 || !strings.ContainsRune(glogSeverities, rune(line[0])) {
+		return 0, false
+	}
+	for _, c := range line[1:5] {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	return line[0], true
+}
+
+// tee copies the glog lines from r to stderr, if their severity meets
+// stderr, and sends those meeting threshold to the syslog server.
+// Continuation lines, such as stack traces, have the severity of the line
+// before them
+func (s *syslogSink) tee(r io.Reader, stderr io.Writer, toStderr byte, threshold byte) {
+	sc := bufio.NewScanner(r)
+	severity := byte('I')
+	for sc.Scan() {
+		line := sc.Text()
+		if sev, ok := glogSeverity(line); ok {
+			severity = sev
+		}
+		rank := strings.IndexByte(glogSeverities, severity)
+		if rank >= strings.IndexByte(glogSeverities, toStderr) {
+			io.WriteString(stderr, line+"\n")
+		}
+		if rank >= strings.IndexByte(glogSeverities, threshold) {
+			s.Send(severity, line)
+		}
+	}
+}
+
+// captureGlog sends glog's output at or above threshold to the sink as well,
+// by having glog also log to stderr and replacing stderr with a pipe. Lines
+// are passed on to the real stderr as glog's flags would have. The returned
+// function stops the capture, it should be called after glog is flushed
+func captureGlog(s *syslogSink, threshold string) (func(), error) {
+	threshold = strings.ToUpper(threshold)
+	if len(threshold) == 0 || !strings.ContainsRune(glogSeverities, rune(threshold[0])) {
+		return nil, errors.New("Unknown syslog threshold: " + threshold)
+	}
+	toStderr := byte('E')
+	if f := flag.Lookup("logtostderr"); f != nil && f.Value.String() == "true" {
+		toStderr = 'I'
+	} else if f := flag.Lookup("alsologtostderr"); f != nil && f.Value.String() == "true" {
+		toStderr = 'I'
+	} else if f := flag.Lookup("stderrthreshold"); f != nil {
+		n, err := strconv.Atoi(f.Value.String())
+		if err != nil || n < 0 || n >= len(glogSeverities) {
+			n = len(glogSeverities) - 2
+		}
+		toStderr = glogSeverities[n]
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = flag.Set("alsologtostderr", "true"); err != nil {
+		return nil, err
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	done := make(chan bool)
+	s.threshold = threshold[0]
+	go func() {
+		s.tee(r, stderr, toStderr, threshold[0])
+		close(done)
+	}()
+	return func() {
+		os.Stderr = stderr
+		w.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+		s.Close(time.Second)
+	}, nil
+}
@@ -0,0 +1,22 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+type syslogSink struct{}
+
+func newSyslogSink(addr string, facility string) (*syslogSink, error) {
+	return nil, errors.New("Syslog is not supported on this platform")
+}
+
+func (s *syslogSink) Send(severity byte, text string) {}
+func (s *syslogSink) Close(wait time.Duration)        {}
+
+func captureGlog(s *syslogSink, threshold string) (func(), error) {
+	return nil, errors.New("Syslog is not supported on this platform")
+}
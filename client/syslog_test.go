@@ -0,0 +1,127 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen for syslog messages over UDP, returning the address and a channel
+// of the messages received
+func syslogListener(t *testing.T) (string, chan string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	msgs := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msgs <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), msgs
+}
+
+// well-formed messages have a priority, timestamp, hostname and tag
+var syslogFormat = regexp.MustCompile(`^<(\d+)>\S+ \S+ hydra-client\[\d+\]: (.*)\n?$`)
+
+// check that glog lines are sent to syslog with the priority of their
+// facility and severity, and copied to stderr as glog would
+func TestSyslogTee(t *testing.T) {
+	addr, msgs := syslogListener(t)
+	s, err := newSyslogSink(addr, "local0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := strings.Join([]string{
+		"I0102 15:04:05.000000    42 client.go:1] Request 1 is: get A",
+		"W0102 15:04:05.000000    42 client.go:2] Request 1 failed",
+		"E0102 15:04:05.000000    42 client.go:3] Unable to connect",
+		"goroutine 1 [running]:",
+		"I0102 15:04:05.000000    42 client.go:4] Request 2 is: get B",
+	}, "\n") + "\n"
+	var stderr bytes.Buffer
+	s.tee(strings.NewReader(logs), &stderr, 'E', 'W')
+	s.Send('N', "Summary")
+	s.Close(time.Second)
+
+	// local0 is facility 16
+	expected := []struct {
+		priority string
+		text     string
+	}{
+		{"132", "Request 1 failed"},
+		{"131", "Unable to connect"},
+		{"131", "goroutine 1 [running]:"},
+		{"133", "Summary"},
+	}
+	for _, e := range expected {
+		select {
+		case msg := <-msgs:
+			m := syslogFormat.FindStringSubmatch(msg)
+			if m == nil || m[1] != e.priority || !strings.HasSuffix(m[2], e.text) {
+				t.Errorf("Received %q, expected priority %s and %q", msg, e.priority, e.text)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Syslog message %q was not received", e.text)
+		}
+	}
+	select {
+	case msg := <-msgs:
+		t.Errorf("Unexpected syslog message %q", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := stderr.String(); !strings.Contains(got, "Unable to connect\ngoroutine 1") || strings.Contains(got, "Request") {
+		t.Errorf("Stderr was %q, expected only errors", got)
+	}
+}
+
+// check that an unavailable syslog server does not block the client
+func TestSyslogUnavailable(t *testing.T) {
+	s, err := newSyslogSink("tcp://"+freeAddr(t), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 2*syslogQueue; i++ {
+		s.Send('W', "lost")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Sending to an unavailable server took %s", elapsed)
+	}
+	s.Close(time.Second)
+	if s.Sent() != 0 || s.Dropped() != 2*syslogQueue {
+		t.Errorf("%d messages sent and %d dropped, expected all %d dropped", s.Sent(), s.Dropped(), 2*syslogQueue)
+	}
+
+	if _, err := newSyslogSink("127.0.0.1:514", "kernel"); err == nil {
+		t.Error("Unknown facility was accepted")
+	}
+}
+
+// check that the summary is sent once, as a notice only if INFO logs are not
+// sent already
+func TestSyslogNotice(t *testing.T) {
+	for _, test := range []struct {
+		threshold byte
+		sent      int
+	}{{0, 1}, {'W', 1}, {'I', 0}} {
+		s := &syslogSink{msgs: make(chan syslogMsg, 1), threshold: test.threshold}
+		s.Notice("Summary")
+		if len(s.msgs) != test.sent {
+			t.Errorf("Threshold %q: %d notices sent, expected %d", test.threshold, len(s.msgs), test.sent)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var throughput_timeline = flag.String("throughputtimeline", "", "File to write the requests completed and p99 latency in each window of the run to, on exit")
+var timeline_window = flag.Duration("timelinewindow", time.Second, "Width of each window of the throughput timeline")
+
+// timelineHeader is the first row of a throughput timeline, as for statsHeader
+var timelineHeader = []string{"#v1 second", "count", "p99_ns"}
+
+// windows are summarised once a later window is this far ahead, as
+// requests may complete slightly out of order
+const timelineLag = 2
+
+type timelineWindow struct {
+	count      int
+	latencies  []time.Duration // until summarised
+	p99        time.Duration
+	summarised bool
+}
+
+// timeline buckets completed requests into windows by when they completed,
+// so that throughput can be plotted over a run, e.g. to spot dips during
+// leader changes. The latencies of a window are only kept until it is
+// summarised. It is safe for concurrent access, and a nil *timeline records
+// nothing
+type timeline struct {
+	start   time.Time
+	window  time.Duration
+	windows []timelineWindow
+	next    int // first window which may not be summarised
+	sync.Mutex
+}
+
+func newTimeline(start time.Time, window time.Duration) *timeline {
+	return &timeline{start: start, window: window}
+}
+
+// Observe records a request which completed at end after latency.
+// Requests completing before the start are counted in the first window
+func (t *timeline) Observe(end time.Time, latency time.Duration) {
+	if t == nil {
+		return
+	}
+	i := 0
+	if offset := end.Sub(t.start); offset > 0 {
+		i = int(offset / t.window)
+	}
+	t.Lock()
+	defer t.Unlock()
+	for len(t.windows) <= i {
+		t.windows = append(t.windows, timelineWindow{})
+	}
+	w := &t.windows[i]
+	w.count++
+	if !w.summarised {
+		w.latencies = append(w.latencies, latency)
+	}
+	for ; t.next <= i-timelineLag; t.next++ {
+		t.summarise(t.next)
+	}
+}
+
+// summarise window i, dropping its latencies. Requests observed in it
+// afterwards are counted, but do not change its p99
+func (t *timeline) summarise(i int) {
+	w := &t.windows[i]
+	if w.summarised {
+		return
+	}
+	sort.Sort(durations(w.latencies))
+	w.p99 = percentile(w.latencies, 99)
+	w.latencies, w.summarised = nil, true
+}
+
+// Write the timeline as CSV, a row for each window from the start to the
+// last with a completed request, including empty windows
+func (t *timeline) Write(w io.Writer) error {
+	t.Lock()
+	defer t.Unlock()
+	out := csv.NewWriter(w)
+	out.Write(timelineHeader)
+	for i := range t.windows {
+		t.summarise(i)
+		second := (time.Duration(i) * t.window).Seconds()
+		out.Write([]string{strconv.FormatFloat(second, 'f', -1, 64), strconv.Itoa(t.windows[i].count),
+			strconv.FormatInt(t.windows[i].p99.Nanoseconds(), 10)})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func writeTimeline(filename string, t *timeline) {
+	glog.Info("Writing throughput timeline to ", filename)
+	file, err := os.Create(filename)
+	if err != nil {
+		glog.Warning(err)
+		return
+	}
+	defer file.Close()
+	if err = t.Write(file); err != nil {
+		glog.Warning(err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check that completions are bucketed by when they completed, with empty
+// windows included
+func TestTimeline(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	ms := time.Millisecond
+	cases := []struct {
+		window      time.Duration
+		completions []time.Duration // offset from the start
+		latencies   []time.Duration
+		rows        []string
+	}{
+		{time.Second, nil, nil, nil},
+		{time.Second,
+			[]time.Duration{100 * ms, 900 * ms, -ms, 1500 * ms, 3200 * ms},
+			[]time.Duration{10 * ms, 20 * ms, 30 * ms, 5 * ms, 7 * ms},
+			[]string{"0,3,20000000", "1,1,5000000", "2,0,0", "3,1,7000000"}},
+		{500 * ms,
+			[]time.Duration{100 * ms, 600 * ms, 700 * ms},
+			[]time.Duration{ms, 2 * ms, 3 * ms},
+			[]string{"0,1,1000000", "0.5,2,2000000"}},
+	}
+	for i, c := range cases {
+		tl := newTimeline(start, c.window)
+		for j := range c.completions {
+			tl.Observe(start.Add(c.completions[j]), c.latencies[j])
+		}
+		var b bytes.Buffer
+		if err := tl.Write(&b); err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(b.String()), "\n")
+		if rows[0] != strings.Join(timelineHeader, ",") {
+			t.Errorf("case %d: header was %q", i, rows[0])
+		}
+		if strings.Join(rows[1:], " ") != strings.Join(c.rows, " ") {
+			t.Errorf("case %d: timeline was %q, expected %q", i, rows[1:], c.rows)
+		}
+	}
+}
+
+// check that the p99 of a window is of its latencies alone, and that its
+// latencies are dropped once later windows complete
+func TestTimelineP99(t *testing.T) {
+	start := time.Now()
+	tl := newTimeline(start, time.Second)
+	for i := 1; i <= 100; i++ {
+		tl.Observe(start.Add(time.Duration(i)*time.Millisecond), time.Duration(i)*time.Millisecond)
+	}
+	tl.Observe(start.Add(1500*time.Millisecond), time.Second)
+	tl.Observe(start.Add(2500*time.Millisecond), time.Millisecond)
+	if tl.windows[0].latencies != nil || tl.windows[0].p99 != 99*time.Millisecond {
+		t.Errorf("First window was not summarised, p99 %s", tl.windows[0].p99)
+	}
+	if tl.windows[1].summarised {
+		t.Error("Second window was summarised too early")
+	}
+	var nilTimeline *timeline
+	nilTimeline.Observe(start, time.Second)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// adaptiveTimeout tunes the request timeout from observed latency, setting
+// it to a percentile of recent latencies multiplied by a factor, within
+// bounds. It is safe for concurrent access
+type adaptiveTimeout struct {
+	window     []time.Duration // most recent latencies, used as a ring
+	next       int
+	full       bool
+	percentile float64
+	factor     float64
+	min        time.Duration
+	max        time.Duration
+	sync.Mutex
+}
+
+func newAdaptiveTimeout(size int, percentile float64, factor float64, min time.Duration, max time.Duration) *adaptiveTimeout {
+	return &adaptiveTimeout{
+		window:     make([]time.Duration, size),
+		percentile: percentile,
+		factor:     factor,
+		min:        min,
+		max:        max}
+}
+
+// Observe records the latency of a successful request
+func (a *adaptiveTimeout) Observe(latency time.Duration) {
+	a.Lock()
+	a.window[a.next] = latency
+	a.next = (a.next + 1) % len(a.window)
+	if a.next == 0 {
+		a.full = true
+	}
+	a.Unlock()
+}
+
+// Timeout returns the timeout to use for the next request, this is the
+// maximum until any latencies have been observed
+func (a *adaptiveTimeout) Timeout() time.Duration {
+	a.Lock()
+	n := a.next
+	if a.full {
+		n = len(a.window)
+	}
+	samples := make([]time.Duration, n)
+	copy(samples, a.window[:n])
+	a.Unlock()
+
+	if n == 0 {
+		return a.max
+	}
+	sort.Sort(durations(samples))
+	idx := int(a.percentile / 100 * float64(n-1))
+	timeout := time.Duration(float64(samples[idx]) * a.factor)
+	if timeout < a.min {
+		return a.min
+	}
+	if timeout > a.max {
+		return a.max
+	}
+	return timeout
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
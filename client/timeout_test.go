@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveTimeout(t *testing.T) {
+	a := newAdaptiveTimeout(1000, 99, 2, 5*time.Millisecond, 500*time.Millisecond)
+	if a.Timeout() != 500*time.Millisecond {
+		t.Errorf("Timeout without samples is %s but the maximum was expected", a.Timeout())
+	}
+
+	// uniform latencies of 10-20ms, so p99 is about 20ms
+	for i := 0; i < 1000; i++ {
+		a.Observe(10*time.Millisecond + time.Duration(rand.Int63n(int64(10*time.Millisecond))))
+	}
+	if got := a.Timeout(); got < 38*time.Millisecond || got > 40*time.Millisecond {
+		t.Errorf("Timeout is %s but about 40ms was expected", got)
+	}
+
+	// latency increases, the old samples leave the window
+	for i := 0; i < 1000; i++ {
+		a.Observe(100 * time.Millisecond)
+	}
+	if got := a.Timeout(); got != 200*time.Millisecond {
+		t.Errorf("Timeout is %s but 200ms was expected", got)
+	}
+}
+
+func TestAdaptiveTimeoutBounds(t *testing.T) {
+	cases := []struct {
+		latency, timeout time.Duration
+	}{
+		{time.Microsecond, 5 * time.Millisecond},
+		{10 * time.Millisecond, 20 * time.Millisecond},
+		{time.Second, 500 * time.Millisecond},
+	}
+	for _, c := range cases {
+		a := newAdaptiveTimeout(10, 99, 2, 5*time.Millisecond, 500*time.Millisecond)
+		a.Observe(c.latency)
+		if got := a.Timeout(); got != c.timeout {
+			t.Errorf("Latency of %s gave timeout %s but %s was expected", c.latency, got, c.timeout)
+		}
+	}
+}
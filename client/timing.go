@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// replyTiming records when a request was sent, and when the first and last
+// bytes of its reply arrived, for large replies the time to the first byte
+// being much less than the time to the whole reply. For a streamed reply,
+// the last byte is that of its last chunk. It also records the size of the
+// marshalled request and reply, that of a streamed reply being the sum of
+// its chunks. It is safe for concurrent access, and a nil *replyTiming
+// records nothing
+type replyTiming struct {
+	sent, first, last time.Time
+	requestSize       int
+	replySize         int
+	sync.Mutex
+}
+
+// Sent records that the request, of size bytes, was sent at t
+func (rt *replyTiming) Sent(t time.Time, size int) {
+	if rt == nil {
+		return
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	rt.sent, rt.first, rt.last = t, time.Time{}, time.Time{}
+	rt.requestSize, rt.replySize = size, 0
+}
+
+// FirstByte records that a byte of the reply arrived at t, which is its
+// first unless one arrived before
+func (rt *replyTiming) FirstByte(t time.Time) {
+	if rt == nil {
+		return
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	if rt.first.IsZero() {
+		rt.first = t
+	}
+}
+
+// LastByte records that a reply, or chunk of it, of size bytes was read in
+// full at t
+func (rt *replyTiming) LastByte(t time.Time, size int) {
+	if rt == nil {
+		return
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	rt.last = t
+	rt.replySize += size
+}
+
+// Discard forgets the reply read, as it was not to the request
+func (rt *replyTiming) Discard() {
+	if rt == nil {
+		return
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	rt.first, rt.last = time.Time{}, time.Time{}
+	rt.replySize = 0
+}
+
+// Latencies returns the time from sending the request to the first byte
+// of its reply, and to the last, or zero if the reply was not read in full
+func (rt *replyTiming) Latencies() (firstByte time.Duration, lastByte time.Duration) {
+	if rt == nil {
+		return 0, 0
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	if rt.sent.IsZero() || rt.first.IsZero() || rt.last.IsZero() {
+		return 0, 0
+	}
+	return rt.first.Sub(rt.sent), rt.last.Sub(rt.sent)
+}
+
+// Sizes returns the size of the request and of its reply, or zero for the
+// reply if none was read in full
+func (rt *replyTiming) Sizes() (request int, reply int) {
+	if rt == nil {
+		return 0, 0
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	return rt.requestSize, rt.replySize
+}
+
+// overhead returns the processing time reported by the server, and the rest
+// of latency, spent on the network and in queues, or zero for both if the
+// server did not report its processing time
+func overhead(latency time.Duration, server time.Duration) (time.Duration, time.Duration) {
+	if server <= 0 {
+		return 0, 0
+	}
+	if server > latency {
+		return server, 0
+	}
+	return server, latency - server
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check that a reply trickled by the server has its first byte well before
+// its last, for replies in one frame and streamed in chunks
+func TestFirstByteLatency(t *testing.T) {
+	trickle := 50 * time.Millisecond
+	for _, chunks := range [][]string{nil, {"a", "b", "c"}} {
+		filename := filepath.Join(t.TempDir(), "latency.csv")
+		stats, err := OpenStatsWriter(filename, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newFakeServer(t, 0)
+		s.trickle, s.chunks = trickle, chunks
+		c := newTestClient(t, s.addr)
+		c.stats = stats
+		c.run(&commandList{commands: []string{"get A", "get B"}})
+		stats.Close()
+
+		frames := len(chunks)
+		if frames == 0 {
+			frames = 1
+		}
+		records := readStats(t, filename, "")
+		if len(records) != 2 {
+			t.Fatalf("%d stats records, expected 2", len(records))
+		}
+		for i, record := range records {
+			column := func(name string) time.Duration {
+				n, _ := strconv.ParseInt(record[statsColumn(t, name)], 10, 64)
+				return time.Duration(n)
+			}
+			firstByte, lastByte, latency := column("first_byte_ns"), column("last_byte_ns"), column("latency_ns")
+			if firstByte <= 0 || firstByte >= trickle || lastByte < time.Duration(frames)*trickle || lastByte > latency {
+				t.Errorf("%d chunks, request %d: first byte after %v, last after %v, latency %v", len(chunks), i, firstByte, lastByte, latency)
+			}
+		}
+	}
+}
+
+// check that the sizes of the marshalled request and reply are recorded,
+// the sum of its chunks for a streamed reply
+func TestRequestSizes(t *testing.T) {
+	for _, chunks := range [][]string{nil, {"a", "bb", strings.Repeat("c", 1000)}} {
+		filename := filepath.Join(t.TempDir(), "latency.csv")
+		stats, err := OpenStatsWriter(filename, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newFakeServer(t, 0)
+		s.response, s.chunks = strings.Repeat("x", 500), chunks
+		c := newTestClient(t, s.addr)
+		c.stats = stats
+		c.run(&commandList{commands: []string{"get A", "update B " + strings.Repeat("y", 2000)}})
+		stats.Close()
+
+		frames := len(chunks)
+		if frames == 0 {
+			frames = 1
+		}
+		records := readStats(t, filename, "")
+		if len(records) != 2 || len(s.requestSizes) != 2 || len(s.replySizes) != 2*frames {
+			t.Fatalf("%d stats records, %d requests and %d replies", len(records), len(s.requestSizes), len(s.replySizes))
+		}
+		for i, record := range records {
+			replySize := 0
+			for _, size := range s.replySizes[i*frames : (i+1)*frames] {
+				replySize += size
+			}
+			if record[statsColumn(t, "request_bytes")] != strconv.Itoa(s.requestSizes[i]) ||
+				record[statsColumn(t, "response_bytes")] != strconv.Itoa(replySize) {
+				t.Errorf("%d chunks, request %d: recorded %s and %s bytes, expected %d and %d", len(chunks), i,
+					record[statsColumn(t, "request_bytes")], record[statsColumn(t, "response_bytes")], s.requestSizes[i], replySize)
+			}
+		}
+	}
+}
+
+func TestReplyTiming(t *testing.T) {
+	start := time.Now()
+	rt := new(replyTiming)
+	if first, last := rt.Latencies(); first != 0 || last != 0 {
+		t.Errorf("Latencies before sending were %v and %v", first, last)
+	}
+	rt.Sent(start, 100)
+	rt.FirstByte(start.Add(time.Millisecond))
+	rt.LastByte(start.Add(2*time.Millisecond), 10)
+	// a stale reply is discarded, and the next read instead
+	rt.Discard()
+	rt.FirstByte(start.Add(3 * time.Millisecond))
+	rt.FirstByte(start.Add(4 * time.Millisecond))
+	if first, last := rt.Latencies(); first != 0 || last != 0 {
+		t.Errorf("Latencies of a partial reply were %v and %v", first, last)
+	}
+	rt.LastByte(start.Add(5*time.Millisecond), 20)
+	rt.LastByte(start.Add(6*time.Millisecond), 30)
+	if first, last := rt.Latencies(); first != 3*time.Millisecond || last != 6*time.Millisecond {
+		t.Errorf("Latencies were %v and %v, expected 3ms and 6ms", first, last)
+	}
+	if request, reply := rt.Sizes(); request != 100 || reply != 50 {
+		t.Errorf("Sizes were %d and %d, expected 100 and 50", request, reply)
+	}
+	var none *replyTiming
+	none.Sent(start, 100)
+	none.FirstByte(start)
+	if first, last := none.Latencies(); first != 0 || last != 0 {
+		t.Errorf("Latencies of nil timing were %v and %v", first, last)
+	}
+	if request, reply := none.Sizes(); request != 0 || reply != 0 {
+		t.Errorf("Sizes of nil timing were %d and %d", request, reply)
+	}
+}
+
+// check that the processing time reported by the server is recorded, with
+// the rest of the round trip of the last try as network overhead
+func TestServerProcessingTime(t *testing.T) {
+	delay := 30 * time.Millisecond
+	for _, test := range []struct{ report, retried bool }{{true, false}, {true, true}, {false, false}} {
+		report := test.report
+		filename := filepath.Join(t.TempDir(), "latency.csv")
+		stats, err := OpenStatsWriter(filename, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newFakeServer(t, delay)
+		s.reportDelay = report
+		if test.retried {
+			s.drop = 1
+		}
+		c := newTestClient(t, s.addr)
+		c.stats = stats
+		c.run(&commandList{commands: []string{"get A"}})
+		stats.Close()
+
+		records := readStats(t, filename, "")
+		if len(records) != 1 {
+			t.Fatalf("%d stats records, expected 1", len(records))
+		}
+		column := func(name string) time.Duration {
+			n, _ := strconv.ParseInt(records[0][statsColumn(t, name)], 10, 64)
+			return time.Duration(n)
+		}
+		server, network, lastByte := column("server_ns"), column("network_ns"), column("last_byte_ns")
+		if report && (server != delay || network <= 0 || server+network != lastByte) {
+			t.Errorf("Server time %v and network %v, with last try %v, expected server time %v", server, network, lastByte, delay)
+		}
+		if latency := column("latency_ns"); test.retried && latency <= lastByte {
+			t.Errorf("Latency %v of a retried request is not more than its last try %v", latency, lastByte)
+		}
+		if !report && (server != 0 || network != 0) {
+			t.Errorf("Server time %v and network %v without a report", server, network)
+		}
+	}
+	if server, network := overhead(time.Millisecond, 2*time.Millisecond); server != 2*time.Millisecond || network != 0 {
+		t.Errorf("Overhead of a longer server time was %v, %v", server, network)
+	}
+}
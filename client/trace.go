@@ -0,0 +1,18 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/golang/glog"
+)
+
+// newTraceID generates a W3C traceparent for a request, so that client and
+// server logs for the request can be correlated
+func newTraceID() string {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		glog.Warning("Unable to generate trace ID: ", err)
+	}
+	return fmt.Sprintf("00-%x-%x-01", b[:16], b[16:])
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+var traceparent = regexp.MustCompile("^00-[0-9a-f]{32}-[0-9a-f]{16}-01$")
+
+func TestTraceIDUnique(t *testing.T) {
+	server := newFakeServer(t, 0)
+	runClients(t, server.addr, []*oneCommand{{text: "get A"}, {text: "get B"}, {text: "get C"}}, nil)
+
+	seen := map[string]bool{}
+	for _, req := range server.Received() {
+		if !traceparent.MatchString(req.TraceID) {
+			t.Errorf("Trace ID '%s' is not a valid traceparent", req.TraceID)
+		}
+		if seen[req.TraceID] {
+			t.Errorf("Trace ID '%s' used for more than one request", req.TraceID)
+		}
+		seen[req.TraceID] = true
+	}
+}
+
+// check retries of a request keep its trace ID
+func TestTraceIDRetries(t *testing.T) {
+	server := newFakeServer(t, 0)
+	server.drop = 1
+	runClients(t, server.addr, []*oneCommand{{text: "update A 7", replicate: true}}, nil)
+
+	received := server.Received()
+	if len(received) != 2 {
+		t.Fatalf("Server received %d requests but 2 were expected", len(received))
+	}
+	if received[0].TraceID != received[1].TraceID {
+		t.Errorf("Retry has trace ID %s but %s was expected", received[1].TraceID, received[0].TraceID)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"strings"
+	"sync"
+)
+
+var transform_spec = flag.String("transform", "", "Transform the responses to commands before returning them, as tag=pipeline,... where tag is the first word of the command and pipeline is transformers separated by |, applied in order: identity, upper, lower, trim, base64, the response decoded from base64, or json:<field>, a field of the response as a JSON object, nested fields separated by dots. Not transformed if empty")
+
+// Transformer transforms the response to a command before it is returned to
+// the API
+type Transformer interface {
+	Transform(response string) (string, error)
+}
+
+// TransformerFunc adapts a function to a Transformer
+type TransformerFunc func(string) (string, error)
+
+func (f TransformerFunc) Transform(response string) (string, error) {
+	return f(response)
+}
+
+// transformRegistry holds the pipeline of transformers for each command tag,
+// the first word of the command. It is safe for concurrent access, and a
+// nil *transformRegistry transforms nothing
+type transformRegistry struct {
+	pipelines map[string][]Transformer
+	sync.RWMutex
+}
+
+func newTransformRegistry() *transformRegistry {
+	return &transformRegistry{pipelines: map[string][]Transformer{}}
+}
+
+// Register appends t to the pipeline of tag
+func (r *transformRegistry) Register(tag string, t Transformer) {
+	r.Lock()
+	r.pipelines[tag] = append(r.pipelines[tag], t)
+	r.Unlock()
+}
+
+// pipeline returns the transformers of the tag of command, nil if it has none
+func (r *transformRegistry) pipeline(command string) []Transformer {
+	if r == nil {
+		return nil
+	}
+	r.RLock()
+	defer r.RUnlock()
+	return r.pipelines[commandName(command)]
+}
+
+// Transforms returns true if responses to command are transformed
+func (r *transformRegistry) Transforms(command string) bool {
+	return len(r.pipeline(command)) > 0
+}
+
+// Apply passes response to command through the pipeline of its tag,
+// returning the error of the first transformer to fail
+func (r *transformRegistry) Apply(command string, response string) (string, error) {
+	for _, t := range r.pipeline(command) {
+		var err error
+		if response, err = t.Transform(response); err != nil {
+			return "", err
+		}
+	}
+	return response, nil
+}
+
+// transform passes response to command through its pipeline, returning
+// ErrTransform if a transformer failed
+func (c *client) transform(command string, response string) (string, error) {
+	transformed, err := c.transforms.Apply(command, response)
+	if err != nil {
+		glog.Warning("Response to request ", c.requestID-1, " from client ", c.id, " could not be transformed: ", err)
+		return "", fmt.Errorf("%w: %v", ErrTransform, err)
+	}
+	return transformed, nil
+}
+
+// transformed returns response to command after its pipeline, or the text of
+// the error if a transformer failed. Failed requests are returned as is
+func (c *client) transformed(command string, response string, err error) string {
+	if err != nil {
+		return response
+	}
+	if response, err = c.transform(command, response); err != nil {
+		return err.Error()
+	}
+	return response
+}
+
+// submitTransformed is submit, with the response transformed
+func (c *client) submitTransformed(text string, replicate bool) string {
+	response, err := c.submitErr(text, replicate)
+	return c.transformed(text, response, err)
+}
+
+// parseTransforms parses the -transform flag, returning nil if it is empty
+func parseTransforms(spec string) (*transformRegistry, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	r := newTransformRegistry()
+	for _, entry := range strings.Split(spec, ",") {
+		i := strings.Index(entry, "=")
+		if i <= 0 {
+			return nil, errors.New("Transform should be given as tag=pipeline: " + entry)
+		}
+		for _, name := range strings.Split(entry[i+1:], "|") {
+			t, err := parseTransformer(name)
+			if err != nil {
+				return nil, err
+			}
+			r.Register(entry[:i], t)
+		}
+	}
+	return r, nil
+}
+
+// parseTransformer returns the built in transformer called name
+func parseTransformer(name string) (Transformer, error) {
+	switch name {
+	case "identity":
+		return TransformerFunc(func(s string) (string, error) { return s, nil }), nil
+	case "upper":
+		return TransformerFunc(func(s string) (string, error) { return strings.ToUpper(s), nil }), nil
+	case "lower":
+		return TransformerFunc(func(s string) (string, error) { return strings.ToLower(s), nil }), nil
+	case "trim":
+		return TransformerFunc(func(s string) (string, error) { return strings.TrimSpace(s), nil }), nil
+	case "base64":
+		return TransformerFunc(func(s string) (string, error) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			return string(b), err
+		}), nil
+	}
+	if strings.HasPrefix(name, "json:") && len(name) > len("json:") {
+		return jsonField(strings.Split(name[len("json:"):], ".")), nil
+	}
+	return nil, errors.New("Unknown transformer \"" + name + "\", expected identity, upper, lower, trim, base64 or json:<field>")
+}
+
+// jsonField extracts the field at path from a response that is a JSON
+// object. A string field is returned as is, any other as JSON
+type jsonField []string
+
+func (path jsonField) Transform(response string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(response), &value); err != nil {
+		return "", err
+	}
+	for _, field := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", errors.New("Response has no field " + strings.Join(path, "."))
+		}
+		if value, ok = object[field]; !ok {
+			return "", errors.New("Response has no field " + strings.Join(path, "."))
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	return string(b), err
+}
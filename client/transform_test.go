@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTransforms(t *testing.T) {
+	cases := []struct {
+		spec     string
+		command  string
+		response string
+		expected string // "" if the transform fails
+	}{
+		{"get=identity", "get A", "abc", "abc"},
+		{"get=upper", "get A", "abc", "ABC"},
+		{"get=upper", "put A abc", "abc", "abc"},
+		{"get=trim|lower", "get A", " ABC\n", "abc"},
+		{"get=base64", "get A", "aGVsbG8=", "hello"},
+		{"get=base64", "get A", "!", ""},
+		{"get=json:a", "get A", `{"a":"x","b":1}`, "x"},
+		{"get=json:a.b", "get A", `{"a":{"b":[1,2]}}`, "[1,2]"},
+		{"get=json:c", "get A", `{"a":"x"}`, ""},
+		{"get=json:a", "get A", "abc", ""},
+		{"get=json:v|base64|upper,put=identity", "get A", `{"v":"aGk="}`, "HI"},
+	}
+	for _, c := range cases {
+		r, err := parseTransforms(c.spec)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		transformed, err := r.Apply(c.command, c.response)
+		if (err != nil) != (c.expected == "") || transformed != c.expected {
+			t.Errorf("%s: %q to %q transformed to %q, %v, expected %q", c.spec, c.response, c.command, transformed, err, c.expected)
+		}
+	}
+	for _, spec := range []string{"upper", "=upper", "get=", "get=reverse", "get=json:", "get=upper,"} {
+		if _, err := parseTransforms(spec); err == nil {
+			t.Errorf("%q was parsed", spec)
+		}
+	}
+	if r, err := parseTransforms(""); r != nil || err != nil || r.Transforms("get A") {
+		t.Errorf("Empty spec parsed as %v, %v", r, err)
+	}
+}
+
+// check that each response is transformed by the pipeline of its command,
+// whole even if it is streamed, and others are returned as is
+func TestTransformResponses(t *testing.T) {
+	var calls []string
+	transforms := newTransformRegistry()
+	transforms.Register("get", TransformerFunc(func(s string) (string, error) {
+		calls = append(calls, s)
+		return s, nil
+	}))
+	transforms.Register("get", jsonField{"value"})
+	transforms.Register("get", TransformerFunc(func(s string) (string, error) { return strings.ToUpper(s), nil }))
+	transforms.Register("count", jsonField{"n"})
+	transforms.Register("scan", jsonField{"missing"})
+
+	for _, streamed := range []bool{false, true} {
+		calls = nil
+		s := newFakeServer(t, 0)
+		s.response = `{"value":"abc","n":2}`
+		if streamed {
+			s.chunks = []string{`{"value":`, `"abc","n":2}`}
+		}
+		c := newTestClient(t, s.addr)
+		c.transforms = transforms
+		api := &commandList{commands: []string{"get A", "put A 1", "count", "scan"}}
+		c.run(api)
+
+		response := `{"value":"abc","n":2}`
+		if expected := []string{"ABC", response, "2"}; !reflect.DeepEqual(api.responses[:3], expected) {
+			t.Errorf("Streamed %t: responses were %q, expected %q", streamed, api.responses, expected)
+		}
+		if !strings.HasPrefix(api.responses[3], ErrTransform.Error()) {
+			t.Errorf("Streamed %t: failed transform returned %q", streamed, api.responses[3])
+		}
+		if !reflect.DeepEqual(calls, []string{response}) {
+			t.Errorf("Streamed %t: get pipeline called with %q", streamed, calls)
+		}
+	}
+}
+
+// check that responses to async requests are transformed, with transform
+// failures returned as errors
+func TestTransformAsync(t *testing.T) {
+	s := newFakeServer(t, 0)
+	s.response = `{"value":"abc"}`
+	c := newTestClient(t, s.addr)
+	c.transforms, _ = parseTransforms("get=json:value,scan=json:missing")
+	for _, test := range []struct {
+		command, response string
+		err               error
+	}{
+		{"get A", "abc", nil},
+		{"put A 1", `{"value":"abc"}`, nil},
+		{"scan", "", ErrTransform},
+	} {
+		done := make(chan bool)
+		var response string
+		var err error
+		c.SubmitAsync(context.Background(), test.command, false, func(r string, e error) {
+			response, err = r, e
+			close(done)
+		})
+		<-done
+		if response != test.response || !errors.Is(err, test.err) {
+			t.Errorf("%s: returned %q, %v, expected %q, %v", test.command, response, err, test.response, test.err)
+		}
+	}
+}
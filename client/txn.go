@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"strings"
+	"time"
+)
+
+// TxnAPI is implemented by APIs which group commands into transactions
+type TxnAPI interface {
+	// Transaction returns the commands of the last command from Next if it
+	// is a transaction, or nil otherwise
+	Transaction() []string
+}
+
+// txnResult formats the result of a transaction for the API
+func txnResult(reply *msgs.TxnResponse) string {
+	if reply.Committed {
+		return "Committed: " + strings.Join(reply.Responses, "; ")
+	}
+	return "Aborted: " + reply.Reason
+}
+
+// submitTxn sends a transaction to the cluster, retrying until it commits
+// or aborts, and returns its result. Transactions are never streamed,
+// hedged or coalesced
+func (c *client) submitTxn(commands []string) string {
+	txn := msgs.TxnRequest{
+		ClientID:  c.id,
+		RequestID: c.requestID,
+		Commands:  commands,
+		TraceID:   newTraceID()}
+	if c.auth != nil {
+		txn.Auth = c.auth.Token()
+	}
+	// the transaction as a single request, for the hooks and stats
+	req := msgs.ClientRequest{
+		ClientID:  c.id,
+		RequestID: c.requestID,
+		Replicate: true,
+		Request:   strings.Join(commands, "; "),
+		TraceID:   txn.TraceID}
+	if logSample.Sampled(c.id, c.requestID) {
+		glog.Info("Transaction ", c.requestID, " (trace ", txn.TraceID, ") is: ", req.Request)
+	}
+	c.hooks.BeforeSend(&req)
+	if err := checkRequestLength(req.Request); err != nil {
+		glog.Error("Transaction ", c.requestID, " (trace ", txn.TraceID, ") not sent: ", err)
+		c.failed(&req, err)
+		return err.Error()
+	}
+
+	startTime := time.Now()
+	inflight := c.inflight.Start()
+	defer c.inflight.Done()
+	defer c.cancellable()()
+	tries := 0
+	for {
+		tries++
+		// each try has its own correlation token
+		txn.Correlation = newCorrelation()
+		c.correlation = txn.Correlation
+		if secret != nil {
+			msgs.Sign(&txn, secret)
+		}
+		b, err := msgs.TxnRequestToBytes(txn)
+		if err != nil {
+			c.fatal(err)
+		}
+		if len(b) > *max_msg_size {
+			glog.Error("Transaction ", c.requestID, " (trace ", txn.TraceID, ") is ", len(b), " bytes, not sending")
+			c.failed(&req, ErrMsgTooLarge)
+			return ErrMsgTooLarge.Error()
+		}
+		if c.conn == nil {
+			c.connectFrom(c.leader)
+		}
+
+		replyCh, errCh := c.dispatchCurrent(b, c.conn, c.rd)
+		replyBytes, err := await(replyCh, errCh, c.timeout)
+		if err == nil {
+			var reply msgs.TxnResponse
+			err = msgs.Unmarshal(replyBytes, &reply)
+			if err == nil && secret != nil && !msgs.Verify(&reply, secret) {
+				err = fmt.Errorf("%w: reply to transaction %d", ErrBadSignature, reply.RequestID)
+			} else if err != nil {
+				err = fmt.Errorf("%w: transaction reply: %v", ErrDecode, err)
+			}
+			if err == nil {
+				result := &msgs.ClientResponse{
+					ClientID:    reply.ClientID,
+					RequestID:   reply.RequestID,
+					Response:    txnResult(&reply),
+					Status:      msgs.StatusOK,
+					Correlation: reply.Correlation}
+				if !reply.Committed {
+					glog.Warning("Transaction ", c.requestID, " (trace ", txn.TraceID, ") aborted: ", reply.Reason)
+					result.Status = msgs.StatusError
+				}
+				c.checkReply(result)
+				c.complete(&req, result, startTime, tries, 0, inflight)
+				return result.Response
+			}
+		}
+		if errors.Is(err, ErrCancelled) || closed(c.cancelled) {
+			glog.Warning("Transaction ", c.requestID, " (trace ", txn.TraceID, ") was cancelled")
+			c.failed(&req, ErrCancelled)
+			// as for requests, the transaction may still be applied
+			c.reconnect()
+			c.requestID++
+			return ErrCancelled.Error()
+		}
+
+		glog.Warning("Transaction ", c.requestID, " (trace ", txn.TraceID, ") failed due to: ", err)
+		c.failed(&req, err)
+		c.reconnect()
+	}
+}
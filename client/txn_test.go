@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// API issuing each group of commands as a transaction
+type txnList struct {
+	txns      [][]string
+	next      int
+	responses []string
+}
+
+func (l *txnList) Next() (string, bool, bool) {
+	if l.next == len(l.txns) {
+		return "", false, false
+	}
+	l.next++
+	return "txn", true, true
+}
+
+func (l *txnList) Transaction() []string {
+	return l.txns[l.next-1]
+}
+
+func (l *txnList) Return(str string) {
+	l.responses = append(l.responses, str)
+}
+
+func (l *txnList) ReturnStream(chunks chan string) {
+	l.Return(reassemble(chunks))
+}
+
+// check that a transaction is sent whole, with a single result whether it
+// commits or aborts
+func TestTxn(t *testing.T) {
+	cases := []struct {
+		abort  string
+		result string
+	}{
+		{"", "Committed: 0; 0"},
+		{"conflict", "Aborted: conflict"},
+	}
+	commands := []string{"get A", "update B 2"}
+	for i, test := range cases {
+		s := newFakeServer(t, 0)
+		s.abort = test.abort
+		c := newTestClient(t, s.addr)
+		api := &txnList{txns: [][]string{commands, commands}}
+		c.run(api)
+
+		if !reflect.DeepEqual(api.responses, []string{test.result, test.result}) {
+			t.Errorf("case %d: results were %q, expected %q", i, api.responses, test.result)
+		}
+		txns := s.Txns()
+		if len(txns) != 2 || !reflect.DeepEqual(txns[0].Commands, commands) {
+			t.Fatalf("case %d: server received %+v", i, txns)
+		}
+		if txns[0].RequestID != 1 || txns[1].RequestID != 2 {
+			t.Errorf("case %d: transactions had RequestIDs %d and %d", i, txns[0].RequestID, txns[1].RequestID)
+		}
+		if len(s.Received()) != 0 {
+			t.Errorf("case %d: commands of the transaction were sent as requests", i)
+		}
+	}
+}
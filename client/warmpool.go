@@ -0,0 +1,164 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
+	"net"
+	"sync"
+	"time"
+)
+
+// how often the warm pool is checked and refilled
+const warmPoolInterval = time.Second
+
+// warmPool maintains standby connections to servers other than the
+// leader in the background, so that on failover the client can switch to an
+// open connection without dialing. Connections are kept up with TCP
+// keepalives, and dead ones replaced. It is safe for concurrent access
+type warmPool struct {
+	size   int
+	addrs  func() []string
+	leader int
+	conns  map[int]net.Conn // by server
+	stop   chan bool
+	closed bool
+	sync.Mutex
+}
+
+// newWarmPool maintains up to size connections to the servers from addrs
+func newWarmPool(size int, addrs func() []string) *warmPool {
+	p := &warmPool{
+		size:  size,
+		addrs: addrs,
+		conns: make(map[int]net.Conn),
+		stop:  make(chan bool)}
+	go p.maintain()
+	return p
+}
+
+func (p *warmPool) maintain() {
+	for {
+		p.prune()
+		p.fill()
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(warmPoolInterval):
+		}
+	}
+}
+
+// prune closes the connections which are no longer up
+func (p *warmPool) prune() {
+	p.Lock()
+	conns := make(map[int]net.Conn)
+	for i, conn := range p.conns {
+		conns[i] = conn
+	}
+	p.Unlock()
+
+	for i, conn := range conns {
+		if alive(conn) {
+			continue
+		}
+		glog.Info("Warm connection to server ", i, " is down")
+		p.Lock()
+		if p.conns[i] == conn {
+			delete(p.conns, i)
+		}
+		p.Unlock()
+		conn.Close()
+	}
+}
+
+// alive checks that an idle connection has not been closed, as reading it
+// times out instead of failing
+func alive(conn net.Conn) bool {
+	// reading a compressed stream would break it on timing out
+	if compressed, ok := conn.(*msgs.CompressedConn); ok {
+		conn = compressed.Conn
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer conn.SetReadDeadline(time.Time{})
+	_, err := conn.Read(make([]byte, 1))
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// fill connects to servers following the leader, up to the pool size
+func (p *warmPool) fill() {
+	addrs := p.addrs()
+	p.Lock()
+	var missing []int
+	for n := 1; n < len(addrs) && len(p.conns)+len(missing) < p.size; n++ {
+		i := (p.leader + n) % len(addrs)
+		if _, ok := p.conns[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	p.Unlock()
+
+	for _, i := range missing {
+		conn, err := dialServer(addrs[i])
+		if err != nil {
+			glog.Warning("Unable to warm a connection to server ", i, ": ", err)
+			continue
+		}
+		p.Lock()
+		_, ok := p.conns[i]
+		if ok || p.closed || i == p.leader || len(p.conns) >= p.size {
+			conn.Close()
+		} else {
+			p.conns[i] = conn
+		}
+		p.Unlock()
+	}
+}
+
+// SetLeader records the server the client is connected to, which does not
+// need a warm connection
+func (p *warmPool) SetLeader(leader int) {
+	p.Lock()
+	defer p.Unlock()
+	p.leader = leader
+	if conn, ok := p.conns[leader]; ok {
+		conn.Close()
+		delete(p.conns, leader)
+	}
+}
+
+// Take removes and returns a warm connection, to hint if possible, otherwise
+// to the next server after hint with one. It returns nil if there are no
+// warm connections.
+func (p *warmPool) Take(hint int) (net.Conn, int) {
+	n := len(p.addrs())
+	p.Lock()
+	defer p.Unlock()
+	for j := 0; j < n; j++ {
+		i := (hint + j) % n
+		if conn, ok := p.conns[i]; ok {
+			delete(p.conns, i)
+			return conn, i
+		}
+	}
+	return nil, 0
+}
+
+// Len returns the number of warm connections
+func (p *warmPool) Len() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.conns)
+}
+
+// Close stops maintaining the pool and closes its connections
+func (p *warmPool) Close() {
+	close(p.stop)
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	for i, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, i)
+	}
+}
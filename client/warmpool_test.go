@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// check that failover uses a warm connection, without dialing
+func TestWarmPoolFailover(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0), newFakeServer(t, 0)}
+	c := newTestClient(t, servers[0].addr, servers[1].addr, servers[2].addr)
+	c.warm = newWarmPool(1, c.addrs)
+	defer c.warm.Close()
+	c.warm.SetLeader(c.leader)
+	for c.warm.Len() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	counting := &countingDialer{Dialer: defaultDialer}
+	dialer = counting
+	defer func() { dialer = defaultDialer }()
+	c.reconnect()
+	if dials := atomic.LoadInt64(&counting.dials); c.leader != 1 || dials != 0 {
+		t.Errorf("Failed over to server %d with %d dials, expected server 1 without dialing", c.leader, dials)
+	}
+	if response := c.submit("get A", false); response != "0" || len(servers[1].Received()) != 1 {
+		t.Errorf("Request over warm connection returned %q", response)
+	}
+	servers[1].Lock()
+	if servers[1].conns != 1 {
+		t.Errorf("Server 1 accepted %d connections, expected only the warm one", servers[1].conns)
+	}
+	servers[1].Unlock()
+}
+
+// check that dead warm connections are replaced
+func TestWarmPoolPrune(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t, 0), newFakeServer(t, 0)}
+	p := newWarmPool(1, func() []string { return []string{servers[0].addr, servers[1].addr} })
+	defer p.Close()
+	for p.Len() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	conn, _ := p.Take(1)
+	// an idle warm connection which the server has since closed
+	local, remote := net.Pipe()
+	remote.Close()
+	p.Lock()
+	p.conns[1] = local
+	p.Unlock()
+	conn.Close()
+
+	p.prune()
+	if p.Len() != 0 {
+		t.Error("Dead connection was not pruned")
+	}
+	p.fill()
+	if conn, i := p.Take(0); conn == nil || i != 1 || !alive(conn) {
+		t.Errorf("Pool was not refilled with a live connection to server 1, got server %d", i)
+	}
+}
+
+// countingDialer counts the connections dialed
+type countingDialer struct {
+	Dialer
+	dials int64
+}
+
+func (d *countingDialer) Dial(addr string) (net.Conn, error) {
+	atomic.AddInt64(&d.dials, 1)
+	return d.Dialer.Dial(addr)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/api/null"
+	"github.com/heidi-ann/hydra/msgs"
+)
+
+var conn_warmup = flag.Int("connwarmup", 0, "Number of untimed reads to send on each client's connection before the workload starts")
+
+// warmup sends n reads before the timed workload, so that the connection,
+// compression and server caches are set up when the first timed request is
+// sent. Probes are not retried and are left out of the stats and metrics
+func (c *client) warmup(n int) {
+	for i := 0; i < n; i++ {
+		if c.conn == nil {
+			c.connectFrom(c.leader)
+		}
+		req := msgs.ClientRequest{
+			ClientID:  c.id,
+			RequestID: c.requestID,
+			Request:   null.Command,
+			TraceID:   newTraceID(),
+			Metadata:  c.metadata}
+		if c.auth != nil {
+			req.Auth = c.auth.Token()
+		}
+		c.correlate(&req)
+		b, err := msgs.Marshal(req)
+		if err != nil {
+			c.fatal(err)
+		}
+		replyCh, errCh := c.dispatchCurrent(b, c.conn, c.rd)
+		reply, err := receive(replyCh, errCh, c.timeout)
+		for err == nil && reply.More {
+			next := make(chan []byte, 1)
+			nextErr := make(chan error, 1)
+			go readReply(c.rd, next, nextErr)
+			reply, err = receive(next, nextErr, c.timeout)
+		}
+		c.requestID++
+		if err != nil {
+			glog.Warning("Warmup probe ", i+1, " of client ", c.id, " failed due to: ", err)
+			c.reconnect()
+		}
+	}
+	glog.Info("Client ", c.id, " sent ", n, " warmup probes")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/api/null"
+	"path/filepath"
+	"testing"
+)
+
+// check that warmup probes are sent before the workload and are not
+// recorded in the stats or metrics
+func TestWarmup(t *testing.T) {
+	for _, probes := range []int{0, 3} {
+		s := newFakeServer(t, 0)
+		c := newTestClient(t, s.addr)
+		filename := filepath.Join(t.TempDir(), "latency.csv")
+		stats, err := OpenStatsWriter(filename, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.stats = stats
+		c.metrics = newMetrics()
+		c.warmup(probes)
+		c.run(&commandList{commands: []string{"update B 1", "get B"}, replicate: true})
+		stats.Close()
+
+		received := s.Received()
+		if len(received) != probes+2 {
+			t.Fatalf("%d probes: server received %d requests, expected %d", probes, len(received), probes+2)
+		}
+		for i, req := range received {
+			if probe := req.Request == null.Command; probe != (i < probes) {
+				t.Errorf("%d probes: request %d was %q", probes, i, req.Request)
+			}
+			if req.RequestID != i+1 {
+				t.Errorf("%d probes: request %d has ID %d", probes, i, req.RequestID)
+			}
+		}
+		if n := len(readStats(t, filename, "")); n != 2 || c.metrics.Requests() != 2 {
+			t.Errorf("%d probes: %d requests in the stats and %d in the metrics, expected 2", probes, n, c.metrics.Requests())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"github.com/heidi-ann/hydra/config"
+	"sort"
+)
+
+var client_zone = flag.String("zone", "", "Zone of the client, e.g. its datacenter, whose servers in the config are connected and failed over to before those of other zones")
+
+// preference orders the servers for connecting and failing over, nil if
+// they are tried in the order of the addresses
+var preference *serverPreference
+
+// serverPreference orders servers by the [server] sections of the config:
+// those in the zone of the client first, then those of higher weight, then
+// the rest in the order of the addresses. Servers without a section are in
+// no zone, with weight 0
+type serverPreference struct {
+	zone    string
+	servers map[string]serverRank
+}
+
+// serverRank is the zone and weight of a server
+type serverRank struct {
+	zone   string
+	weight int
+}
+
+// newServerPreference returns the preference of the servers of conf for a
+// client in zone, or nil if there is none
+func newServerPreference(conf config.Config, zone string) *serverPreference {
+	if len(conf.Server) == 0 {
+		return nil
+	}
+	p := &serverPreference{zone: zone, servers: map[string]serverRank{}}
+	for addr, server := range conf.Server {
+		p.servers[addr] = serverRank{server.Zone, server.Weight}
+	}
+	return p
+}
+
+// less returns true if the server at a is preferred to that at b
+func (p *serverPreference) less(a string, b string) bool {
+	ra, rb := p.servers[a], p.servers[b]
+	if p.zone != "" && (ra.zone == p.zone) != (rb.zone == p.zone) {
+		return ra.zone == p.zone
+	}
+	return ra.weight > rb.weight
+}
+
+// Order returns the indexes of addrs, most preferred first
+func (p *serverPreference) Order(addrs []string) []int {
+	order := make([]int, len(addrs))
+	for i := range order {
+		order[i] = i
+	}
+	if p != nil {
+		sort.SliceStable(order, func(i, j int) bool { return p.less(addrs[order[i]], addrs[order[j]]) })
+	}
+	return order
+}
+
+// First returns the index of the most preferred of addrs
+func (p *serverPreference) First(addrs []string) int {
+	return p.Order(addrs)[0]
+}
+
+// Failover returns the index of the server to fail over to from the server
+// at current: the most preferred other server, so that the client returns
+// to preferred servers once they are back, or the next server if there is
+// no preference
+func (p *serverPreference) Failover(addrs []string, current int) int {
+	if p == nil || len(addrs) == 1 {
+		return (current + 1) % len(addrs)
+	}
+	for _, i := range p.Order(addrs) {
+		if i != current {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"github.com/heidi-ann/hydra/config"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// zonedConfig returns a config of addrs, in the zone and with the weight of
+// each, given as zones and weights
+func zonedConfig(addrs []string, zones []string, weights []int) config.Config {
+	var conf config.Config
+	conf.Addresses.Address = addrs
+	conf.Parameters.Retries = 1
+	conf.Server = make(map[string]*struct {
+		Zone   string
+		Weight int
+	})
+	for i, addr := range addrs {
+		if zones[i] != "" || weights[i] != 0 {
+			conf.Server[addr] = &struct {
+				Zone   string
+				Weight int
+			}{zones[i], weights[i]}
+		}
+	}
+	return conf
+}
+
+func TestServerPreference(t *testing.T) {
+	addrs := []string{"a:1", "b:1", "c:1", "d:1", "e:1"}
+	conf := zonedConfig(addrs, []string{"dc2", "dc1", "dc1", "", "dc2"}, []int{2, 1, 5, 0, 2})
+	cases := []struct {
+		zone     string
+		order    []int
+		failover []int // from each server
+	}{
+		// local servers first, by weight
+		{"dc1", []int{2, 1, 0, 4, 3}, []int{2, 2, 1, 2, 2}},
+		// by weight alone, in order of the addresses for equal weights
+		{"", []int{2, 0, 4, 1, 3}, []int{2, 2, 0, 2, 2}},
+		{"dc3", []int{2, 0, 4, 1, 3}, []int{2, 2, 0, 2, 2}},
+	}
+	for _, c := range cases {
+		p := newServerPreference(conf, c.zone)
+		if order := p.Order(addrs); !reflect.DeepEqual(order, c.order) || p.First(addrs) != c.order[0] {
+			t.Errorf("Zone %q: order was %v, expected %v", c.zone, order, c.order)
+		}
+		for i := range addrs {
+			if next := p.Failover(addrs, i); next != c.failover[i] {
+				t.Errorf("Zone %q: failed over from %d to %d, expected %d", c.zone, i, next, c.failover[i])
+			}
+		}
+	}
+	// without preferences, servers are tried in order
+	var none *serverPreference
+	if p := newServerPreference(config.Config{}, "dc1"); p != nil {
+		t.Errorf("Preference without servers was %+v", p)
+	}
+	if order := none.Order(addrs); !reflect.DeepEqual(order, []int{0, 1, 2, 3, 4}) || none.First(addrs) != 0 || none.Failover(addrs, 4) != 0 {
+		t.Errorf("Order without preference was %v", order)
+	}
+}
+
+// unusedAddr returns an address which refuses connections
+func unusedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// check that clients connect and fail over to servers in their zone, only
+// using other zones when those are down
+func TestZoneFailover(t *testing.T) {
+	defer func() { preference = nil }()
+	stats, err := OpenStatsWriter(filepath.Join(t.TempDir(), "latency.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Close()
+	zones := []string{"dc2", "dc1", "dc1"}
+
+	// the first local server fails, so the client fails over to the other
+	remote, local1, local2 := newFakeServer(t, 0), newFakeServer(t, 0), newFakeServer(t, 0)
+	local1.drop = 1
+	conf := zonedConfig([]string{remote.addr, local1.addr, local2.addr}, zones, []int{0, 0, 0})
+	preference = newServerPreference(conf, "dc1")
+	c := newClient(0, conf, time.Second, stats)
+	if c.leader != 1 {
+		t.Errorf("Connected to server %d, expected local server 1", c.leader)
+	}
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Response was %q", response)
+	}
+	if c.leader != 2 || len(remote.Received()) != 0 {
+		t.Errorf("Failed over to server %d, expected local server 2", c.leader)
+	}
+
+	// the remote server is used while the local servers are down
+	conf = zonedConfig([]string{remote.addr, unusedAddr(t), unusedAddr(t)}, zones, []int{0, 0, 0})
+	preference = newServerPreference(conf, "dc1")
+	c = newClient(1, conf, time.Second, stats)
+	if c.leader != 0 {
+		t.Errorf("Connected to server %d, expected remote server 0 as the local servers are down", c.leader)
+	}
+
+	// and left for a local server on the next failover
+	conf = zonedConfig([]string{remote.addr, unusedAddr(t), local2.addr}, zones, []int{0, 0, 0})
+	preference = newServerPreference(conf, "dc1")
+	c = newClient(2, conf, time.Second, stats)
+	c.conn.Close()
+	c.connectFrom(0)
+	remote.Lock()
+	remote.drop = 1
+	remote.Unlock()
+	if response := c.submit("get A", false); response != "0" {
+		t.Errorf("Response was %q", response)
+	}
+	if c.leader != 2 || len(remote.Received()) != 1 {
+		t.Errorf("Failed over from the remote server to %d, expected local server 2", c.leader)
+	}
+}
@@ -1,10 +1,18 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/golang/glog"
 	"gopkg.in/gcfg.v1"
+	"io/ioutil"
 )
 
+// ErrEmptyConfig is returned for a config file with nothing but whitespace
+// and comments in it, e.g. as it was truncated or the wrong file was given
+var ErrEmptyConfig = errors.New("Config file is empty")
+
 type Config struct {
 	Addresses struct {
 		Address []string
@@ -12,14 +20,59 @@ type Config struct {
 	Parameters struct {
 		Retries int
 		Timeout int
+		Codec   string // wire format, json if empty
+	}
+	// how to retry each category of error, as "<category> <action>"
+	Retry struct {
+		Policy []string
+	}
+	// preference of servers for connecting and failing over, by address
+	Server map[string]*struct {
+		Zone   string // e.g. the datacenter of the server
+		Weight int    // servers of higher weight are preferred
+	}
+	// TCP keepalive of connections to servers, so that the OS detects dead
+	// servers. Zero values are Go's defaults
+	KeepAlive struct {
+		Enable   bool // use the settings below, rather than Go's defaults
+		Idle     int  // milliseconds idle before the first probe
+		Interval int  // milliseconds between probes
+		Count    int  // probes unanswered before the connection is dropped
 	}
 }
 
 func ParseClientConfig(filename string) Config {
-	var config Config
-	err := gcfg.ReadFileInto(&config, filename)
+	config, err := ReadClientConfig(filename)
+	if errors.Is(err, ErrEmptyConfig) {
+		glog.Fatal(err)
+	}
 	if err != nil {
 		glog.Fatalf("Failed to parse gcfg data: %s", err)
 	}
 	return config
 }
+
+// ReadClientConfig parses a client config, returning any error
+func ReadClientConfig(filename string) (Config, error) {
+	var config Config
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+	if empty(b) {
+		return config, fmt.Errorf("%w: %s", ErrEmptyConfig, filename)
+	}
+	err = gcfg.ReadStringInto(&config, string(b))
+	return config, err
+}
+
+// empty returns true if a config has only whitespace and comments
+func empty(b []byte) bool {
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] != ';' && line[0] != '#' {
+			return false
+		}
+	}
+	return true
+}
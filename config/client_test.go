@@ -0,0 +1,34 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmptyClientConfig(t *testing.T) {
+	cases := []struct {
+		config string
+		empty  bool
+	}{
+		{"", true},
+		{" \n\t\n\r\n", true},
+		{"; servers\n# none yet\n  ; indented\n", true},
+		{"[addresses]\n", false},
+		{SampleClientConfig, false},
+	}
+	for i, c := range cases {
+		filename := filepath.Join(t.TempDir(), "client.conf")
+		if err := ioutil.WriteFile(filename, []byte(c.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadClientConfig(filename)
+		if errors.Is(err, ErrEmptyConfig) != c.empty {
+			t.Errorf("case %d: reading returned %v", i, err)
+		}
+		if c.empty && err.Error() != "Config file is empty: "+filename {
+			t.Errorf("case %d: error was %q", i, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"strconv"
+)
+
+// SampleClientConfig is an example client config, with the default parameters
+const SampleClientConfig = `; Hydra client configuration
+
+; servers to try connecting to, in order. The client connects to the first
+; available server and tries the others when it fails.
+[addresses]
+address = 127.0.0.1:8080
+address = 127.0.0.1:8081
+address = 127.0.0.1:8082
+
+[parameters]
+; number of times to try connecting to each server before giving up
+retries = 1
+; time in milliseconds to wait for a response before retrying the request
+timeout = 500
+; wire format of messages, which must match the servers
+codec = json
+
+; how to retry requests failing with each category of error, one of
+; retry-same, failover, backoff-retry or fail. Categories not listed are
+; retried as by default, failing over to another server, except for busy
+; servers, which are backed off from, and replies too large, which fail.
+[retry]
+policy = timeout failover
+policy = busy backoff-retry
+
+; preference of servers, for connecting and failing over. Servers in the
+; zone of the client, given by -zone, are tried first, then those of higher
+; weight, then the rest in the order of the addresses.
+; [server "127.0.0.1:8080"]
+; zone = dc1
+; weight = 10
+
+; TCP keepalive of connections to servers, so that dead servers are
+; detected by the OS. Times are in milliseconds, and unset values are
+; Go's defaults, of 15s idle, 15s between probes and 9 probes.
+; [keepalive]
+; enable = true
+; idle = 15000
+; interval = 5000
+; count = 3
+`
+
+// Validate checks that the config is usable by a client
+func (c Config) Validate() error {
+	if len(c.Addresses.Address) == 0 {
+		return errors.New("Config has no addresses")
+	}
+	for _, addr := range c.Addresses.Address {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return errors.New("Invalid address " + addr + ": " + err.Error())
+		}
+		if _, err := strconv.Atoi(port); err != nil {
+			return errors.New("Invalid port in address " + addr)
+		}
+	}
+	// servers need not be in the addresses, as they may be discovered
+	for addr, server := range c.Server {
+		if server.Weight < 0 {
+			return errors.New("Weight of server " + addr + " must not be negative")
+		}
+	}
+	if c.KeepAlive.Idle < 0 || c.KeepAlive.Interval < 0 || c.KeepAlive.Count < 0 {
+		return errors.New("Keepalive idle, interval and count must not be negative")
+	}
+	if c.Parameters.Retries < 1 {
+		return errors.New("Retries must be at least 1")
+	}
+	if c.Parameters.Timeout <= 0 {
+		return errors.New("Timeout must be positive")
+	}
+	return nil
+}
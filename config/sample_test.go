@@ -0,0 +1,94 @@
+package config
+
+import (
+	"gopkg.in/gcfg.v1"
+	"testing"
+)
+
+func TestSampleClientConfig(t *testing.T) {
+	var config Config
+	if err := gcfg.ReadStringInto(&config, SampleClientConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Error(err)
+	}
+	if len(config.Addresses.Address) != 3 || config.Parameters.Retries != 1 || config.Parameters.Timeout != 500 || len(config.Retry.Policy) != 2 {
+		t.Errorf("Sample config parsed as %+v", config)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		addrs   []string
+		retries int
+		timeout int
+		valid   bool
+	}{
+		{[]string{"127.0.0.1:8080"}, 1, 500, true},
+		{[]string{"localhost:8080", "[::1]:8081"}, 3, 100, true},
+		{nil, 1, 500, false},
+		{[]string{"127.0.0.1"}, 1, 500, false},
+		{[]string{"127.0.0.1:http"}, 1, 500, false},
+		{[]string{"127.0.0.1:8080"}, 0, 500, false},
+		{[]string{"127.0.0.1:8080"}, 1, 0, false},
+	}
+	for i, c := range cases {
+		var config Config
+		config.Addresses.Address = c.addrs
+		config.Parameters.Retries = c.retries
+		config.Parameters.Timeout = c.timeout
+		if err := config.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: validating returned %v", i, err)
+		}
+	}
+}
+
+func TestServerPreferences(t *testing.T) {
+	cases := []struct {
+		config string
+		valid  bool
+	}{
+		{"[addresses]\naddress = 127.0.0.1:8080\naddress = 127.0.0.1:8081\n" +
+			"[server \"127.0.0.1:8081\"]\nzone = dc1\nweight = 10\n", true},
+		{"[addresses]\naddress = 127.0.0.1:8080\n[server \"127.0.0.1:9090\"]\nzone = dc1\n", true},
+		{"[addresses]\naddress = 127.0.0.1:8080\n[server \"127.0.0.1:8080\"]\nweight = -1\n", false},
+	}
+	for i, c := range cases {
+		var config Config
+		if err := gcfg.ReadStringInto(&config, c.config+"[parameters]\nretries = 1\ntimeout = 500\n"); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: validating returned %v", i, err)
+		}
+	}
+	var config Config
+	gcfg.ReadStringInto(&config, cases[0].config)
+	if s := config.Server["127.0.0.1:8081"]; len(config.Server) != 1 || s == nil || s.Zone != "dc1" || s.Weight != 10 {
+		t.Errorf("Servers parsed as %+v", config.Server)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	cases := []struct {
+		config string
+		valid  bool
+	}{
+		{"[keepalive]\nenable = true\nidle = 15000\ninterval = 5000\ncount = 3\n", true},
+		{"[keepalive]\nenable = true\n", true},
+		{"[keepalive]\nenable = true\ncount = -1\n", false},
+	}
+	for i, c := range cases {
+		var config Config
+		if err := gcfg.ReadStringInto(&config, "[addresses]\naddress = 127.0.0.1:8080\n[parameters]\nretries = 1\ntimeout = 500\n"+c.config); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: validating returned %v", i, err)
+		}
+		if i == 0 && (!config.KeepAlive.Enable || config.KeepAlive.Idle != 15000 || config.KeepAlive.Interval != 5000 || config.KeepAlive.Count != 3) {
+			t.Errorf("Keepalive parsed as %+v", config.KeepAlive)
+		}
+	}
+}
@@ -9,10 +9,16 @@ type ServerConfig struct {
 	Peers struct {
 		Address []string
 	}
+	// address clients connect to for each peer, in the same order, so that
+	// clients can discover them. Optional
+	Clients struct {
+		Address []string
+	}
 	Options struct {
 		Length   int
 		BatchInterval int
 		MaxBatch int
+		Codec    string // wire format, json if empty
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"github.com/golang/glog"
 	"github.com/heidi-ann/hydra/msgs"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -81,7 +82,8 @@ func TestInit(t *testing.T) {
 
 	select {
 	case reply := <-(*io).OutgoingRequests:
-		if reply != request1 {
+		// requests have a Metadata map, so are compared in full
+		if !reflect.DeepEqual(reply, request1) {
 			t.Error(reply)
 		}
 	case <-time.After(time.Second):
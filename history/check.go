@@ -0,0 +1,230 @@
+package history
+
+import (
+	"github.com/heidi-ann/hydra/store"
+	"sort"
+	"strings"
+)
+
+// state of the key-value store, as a model for checking
+type state map[string]string
+
+// initial is the state the store starts in
+func initial() state {
+	s := make(state)
+	for k, v := range *store.New() {
+		s[k] = v
+	}
+	return s
+}
+
+// apply a command to s, returning the new state and the result. This
+// mirrors store.Process, without its logging as it is called many times
+func (s state) apply(command string) (state, string) {
+	next := s
+	var results []string
+	for _, cmd := range strings.Split(strings.Trim(command, "\n"), "; ") {
+		args := strings.Split(cmd, " ")
+		switch {
+		case args[0] == "update" && len(args) == 3:
+			if value, ok := next[args[1]]; !ok || value != args[2] {
+				next = next.with(args[1], args[2])
+			}
+			results = append(results, "OK")
+		case args[0] == "get" && len(args) == 2:
+			value, ok := next[args[1]]
+			if !ok {
+				value = store.NotFound
+			}
+			results = append(results, value)
+		default:
+			results = append(results, store.NotRecognised)
+		}
+	}
+	return next, strings.Join(results, "; ")
+}
+
+// with returns a copy of s with key set to value
+func (s state) with(key string, value string) state {
+	c := make(state, len(s)+1)
+	for k, v := range s {
+		c[k] = v
+	}
+	c[key] = value
+	return c
+}
+
+// String encodes s for memoizing the search
+func (s state) String() string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(s[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// keys returns the keys accessed by a command
+func keys(command string) []string {
+	var ks []string
+	for _, cmd := range strings.Split(strings.Trim(command, "\n"), "; ") {
+		if args := strings.Split(cmd, " "); len(args) >= 2 {
+			ks = append(ks, args[1])
+		}
+	}
+	return ks
+}
+
+// partition splits ops into groups accessing disjoint sets of keys, which
+// are linearizable together only if each is linearizable on its own. Groups
+// are ordered by their first operation
+func partition(ops []Operation) [][]Operation {
+	parent := make(map[string]string)
+	var find func(k string) string
+	find = func(k string) string {
+		if p, ok := parent[k]; ok && p != k {
+			parent[k] = find(p)
+			return parent[k]
+		}
+		parent[k] = k
+		return k
+	}
+	for _, op := range ops {
+		ks := keys(op.Command)
+		for _, k := range ks {
+			parent[find(k)] = find(ks[0])
+		}
+	}
+
+	var groups [][]Operation
+	index := make(map[string]int)
+	for _, op := range ops {
+		root := ""
+		if ks := keys(op.Command); len(ks) > 0 {
+			root = find(ks[0])
+		}
+		i, ok := index[root]
+		if !ok {
+			i = len(groups)
+			index[root] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], op)
+	}
+	return groups
+}
+
+// linearizable checks ops with the Wing-Gong algorithm, memoizing the states
+// reached for each set of linearized operations, as suggested by Lowe
+func linearizable(ops []Operation) bool {
+	ops = append([]Operation{}, ops...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Start < ops[j].Start })
+	done := make([]byte, len(ops))
+	seen := make(map[string]bool)
+	remaining := len(ops)
+
+	var search func(s state) bool
+	search = func(s state) bool {
+		if remaining == 0 {
+			return true
+		}
+		// an operation can be linearized next only if it started before
+		// every remaining operation ended
+		first := -1
+		for i := range ops {
+			if done[i] == 0 && (first < 0 || ops[i].End < ops[first].End) {
+				first = i
+			}
+		}
+		for i := range ops {
+			if ops[i].Start > ops[first].End {
+				break
+			}
+			if done[i] != 0 {
+				continue
+			}
+			next, result := s.apply(ops[i].Command)
+			if result != ops[i].Result {
+				continue
+			}
+			done[i] = 1
+			remaining--
+			key := string(done) + next.String()
+			if !seen[key] {
+				seen[key] = true
+				if search(next) {
+					return true
+				}
+			}
+			done[i] = 0
+			remaining++
+		}
+		return false
+	}
+	return search(initial())
+}
+
+// observed returns whether a value written by op is read by one of ops.
+// Such writes are kept when minimizing, as removing them would just leave
+// reads of values which were never written
+func observed(op Operation, ops []Operation) bool {
+	for _, cmd := range strings.Split(op.Command, "; ") {
+		args := strings.Split(cmd, " ")
+		if args[0] != "update" || len(args) != 3 {
+			continue
+		}
+		for _, other := range ops {
+			results := strings.Split(other.Result, "; ")
+			for i, read := range strings.Split(other.Command, "; ") {
+				if read == "get "+args[1] && i < len(results) && results[i] == args[2] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// minimize shrinks a history which is not linearizable to a minimal set of
+// operations which are still not linearizable, that is removing any one of
+// them, other than writes which are observed, leaves a linearizable history
+func minimize(ops []Operation) []Operation {
+	ops = append([]Operation{}, ops...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Start < ops[j].Start })
+	// first find a short prefix which is not linearizable
+	for n := 1; ; n *= 2 {
+		if n >= len(ops) || !linearizable(ops[:n]) {
+			if n < len(ops) {
+				ops = ops[:n]
+			}
+			break
+		}
+	}
+	for i := 0; i < len(ops); {
+		without := append(append([]Operation{}, ops[:i]...), ops[i+1:]...)
+		if !observed(ops[i], without) && !linearizable(without) {
+			ops = without
+		} else {
+			i++
+		}
+	}
+	return ops
+}
+
+// Check returns whether ops are linearizable with respect to the key-value
+// store. If they are not, a minimal set of violating operations is returned
+func Check(ops []Operation) (bool, []Operation) {
+	for _, group := range partition(ops) {
+		if !linearizable(group) {
+			return false, minimize(group)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,124 @@
+package history
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// op is an operation by client over [start, end] milliseconds
+func op(client int, start, end int, command, result string) Operation {
+	return Operation{client, time.Duration(start) * time.Millisecond, time.Duration(end) * time.Millisecond, command, result}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		ops       []Operation
+		violation []int // indices of the minimal violating operations, nil if linearizable
+	}{
+		{"empty", nil, nil},
+		{"sequential", []Operation{
+			op(0, 0, 10, "update A 1", "OK"),
+			op(0, 20, 30, "get A", "1"),
+			op(1, 40, 50, "get B", "0"),
+			op(1, 60, 70, "get D", "key not found"),
+		}, nil},
+		{"concurrent read sees old or new value", []Operation{
+			op(0, 0, 100, "update A 1", "OK"),
+			op(1, 10, 20, "get A", "0"),
+			op(2, 30, 40, "get A", "1"),
+			op(1, 50, 60, "get A", "1"),
+		}, nil},
+		{"concurrent writes in either order", []Operation{
+			op(0, 0, 100, "update A 1", "OK"),
+			op(1, 0, 100, "update A 2", "OK"),
+			op(2, 200, 210, "get A", "1"),
+		}, nil},
+		{"batched commands", []Operation{
+			op(0, 0, 10, "update A 1; update B 2", "OK; OK"),
+			op(1, 20, 30, "get B; get A", "2; 1"),
+		}, nil},
+		{"stale read after write", []Operation{
+			op(0, 0, 10, "get B", "0"),
+			op(0, 20, 30, "update A 1", "OK"),
+			op(1, 40, 50, "get A", "0"),
+		}, []int{1, 2}},
+		{"value never written", []Operation{
+			op(0, 0, 10, "update A 1", "OK"),
+			op(1, 20, 30, "get A", "7"),
+		}, []int{1}},
+		{"read goes back in time", []Operation{
+			op(0, 0, 100, "update A 1", "OK"),
+			op(1, 10, 20, "get A", "1"),
+			op(2, 30, 40, "get A", "0"),
+			op(3, 0, 100, "update B 1", "OK"),
+		}, []int{0, 1, 2}},
+		{"violation on one key only", []Operation{
+			op(0, 0, 10, "update B 1", "OK"),
+			op(1, 5, 15, "get B", "0"),
+			op(0, 20, 30, "update C 1", "OK"),
+			op(1, 40, 50, "get C", "0"),
+			op(2, 60, 70, "get B", "1"),
+		}, []int{2, 3}},
+		{"batch spanning keys", []Operation{
+			op(0, 0, 10, "update A 1", "OK"),
+			op(1, 20, 30, "update B 1", "OK"),
+			op(2, 40, 50, "get A; get B", "1; 0"),
+		}, []int{0, 1, 2}},
+	}
+	for _, test := range tests {
+		ok, violation := Check(test.ops)
+		if ok != (test.violation == nil) {
+			t.Errorf("%s: linearizable was %t", test.name, ok)
+			continue
+		}
+		var expected []Operation
+		for _, i := range test.violation {
+			expected = append(expected, test.ops[i])
+		}
+		if !reflect.DeepEqual(violation, expected) {
+			t.Errorf("%s: violation was %v, expected %v", test.name, violation, expected)
+		}
+	}
+}
+
+// check that a history round trips through a file
+func TestHistoryFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history.csv")
+	w, err := Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []Operation{
+		op(0, 0, 10, "update A 1", "OK"),
+		op(1, 5, 20, "get A", "1"),
+		op(1, 30, 40, "get A, B", "with, a comma"),
+	}
+	for _, o := range ops {
+		if err := w.Record(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w.Record(op(2, 50, 60, "get C", "0"))
+
+	got, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ops) {
+		t.Errorf("Read back %v, expected %v", got, ops)
+	}
+
+	bad := []string{"#v2 client_id,start_ns,end_ns,command,result\n", "0,10,5,get A,0\n", "0,x,5,get A,0\n"}
+	for _, history := range bad {
+		if _, err := Read(strings.NewReader(history)); err == nil {
+			t.Errorf("Invalid history %q was read", history)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package history records the operations of a run, with the interval over
+// which each was outstanding, and checks whether they are linearizable
+package history
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation is a command issued by a client and the result it returned.
+// Start and End are offsets from the start of the history
+type Operation struct {
+	Client  int
+	Start   time.Duration
+	End     time.Duration
+	Command string
+	Result  string
+}
+
+// Header is the first row of each history file
+var Header = []string{"#v1 client_id", "start_ns", "end_ns", "command", "result"}
+
+// Writer records operations to a history file as CSV.
+// It is safe for concurrent access
+type Writer struct {
+	file   *os.File
+	csv    *csv.Writer
+	start  time.Time
+	closed bool
+	sync.Mutex
+}
+
+// Create starts a history in filename, replacing any existing file. Times
+// are measured from now, on the monotonic clock
+func Create(filename string) (*Writer, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{file: file, csv: csv.NewWriter(file), start: time.Now()}
+	if err = w.csv.Write(Header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Since returns the offset of t from the start of the history
+func (w *Writer) Since(t time.Time) time.Duration {
+	return t.Sub(w.start)
+}
+
+// Record an operation. Operations recorded after Close are dropped
+func (w *Writer) Record(op Operation) error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.csv.Write([]string{strconv.Itoa(op.Client), strconv.FormatInt(op.Start.Nanoseconds(), 10),
+		strconv.FormatInt(op.End.Nanoseconds(), 10), op.Command, op.Result})
+}
+
+// Close flushes and closes the history file
+func (w *Writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Read reads the operations of a history file
+func Read(r io.Reader) ([]Operation, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(Header)
+	var ops []Operation
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return ops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(row[0], "#") {
+			if row[0] != Header[0] {
+				return nil, errors.New("Unsupported history version: " + row[0])
+			}
+			continue
+		}
+		client, err := strconv.Atoi(row[0])
+		if err != nil {
+			return nil, err
+		}
+		start, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		end, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, errors.New("Operation ends before it starts: " + strings.Join(row, ","))
+		}
+		ops = append(ops, Operation{client, time.Duration(start), time.Duration(end), row[3], row[4]})
+	}
+}
+
+// Load reads the history in filename
+func Load(filename string) ([]Operation, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
@@ -0,0 +1,61 @@
+package msgs
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Codec encodes and decodes messages for a wire format. Messages are newline
+// delimited, so encoded messages must not contain newlines
+type Codec struct {
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+var codecs = map[string]Codec{
+	"json": {json.Marshal, json.Unmarshal},
+}
+
+// codec used by Marshal and Unmarshal
+var codec = codecs["json"]
+var codec_mutex sync.RWMutex
+
+// RegisterCodec makes a wire format available to UseCodec by name
+func RegisterCodec(name string, c Codec) {
+	codec_mutex.Lock()
+	defer codec_mutex.Unlock()
+	codecs[name] = c
+}
+
+// UseCodec selects the wire format used for all messages, it should be
+// called before any messages are sent
+func UseCodec(name string) error {
+	codec_mutex.Lock()
+	defer codec_mutex.Unlock()
+	c, ok := codecs[name]
+	if !ok {
+		return errors.New("Unknown codec: " + name)
+	}
+	codec = c
+	return nil
+}
+
+// Codecs returns the names of the registered codecs
+func Codecs() []string {
+	codec_mutex.RLock()
+	defer codec_mutex.RUnlock()
+	var names []string
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func currentCodec() Codec {
+	codec_mutex.RLock()
+	defer codec_mutex.RUnlock()
+	return codec
+}
@@ -0,0 +1,78 @@
+package msgs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// base64 encoded JSON, a custom codec which is easy to recognise
+var base64Codec = Codec{
+	func(v interface{}) ([]byte, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(base64.StdEncoding.EncodeToString(b)), nil
+	},
+	func(data []byte, v interface{}) error {
+		b, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, v)
+	},
+}
+
+func TestCodecRegistry(t *testing.T) {
+	RegisterCodec("base64", base64Codec)
+	if err := UseCodec("base64"); err != nil {
+		t.Fatal(err)
+	}
+	defer UseCodec("json")
+	if !reflect.DeepEqual(Codecs(), []string{"base64", "json"}) {
+		t.Errorf("Registered codecs are %v", Codecs())
+	}
+
+	req := ClientRequest{ClientID: 2, RequestID: 1, Replicate: true, Request: "update A 3", TraceID: "t"}
+	entry := Entry{View: 1, Committed: true, Requests: []ClientRequest{req}}
+	messages := []interface{}{
+		&req,
+		&ClientResponse{ClientID: 2, RequestID: 1, Response: "OK", More: true},
+		&MembershipRequest{ClientID: 2},
+		&MembershipResponse{SenderID: 0, MasterID: 1, Members: []Member{{0, "127.0.0.1:8090", "master", true, "127.0.0.1:8080"}}},
+		&Entry{View: 1, Committed: true, Requests: []ClientRequest{req}},
+		&Prepare{PrepareRequest{0, 1, 2, entry}, PrepareResponse{1, true}},
+		&Commit{CommitRequest{0, 1, 2, entry}, CommitResponse{1, true, 2}},
+		&NewView{NewViewRequest{0, 1}, NewViewResponse{1, 1, 2}},
+		&Query{QueryRequest{0, 1, 2}, QueryResponse{1, 1, true, entry}},
+		&LogUpdate{2, entry},
+	}
+	for _, msg := range messages {
+		b, err := Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.ContainsAny(b, "{\n") {
+			t.Errorf("%T was not encoded by the custom codec: %s", msg, b)
+		}
+		got := reflect.New(reflect.TypeOf(msg).Elem()).Interface()
+		if err := Unmarshal(b, got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Errorf("%T round tripped as %v but %v was expected", msg, got, msg)
+		}
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	if err := UseCodec("msgpack"); err == nil {
+		t.Error("Unknown codec was accepted")
+	}
+	if b, _ := Marshal(ClientRequest{}); !bytes.HasPrefix(b, []byte("{")) {
+		t.Errorf("Failed UseCodec changed the codec, encoded %s", b)
+	}
+}
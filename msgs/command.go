@@ -0,0 +1,108 @@
+package msgs
+
+import (
+	"errors"
+	"strings"
+)
+
+// Operation of a structured command
+type Operation string
+
+// operations understood by the store, others are passed through to it
+const (
+	OpGet    Operation = "get"
+	OpUpdate Operation = "update"
+)
+
+// Command is the structured form of a command, which APIs may build in
+// place of the raw string, so that it need not be formatted and parsed
+// again. Its string form is sent too, for servers which only understand
+// raw commands
+type Command struct {
+	Op    Operation
+	Key   string   `json:",omitempty"`
+	Value string   `json:",omitempty"` // only for updates
+	Args  []string `json:",omitempty"` // further words, for other operations
+}
+
+// ParseCommand parses the raw command text, e.g. "update A 1", into a
+// Command. Get takes a key and update a key and value, while the words of
+// other operations are kept as their key and args
+func ParseCommand(text string) (Command, error) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return Command{}, errors.New("Empty command")
+	}
+	cmd := Command{Op: Operation(words[0])}
+	switch cmd.Op {
+	case OpGet:
+		if len(words) != 2 {
+			return Command{}, errors.New("get takes a key: " + text)
+		}
+		cmd.Key = words[1]
+	case OpUpdate:
+		if len(words) != 3 {
+			return Command{}, errors.New("update takes a key and value: " + text)
+		}
+		cmd.Key, cmd.Value = words[1], words[2]
+	default:
+		if len(words) > 1 {
+			cmd.Key = words[1]
+		}
+		if len(words) > 2 {
+			cmd.Args = words[2:]
+		}
+	}
+	return cmd, nil
+}
+
+// Validate returns an error if cmd cannot be given as a raw command, e.g.
+// as its key has a space in it
+func (cmd Command) Validate() error {
+	if cmd.Op == "" || strings.ContainsAny(string(cmd.Op), " \t\n;") {
+		return errors.New("Invalid operation \"" + string(cmd.Op) + "\"")
+	}
+	switch cmd.Op {
+	case OpGet:
+		if cmd.Key == "" || cmd.Value != "" || len(cmd.Args) > 0 {
+			return errors.New("get takes a key")
+		}
+	case OpUpdate:
+		if cmd.Key == "" || cmd.Value == "" || len(cmd.Args) > 0 {
+			return errors.New("update takes a key and value")
+		}
+	default:
+		if cmd.Value != "" {
+			return errors.New("Only updates take a value")
+		}
+		if cmd.Key == "" && len(cmd.Args) > 0 {
+			return errors.New("Args given without a key")
+		}
+	}
+	for _, word := range append([]string{cmd.Key, cmd.Value}, cmd.Args...) {
+		if strings.ContainsAny(word, " \t\n;") {
+			return errors.New("Invalid word \"" + word + "\" in command")
+		}
+	}
+	return nil
+}
+
+// String returns the raw form of cmd, which ParseCommand parses back
+func (cmd Command) String() string {
+	words := []string{string(cmd.Op)}
+	for _, word := range append([]string{cmd.Key, cmd.Value}, cmd.Args...) {
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Text returns the command of req, the string form of its structured
+// command if it has one, or its raw command otherwise
+func (req ClientRequest) Text() string {
+	if req.Command != nil {
+		return req.Command.String()
+	}
+	return req.Request
+}
@@ -0,0 +1,96 @@
+package msgs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		cmd  Command
+		ok   bool
+	}{
+		{"get A", Command{Op: OpGet, Key: "A"}, true},
+		{"update A 1", Command{Op: OpUpdate, Key: "A", Value: "1"}, true},
+		{" update  B 2\n", Command{Op: OpUpdate, Key: "B", Value: "2"}, true},
+		{"ping", Command{Op: "ping"}, true},
+		{"scan A Z 10", Command{Op: "scan", Key: "A", Args: []string{"Z", "10"}}, true},
+		{"", Command{}, false},
+		{"get", Command{}, false},
+		{"get A B", Command{}, false},
+		{"update A", Command{}, false},
+	}
+	for _, test := range tests {
+		cmd, err := ParseCommand(test.text)
+		if (err == nil) != test.ok || !reflect.DeepEqual(cmd, test.cmd) {
+			t.Errorf("%q parsed as %+v (%v), expected %+v", test.text, cmd, err, test.cmd)
+		}
+	}
+}
+
+// check that structured commands round trip through their string form and
+// through marshalling in requests, and that requests without one are raw
+func TestCommandRoundTrip(t *testing.T) {
+	cmds := []Command{
+		{Op: OpGet, Key: "A"},
+		{Op: OpUpdate, Key: "A", Value: "3"},
+		{Op: "ping"},
+		{Op: "scan", Key: "A", Args: []string{"Z", "10"}},
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Validate(); err != nil {
+			t.Errorf("%+v: %v", cmd, err)
+		}
+		parsed, err := ParseCommand(cmd.String())
+		if err != nil || !reflect.DeepEqual(parsed, cmd) {
+			t.Errorf("%+v parsed back from %q as %+v (%v)", cmd, cmd.String(), parsed, err)
+		}
+
+		cmd := cmd
+		req := ClientRequest{ClientID: 1, RequestID: 2, Request: cmd.String(), Command: &cmd}
+		b, err := Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded ClientRequest
+		if err := Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, req) || decoded.Text() != cmd.String() {
+			t.Errorf("%s decoded as %+v", b, decoded)
+		}
+	}
+
+	// raw commands are unchanged
+	b, err := Marshal(ClientRequest{Request: "update A 1; get A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw ClientRequest
+	if err := Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.Command != nil || raw.Text() != "update A 1; get A" {
+		t.Errorf("Raw request decoded as %+v", raw)
+	}
+}
+
+func TestCommandValidate(t *testing.T) {
+	invalid := []Command{
+		{},
+		{Op: "get A"},
+		{Op: OpGet},
+		{Op: OpGet, Key: "A", Value: "1"},
+		{Op: OpUpdate, Key: "A"},
+		{Op: OpUpdate, Key: "A B", Value: "1"},
+		{Op: OpUpdate, Key: "A", Value: "1; get B"},
+		{Op: "ping", Value: "1"},
+		{Op: "scan", Args: []string{"Z"}},
+	}
+	for _, cmd := range invalid {
+		if err := cmd.Validate(); err == nil {
+			t.Errorf("%+v was valid", cmd)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package msgs
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net"
+)
+
+// HandshakeTag is the first byte of a handshake on a client connection,
+// which must be its first message
+const HandshakeTag byte = 11
+
+// Compressions are the connection compressions supported, in order of
+// preference
+var Compressions = []string{"zstd", "gzip"}
+
+// A Handshake is sent by the client to negotiate the connection
+type Handshake struct {
+	Compression []string // supported by the client, in order of preference
+}
+
+// A HandshakeResponse has the compression chosen by the server, applied to
+// all following messages in both directions, or "" for none
+type HandshakeResponse struct {
+	Compression string
+}
+
+func HandshakeToBytes(h Handshake) ([]byte, error) {
+	b, err := Marshal(h)
+	return appendr(HandshakeTag, b), err
+}
+
+// BytesToHandshake decodes a handshake, returning false if the bytes are
+// not a handshake
+func BytesToHandshake(b []byte) (Handshake, bool, error) {
+	var h Handshake
+	if len(b) == 0 || b[0] != HandshakeTag {
+		return h, false, nil
+	}
+	err := Unmarshal(b[1:], &h)
+	return h, true, err
+}
+
+// NegotiateCompression picks the first of the client's offered compressions
+// which the server supports, or "" if there is none
+func NegotiateCompression(offered []string, supported []string) string {
+	for _, c := range offered {
+		for _, s := range supported {
+			if c == s {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// CompressedConn is a connection whose messages are compressed as a single
+// stream in each direction, flushed after each write. Closing it closes the
+// connection without ending the streams, as it may be closed while in use.
+type CompressedConn struct {
+	net.Conn
+	compression string
+	r           io.Reader // created on the first read, as it reads a header
+	w           flushWriter
+}
+
+// Compress wraps conn with compression, which must be one of Compressions
+func Compress(conn net.Conn, compression string) (*CompressedConn, error) {
+	c := &CompressedConn{Conn: conn, compression: compression}
+	var err error
+	switch compression {
+	case "gzip":
+		c.w = gzip.NewWriter(conn)
+	case "zstd":
+		c.w, err = zstd.NewWriter(conn, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, errors.New("Unknown compression: " + compression)
+	}
+	return c, err
+}
+
+// Compression returns the compression negotiated for the connection
+func (c *CompressedConn) Compression() string {
+	return c.compression
+}
+
+func (c *CompressedConn) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+func (c *CompressedConn) Read(b []byte) (int, error) {
+	if c.r == nil {
+		r, err := c.newReader()
+		if err != nil {
+			return 0, err
+		}
+		c.r = r
+	}
+	return c.r.Read(b)
+}
+
+func (c *CompressedConn) newReader() (io.Reader, error) {
+	if c.compression == "gzip" {
+		return gzip.NewReader(c.Conn)
+	}
+	return zstd.NewReader(c.Conn, zstd.WithDecoderConcurrency(1))
+}
@@ -0,0 +1,64 @@
+package msgs
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+func TestNegotiateCompression(t *testing.T) {
+	cases := []struct {
+		offered   []string
+		supported []string
+		chosen    string
+	}{
+		{[]string{"zstd", "gzip"}, []string{"gzip", "zstd"}, "zstd"},
+		{[]string{"gzip", "zstd"}, []string{"zstd"}, "zstd"},
+		{[]string{"zstd"}, []string{"gzip"}, ""},
+		{nil, Compressions, ""},
+		{Compressions, nil, ""},
+	}
+	for _, c := range cases {
+		if chosen := NegotiateCompression(c.offered, c.supported); chosen != c.chosen {
+			t.Errorf("%v offered to %v chose %q, expected %q", c.offered, c.supported, chosen, c.chosen)
+		}
+	}
+}
+
+// check that messages are exchanged in both directions over each compression
+func TestCompressedConn(t *testing.T) {
+	for _, compression := range Compressions {
+		client, server := net.Pipe()
+		cc, err := Compress(client, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc, err := Compress(server, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			rd := bufio.NewReader(sc)
+			for {
+				msg, err := rd.ReadBytes('\n')
+				if err != nil {
+					return
+				}
+				sc.Write(append([]byte("reply to "), msg...))
+			}
+		}()
+
+		rd := bufio.NewReader(cc)
+		for _, msg := range []string{"get A\n", "update A 1\n"} {
+			if _, err := cc.Write([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+			reply, err := rd.ReadString('\n')
+			if err != nil || reply != "reply to "+msg {
+				t.Errorf("%s: reply %q (%v) to %q", compression, reply, err, msg)
+			}
+		}
+		cc.Close()
+		sc.Close()
+	}
+}
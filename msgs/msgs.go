@@ -1,8 +1,10 @@
 package msgs
 
 import (
-	"encoding/json"
+	"errors"
 	"github.com/golang/glog"
+	"strings"
+	"time"
 )
 
 // MESSAGE FORMATS
@@ -12,12 +14,162 @@ type ClientRequest struct {
 	RequestID int
 	Replicate bool
 	Request   string
+	TraceID   string `json:",omitempty"` // W3C traceparent, the same for all retries of a request
+	Auth      string `json:",omitempty"` // bearer token, if the cluster requires authentication
+	// structured form of Request, if the API built one
+	Command *Command `json:",omitempty"`
+	// key-value pairs for extensions, such as routing hints or feature flags.
+	// ClientRequest is not comparable, so use RequestKey as a map key
+	Metadata map[string]string `json:",omitempty"`
+	// opaque token echoed in the response, new for each try of a request, so
+	// that replies are matched to tries independently of RequestID
+	Correlation string `json:",omitempty"`
+	// staleness tolerated by a read, ignored for writes
+	Consistency Consistency `json:",omitempty"`
+	// HMAC of the other fields, if requests are signed, see Sign
+	Signature string `json:",omitempty"`
 }
 
+// RequestKey identifies a request, across retries
+type RequestKey struct {
+	ClientID  int
+	RequestID int
+}
+
+// Key returns the key identifying req
+func (req ClientRequest) Key() RequestKey {
+	return RequestKey{req.ClientID, req.RequestID}
+}
+
+// A response may be streamed as several ClientResponses, with More set on
+// all but the last
 type ClientResponse struct {
 	ClientID  int
 	RequestID int
 	Response  string
+	More      bool `json:",omitempty"` // further chunks of the response follow
+	// the request was rejected as its token was missing or invalid
+	Unauthorized bool `json:",omitempty"`
+	// set in every response, so that an empty Response can be told apart
+	// from a response which was never filled in
+	Status Status `json:",omitempty"`
+	// Correlation of the request replied to, if it had one
+	Correlation string `json:",omitempty"`
+	// backpressure hint from an overloaded server: clients should issue
+	// requests at Throttle times their rate, from 0 to 1, for RetryAfter,
+	// and retry a busy request after RetryAfter. Zero for no hint
+	Throttle   float64       `json:",omitempty"`
+	RetryAfter time.Duration `json:",omitempty"`
+	// time the server spent handling the request, including consensus,
+	// zero if it does not report it
+	ServerProcessingTime time.Duration `json:",omitempty"`
+	// position of the request in the order the server applied requests, so
+	// that a read with a lower Version than another observed an older
+	// state, zero if the server does not report it
+	Version uint64 `json:",omitempty"`
+	// HMAC of the other fields, if responses are signed, see Sign
+	Signature string `json:",omitempty"`
+}
+
+// Status of a request, as given in its response
+type Status int
+
+const (
+	StatusNone     Status = iota // not a response
+	StatusOK                     // succeeded, an empty Response is a valid value
+	StatusNotFound               // a key was not found
+	StatusError                  // failed, e.g. the command was not recognised or unauthorized
+	StatusBusy                   // not served as the server is overloaded, it may be retried later
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusNone:
+		return "none"
+	case StatusOK:
+		return "ok"
+	case StatusNotFound:
+		return "not found"
+	case StatusError:
+		return "error"
+	case StatusBusy:
+		return "busy"
+	}
+	return "unknown"
+}
+
+// Consistency is the staleness a read tolerates, which decides which server
+// the client sends it to
+type Consistency string
+
+const (
+	// sent to the leader, which orders it with writes
+	ConsistencyLinearizable Consistency = ""
+	// sent to the leader, which may answer from its own state while it
+	// holds a lease, without ordering it with writes
+	ConsistencyLease Consistency = "lease"
+	// sent to any replica, which may answer from state behind the leader's
+	ConsistencyStale Consistency = "stale"
+)
+
+// ParseConsistency parses the name of a consistency level, "linearizable"
+// or "" for ConsistencyLinearizable, "lease", or "stale" or "any"
+func ParseConsistency(name string) (Consistency, error) {
+	switch strings.ToLower(name) {
+	case "", "linearizable":
+		return ConsistencyLinearizable, nil
+	case "lease":
+		return ConsistencyLease, nil
+	case "stale", "any":
+		return ConsistencyStale, nil
+	}
+	return "", errors.New("Unknown consistency level " + name + ", expected linearizable, lease or stale")
+}
+
+// TxnRequest is a transaction, a sequence of commands which are applied
+// together or not at all. Transactions are sent over client connections,
+// prefixed with TxnTag to distinguish them from client requests
+type TxnRequest struct {
+	ClientID    int
+	RequestID   int
+	Commands    []string
+	TraceID     string `json:",omitempty"`
+	Auth        string `json:",omitempty"`
+	Correlation string `json:",omitempty"`
+	Signature   string `json:",omitempty"`
+}
+
+// TxnResponse is the result of a transaction, with the response to each of
+// its commands if it committed, or why it aborted otherwise
+type TxnResponse struct {
+	ClientID    int
+	RequestID   int
+	Committed   bool
+	Responses   []string `json:",omitempty"`
+	Reason      string   `json:",omitempty"`
+	Correlation string   `json:",omitempty"`
+	Signature   string   `json:",omitempty"`
+}
+
+// Membership requests are sent over client connections, prefixed with
+// MembershipTag to distinguish them from client requests
+type MembershipRequest struct {
+	ClientID int
+}
+
+type Member struct {
+	ID      int
+	Address string // peer address of the node
+	Role    string // "master" or "participant"
+	Live    bool   // whether the responding node is connected to it
+	// address clients connect to, if the responding node knows it
+	ClientAddress string `json:",omitempty"`
+}
+
+type MembershipResponse struct {
+	SenderID int
+	MasterID int // if not the SenderID, the request should be redirected to the master
+	Members  []Member
 }
 
 type Entry struct {
@@ -222,14 +374,14 @@ func (to *ProtoMsgs) Forward(from *ProtoMsgs) {
 
 }
 
-// abstract the fact that JSON is used for comms
+// abstract the wire format used for comms, see UseCodec
 
 func Marshal(v interface{}) ([]byte, error) {
-	return json.Marshal(v)
+	return currentCodec().Marshal(v)
 }
 
 func Unmarshal(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+	return currentCodec().Unmarshal(data, v)
 }
 
 func MakeProtoMsgs(buf int) ProtoMsgs {
@@ -404,6 +556,45 @@ func (msgch *ProtoMsgs) ProtoMsgToBytes() ([]byte, error) {
 	}
 }
 
+// MembershipTag is the first byte of a membership request on a client connection
+const MembershipTag byte = 9
+
+func MembershipRequestToBytes(req MembershipRequest) ([]byte, error) {
+	b, err := Marshal(req)
+	return appendr(MembershipTag, b), err
+}
+
+// BytesToMembershipRequest decodes a membership request, returning false if
+// the bytes are not a membership request
+func BytesToMembershipRequest(b []byte) (MembershipRequest, bool, error) {
+	var req MembershipRequest
+	if len(b) == 0 || b[0] != MembershipTag {
+		return req, false, nil
+	}
+	err := Unmarshal(b[1:], &req)
+	return req, true, err
+}
+
+// TxnTag is the first byte of a transaction on a client connection. 10 is
+// not used as a tag, as it is a newline, which ends each message
+const TxnTag byte = 12
+
+func TxnRequestToBytes(req TxnRequest) ([]byte, error) {
+	b, err := Marshal(req)
+	return appendr(TxnTag, b), err
+}
+
+// BytesToTxnRequest decodes a transaction, returning false if the bytes are
+// not a transaction
+func BytesToTxnRequest(b []byte) (TxnRequest, bool, error) {
+	var req TxnRequest
+	if len(b) == 0 || b[0] != TxnTag {
+		return req, false, nil
+	}
+	err := Unmarshal(b[1:], &req)
+	return req, true, err
+}
+
 func (io *Io) DumpPersistentStorage() {
 	for {
 		select {
@@ -1,8 +1,11 @@
 package msgs
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"github.com/golang/glog"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -21,7 +24,7 @@ func TestMakeIo(t *testing.T) {
 	entry1 := Entry{
 		View:      0,
 		Committed: false,
-		Request:   request1}
+		Requests:  []ClientRequest{request1}}
 
 	prepare := PrepareRequest{
 		SenderID: 0,
@@ -51,7 +54,7 @@ func TestMakeIo(t *testing.T) {
 
 	select {
 	case reply := <-(*io).Incoming.Requests.Prepare:
-		if reply != prepare {
+		if !reflect.DeepEqual(reply, prepare) {
 			t.Error(reply)
 		}
 	case <-time.After(time.Millisecond):
@@ -86,3 +89,178 @@ func TestMakeIo(t *testing.T) {
 		}
 	}
 }
+
+func TestMembershipRequest(t *testing.T) {
+	req := MembershipRequest{ClientID: 3}
+	b, err := MembershipRequestToBytes(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := BytesToMembershipRequest(b)
+	if err != nil || !ok {
+		t.Fatal("Membership request not decoded: ", err)
+	}
+	if got != req {
+		t.Errorf("Decoded %v but %v was expected", got, req)
+	}
+
+	// client requests are not membership requests
+	b, err = Marshal(ClientRequest{ClientID: 3, RequestID: 1, Request: "get A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = BytesToMembershipRequest(b)
+	if ok || err != nil {
+		t.Error("Client request decoded as membership request")
+	}
+}
+
+func TestTxnRequest(t *testing.T) {
+	req := TxnRequest{ClientID: 3, RequestID: 7, Commands: []string{"get A", "update B 2"}, Correlation: "c"}
+	b, err := TxnRequestToBytes(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := BytesToTxnRequest(b)
+	if err != nil || !ok {
+		t.Fatal("Transaction not decoded: ", err)
+	}
+	if !reflect.DeepEqual(got, req) {
+		t.Errorf("Decoded %v but %v was expected", got, req)
+	}
+
+	// client and membership requests are not transactions
+	b, err = Marshal(ClientRequest{ClientID: 3, RequestID: 1, Request: "get A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err = BytesToTxnRequest(b); ok || err != nil {
+		t.Error("Client request decoded as transaction")
+	}
+	b, err = MembershipRequestToBytes(MembershipRequest{ClientID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err = BytesToTxnRequest(b); ok || err != nil {
+		t.Error("Membership request decoded as transaction")
+	}
+}
+
+func TestTxnResponse(t *testing.T) {
+	cases := []TxnResponse{
+		{ClientID: 3, RequestID: 7, Committed: true, Responses: []string{"0", "OK"}},
+		{ClientID: 3, RequestID: 8, Reason: "conflict"},
+	}
+	for _, res := range cases {
+		b, err := Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got TxnResponse
+		if err = Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, res) {
+			t.Errorf("Decoded %v but %v was expected", got, res)
+		}
+
+		// the reply can be matched to its request as a client response
+		var reply ClientResponse
+		if err = Unmarshal(b, &reply); err != nil || reply.ClientID != res.ClientID || reply.RequestID != res.RequestID {
+			t.Errorf("Transaction response decoded as %v (%v)", reply, err)
+		}
+	}
+}
+
+func TestMembershipResponse(t *testing.T) {
+	res := MembershipResponse{
+		SenderID: 1,
+		MasterID: 0,
+		Members: []Member{
+			{0, "127.0.0.1:8090", "master", true, "127.0.0.1:8080"},
+			{1, "127.0.0.1:8091", "participant", true, "127.0.0.1:8081"},
+			{2, "127.0.0.1:8092", "participant", false, ""}}}
+
+	b, err := Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got MembershipResponse
+	err = Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, res) {
+		t.Errorf("Decoded %v but %v was expected", got, res)
+	}
+}
+
+func TestRequestMetadata(t *testing.T) {
+	many := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		many[fmt.Sprint("key", i)] = fmt.Sprint("value ", i)
+	}
+	tests := []map[string]string{
+		nil,
+		{},
+		{"route": "eu-west"},
+		{"": "", "quote\"d": "new\nline"},
+		many,
+	}
+	for _, metadata := range tests {
+		req := ClientRequest{ClientID: 3, RequestID: 7, Request: "get A", Metadata: metadata}
+		b, err := Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.ContainsRune(b, '\n') {
+			t.Errorf("Request with metadata %v encoded with a newline", metadata)
+		}
+		var got ClientRequest
+		if err := Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(metadata) == 0 {
+			if len(got.Metadata) != 0 {
+				t.Errorf("Empty metadata decoded as %v", got.Metadata)
+			}
+		} else if !reflect.DeepEqual(got, req) {
+			t.Errorf("Decoded %v but %v was expected", got, req)
+		}
+	}
+
+	// requests without metadata are encoded as before
+	b, _ := Marshal(ClientRequest{ClientID: 3, RequestID: 7, Request: "get A", Metadata: map[string]string{}})
+	if expected := `{"ClientID":3,"RequestID":7,"Replicate":false,"Request":"get A"}`; string(b) != expected {
+		t.Errorf("Request without metadata encoded as %s, expected %s", b, expected)
+	}
+}
+
+func TestParseConsistency(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Consistency
+		ok       bool
+	}{
+		{"", ConsistencyLinearizable, true},
+		{"linearizable", ConsistencyLinearizable, true},
+		{"Lease", ConsistencyLease, true},
+		{"stale", ConsistencyStale, true},
+		{"any", ConsistencyStale, true},
+		{"eventual", "", false},
+	}
+	for _, test := range tests {
+		got, err := ParseConsistency(test.name)
+		if (err == nil) != test.ok || got != test.expected {
+			t.Errorf("ParseConsistency(%q) returned %q, %v", test.name, got, err)
+		}
+	}
+
+	// linearizable reads are encoded as before
+	b, _ := Marshal(ClientRequest{ClientID: 3, RequestID: 7, Request: "get A", Consistency: ConsistencyLinearizable})
+	if expected := `{"ClientID":3,"RequestID":7,"Replicate":false,"Request":"get A"}`; string(b) != expected {
+		t.Errorf("Linearizable read encoded as %s, expected %s", b, expected)
+	}
+}
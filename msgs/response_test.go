@@ -0,0 +1,38 @@
+package msgs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// check that the optional fields of responses round trip, and are left out
+// when zero, so that responses are encoded as before
+func TestResponseEncoding(t *testing.T) {
+	responses := []ClientResponse{
+		{ClientID: 1, RequestID: 2, Response: "0", Status: StatusOK},
+		{ClientID: 1, RequestID: 2, Response: "0", Status: StatusOK, ServerProcessingTime: 1500 * time.Microsecond},
+		{ClientID: 1, RequestID: 3, Status: StatusBusy, Throttle: 0.5, RetryAfter: 200 * time.Millisecond},
+		{ClientID: 1, RequestID: 4, Response: "1", Status: StatusOK, Version: 42},
+	}
+	for i, res := range responses {
+		b, err := Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded ClientResponse
+		if err := Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, res) {
+			t.Errorf("case %d: %s decoded as %+v", i, b, decoded)
+		}
+		for _, field := range []string{"ServerProcessingTime", "Throttle", "RetryAfter", "Version"} {
+			zero := reflect.ValueOf(res).FieldByName(field).IsZero()
+			if strings.Contains(string(b), "\""+field+"\"") == zero {
+				t.Errorf("case %d: %s encoded as %s", i, field, b)
+			}
+		}
+	}
+}
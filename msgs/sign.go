@@ -0,0 +1,51 @@
+package msgs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/golang/glog"
+)
+
+// Messages are signed with an HMAC-SHA256 of their other fields, keyed by
+// a secret shared by the clients and servers, so that messages corrupted
+// or tampered with on networks without TLS are detected. The signature
+// covers the JSON encoding of the message, whichever codec carries it.
+
+// signed is implemented by the *ClientRequest, *ClientResponse, *TxnRequest
+// and *TxnResponse messages, which carry a signature
+type signed interface {
+	signature() *string
+}
+
+func (req *ClientRequest) signature() *string  { return &req.Signature }
+func (res *ClientResponse) signature() *string { return &res.Signature }
+func (req *TxnRequest) signature() *string     { return &req.Signature }
+func (res *TxnResponse) signature() *string    { return &res.Signature }
+
+// mac returns the signature of msg, ignoring any signature it already has
+func mac(msg signed, secret []byte) string {
+	sig := msg.signature()
+	saved := *sig
+	*sig = ""
+	b, err := json.Marshal(msg)
+	*sig = saved
+	if err != nil {
+		glog.Fatal(err)
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign sets the signature of msg with secret. It should be signed after
+// any other changes, such as its correlation token
+func Sign(msg signed, secret []byte) {
+	*msg.signature() = mac(msg, secret)
+}
+
+// Verify returns true if msg was signed with secret, and not changed since
+func Verify(msg signed, secret []byte) bool {
+	return hmac.Equal([]byte(*msg.signature()), []byte(mac(msg, secret)))
+}
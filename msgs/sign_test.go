@@ -0,0 +1,63 @@
+package msgs
+
+import (
+	"bytes"
+	"testing"
+)
+
+// check a signed message is accepted with the same secret, and rejected
+// with another secret or if a byte of it is flipped on the wire
+func TestSign(t *testing.T) {
+	secret := []byte("shared secret")
+	req := ClientRequest{ClientID: 3, RequestID: 7, Request: "update A 1", Replicate: true,
+		Metadata: map[string]string{"route": "eu-west"}, Correlation: "c0ffee"}
+	Sign(&req, secret)
+	if req.Signature == "" {
+		t.Fatal("Request was not signed")
+	}
+	b, err := Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got ClientRequest
+	if err := Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(&got, secret) {
+		t.Error("Signed request rejected with the correct secret")
+	}
+	if Verify(&got, []byte("wrong secret")) {
+		t.Error("Signed request accepted with the wrong secret")
+	}
+
+	// flip a byte of the command
+	flipped := bytes.Replace(b, []byte("update A 1"), []byte("update A 9"), 1)
+	got = ClientRequest{}
+	if err := Unmarshal(flipped, &got); err != nil {
+		t.Fatal(err)
+	}
+	if Verify(&got, secret) {
+		t.Error("Request with a flipped byte accepted")
+	}
+
+	// unsigned messages are rejected
+	res := ClientResponse{ClientID: 3, RequestID: 7, Response: "0", Status: StatusOK}
+	if Verify(&res, secret) {
+		t.Error("Unsigned response accepted")
+	}
+	Sign(&res, secret)
+	if !Verify(&res, secret) {
+		t.Error("Signed response rejected")
+	}
+	res.Status = StatusError
+	if Verify(&res, secret) {
+		t.Error("Response with a changed status accepted")
+	}
+
+	txn := TxnResponse{ClientID: 3, RequestID: 8, Committed: true, Responses: []string{"0"}}
+	Sign(&txn, secret)
+	if !Verify(&txn, secret) {
+		t.Error("Signed transaction response rejected")
+	}
+}
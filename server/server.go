@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/subtle"
 	"flag"
 	"github.com/golang/glog"
 	"github.com/heidi-ann/hydra/cache"
@@ -10,6 +12,7 @@ import (
 	"github.com/heidi-ann/hydra/msgs"
 	"github.com/heidi-ann/hydra/store"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/signal"
@@ -24,23 +27,49 @@ var keyval *store.Store
 var c *cache.Cache
 var cons_io *msgs.Io
 
-var notifyclient map[msgs.ClientRequest](chan msgs.ClientResponse)
+var notifyclient map[msgs.RequestKey](chan msgs.ClientResponse)
 var notifyclient_mutex sync.RWMutex
 
 type Peer struct {
 	id      int
 	address string
-	handled bool // TOOD: replace with Mutex
+	handled bool   // TOOD: replace with Mutex
+	client  string // client address, if configured
 }
 
 var peers []Peer
 var peers_mutex sync.RWMutex
 
+// current view, as last persisted by the consensus algorithm
+var current_view int
+var current_view_mutex sync.RWMutex
+
 var client_port = flag.Int("client-port", 8080, "port to listen on for clients")
 var peer_port = flag.Int("peer-port", 8090, "port to listen on for peers")
 var id = flag.Int("id", -1, "server ID")
 var config_file = flag.String("config", "example.conf", "Server configuration file")
 var disk_path = flag.String("disk", ".", "Path to directory to store persistent storage")
+var compression = flag.String("compression", "zstd,gzip", "Connection compressions clients may negotiate, in order of preference, none if empty")
+var token_file = flag.String("tokenfile", "", "File containing the bearer token clients must authenticate with, none if empty")
+var secret_file = flag.String("secret", "", "File containing the secret shared with clients, to check the signatures of requests and sign responses with, none if empty")
+var max_pending = flag.Int("maxpending", 0, "Maximum number of requests waiting for consensus at once, beyond which clients are told the server is busy. 0 for no limit")
+var busy_throttle = flag.Float64("busythrottle", 0, "Fraction of their rate, from 0 to 1, which clients told the server is busy are asked to slow down to, 0 to not ask them")
+var busy_retry_after = flag.Duration("busyretryafter", 0, "How long clients told the server is busy should wait before retrying, and stay slowed down for, 0 to leave it to them")
+
+// token required of clients, empty if authentication is disabled
+var token string
+
+// secret signing requests and responses, nil if messages are not signed
+var secret []byte
+
+// holds a value for each request waiting for consensus, nil if there is no
+// limit
+var pending chan bool
+
+// check that the client presented the token
+func authorized(req msgs.ClientRequest) bool {
+	return token == "" || subtle.ConstantTimeCompare([]byte(req.Auth), []byte(token)) == 1
+}
 
 func openFile(filename string) (*bufio.Writer, *bufio.Reader, bool) {
 	// check if file exists already for logging
@@ -66,6 +95,8 @@ func openFile(filename string) (*bufio.Writer, *bufio.Reader, bool) {
 }
 
 func stateMachine() {
+	// requests applied, the version of each response
+	var applied uint64
 	for {
 		req := <-cons_io.OutgoingRequests
 		glog.Info("Request has been safely replicated by consensus algorithm", req)
@@ -76,26 +107,42 @@ func stateMachine() {
 			glog.Info("Request found in cache and thus cannot be applied")
 		} else {
 			// apply request
-			output := keyval.Process(req.Request)
+			output := keyval.Process(req.Text())
+			applied++
 			//keyval.Print()
 
 			// write response to request cache
 			reply = msgs.ClientResponse{
-				req.ClientID, req.RequestID, output}
+				ClientID:  req.ClientID,
+				RequestID: req.RequestID,
+				Response:  output,
+				Status:    store.StatusOf(output),
+				Version:   applied}
 			c.Add(reply)
 		}
 
 		// if any handleRequests are waiting on this reply, then reply to them
 		notifyclient_mutex.Lock()
-		if notifyclient[req] != nil {
-			notifyclient[req] <- reply
+		if notifyclient[req.Key()] != nil {
+			notifyclient[req.Key()] <- reply
 		}
 		notifyclient_mutex.Unlock()
 	}
 }
 
+// handleTxn aborts transactions, as consensus cannot yet apply several
+// commands atomically
+func handleTxn(req msgs.TxnRequest) msgs.TxnResponse {
+	glog.Warning("Aborting transaction from client ", req.ClientID, " (trace ", req.TraceID, ")")
+	return msgs.TxnResponse{
+		ClientID:    req.ClientID,
+		RequestID:   req.RequestID,
+		Reason:      "transactions are not supported",
+		Correlation: req.Correlation}
+}
+
 func handleRequest(req msgs.ClientRequest) msgs.ClientResponse {
-	glog.Info("Handling ", req.Request)
+	glog.Info("Handling ", req.Request, " (trace ", req.TraceID, ")")
 
 	// check if already applied
 	found, res := c.Check(req)
@@ -104,15 +151,30 @@ func handleRequest(req msgs.ClientRequest) msgs.ClientResponse {
 		return res // FAST PASS
 	}
 
+	if pending != nil {
+		select {
+		case pending <- true:
+			defer func() { <-pending }()
+		default:
+			glog.Warning("Busy, rejecting request from client ", req.ClientID)
+			return msgs.ClientResponse{
+				ClientID:   req.ClientID,
+				RequestID:  req.RequestID,
+				Status:     msgs.StatusBusy,
+				Throttle:   *busy_throttle,
+				RetryAfter: *busy_retry_after}
+		}
+	}
+
 	// CONSENESUS ALGORITHM HERE
 	glog.Info("Passing request to consensus algorithm")
 	cons_io.IncomingRequests <- req
 
 	// wait for reply
 	notifyclient_mutex.Lock()
-	notifyclient[req] = make(chan msgs.ClientResponse)
+	notifyclient[req.Key()] = make(chan msgs.ClientResponse)
 	notifyclient_mutex.Unlock()
-	reply := <-notifyclient[req]
+	reply := <-notifyclient[req.Key()]
 
 	// check reply
 	if reply.ClientID != req.ClientID {
@@ -228,6 +290,38 @@ func handlePeer(cn net.Conn, init bool) {
 	cn.Close()
 }
 
+// describe the cluster membership, as seen by this node
+func handleMembership(req msgs.MembershipRequest) msgs.MembershipResponse {
+	glog.Info("Handling membership request from client ", req.ClientID)
+	current_view_mutex.RLock()
+	view := current_view
+	current_view_mutex.RUnlock()
+
+	peers_mutex.RLock()
+	defer peers_mutex.RUnlock()
+	master := 0
+	if len(peers) > 0 {
+		master = view % len(peers)
+	}
+	members := make([]msgs.Member, len(peers))
+	for i := range peers {
+		role := "participant"
+		if i == master {
+			role = "master"
+		}
+		members[i] = msgs.Member{
+			ID:            peers[i].id,
+			Address:       peers[i].address,
+			Role:          role,
+			Live:          peers[i].handled,
+			ClientAddress: peers[i].client}
+	}
+	return msgs.MembershipResponse{
+		SenderID: *id,
+		MasterID: master,
+		Members:  members}
+}
+
 func handleConnection(cn net.Conn) {
 	glog.Info("Incoming client connection from ",
 		cn.RemoteAddr().String())
@@ -248,16 +342,100 @@ func handleConnection(cn net.Conn) {
 			break
 		}
 		glog.Info("--------------------New request----------------------")
-		glog.Info("Request: ", string(text))
-		req := new(msgs.ClientRequest)
-		err = msgs.Unmarshal(text, req)
+		if token == "" {
+			// requests would include the token otherwise
+			glog.Info("Request: ", string(text))
+		}
+
+		// negotiate compression, applied to the rest of the connection. The
+		// client waits for the reply, so nothing further has been buffered
+		handshake, is_handshake, err := msgs.BytesToHandshake(text)
 		if err != nil {
-			glog.Fatal(err)
+			glog.Warning("Invalid handshake: ", err)
+			break
+		}
+		if is_handshake {
+			chosen := msgs.NegotiateCompression(handshake.Compression, strings.Split(*compression, ","))
+			b, err := msgs.Marshal(msgs.HandshakeResponse{Compression: chosen})
+			if err != nil {
+				glog.Fatal(err)
+			}
+			writer.Write(append(b, '\n'))
+			if err = writer.Flush(); err != nil {
+				glog.Warning(err)
+				break
+			}
+			if chosen != "" {
+				glog.Info("Compressing connection with ", chosen)
+				compressed, err := msgs.Compress(cn, chosen)
+				if err != nil {
+					glog.Fatal(err)
+				}
+				reader = bufio.NewReader(compressed)
+				writer = bufio.NewWriter(compressed)
+			}
+			continue
 		}
 
 		// construct reply
-		reply := handleRequest(*req)
-		b, err := msgs.Marshal(reply)
+		var b []byte
+		member_req, is_member, err := msgs.BytesToMembershipRequest(text)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		txn_req, is_txn, err := msgs.BytesToTxnRequest(text)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if is_txn && secret != nil && !msgs.Verify(&txn_req, secret) {
+			glog.Warning("Closing connection after transaction from client ", txn_req.ClientID, " with an invalid signature")
+			break
+		}
+		if is_txn {
+			reply := handleTxn(txn_req)
+			if secret != nil {
+				msgs.Sign(&reply, secret)
+			}
+			b, err = msgs.Marshal(reply)
+		} else if is_member {
+			b, err = msgs.Marshal(handleMembership(member_req))
+		} else {
+			req := new(msgs.ClientRequest)
+			err = msgs.Unmarshal(text, req)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			// the client retries requests whose signature is invalid, as
+			// they may have been corrupted, on a new connection
+			if secret != nil && !msgs.Verify(req, secret) {
+				glog.Warning("Closing connection after request from client ", req.ClientID, " with an invalid signature")
+				break
+			}
+			// the correlation token and signature are not replicated, they
+			// differ between retries
+			correlation := req.Correlation
+			req.Correlation, req.Signature = "", ""
+			var reply msgs.ClientResponse
+			if authorized(*req) {
+				// the token is not replicated
+				req.Auth = ""
+				start := time.Now()
+				reply = handleRequest(*req)
+				reply.ServerProcessingTime = time.Since(start)
+			} else {
+				glog.Warning("Rejecting unauthorized request from client ", req.ClientID)
+				reply = msgs.ClientResponse{
+					ClientID:     req.ClientID,
+					RequestID:    req.RequestID,
+					Unauthorized: true,
+					Status:       msgs.StatusError}
+			}
+			reply.Correlation = correlation
+			if secret != nil {
+				msgs.Sign(&reply, secret)
+			}
+			b, err = msgs.Marshal(reply)
+		}
 		if err != nil {
 			glog.Fatal("error:", err)
 		}
@@ -290,6 +468,36 @@ func main() {
 	if *id == -1 {
 		glog.Fatal("ID is required")
 	}
+	if conf.Options.Codec != "" {
+		if err := msgs.UseCodec(conf.Options.Codec); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	if *token_file != "" {
+		b, err := ioutil.ReadFile(*token_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		token = strings.TrimSpace(string(b))
+		if token == "" {
+			glog.Fatal("Token file ", *token_file, " is empty")
+		}
+	}
+
+	if *secret_file != "" {
+		b, err := ioutil.ReadFile(*secret_file)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		secret = bytes.TrimSpace(b)
+		if len(secret) == 0 {
+			glog.Fatal("Secret file ", *secret_file, " is empty")
+		}
+	}
+	if *max_pending > 0 {
+		pending = make(chan bool, *max_pending)
+	}
 
 	glog.Info("Starting server ", *id)
 	defer glog.Warning("Shutting down server ", *id)
@@ -300,7 +508,7 @@ func main() {
 	// setup IO
 	cons_io = msgs.MakeIo(2000, len(conf.Peers.Address))
 
-	notifyclient = make(map[msgs.ClientRequest](chan msgs.ClientResponse))
+	notifyclient = make(map[msgs.RequestKey](chan msgs.ClientResponse))
 	notifyclient_mutex = sync.RWMutex{}
 	go stateMachine()
 
@@ -342,15 +550,23 @@ func main() {
 				break
 			}
 			found = true
-			view, _ = strconv.Atoi(string(b))
+			view, err = strconv.Atoi(strings.Trim(string(b), "\n"))
+			if err != nil {
+				glog.Fatal("Cannot parse view update ", err)
+			}
 		}
 	}
 
+	current_view = view
+
 	// write updates to persistent storage
 	go func() {
 		for {
 			view := <-cons_io.ViewPersist
 			glog.Info("Updating view to ", view)
+			current_view_mutex.Lock()
+			current_view = view
+			current_view_mutex.Unlock()
 			_, err := meta_disk.Write([]byte(strconv.Itoa(view)))
 			_, err = meta_disk.Write([]byte("\n"))
 			if err != nil {
@@ -400,7 +616,10 @@ func main() {
 	peers = make([]Peer, len(conf.Peers.Address))
 	for i := range conf.Peers.Address {
 		peers[i] = Peer{
-			i, conf.Peers.Address[i], false}
+			i, conf.Peers.Address[i], false, ""}
+		if i < len(conf.Clients.Address) {
+			peers[i].client = conf.Clients.Address[i]
+		}
 	}
 	peers_mutex = sync.RWMutex{}
 
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"github.com/golang/glog"
 	"github.com/heidi-ann/hydra/msgs"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -14,7 +15,8 @@ func checkRequest(t *testing.T, req msgs.ClientRequest, ios []*msgs.Io, master_i
 	for id := range ios {
 		select {
 		case reply := <-(*ios[id]).OutgoingRequests:
-			if reply != req {
+			// requests have a Metadata map, so are compared in full
+			if !reflect.DeepEqual(reply, req) {
 				t.Error(reply)
 			}
 		case <-time.After(time.Millisecond):
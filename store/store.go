@@ -3,9 +3,16 @@ package store
 
 import (
 	"github.com/golang/glog"
+	"github.com/heidi-ann/hydra/msgs"
 	"strings"
 )
 
+// replies to commands which failed
+const (
+	NotFound      = "key not found"
+	NotRecognised = "not reconised"
+)
+
 type Store map[string]string
 
 func New() *Store {
@@ -24,24 +31,24 @@ func (s *Store) execute(req string) string {
 	switch request[0] {
 	case "update":
 		if len(request) != 3 {
-			return "not reconised"
+			return NotRecognised
 		}
 		glog.Infof("Updating %s to %s", request[1], request[2])
 		(*s)[request[1]] = request[2]
 		return "OK"
 	case "get":
 		if len(request) != 2 {
-			return "not reconised"
+			return NotRecognised
 		}
 		glog.Infof("Getting %s", request[1])
 		value, ok := (*s)[request[1]]
 		if ok {
 			return value
 		} else {
-			return "key not found"
+			return NotFound
 		}
 	default:
-		return "not reconised"
+		return NotRecognised
 	}
 }
 
@@ -59,6 +66,21 @@ func (s *Store) Process(req string) string {
 	return reply
 }
 
+// StatusOf returns the status of a reply from Process. A batch of commands
+// has the status of its worst command
+func StatusOf(reply string) msgs.Status {
+	status := msgs.StatusOK
+	for _, r := range strings.Split(reply, "; ") {
+		switch r {
+		case NotRecognised:
+			return msgs.StatusError
+		case NotFound:
+			status = msgs.StatusNotFound
+		}
+	}
+	return status
+}
+
 func (s *Store) Print() {
 	for key, value := range *s {
 		glog.Info("(", key, value, ")")
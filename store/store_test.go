@@ -1,6 +1,9 @@
 package store
 
-import "testing"
+import (
+	"github.com/heidi-ann/hydra/msgs"
+	"testing"
+)
 
 func TestProcess(t *testing.T) {
 	store := New()
@@ -19,3 +22,26 @@ func TestProcess(t *testing.T) {
 		}
 	}
 }
+
+func TestStatusOf(t *testing.T) {
+	store := New()
+
+	cases := []struct {
+		req    string
+		status msgs.Status
+	}{
+		{"update A ", msgs.StatusOK},
+		{"get A", msgs.StatusOK},
+		{"get D", msgs.StatusNotFound},
+		{"delete A", msgs.StatusError},
+		{"get A; get D", msgs.StatusNotFound},
+		{"get D; delete A; get A", msgs.StatusError},
+	}
+
+	for _, c := range cases {
+		reply := store.Process(c.req)
+		if got := StatusOf(reply); got != c.status {
+			t.Errorf("%s replied %q with status %s but %s was expected", c.req, reply, got, c.status)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package test
 
 import (
+	"errors"
 	"github.com/golang/glog"
 	"gopkg.in/gcfg.v1"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 type Commands struct {
@@ -15,16 +19,163 @@ type Termination struct {
 	Requests int
 }
 
+// Script is a list of commands to issue in order, instead of generating
+// them, see ParseCommand and Template for their format
+type Script struct {
+	Command []string
+	Seed    int64 // for random template variables, from the time if 0
+}
+
+// Operations is a workload given as a mix of operations, see ParseMix
+// for its format
+type Operations struct {
+	Mix string
+}
+
 type ConfigAuto struct {
 	Commands    Commands
 	Termination Termination
+	Script      Script
+	Operations  Operations
+	Think       Think
 }
 
-func ParseAuto(filename string) ConfigAuto {
-	var config ConfigAuto
-	err := gcfg.ReadFileInto(&config, filename)
+// Command is a command of a script, with its expected response if HasExpect
+// is set, or a regular expression its response must match if Pattern is
+type Command struct {
+	Text      string
+	Expect    string
+	HasExpect bool
+	Pattern   string
+}
+
+// ParseCommand parses a script command, either "<command>",
+// "<command> => <expected response>", e.g. "get x => 42", or
+// "<command> =~ <regular expression>", e.g. "get x =~ ^[0-9]+$". The
+// regular expression is not expanded as a template, and is matched against
+// any part of the response unless anchored
+func ParseCommand(line string) (Command, error) {
+	var command Command
+	sep := "=>"
+	if i, j := strings.Index(line, "=~"), strings.Index(line, "=>"); i >= 0 && (j < 0 || i < j) {
+		sep = "=~"
+	}
+	parts := strings.SplitN(line, sep, 2)
+	command.Text = strings.TrimSpace(parts[0])
+	if command.Text == "" {
+		return command, errors.New("Missing command in \"" + line + "\"")
+	}
+	if len(parts) < 2 {
+		return command, nil
+	}
+	if sep == "=>" {
+		command.Expect = strings.TrimSpace(parts[1])
+		command.HasExpect = true
+		return command, nil
+	}
+	command.Pattern = strings.TrimSpace(parts[1])
+	if command.Pattern == "" {
+		return command, errors.New("Missing response pattern in \"" + line + "\"")
+	}
+	if _, err := regexp.Compile(command.Pattern); err != nil {
+		return command, errors.New("Invalid response pattern in \"" + line + "\": " + err.Error())
+	}
+	return command, nil
+}
+
+// Workload is a named workload in a workload library
+type Workload struct {
+	Reads     int
+	Conflicts int
+	Interval  int
+	Requests  int
+	Command   []string
+	Seed      int64
+	Mix       string
+	// think time, as in the [think] section
+	ThinkDistribution string
+	ThinkMean         int
+	ThinkMin          int
+	ThinkMax          int
+}
+
+// WorkloadLibrary is a file of named workloads, each in a
+// [workload "name"] section
+type WorkloadLibrary struct {
+	Workload map[string]*Workload
+}
+
+// ParseAuto parses a workload file. If name is not empty, the file is a
+// workload library and the named workload is used
+func ParseAuto(filename string, name string) ConfigAuto {
+	config, err := parseAuto(filename, name)
 	if err != nil {
 		glog.Fatalf("Failed to parse gcfg data: %s", err)
 	}
 	return config
 }
+
+func parseAuto(filename string, name string) (ConfigAuto, error) {
+	var config ConfigAuto
+	if name == "" {
+		err := gcfg.ReadFileInto(&config, filename)
+		if err != nil {
+			return config, err
+		}
+		return config, checkWorkload(config)
+	}
+
+	var library WorkloadLibrary
+	err := gcfg.ReadFileInto(&library, filename)
+	if err != nil {
+		return config, err
+	}
+	w, ok := library.Workload[name]
+	if !ok {
+		var names []string
+		for n := range library.Workload {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return config, errors.New("Workload \"" + name + "\" not found in " + filename +
+			", available workloads are: " + strings.Join(names, ", "))
+	}
+	config.Commands = Commands{w.Reads, w.Conflicts, w.Interval}
+	config.Termination = Termination{w.Requests}
+	config.Script = Script{w.Command, w.Seed}
+	config.Operations = Operations{w.Mix}
+	config.Think = Think{w.ThinkDistribution, w.ThinkMean, w.ThinkMin, w.ThinkMax}
+	return config, checkWorkload(config)
+}
+
+// checkWorkload checks the script, mix and think time of a workload
+func checkWorkload(config ConfigAuto) error {
+	if _, err := NewThinkTime(config.Think); err != nil {
+		return err
+	}
+	if config.Operations.Mix != "" {
+		if len(config.Script.Command) > 0 {
+			return errors.New("A workload cannot have both a script and a mix")
+		}
+		if _, err := ParseMix(config.Operations.Mix); err != nil {
+			return err
+		}
+	}
+	return checkScript(config.Script)
+}
+
+func checkScript(script Script) error {
+	for _, line := range script.Command {
+		command, err := ParseCommand(line)
+		if err != nil {
+			return err
+		}
+		if _, err = ParseTemplate(command.Text); err != nil {
+			return err
+		}
+		if _, err = ParseTemplate(command.Expect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
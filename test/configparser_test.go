@@ -0,0 +1,76 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAuto(t *testing.T) {
+	cases := []struct {
+		filename string
+		name     string
+		config   ConfigAuto
+	}{
+		{"workload.conf", "", ConfigAuto{Commands{100, 2, 0}, Termination{1000}, Script{}, Operations{}, Think{}}},
+		{"workloads.conf", "readheavy", ConfigAuto{Commands{95, 2, 0}, Termination{1000}, Script{}, Operations{}, Think{}}},
+		{"workloads.conf", "writeheavy", ConfigAuto{Commands{5, 2, 0}, Termination{1000}, Script{}, Operations{}, Think{}}},
+		{"workloads.conf", "mixed", ConfigAuto{Commands{50, 2, 0}, Termination{1000}, Script{}, Operations{}, Think{}}},
+		{"script.conf", "", ConfigAuto{Commands{}, Termination{}, Script{Command: []string{"update x 42", "get x => 42", "get y", "get x =~ ^[0-9]+$"}}, Operations{}, Think{}}},
+		{"mix.conf", "", ConfigAuto{Commands{}, Termination{1000}, Script{}, Operations{"get 60%, set 40% over keyspace 0..9999, zipf 1.1"}, Think{}}},
+	}
+	for _, c := range cases {
+		config, err := parseAuto(c.filename, c.name)
+		if err != nil {
+			t.Errorf("%s %s: %s", c.filename, c.name, err)
+		} else if !reflect.DeepEqual(config, c.config) {
+			t.Errorf("%s %s parsed as %v but %v was expected", c.filename, c.name, config, c.config)
+		}
+	}
+}
+
+// check that scripts with an invalid response pattern are rejected
+func TestCheckScriptPattern(t *testing.T) {
+	if err := checkScript(Script{Command: []string{"get x =~ (["}}); err == nil || !strings.Contains(err.Error(), "Invalid response pattern") {
+		t.Errorf("Invalid pattern returned %v", err)
+	}
+	if err := checkScript(Script{Command: []string{"get x =~ ^x{2}$"}}); err != nil {
+		t.Errorf("Pattern with braces returned %v", err)
+	}
+}
+
+func TestParseAutoUnknownWorkload(t *testing.T) {
+	_, err := parseAuto("workloads.conf", "bursty")
+	if err == nil {
+		t.Fatal("Unknown workload was accepted")
+	}
+	if !strings.Contains(err.Error(), "mixed, readheavy, writeheavy") {
+		t.Errorf("Error does not list the available workloads: %s", err)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		line    string
+		command Command
+		ok      bool
+	}{
+		{"get x", Command{"get x", "", false, ""}, true},
+		{"get x => 42", Command{"get x", "42", true, ""}, true},
+		{"get x =>", Command{"get x", "", true, ""}, true},
+		{"update x 42=>OK", Command{"update x 42", "OK", true, ""}, true},
+		{" => 42", Command{}, false},
+		{"get x =~ ^[0-9]{2}$", Command{"get x", "", false, "^[0-9]{2}$"}, true},
+		{"get x =~ a=>b", Command{"get x", "", false, "a=>b"}, true},
+		{"get x => a=~b", Command{"get x", "a=~b", true, ""}, true},
+		{"get x =~", Command{}, false},
+		{"get x =~ [0-9", Command{}, false},
+		{" =~ .", Command{}, false},
+	}
+	for _, c := range cases {
+		command, err := ParseCommand(c.line)
+		if (err == nil) != c.ok || (c.ok && command != c.command) {
+			t.Errorf("\"%s\" parsed as %v (%v) but %v was expected", c.line, command, err, c.command)
+		}
+	}
+}
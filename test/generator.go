@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"math/rand"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,12 +15,74 @@ import (
 type Generator struct {
 	Ratio    int // percentage of read requests
 	Conflict int // 1 to 5, degree of requests which target particular area
-	Requests int // terminate after this number of requests
+	Requests int // terminate after this number of requests, never if negative
 	Interval int // milliseconand delay between client resquest and response
+
+	Verify bool       // check responses against the expectations of the script
+	Think  *ThinkTime // wait after each response, none if nil
+
+	script     []Command        // if not empty, commands are issued from here in order
+	templates  [][2]*Template   // of the text and expectation of each command
+	patterns   []*regexp.Regexp // of each command, nil if it has none
+	rand       *rand.Rand       // for template variables and mixes
+	seed       int64            // of rand
+	mix        *mixSource       // if not nil, commands are generated from here
+	now        func() time.Time
+	next       int
+	last       Command // last command issued, expanded
+	lastMatch  *regexp.Regexp
+	checked    int
+	mismatches int
 }
 
 func Generate(conf ConfigAuto) *Generator {
-	return &Generator{conf.Commands.Reads, conf.Commands.Conflicts, conf.Termination.Requests, conf.Commands.Interval}
+	g := &Generator{Ratio: conf.Commands.Reads, Conflict: conf.Commands.Conflicts,
+		Requests: conf.Termination.Requests, Interval: conf.Commands.Interval}
+	for _, line := range conf.Script.Command {
+		command, err := ParseCommand(line)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		text, err := ParseTemplate(command.Text)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		expect, err := ParseTemplate(command.Expect)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		var pattern *regexp.Regexp
+		if command.Pattern != "" {
+			pattern = regexp.MustCompile(command.Pattern)
+		}
+		g.script = append(g.script, command)
+		g.templates = append(g.templates, [2]*Template{text, expect})
+		g.patterns = append(g.patterns, pattern)
+	}
+	seed := conf.Script.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	g.rand = rand.New(rand.NewSource(seed))
+	g.seed = seed
+	g.now = time.Now
+	think, err := NewThinkTime(conf.Think)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	g.Think = think
+	if conf.Operations.Mix != "" {
+		mix, err := ParseMix(conf.Operations.Mix)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		g.mix = newMixSource(mix, g.rand)
+	}
+	// by default, a script is issued once
+	if len(g.script) > 0 && g.Requests == 0 {
+		g.Requests = len(g.script)
+	}
+	return g
 }
 
 func (g *Generator) Next() (string, bool, bool) {
@@ -27,7 +91,9 @@ func (g *Generator) Next() (string, bool, bool) {
 	if g.Requests == 0 {
 		return "", false, false
 	}
-	g.Requests--
+	if g.Requests > 0 {
+		g.Requests--
+	}
 
 	delay := 0
 	if g.Interval > 0 {
@@ -35,6 +101,24 @@ func (g *Generator) Next() (string, bool, bool) {
 	}
 	time.Sleep(time.Duration(delay) * time.Millisecond)
 
+	// scripts are repeated until the requests have been issued
+	if len(g.script) > 0 {
+		n := g.next % len(g.script)
+		iteration := g.next / len(g.script)
+		g.last = g.script[n]
+		g.last.Text = g.templates[n][0].Expand(iteration, g.rand, g.now())
+		g.last.Expect = g.templates[n][1].Expand(iteration, g.rand, g.now())
+		g.lastMatch = g.patterns[n]
+		g.next++
+		read := strings.HasPrefix(strings.ToLower(g.last.Text), "get ")
+		return g.last.Text, !read, true
+	}
+
+	if g.mix != nil {
+		text, write := g.mix.Next()
+		return text, write, true
+	}
+
 	// generate key
 	key := "A" // default just in case
 	glog.Info("Starting to generate command")
@@ -59,6 +143,48 @@ func (g *Generator) Next() (string, bool, bool) {
 	}
 }
 
-func (_ *Generator) Return(_ string) {
-	//STUB
+// Return checks the response against the expectation of the last command,
+// if verifying, then thinks before the next command
+func (g *Generator) Return(response string) {
+	if g.Think != nil {
+		defer time.Sleep(g.Think.Draw(g.rand))
+	}
+	if !g.Verify {
+		return
+	}
+	if g.last.HasExpect {
+		g.checked++
+		if response != g.last.Expect {
+			g.mismatches++
+			glog.Errorf("Verification failed for \"%s\": response was \"%s\", expected \"%s\"",
+				g.last.Text, response, g.last.Expect)
+		}
+	} else if g.lastMatch != nil {
+		g.checked++
+		if !g.lastMatch.MatchString(response) {
+			g.mismatches++
+			glog.Errorf("Verification failed for \"%s\": response was \"%s\", expected a match of \"%s\"",
+				g.last.Text, response, g.last.Pattern)
+		}
+	}
+}
+
+func (g *Generator) ReturnStream(chunks chan string) {
+	response := ""
+	for chunk := range chunks {
+		response += chunk
+	}
+	g.Return(response)
+}
+
+// Verified returns the number of responses checked against their
+// expectation, and how many of those did not match
+func (g *Generator) Verified() (int, int) {
+	return g.checked, g.mismatches
+}
+
+// Seed returns the seed of the random numbers of the generator, so that a
+// run can be reproduced by setting it in the workload
+func (g *Generator) Seed() int64 {
+	return g.seed
 }
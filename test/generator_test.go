@@ -49,14 +49,17 @@ func checkFormat(t *testing.T, req string) {
 // check that the generator is producing valid commands
 func TestGenerate(t *testing.T) {
 	conf := ConfigAuto{
-		Commands{50, 3},
+		Commands{Reads: 50, Conflicts: 3},
 		Termination{20},
+		Script{},
+		Operations{},
+		Think{},
 	}
 
 	gen := Generate(conf)
 
 	for i := 0; i < 100; i++ {
-		str, ok := gen.Next()
+		str, _, ok := gen.Next()
 		if !ok {
 			if conf.Termination.Requests != i {
 				t.Errorf("Generator terminated a request %d, should terminate at %d'",
@@ -68,3 +71,43 @@ func TestGenerate(t *testing.T) {
 	}
 
 }
+
+// check that a script is issued in order, and its responses verified
+func TestGenerateScript(t *testing.T) {
+	conf := ConfigAuto{Script: Script{Command: []string{"update x 42", "get x => 42", "get y", "get x => 42"}}}
+	responses := []string{"OK", "42", "", "7"}
+	gen := Generate(conf)
+	gen.Verify = true
+	for i, line := range conf.Script.Command {
+		str, replicate, ok := gen.Next()
+		command, _ := ParseCommand(line)
+		if !ok || str != command.Text || replicate != (i == 0) {
+			t.Errorf("Command %d is '%s' (replicate %t), expected '%s'", i, str, replicate, command.Text)
+		}
+		gen.Return(responses[i])
+	}
+	if _, _, ok := gen.Next(); ok {
+		t.Error("Generator did not terminate at the end of the script")
+	}
+	if checked, mismatches := gen.Verified(); checked != 2 || mismatches != 1 {
+		t.Errorf("%d responses checked with %d mismatches, expected 2 with 1", checked, mismatches)
+	}
+}
+
+// check that responses are verified against the patterns of a script, which
+// are not expanded as templates
+func TestGenerateScriptPattern(t *testing.T) {
+	conf := ConfigAuto{Script: Script{Command: []string{"get x =~ ^[0-9]{2}$", "get y =~ not found", "get z =~ ^(OK|[0-9]+)$"}}}
+	responses := []string{"42", "Key not found", "4x2"}
+	gen := Generate(conf)
+	gen.Verify = true
+	for i := range conf.Script.Command {
+		if _, _, ok := gen.Next(); !ok {
+			t.Fatalf("Generator ended at command %d", i)
+		}
+		gen.Return(responses[i])
+	}
+	if checked, mismatches := gen.Verified(); checked != 3 || mismatches != 1 {
+		t.Errorf("%d responses checked with %d mismatches, expected 3 with 1", checked, mismatches)
+	}
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Mix is a workload given as the weights of its operations over a range of
+// keys, instead of as commands, e.g.
+//
+//	get 60%, set 40% over keyspace 0..9999, zipf 1.1
+//
+// Its grammar is:
+//
+//	mix          = op {", " op} [", " distribution]
+//	op           = name " " weight "%" [" over keyspace " low ".." high]
+//	name         = "get" | "set" | "update"
+//	distribution = "uniform" | "zipf " s
+//
+// Weights are percentages, which must add up to 100. The keyspace is given
+// once, on any operation, and is 0..9 if not given. Keys are drawn
+// uniformly by default, or from a Zipf distribution with exponent s > 1,
+// the lowest keys being the most popular. Names are not case sensitive,
+// set is the same as update, and each update writes 7.
+type Mix struct {
+	ops       []mixOp
+	low, high int
+	zipf      float64 // exponent, 0 if uniform
+}
+
+type mixOp struct {
+	name   string // store command
+	weight int
+}
+
+// ParseMix parses a workload mix
+func ParseMix(spec string) (*Mix, error) {
+	m := &Mix{high: 9}
+	keyspace, distribution := false, false
+	total := 0
+	for _, part := range strings.Split(spec, ",") {
+		args := strings.Fields(strings.ToLower(part))
+		if len(args) == 0 {
+			return nil, errors.New("Missing operation in mix \"" + spec + "\"")
+		}
+		switch args[0] {
+		case "uniform", "zipf":
+			if distribution {
+				return nil, errors.New("More than one distribution in mix \"" + spec + "\"")
+			}
+			distribution = true
+			if args[0] == "uniform" {
+				if len(args) != 1 {
+					return nil, errors.New("Invalid distribution in mix: " + part)
+				}
+				continue
+			}
+			if len(args) != 2 {
+				return nil, errors.New("Zipf distribution needs an exponent: " + part)
+			}
+			s, err := strconv.ParseFloat(args[1], 64)
+			if err != nil || s <= 1 {
+				return nil, errors.New("Zipf exponent must be a number greater than 1: " + part)
+			}
+			m.zipf = s
+			continue
+		case "get", "update":
+		case "set":
+			args[0] = "update"
+		default:
+			return nil, errors.New("Unsupported operation " + args[0] + " in mix, operations are get, set and update")
+		}
+		if len(args) != 2 && len(args) != 5 {
+			return nil, errors.New("Operations should be \"<name> <weight>%\", optionally followed by \"over keyspace <low>..<high>\": " + part)
+		}
+		weight, err := strconv.Atoi(strings.TrimSuffix(args[1], "%"))
+		if err != nil || !strings.HasSuffix(args[1], "%") || weight < 0 {
+			return nil, errors.New("Invalid weight in mix: " + part)
+		}
+		m.ops = append(m.ops, mixOp{args[0], weight})
+		total += weight
+		if len(args) == 5 {
+			if args[2] != "over" || args[3] != "keyspace" || keyspace {
+				return nil, errors.New("Invalid keyspace in mix: " + part)
+			}
+			keyspace = true
+			if m.low, m.high, err = parseKeyspace(args[4]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if total != 100 {
+		return nil, fmt.Errorf("Weights in mix \"%s\" add up to %d%%, not 100%%", spec, total)
+	}
+	return m, nil
+}
+
+// parseKeyspace parses a range of keys, low..high
+func parseKeyspace(s string) (int, int, error) {
+	bounds := strings.SplitN(s, "..", 2)
+	if len(bounds) == 2 {
+		low, err1 := strconv.Atoi(bounds[0])
+		high, err2 := strconv.Atoi(bounds[1])
+		if err1 == nil && err2 == nil && low >= 0 && low <= high {
+			return low, high, nil
+		}
+	}
+	return 0, 0, errors.New("Keyspace should be <low>..<high>: " + s)
+}
+
+// mixSource generates the commands of a mix, drawing from r
+type mixSource struct {
+	mix  *Mix
+	rand *rand.Rand
+	zipf *rand.Zipf // nil if keys are uniform
+}
+
+func newMixSource(m *Mix, r *rand.Rand) *mixSource {
+	s := &mixSource{mix: m, rand: r}
+	if m.zipf != 0 {
+		s.zipf = rand.NewZipf(r, m.zipf, 1, uint64(m.high-m.low))
+	}
+	return s
+}
+
+// Next returns the next command, and whether it is a write
+func (s *mixSource) Next() (string, bool) {
+	var key int
+	if s.zipf != nil {
+		key = s.mix.low + int(s.zipf.Uint64())
+	} else {
+		key = s.mix.low + s.rand.Intn(s.mix.high-s.mix.low+1)
+	}
+	n := s.rand.Intn(100)
+	op := s.mix.ops[len(s.mix.ops)-1]
+	for _, o := range s.mix.ops {
+		if n < o.weight {
+			op = o
+			break
+		}
+		n -= o.weight
+	}
+	if op.name == "get" {
+		return fmt.Sprintf("get %d", key), false
+	}
+	return fmt.Sprintf("update %d 7", key), true
+}
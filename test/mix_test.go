@@ -0,0 +1,100 @@
+package test
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseMix(t *testing.T) {
+	cases := []struct {
+		spec      string
+		ok        bool
+		low, high int
+		zipf      float64
+	}{
+		{"get 60%, set 40% over keyspace 0..9999, zipf 1.1", true, 0, 9999, 1.1},
+		{"SET 30%, GET 70%", true, 0, 9, 0},
+		{"get 100% over keyspace 5..5, uniform", true, 5, 5, 0},
+		{"get 50%, update 50%", true, 0, 9, 0},
+		{"get 60%, set 30%", false, 0, 0, 0},
+		{"get 60%, del 40%", false, 0, 0, 0},
+		{"get 60, set 40%", false, 0, 0, 0},
+		{"get 60%, set 40%, zipf 1", false, 0, 0, 0},
+		{"get 60%, set 40%, zipf", false, 0, 0, 0},
+		{"get 60%, set 40%, zipf 1.1, uniform", false, 0, 0, 0},
+		{"get 60% over keyspace 9..0, set 40%", false, 0, 0, 0},
+		{"get 60% over keyspace 0..9, set 40% over keyspace 0..9", false, 0, 0, 0},
+		{"get 60%,, set 40%", false, 0, 0, 0},
+	}
+	for _, c := range cases {
+		m, err := ParseMix(c.spec)
+		if (err == nil) != c.ok {
+			t.Errorf("\"%s\" parsed with error %v", c.spec, err)
+			continue
+		}
+		if c.ok && (m.low != c.low || m.high != c.high || m.zipf != c.zipf) {
+			t.Errorf("\"%s\" parsed as keys %d..%d, zipf %g", c.spec, m.low, m.high, m.zipf)
+		}
+	}
+}
+
+// check that the generated operations match the weights of the mix, with
+// keys in its keyspace
+func TestGenerateMix(t *testing.T) {
+	cases := []struct {
+		mix    string
+		writes float64 // fraction of commands
+	}{
+		{"get 60%, set 40% over keyspace 100..199", 0.4},
+		{"set 30%, get 60%, update 10%, zipf 1.1", 0.4},
+		{"get 100%", 0},
+	}
+	n := 100000
+	for _, c := range cases {
+		mix, _ := ParseMix(c.mix)
+		gen := Generate(ConfigAuto{Termination: Termination{n}, Operations: Operations{c.mix}})
+		writes := 0
+		for i := 0; i < n; i++ {
+			text, write, ok := gen.Next()
+			if !ok {
+				t.Fatalf("\"%s\": generator terminated after %d commands", c.mix, i)
+			}
+			args := strings.Fields(text)
+			if write != (args[0] == "update") || (write && len(args) != 3) || (!write && len(args) != 2) {
+				t.Errorf("\"%s\": invalid command %q (write %t)", c.mix, text, write)
+				continue
+			}
+			if write {
+				writes++
+			}
+			key, err := strconv.Atoi(args[1])
+			if err != nil || key < mix.low || key > mix.high {
+				t.Errorf("\"%s\": key of %q out of keyspace", c.mix, text)
+			}
+		}
+		if frac := float64(writes) / float64(n); math.Abs(frac-c.writes) > 0.01 {
+			t.Errorf("\"%s\": %.3f of commands were writes, expected %.2f", c.mix, frac, c.writes)
+		}
+	}
+}
+
+// check that zipf keys favour the lowest keys
+func TestMixZipf(t *testing.T) {
+	mix, err := ParseMix("get 100% over keyspace 10..1009, zipf 1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newMixSource(mix, rand.New(rand.NewSource(1)))
+	counts := make(map[string]int)
+	n := 10000
+	for i := 0; i < n; i++ {
+		text, _ := s.Next()
+		counts[text]++
+	}
+	if counts["get 10"] < n/4 || counts["get 10"] <= counts["get 11"] || counts["get 11"] <= counts["get 20"] {
+		t.Errorf("Keys are not skewed: %d of 10, %d of 11, %d of 20", counts["get 10"], counts["get 11"], counts["get 20"])
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Template is a script command with variables in braces, which are expanded
+// each time the command is issued:
+//
+//	{i}       the iteration of the script, from 0
+//	{rand}    a random non-negative integer
+//	{rand:N}  a random integer from 0 to N-1
+//	{time}    the current Unix time in seconds
+//	{timems}  the current Unix time in milliseconds
+//
+// A literal brace is written as {{ or }}.
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	text string // literal text, if name is empty
+	name string
+	max  int64 // for rand:N
+}
+
+// ParseTemplate parses a command with variables
+func ParseTemplate(s string) (*Template, error) {
+	t := new(Template)
+	literal := ""
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "{{"), strings.HasPrefix(s, "}}"):
+			literal += s[:1]
+			s = s[2:]
+		case s[0] == '}':
+			return nil, errors.New("Unmatched } in template")
+		case s[0] == '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, errors.New("Unterminated variable in template: " + s)
+			}
+			part, err := parseVariable(s[1:end])
+			if err != nil {
+				return nil, err
+			}
+			if literal != "" {
+				t.parts = append(t.parts, templatePart{text: literal})
+				literal = ""
+			}
+			t.parts = append(t.parts, part)
+			s = s[end+1:]
+		default:
+			literal += s[:1]
+			s = s[1:]
+		}
+	}
+	if literal != "" {
+		t.parts = append(t.parts, templatePart{text: literal})
+	}
+	return t, nil
+}
+
+func parseVariable(v string) (templatePart, error) {
+	switch v {
+	case "i", "rand", "time", "timems":
+		return templatePart{name: v}, nil
+	}
+	if strings.HasPrefix(v, "rand:") {
+		max, err := strconv.ParseInt(v[len("rand:"):], 10, 64)
+		if err != nil || max <= 0 {
+			return templatePart{}, errors.New("Invalid range in template variable {" + v + "}")
+		}
+		return templatePart{name: "rand", max: max}, nil
+	}
+	return templatePart{}, errors.New("Unknown template variable {" + v + "}")
+}
+
+// Expand the template for iteration i, drawing random numbers from r
+func (t *Template) Expand(i int, r *rand.Rand, now time.Time) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		switch part.name {
+		case "":
+			b.WriteString(part.text)
+		case "i":
+			b.WriteString(strconv.Itoa(i))
+		case "rand":
+			if part.max > 0 {
+				b.WriteString(strconv.FormatInt(r.Int63n(part.max), 10))
+			} else {
+				b.WriteString(strconv.FormatInt(r.Int63(), 10))
+			}
+		case "time":
+			b.WriteString(strconv.FormatInt(now.Unix(), 10))
+		case "timems":
+			b.WriteString(strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	now := time.Unix(1500000000, 250*int64(time.Millisecond))
+	cases := []struct {
+		template string
+		expanded string
+	}{
+		{"get A", "get A"},
+		{"update key{i} val{i}", "update key3 val3"},
+		{"update A {time}", "update A 1500000000"},
+		{"update A {timems}", "update A 1500000000250"},
+		{"update {{i}} }}", "update {i} }"},
+	}
+	for _, c := range cases {
+		tmpl, err := ParseTemplate(c.template)
+		if err != nil {
+			t.Errorf("%s: %s", c.template, err)
+		} else if expanded := tmpl.Expand(3, rand.New(rand.NewSource(1)), now); expanded != c.expanded {
+			t.Errorf("%s expanded to '%s', expected '%s'", c.template, expanded, c.expanded)
+		}
+	}
+}
+
+func TestTemplateRand(t *testing.T) {
+	tmpl, err := ParseTemplate("{rand:10}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		n, err := strconv.Atoi(tmpl.Expand(0, r, time.Now()))
+		if err != nil || n < 0 || n >= 10 {
+			t.Errorf("{rand:10} expanded to %d (%v)", n, err)
+		}
+	}
+	tmpl, err = ParseTemplate("{rand}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := strconv.ParseInt(tmpl.Expand(0, r, time.Now()), 10, 64); err != nil || n < 0 {
+		t.Errorf("{rand} expanded to %d (%v)", n, err)
+	}
+}
+
+func TestTemplateInvalid(t *testing.T) {
+	for _, template := range []string{"get {", "get }", "get {j}", "get {rand:0}", "get {rand:x}"} {
+		if _, err := ParseTemplate(template); err == nil {
+			t.Errorf("Invalid template '%s' was accepted", template)
+		}
+	}
+}
+
+// check that scripts expand the same under the same seed
+func TestGenerateTemplateSeed(t *testing.T) {
+	conf := ConfigAuto{
+		Termination: Termination{6},
+		Script:      Script{Command: []string{"update key{i} {rand:1000}", "get key{i}"}, Seed: 42}}
+	expand := func() []string {
+		var commands []string
+		gen := Generate(conf)
+		for {
+			str, _, ok := gen.Next()
+			if !ok {
+				return commands
+			}
+			commands = append(commands, str)
+		}
+	}
+	first, second := expand(), expand()
+	if len(first) != 6 {
+		t.Fatalf("Generated %d commands, expected 6", len(first))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("Command %d was '%s' then '%s' with the same seed", i, first[i], second[i])
+		}
+	}
+	if first[5] != "get key2" {
+		t.Errorf("Last command was '%s', expected 'get key2'", first[5])
+	}
+}
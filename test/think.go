@@ -0,0 +1,58 @@
+package test
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Think configures the time a client thinks between receiving a response
+// and issuing its next command, in milliseconds. The distribution is fixed,
+// taking mean each time, uniform, from min to max, or exponential, with
+// mean. There is no think time if the distribution is not given
+type Think struct {
+	Distribution string
+	Mean         int
+	Min          int
+	Max          int
+}
+
+// ThinkTime is a distribution of think times
+type ThinkTime struct {
+	distribution string
+	mean         time.Duration
+	min, max     time.Duration
+}
+
+// NewThinkTime checks a think time configuration, returning nil if there is
+// no think time
+func NewThinkTime(conf Think) (*ThinkTime, error) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	t := &ThinkTime{conf.Distribution, ms(conf.Mean), ms(conf.Min), ms(conf.Max)}
+	switch conf.Distribution {
+	case "":
+		return nil, nil
+	case "fixed", "exponential":
+		if conf.Mean <= 0 {
+			return nil, errors.New("Think time mean must be positive for the " + conf.Distribution + " distribution")
+		}
+	case "uniform":
+		if conf.Min < 0 || conf.Max < conf.Min {
+			return nil, errors.New("Think time must have 0 <= min <= max for the uniform distribution")
+		}
+	default:
+		return nil, errors.New("Unknown think time distribution \"" + conf.Distribution + "\", expected fixed, uniform or exponential")
+	}
+	return t, nil
+}
+
+// Draw a think time, drawing random numbers from r
+func (t *ThinkTime) Draw(r *rand.Rand) time.Duration {
+	switch t.distribution {
+	case "uniform":
+		return t.min + time.Duration(r.Int63n(int64(t.max-t.min)+1))
+	case "exponential":
+		return time.Duration(r.ExpFloat64() * float64(t.mean))
+	}
+	return t.mean
+}
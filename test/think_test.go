@@ -0,0 +1,131 @@
+package test
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewThinkTime(t *testing.T) {
+	cases := []struct {
+		conf Think
+		ok   bool
+	}{
+		{Think{}, true},
+		{Think{"fixed", 10, 0, 0}, true},
+		{Think{"uniform", 0, 5, 15}, true},
+		{Think{"uniform", 0, 5, 5}, true},
+		{Think{"exponential", 10, 0, 0}, true},
+		{Think{"fixed", 0, 0, 0}, false},
+		{Think{"uniform", 0, 15, 5}, false},
+		{Think{"exponential", -1, 0, 0}, false},
+		{Think{"normal", 10, 0, 0}, false},
+	}
+	for _, c := range cases {
+		think, err := NewThinkTime(c.conf)
+		if (err == nil) != c.ok {
+			t.Errorf("%v was checked with error %v", c.conf, err)
+		}
+		if c.ok && (think == nil) != (c.conf.Distribution == "") {
+			t.Errorf("%v gave think time %v", c.conf, think)
+		}
+	}
+}
+
+// check that think times are drawn from their distribution
+func TestThinkTimeDraw(t *testing.T) {
+	ms := time.Millisecond
+	cases := []struct {
+		conf     Think
+		min, max time.Duration
+		mean     time.Duration
+	}{
+		{Think{"fixed", 10, 0, 0}, 10 * ms, 10 * ms, 10 * ms},
+		{Think{"uniform", 0, 5, 15}, 5 * ms, 15 * ms, 10 * ms},
+		{Think{"exponential", 10, 0, 0}, 0, time.Hour, 10 * ms},
+	}
+	r := rand.New(rand.NewSource(1))
+	n := 100000
+	for _, c := range cases {
+		think, _ := NewThinkTime(c.conf)
+		var total time.Duration
+		for i := 0; i < n; i++ {
+			d := think.Draw(r)
+			if d < c.min || d > c.max {
+				t.Fatalf("%v drew %s, outside %s to %s", c.conf, d, c.min, c.max)
+			}
+			total += d
+		}
+		if mean := total / time.Duration(n); math.Abs(float64(mean-c.mean)) > 0.02*float64(c.mean) {
+			t.Errorf("%v drew a mean of %s, expected %s", c.conf, mean, c.mean)
+		}
+	}
+}
+
+// check that the generator thinks between a response and the next command
+func TestGenerateThink(t *testing.T) {
+	cases := []struct {
+		think Think
+		gap   time.Duration // mean
+	}{
+		{Think{"fixed", 5, 0, 0}, 5 * time.Millisecond},
+		{Think{"uniform", 0, 2, 8}, 5 * time.Millisecond},
+		{Think{"exponential", 5, 0, 0}, 5 * time.Millisecond},
+	}
+	n := 100
+	for _, c := range cases {
+		gen := Generate(ConfigAuto{
+			Commands:    Commands{Reads: 50, Conflicts: 1},
+			Termination: Termination{n},
+			Script:      Script{Seed: 1},
+			Think:       c.think})
+		var total time.Duration
+		for i := 0; i < n; i++ {
+			if _, _, ok := gen.Next(); !ok {
+				t.Fatal("Generator terminated early")
+			}
+			start := time.Now()
+			gen.Return("0")
+			total += time.Since(start)
+		}
+		if mean := total / time.Duration(n); mean < c.gap*8/10 || mean > c.gap*13/10 {
+			t.Errorf("%v: mean gap between requests was %s, expected %s", c.think, mean, c.gap)
+		}
+	}
+}
+
+func TestParseAutoThink(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"think.conf":  "[termination]\nrequests = 10\n[think]\ndistribution = uniform\nmin = 5\nmax = 15\n",
+		"paced.conf":  "[workload \"paced\"]\nrequests = 10\nthinkdistribution = exponential\nthinkmean = 20\n",
+		"broken.conf": "[think]\ndistribution = normal\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		filename string
+		name     string
+		think    Think
+		ok       bool
+	}{
+		{"think.conf", "", Think{"uniform", 0, 5, 15}, true},
+		{"paced.conf", "paced", Think{"exponential", 20, 0, 0}, true},
+		{"broken.conf", "", Think{}, false},
+	}
+	for _, c := range cases {
+		config, err := parseAuto(filepath.Join(dir, c.filename), c.name)
+		if (err == nil) != c.ok {
+			t.Errorf("%s parsed with error %v", c.filename, err)
+		} else if c.ok && !reflect.DeepEqual(config.Think, c.think) {
+			t.Errorf("%s parsed with think time %v but %v was expected", c.filename, config.Think, c.think)
+		}
+	}
+}